@@ -282,7 +282,7 @@ func (c *TestUsbIpClient) ReadInputReportWithTimeout(conn net.Conn, timeout time
 	cur := c.nextSeq()
 
 	// Request a buffer large enough for all current VIIPER HID devices.
-	// (Keyboard reports are 34 bytes; mouse/xbox360 are smaller.)
+	// (Keyboard reports are 35 bytes; mouse/xbox360 are smaller.)
 	const inMax = 255
 
 	cmd := usbip.CmdSubmit{
@@ -0,0 +1,271 @@
+package clone_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/device/clone"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/usbip"
+	"github.com/Alia5/VIIPER/viiperclient"
+	"github.com/Alia5/VIIPER/virtualbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/Alia5/VIIPER/internal/registry" // Register devices
+)
+
+// 16 button "button box" with an 8 bit LED output report.
+var buttonBox = clone.Profile{
+	Speed:  2,
+	Device: hexBytes("12 01 00 02 00 00 00 40 09 12 01 00 00 01 01 02 00 01"),
+	Configuration: hexBytes("09 02 22 00 01 01 00 a0 32 " +
+		"09 04 00 00 01 03 00 00 00 " +
+		"09 21 11 01 00 01 22 21 00 " +
+		"07 05 81 03 08 00 0a"),
+	Strings: map[uint8]string{0: "Љ", 1: "ACME", 2: "Button Box"},
+	ReportDescriptors: map[uint8]clone.Hex{
+		0: hexBytes("05 01 09 05 a1 01 05 09 19 01 29 10 15 00 25 01 75 01 95 10 81 02 " +
+			"05 08 19 01 29 08 95 08 91 02 c0"),
+	},
+	Controls: []clone.Control{
+		{RequestType: 0xA1, Request: 0x01, Value: 0x0300, Index: 0, Data: clone.Hex{0xAA, 0xBB}},
+	},
+}
+
+func hexBytes(s string) clone.Hex {
+	var h clone.Hex
+	if err := h.UnmarshalText([]byte(s)); err != nil {
+		panic(err)
+	}
+	return h
+}
+
+func newClone(t *testing.T, opts any, o *device.CreateOptions) (*clone.Clone, error) {
+	t.Helper()
+	b, err := json.Marshal(opts)
+	require.NoError(t, err)
+	if o == nil {
+		o = &device.CreateOptions{}
+	}
+	o.DeviceSpecific = string(b)
+	return clone.New(o)
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, buttonBox.WriteFile(filepath.Join(dir, "profile.json")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0o600))
+
+	t.Run("inline", func(t *testing.T) {
+		d, err := newClone(t, buttonBox, nil)
+		require.NoError(t, err)
+		desc := d.GetDescriptor()
+		assert.Equal(t, uint16(0x1209), desc.Device.IDVendor)
+		assert.Equal(t, uint16(0x0001), desc.Device.IDProduct)
+		assert.Equal(t, uint8(0x40), desc.Device.BMaxPacketSize0)
+		assert.Equal(t, uint8(0xA0), desc.Configuration.BMAttributes)
+		assert.Equal(t, "Button Box", desc.Strings[2])
+		require.Len(t, desc.Interfaces, 1)
+		require.NotNil(t, desc.Interfaces[0].HID)
+		rd, err := desc.Interfaces[0].HID.ReportBytes()
+		require.NoError(t, err)
+		assert.Equal(t, []byte(buttonBox.ReportDescriptors[0]), []byte(rd))
+		require.Len(t, desc.Interfaces[0].Endpoints, 1)
+		assert.Equal(t, uint8(0x81), desc.Interfaces[0].Endpoints[0].BEndpointAddress)
+		assert.Equal(t, uint8(10), desc.Interfaces[0].Endpoints[0].BInterval)
+	})
+
+	t.Run("file with VID/PID override", func(t *testing.T) {
+		vid, pid := uint16(0x1234), uint16(0x5678)
+		d, err := newClone(t, clone.Options{File: "profile.json"}, &device.CreateOptions{DataDir: dir, IDVendor: &vid, IDProduct: &pid})
+		require.NoError(t, err)
+		assert.Equal(t, vid, d.GetDescriptor().Device.IDVendor)
+		assert.Equal(t, pid, d.GetDescriptor().Device.IDProduct)
+		assert.Equal(t, map[string]any{"file": "profile.json"}, d.GetDeviceSpecificArgs())
+	})
+
+	t.Run("file names", func(t *testing.T) {
+		for _, name := range []string{filepath.Join(dir, "profile.json"), "../profile.json", "sub/profile.json", ".."} {
+			_, err := newClone(t, clone.Options{File: name}, &device.CreateOptions{DataDir: dir})
+			assert.Error(t, err, name)
+		}
+		_, err := newClone(t, clone.Options{File: "profile.json"}, nil)
+		assert.ErrorIs(t, err, device.ErrNoDataDir)
+	})
+
+	t.Run("unreadable file", func(t *testing.T) {
+		for _, name := range []string{"nope.json", "secret.txt"} {
+			_, err := newClone(t, clone.Options{File: name}, &device.CreateOptions{DataDir: dir})
+			require.Error(t, err)
+			assert.Equal(t, fmt.Sprintf("file: cannot read profile %q", name), err.Error())
+		}
+	})
+
+	broken := func(f func(p *clone.Profile)) clone.Profile {
+		p := buttonBox
+		p.ReportDescriptors = map[uint8]clone.Hex{0: buttonBox.ReportDescriptors[0]}
+		f(&p)
+		return p
+	}
+	for name, opts := range map[string]any{
+		"missing profile":        clone.Options{},
+		"file and inline":        clone.Options{File: "profile.json", Profile: buttonBox},
+		"short device":           broken(func(p *clone.Profile) { p.Device = p.Device[:8] }),
+		"truncated config":       broken(func(p *clone.Profile) { p.Configuration = p.Configuration[:30] }),
+		"no report descriptor":   broken(func(p *clone.Profile) { p.ReportDescriptors = nil }),
+		"endpoint without iface": broken(func(p *clone.Profile) { p.Configuration = append(p.Configuration[:9:9], p.Configuration[27:]...) }),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := newClone(t, opts, nil)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestControls(t *testing.T) {
+	d, err := newClone(t, buttonBox, nil)
+	require.NoError(t, err)
+
+	resp, handled := d.HandleControl(0xA1, 0x01, 0x0300, 0, 64, nil)
+	assert.True(t, handled)
+	assert.Equal(t, []byte{0xAA, 0xBB}, resp)
+
+	_, handled = d.HandleControl(0xA1, 0x01, 0x0301, 0, 64, nil)
+	assert.False(t, handled, "no recorded response")
+	_, handled = d.HandleControl(0x80, 0x06, 0x0100, 0, 18, nil)
+	assert.False(t, handled, "standard requests are left to the server")
+
+	var got []clone.Transfer
+	d.SetOutputCallback(func(tr clone.Transfer) { got = append(got, tr) })
+	_, handled = d.HandleControl(0x21, 0x09, 0x0200, 0, 1, []byte{0x5A})
+	assert.True(t, handled)
+	assert.Equal(t, []clone.Transfer{{Endpoint: 0, Data: []byte{0x21, 0x09, 0x00, 0x02, 0x00, 0x00, 0x01, 0x00, 0x5A}}}, got)
+
+	assert.Error(t, d.QueueInput(0x82, []byte{1}), "unknown endpoint")
+	assert.Error(t, d.QueueInput(0x01, []byte{1}), "not an IN endpoint")
+}
+
+func controlIn(conn net.Conn, setup [8]byte) ([]byte, error) {
+	cmd := usbip.CmdSubmit{
+		Basic:             usbip.HeaderBasic{Command: usbip.CmdSubmitCode, Seqnum: 0xC001, Devid: 0, Dir: usbip.DirIn, Ep: 0},
+		TransferBufferLen: uint32(binary.LittleEndian.Uint16(setup[6:8])),
+		Setup:             setup,
+	}
+	_ = conn.SetDeadline(time.Now().Add(750 * time.Millisecond))
+	defer conn.SetDeadline(time.Time{}) //nolint:errcheck
+	if err := cmd.Write(conn); err != nil {
+		return nil, err
+	}
+
+	var retHdr [48]byte
+	if err := usbip.ReadExactly(conn, retHdr[:]); err != nil {
+		return nil, err
+	}
+	if status := int32(binary.BigEndian.Uint32(retHdr[20:24])); status != 0 {
+		return nil, fmt.Errorf("ret status %d", status)
+	}
+	data := make([]byte, binary.BigEndian.Uint32(retHdr[24:28]))
+	if err := usbip.ReadExactly(conn, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func TestStream(t *testing.T) {
+	s := viiperTesting.NewTestServer(t)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+
+	r := s.ApiServer.Router()
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	r.RegisterStream("bus/{busId}/{deviceid}", api.DeviceStreamHandler(s.UsbServer))
+
+	if err := s.ApiServer.Start(); err != nil {
+		t.Fatalf("Failed to start API server: %v", err)
+	}
+
+	b, err := virtualbus.NewWithBusID(1)
+	if err != nil {
+		t.Fatalf("Failed to create virtual bus: %v", err)
+	}
+	defer b.Close() //nolint:errcheck
+	_ = s.UsbServer.AddBus(b)
+
+	opts, err := json.Marshal(buttonBox)
+	require.NoError(t, err)
+
+	client := viiperclient.New(s.ApiServer.Addr())
+	stream, _, err := client.AddDeviceAndConnect(context.Background(), b.BusID(), "clone", &device.CreateOptions{
+		DeviceSpecific: string(opts),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stream.Close() //nolint:errcheck
+
+	usbipClient := viiperTesting.NewUsbIpClient(t, s.UsbServer.Addr())
+	devs, err := usbipClient.ListDevices()
+	if !assert.NoError(t, err) || !assert.Len(t, devs, 1) {
+		return
+	}
+	assert.Equal(t, uint16(0x1209), devs[0].IDVendor)
+	imp, err := usbipClient.AttachDevice(devs[0].BusID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if imp != nil && imp.Conn != nil {
+		defer imp.Conn.Close() //nolint:errcheck
+	}
+
+	t.Run("descriptors are served verbatim", func(t *testing.T) {
+		for _, tc := range []struct {
+			setup [8]byte
+			want  []byte
+		}{
+			{[8]byte{0x80, 0x06, 0x00, 0x01, 0x00, 0x00, 0x40, 0x00}, buttonBox.Device},
+			{[8]byte{0x80, 0x06, 0x00, 0x02, 0x00, 0x00, 0xFF, 0x00}, buttonBox.Configuration},
+			{[8]byte{0x81, 0x06, 0x00, 0x22, 0x00, 0x00, 0xFF, 0x00}, buttonBox.ReportDescriptors[0]},
+			{[8]byte{0xA1, 0x01, 0x00, 0x03, 0x00, 0x00, 0x40, 0x00}, []byte{0xAA, 0xBB}},
+		} {
+			got, err := controlIn(imp.Conn, tc.setup)
+			if assert.NoError(t, err) {
+				assert.Equal(t, []byte(tc.want), got)
+			}
+		}
+	})
+
+	t.Run("IN endpoint", func(t *testing.T) {
+		for _, report := range [][]byte{{0x01, 0x00}, {0x00, 0x80}} {
+			if !assert.NoError(t, stream.WriteBinary(&clone.Transfer{Endpoint: 0x81, Data: report})) {
+				return
+			}
+			got, err := usbipClient.PollInputReport(imp.Conn, report, 750*time.Millisecond)
+			if assert.NoError(t, err) {
+				assert.Equal(t, report, got)
+			}
+		}
+	})
+
+	t.Run("forwarded SET_REPORT", func(t *testing.T) {
+		setup := [8]byte{0x21, 0x09, 0x00, 0x02, 0x00, 0x00, 0x01, 0x00}
+		if !assert.NoError(t, usbipClient.Submit(imp.Conn, usbip.DirOut, 0, []byte{0x5A}, &setup)) {
+			return
+		}
+		_ = stream.SetReadDeadline(time.Now().Add(750 * time.Millisecond))
+		got, err := clone.ReadTransfer(stream)
+		if assert.NoError(t, err) {
+			assert.Equal(t, &clone.Transfer{Endpoint: 0, Data: append(setup[:], 0x5A)}, got)
+		}
+	})
+}
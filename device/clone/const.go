@@ -0,0 +1,14 @@
+package clone
+
+// MaxTransferSize is the largest payload that fits into a single stream frame.
+const MaxTransferSize = 0xFFFF
+
+// TransferHeaderSize is the size of the frame header (endpoint + length) on the device stream.
+const TransferHeaderSize = 3
+
+// SetupSize is the size of the setup packet that precedes the data of
+// control requests forwarded on endpoint 0.
+const SetupSize = 8
+
+// DefaultSpeed is used for profiles that do not record the device speed.
+const DefaultSpeed = 2 // Full speed
@@ -0,0 +1,173 @@
+package clone
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/Alia5/VIIPER/usb"
+)
+
+const interfaceClassHID = 0x03
+
+// buildDescriptor turns the recorded descriptors of p into the descriptor the
+// server serves for the clone.
+func buildDescriptor(p *Profile) (usb.Descriptor, error) {
+	d := p.Device
+	if len(d) < usb.DeviceDescLen || d[1] != usb.DeviceDescType {
+		return usb.Descriptor{}, fmt.Errorf("device descriptor: need %d bytes of type 0x%02x", usb.DeviceDescLen, usb.DeviceDescType)
+	}
+	speed := p.Speed
+	if speed == 0 {
+		speed = DefaultSpeed
+	}
+	desc := usb.Descriptor{
+		Device: usb.DeviceDescriptor{
+			BcdUSB:             binary.LittleEndian.Uint16(d[2:4]),
+			BDeviceClass:       d[4],
+			BDeviceSubClass:    d[5],
+			BDeviceProtocol:    d[6],
+			BMaxPacketSize0:    d[7],
+			IDVendor:           binary.LittleEndian.Uint16(d[8:10]),
+			IDProduct:          binary.LittleEndian.Uint16(d[10:12]),
+			BcdDevice:          binary.LittleEndian.Uint16(d[12:14]),
+			IManufacturer:      d[14],
+			IProduct:           d[15],
+			ISerialNumber:      d[16],
+			BNumConfigurations: d[17],
+			Speed:              speed,
+		},
+		Strings: map[uint8]string{},
+	}
+	for i, s := range p.Strings {
+		desc.Strings[i] = s
+	}
+
+	if err := parseConfiguration(&desc, p); err != nil {
+		return usb.Descriptor{}, fmt.Errorf("configuration descriptor: %w", err)
+	}
+	return desc, nil
+}
+
+// parseConfiguration splits the configuration descriptor into its interfaces.
+// HID descriptors become HID functions backed by the recorded report
+// descriptors; all other class specific descriptors are kept verbatim.
+func parseConfiguration(desc *usb.Descriptor, p *Profile) error {
+	b := p.Configuration
+	if len(b) < usb.ConfigDescLen || b[1] != usb.ConfigDescType {
+		return fmt.Errorf("need %d bytes of type 0x%02x", usb.ConfigDescLen, usb.ConfigDescType)
+	}
+
+	var iface *usb.InterfaceConfig
+	for off := 0; off < len(b); {
+		l := int(b[off])
+		if l < 2 || off+l > len(b) {
+			return fmt.Errorf("truncated descriptor at offset %d", off)
+		}
+		db := b[off : off+l]
+		off += l
+
+		switch db[1] {
+		case usb.ConfigDescType:
+			if l < usb.ConfigDescLen {
+				return fmt.Errorf("short configuration descriptor")
+			}
+			desc.Configuration = usb.ConfigurationDescriptor{
+				BConfigurationValue: db[5],
+				IConfiguration:      db[6],
+				BMAttributes:        db[7],
+				BMaxPower:           db[8],
+			}
+		case usb.IADDescType:
+			if l < usb.IADDescLen {
+				return fmt.Errorf("short interface association descriptor")
+			}
+			desc.Associations = append(desc.Associations, usb.InterfaceAssociationDescriptor{
+				BFirstInterface:   db[2],
+				BInterfaceCount:   db[3],
+				BFunctionClass:    db[4],
+				BFunctionSubClass: db[5],
+				BFunctionProtocol: db[6],
+				IFunction:         db[7],
+			})
+		case usb.InterfaceDescType:
+			if l < usb.InterfaceDescLen {
+				return fmt.Errorf("short interface descriptor")
+			}
+			desc.Interfaces = append(desc.Interfaces, usb.InterfaceConfig{
+				Descriptor: usb.InterfaceDescriptor{
+					BInterfaceNumber:   db[2],
+					BAlternateSetting:  db[3],
+					BNumEndpoints:      db[4],
+					BInterfaceClass:    db[5],
+					BInterfaceSubClass: db[6],
+					BInterfaceProtocol: db[7],
+					IInterface:         db[8],
+				},
+			})
+			iface = &desc.Interfaces[len(desc.Interfaces)-1]
+		case usb.EndpointDescType:
+			if l < usb.EndpointDescLen {
+				return fmt.Errorf("short endpoint descriptor")
+			}
+			if iface == nil {
+				return fmt.Errorf("endpoint descriptor outside of an interface")
+			}
+			iface.Endpoints = append(iface.Endpoints, usb.EndpointDescriptor{
+				BEndpointAddress: db[2],
+				BMAttributes:     db[3],
+				WMaxPacketSize:   binary.LittleEndian.Uint16(db[4:6]),
+				BInterval:        db[6],
+			})
+		case usb.HIDDescType:
+			if iface != nil && iface.Descriptor.BInterfaceClass == interfaceClassHID && iface.HID == nil && len(iface.Endpoints) == 0 {
+				hid, err := parseHID(db, p.ReportDescriptors[iface.Descriptor.BInterfaceNumber])
+				if err != nil {
+					return fmt.Errorf("interface %d: %w", iface.Descriptor.BInterfaceNumber, err)
+				}
+				iface.HID = hid
+				continue
+			}
+			fallthrough
+		default:
+			cd := usb.ClassSpecificDescriptor{DescriptorType: db[1], Payload: usb.Data(db[2:])}
+			switch {
+			case iface == nil:
+				// Descriptors ahead of the first interface (e.g. OTG) are not served.
+			case len(iface.Endpoints) > 0:
+				ep := &iface.Endpoints[len(iface.Endpoints)-1]
+				ep.ClassDescriptors = append(ep.ClassDescriptors, cd)
+			default:
+				iface.ClassDescriptors = append(iface.ClassDescriptors, cd)
+			}
+		}
+	}
+	if len(desc.Interfaces) == 0 {
+		return fmt.Errorf("no interfaces")
+	}
+	return nil
+}
+
+func parseHID(db []byte, report Hex) (*usb.HIDFunction, error) {
+	if len(report) == 0 {
+		return nil, fmt.Errorf("no report descriptor recorded for HID interface")
+	}
+	if len(db) < 6 || len(db) < 6+3*int(db[5]) {
+		return nil, fmt.Errorf("short HID descriptor")
+	}
+	hid := &usb.HIDFunction{
+		Descriptor: usb.HIDDescriptor{
+			BcdHID:       binary.LittleEndian.Uint16(db[2:4]),
+			BCountryCode: db[4],
+		},
+		ReportDescriptorBytes: usb.Data(report),
+	}
+	for i := range int(db[5]) {
+		e := db[6+3*i : 9+3*i]
+		sd := usb.HIDSubDescriptor{Type: e[0], Length: binary.LittleEndian.Uint16(e[1:3])}
+		if sd.Type == usb.ReportDescType {
+			sd.Length = 0 // filled in from the recorded report descriptor
+		}
+		hid.Descriptor.Descriptors = append(hid.Descriptor.Descriptors, sd)
+	}
+	return hid, nil
+}
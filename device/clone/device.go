@@ -0,0 +1,225 @@
+// Package clone provides a device that replays the recorded identity of a
+// real USB device.
+//
+// A profile captured with `viiper proxy --capture-profile` holds the device
+// and configuration descriptors, strings, HID report descriptors and the
+// responses to class and vendor requests (e.g. feature reports). The clone
+// serves those to the host unchanged, so drivers bind to it as they would to
+// the original; endpoint data is passed through the device stream verbatim.
+package clone
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/usb"
+	"github.com/Alia5/VIIPER/usbip"
+)
+
+const (
+	reqTypeDirIn = 0x80
+	reqTypeMask  = 0x60 // standard, class or vendor
+
+	// inputQueueSize bounds the pending IN transfers per endpoint.
+	inputQueueSize = 16
+)
+
+type controlKey struct {
+	requestType uint8
+	request     uint8
+	value       uint16
+	index       uint16
+}
+
+// Clone implements a device whose descriptors come from a recorded Profile.
+type Clone struct {
+	descriptor usb.Descriptor
+	options    Options
+
+	controls map[controlKey][]byte
+	inputCh  map[uint32]chan []byte // by IN endpoint number
+	outEPs   map[uint32]uint8       // OUT endpoint number -> address
+
+	mtx        sync.Mutex
+	inputs     map[uint8][]byte // last data per IN endpoint address
+	outputs    map[uint8][]byte // last data per OUT endpoint address
+	outputFunc func(Transfer)
+}
+
+// New returns a new Clone loaded from the profile in o.DeviceSpecific (see Options).
+// The top-level idVendor/idProduct override the recorded ones.
+func New(o *device.CreateOptions) (*Clone, error) {
+	opts, err := parseOptions(o)
+	if err != nil {
+		return nil, err
+	}
+	p, err := opts.profile(o)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := buildDescriptor(p)
+	if err != nil {
+		return nil, err
+	}
+	if o.IDVendor != nil {
+		desc.Device.IDVendor = *o.IDVendor
+	}
+	if o.IDProduct != nil {
+		desc.Device.IDProduct = *o.IDProduct
+	}
+
+	d := &Clone{
+		descriptor: desc,
+		options:    opts,
+		controls:   map[controlKey][]byte{},
+		inputCh:    map[uint32]chan []byte{},
+		outEPs:     map[uint32]uint8{},
+		inputs:     map[uint8][]byte{},
+		outputs:    map[uint8][]byte{},
+	}
+	for _, c := range p.Controls {
+		d.controls[controlKey{c.RequestType, c.Request, c.Value, c.Index}] = c.Data
+	}
+	for _, iface := range desc.Interfaces {
+		for _, ep := range iface.Endpoints {
+			n := uint32(ep.BEndpointAddress & 0x0F)
+			if ep.BEndpointAddress&0x80 != 0 {
+				if _, ok := d.inputCh[n]; !ok {
+					d.inputCh[n] = make(chan []byte, inputQueueSize)
+				}
+			} else {
+				d.outEPs[n] = ep.BEndpointAddress
+			}
+		}
+	}
+	return d, nil
+}
+
+// SetOutputCallback sets a callback that is invoked for data the host writes
+// to OUT endpoints and for forwarded control requests (endpoint 0).
+func (d *Clone) SetOutputCallback(f func(Transfer)) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.outputFunc = f
+}
+
+// QueueInput queues data for the next IN transfer on the endpoint with the
+// given address. If the host does not keep up, the oldest data is dropped.
+func (d *Clone) QueueInput(endpoint uint8, data []byte) error {
+	ch, ok := d.inputCh[uint32(endpoint&0x0F)]
+	if endpoint&0x80 == 0 || !ok {
+		return fmt.Errorf("no IN endpoint 0x%02x", endpoint)
+	}
+	data = append([]byte(nil), data...)
+	d.mtx.Lock()
+	d.inputs[endpoint] = data
+	d.mtx.Unlock()
+
+	for {
+		select {
+		case ch <- data:
+			return nil
+		default:
+		}
+		// Queue is full: drop the oldest pending transfer.
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
+
+func (d *Clone) emitOutput(endpoint uint8, data []byte) {
+	d.mtx.Lock()
+	if endpoint != 0 {
+		d.outputs[endpoint] = append([]byte(nil), data...)
+	}
+	f := d.outputFunc
+	d.mtx.Unlock()
+	if f != nil {
+		f(Transfer{Endpoint: endpoint, Data: append([]byte(nil), data...)})
+	}
+}
+
+// GetInputState returns the last data queued per IN endpoint address.
+func (d *Clone) GetInputState() any {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return maps.Clone(d.inputs)
+}
+
+// GetOutputState returns the last data written per OUT endpoint address, or
+// nil if the host has not written any.
+func (d *Clone) GetOutputState() any {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if len(d.outputs) == 0 {
+		return nil
+	}
+	return maps.Clone(d.outputs)
+}
+
+func (d *Clone) HandleTransfer(ctx context.Context, ep uint32, dir uint32, out []byte) []byte {
+	if dir == usbip.DirIn {
+		ch, ok := d.inputCh[ep]
+		if !ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case data := <-ch:
+			return data
+		}
+	}
+	if addr, ok := d.outEPs[ep]; ok && len(out) > 0 {
+		d.emitOutput(addr, out)
+	}
+	return nil
+}
+
+// HandleControl answers class and vendor IN requests from the recorded
+// responses and forwards class and vendor OUT requests to the stream.
+// Requests without a recorded response fall back to the server defaults.
+func (d *Clone) HandleControl(bmRequestType, bRequest uint8, wValue, wIndex, wLength uint16, data []byte) ([]byte, bool) {
+	if bmRequestType&reqTypeMask == 0 {
+		return nil, false
+	}
+	if bmRequestType&reqTypeDirIn != 0 {
+		resp, ok := d.controls[controlKey{bmRequestType, bRequest, wValue, wIndex}]
+		if !ok {
+			return nil, false
+		}
+		return append([]byte(nil), resp...), true
+	}
+
+	frame := make([]byte, SetupSize, SetupSize+len(data))
+	frame[0] = bmRequestType
+	frame[1] = bRequest
+	binary.LittleEndian.PutUint16(frame[2:4], wValue)
+	binary.LittleEndian.PutUint16(frame[4:6], wIndex)
+	binary.LittleEndian.PutUint16(frame[6:8], wLength)
+	d.emitOutput(0, append(frame, data...))
+	return nil, true
+}
+
+func (d *Clone) GetDescriptor() *usb.Descriptor {
+	return &d.descriptor
+}
+
+func (d *Clone) GetDeviceSpecificArgs() map[string]any {
+	var res map[string]any
+	bytes, err := json.Marshal(d.options)
+	if err != nil {
+		return map[string]any{}
+	}
+	if err := json.Unmarshal(bytes, &res); err != nil {
+		return map[string]any{}
+	}
+	return res
+}
@@ -0,0 +1,70 @@
+package clone
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	"github.com/Alia5/VIIPER/usb"
+)
+
+func init() {
+	api.RegisterDevice("clone", &handler{})
+}
+
+type handler struct{}
+
+func (h *handler) CreateDevice(o *device.CreateOptions) (usb.Device, error) { return New(o) }
+
+func (h *handler) StreamHandler() api.StreamHandlerFunc {
+	return func(conn net.Conn, devPtr *usb.Device, logger *slog.Logger) error {
+		if devPtr == nil || *devPtr == nil {
+			return fmt.Errorf("nil device")
+		}
+		cdev, ok := (*devPtr).(*Clone)
+		if !ok {
+			return fmt.Errorf("%w: expected clone", device.ErrWrongDeviceType)
+		}
+
+		var writeMu sync.Mutex
+		cdev.SetOutputCallback(func(t Transfer) {
+			data, err := t.MarshalBinary()
+			if err != nil {
+				logger.Error("failed to marshal transfer", "error", err)
+				return
+			}
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			if _, err := conn.Write(data); err != nil {
+				logger.Error("failed to send transfer", "error", err)
+			}
+		})
+		defer cdev.SetOutputCallback(nil)
+
+		for {
+			t, err := ReadTransfer(conn)
+			if err != nil {
+				if err == io.EOF {
+					logger.Info("client disconnected")
+					return nil
+				}
+				return fmt.Errorf("read transfer: %w", err)
+			}
+			if err := cdev.QueueInput(t.Endpoint, t.Data); err != nil {
+				logger.Warn("ignoring transfer", "error", err)
+				continue
+			}
+			if data, err := t.MarshalBinary(); err == nil {
+				api.RecordFrame(conn, data)
+			}
+		}
+	}
+}
+
+func (h *handler) UpdateMetaState(meta string, dev *usb.Device) error {
+	return device.ErrNoMetaState
+}
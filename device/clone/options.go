@@ -0,0 +1,55 @@
+package clone
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Alia5/VIIPER/device"
+)
+
+// Options is the DeviceSpecific payload accepted by the clone device type.
+// The profile is either read from File on the server, or given inline.
+//
+// Example:
+//
+//	{"file": "controller.json"}
+type Options struct {
+	// File is the name of a profile in the server's data directory.
+	File string `json:"file,omitempty"`
+
+	Profile
+}
+
+// profile returns the profile selected by the options. Profile files are
+// resolved in the data directory of o.
+// Read errors are logged; the returned error does not include them, as it is
+// sent to API clients.
+func (opts *Options) profile(o *device.CreateOptions) (*Profile, error) {
+	if opts.File == "" {
+		return &opts.Profile, nil
+	}
+	if len(opts.Device) > 0 || len(opts.Configuration) > 0 {
+		return nil, fmt.Errorf("file and an inline profile are mutually exclusive")
+	}
+	path, err := o.DataFile(opts.File)
+	if err != nil {
+		return nil, fmt.Errorf("file: %w", err)
+	}
+	p, err := ReadProfile(path)
+	if err != nil {
+		o.GetLogger().Warn("failed to read clone profile", "file", path, "error", err)
+		return nil, fmt.Errorf("file: cannot read profile %q", opts.File)
+	}
+	return p, nil
+}
+
+func parseOptions(o *device.CreateOptions) (Options, error) {
+	var opts Options
+	if o == nil || o.DeviceSpecific == "" {
+		return opts, fmt.Errorf("missing profile: set file or pass a profile inline")
+	}
+	if err := json.Unmarshal([]byte(o.DeviceSpecific), &opts); err != nil {
+		return opts, fmt.Errorf("invalid JSON payload: %w", err)
+	}
+	return opts, nil
+}
@@ -0,0 +1,94 @@
+package clone
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Profile is the recorded identity of a real USB device, as written by
+// `viiper proxy --capture-profile`.
+//
+// Example:
+//
+//	{
+//	  "busId": "1-2",
+//	  "speed": 2,
+//	  "device": "12 01 00 02 00 00 00 40 4c 05 68 02 00 01 01 02 00 01",
+//	  "configuration": "09 02 29 00 01 01 00 80 fa 09 04 00 00 02 03 00 00 00 ...",
+//	  "strings": {"0": "Љ", "1": "Sony", "2": "PLAYSTATION(R)3 Controller"},
+//	  "reportDescriptors": {"0": "05 01 09 04 a1 01 ..."},
+//	  "controls": [
+//	    {"requestType": 161, "request": 1, "value": 1010, "index": 0, "data": "f2 ff ff 00 ..."}
+//	  ]
+//	}
+type Profile struct {
+	// BusID is the USB-IP bus ID the profile was captured from. Informational only.
+	BusID string `json:"busId,omitempty"`
+	// Speed is the USB speed reported by OP_REP_IMPORT (1 low, 2 full, 3 high, 4 super).
+	Speed uint32 `json:"speed,omitempty"`
+
+	// Device is the device descriptor.
+	Device Hex `json:"device,omitempty"`
+	// Configuration is the complete configuration descriptor with all
+	// interface, class specific and endpoint descriptors.
+	Configuration Hex `json:"configuration,omitempty"`
+	// Strings are the string descriptors by index; index 0 holds the language IDs.
+	Strings map[uint8]string `json:"strings,omitempty"`
+	// ReportDescriptors are the HID report descriptors by interface number.
+	ReportDescriptors map[uint8]Hex `json:"reportDescriptors,omitempty"`
+	// Controls are the recorded responses to class and vendor IN requests,
+	// e.g. HID GET_REPORT(Feature).
+	Controls []Control `json:"controls,omitempty"`
+}
+
+// Control is the response of the device to a class or vendor IN request.
+type Control struct {
+	RequestType uint8  `json:"requestType"`
+	Request     uint8  `json:"request"`
+	Value       uint16 `json:"value"`
+	Index       uint16 `json:"index"`
+	Data        Hex    `json:"data"`
+}
+
+// Hex is a byte slice that is encoded as a hex string in JSON, e.g. "05 01 09 04".
+// Whitespace, commas and 0x prefixes are ignored when decoding.
+type Hex []byte
+
+func (h Hex) MarshalText() ([]byte, error) {
+	return fmt.Appendf(nil, "% x", []byte(h)), nil
+}
+
+func (h *Hex) UnmarshalText(text []byte) error {
+	s := strings.NewReplacer("0x", "", "0X", "", ",", "", " ", "", "\t", "", "\n", "", "\r", "").Replace(string(text))
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("invalid hex: %w", err)
+	}
+	*h = b
+	return nil
+}
+
+// ReadProfile reads a profile from a JSON file.
+func ReadProfile(path string) (*Profile, error) {
+	b, err := os.ReadFile(path) // nolint
+	if err != nil {
+		return nil, err
+	}
+	var p Profile
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("invalid profile %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// WriteFile writes the profile to path as indented JSON.
+func (p *Profile) WriteFile(path string) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644) // nolint
+}
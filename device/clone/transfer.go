@@ -0,0 +1,69 @@
+package clone
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Transfer is a single endpoint transfer framed for the device stream.
+//
+// Client -> server frames carry data for an IN endpoint of the clone; the
+// host receives it with its next IN transfer on that endpoint.
+// Server -> client frames carry data the host wrote to an OUT endpoint.
+// Class and vendor control requests the host sends to the device are
+// forwarded as frames for endpoint 0 whose data starts with the 8 byte setup
+// packet, followed by the data stage.
+//
+// Endpoint is the endpoint address as in the configuration descriptor, with
+// bit 7 set for IN endpoints (e.g. 0x81).
+//
+// viiper:wire clone c2s endpoint:u8 length:u16 data:u8*length
+// viiper:wire clone s2c endpoint:u8 length:u16 data:u8*length
+type Transfer struct {
+	Endpoint uint8
+	Data     []byte
+}
+
+// MarshalBinary encodes the transfer as a frame: endpoint (u8), length (u16 LE), data.
+func (t *Transfer) MarshalBinary() ([]byte, error) {
+	if len(t.Data) > MaxTransferSize {
+		return nil, fmt.Errorf("transfer too large: %d bytes", len(t.Data))
+	}
+	b := make([]byte, TransferHeaderSize+len(t.Data))
+	b[0] = t.Endpoint
+	binary.LittleEndian.PutUint16(b[1:3], uint16(len(t.Data)))
+	copy(b[TransferHeaderSize:], t.Data)
+	return b, nil
+}
+
+// UnmarshalBinary decodes a single frame produced by MarshalBinary.
+func (t *Transfer) UnmarshalBinary(data []byte) error {
+	if len(data) < TransferHeaderSize {
+		return io.ErrUnexpectedEOF
+	}
+	n := int(binary.LittleEndian.Uint16(data[1:3]))
+	if len(data) < TransferHeaderSize+n {
+		return io.ErrUnexpectedEOF
+	}
+	t.Endpoint = data[0]
+	t.Data = append([]byte(nil), data[TransferHeaderSize:TransferHeaderSize+n]...)
+	return nil
+}
+
+// ReadTransfer reads exactly one framed transfer from r.
+func ReadTransfer(r io.Reader) (*Transfer, error) {
+	var hdr [TransferHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := int(binary.LittleEndian.Uint16(hdr[1:3]))
+	t := &Transfer{Endpoint: hdr[0], Data: make([]byte, n)}
+	if _, err := io.ReadFull(r, t.Data); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,157 @@
+package composite_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/device/composite"
+	"github.com/Alia5/VIIPER/device/keyboard"
+	"github.com/Alia5/VIIPER/device/mouse"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/usbip"
+	"github.com/Alia5/VIIPER/viiperclient"
+	"github.com/Alia5/VIIPER/virtualbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/Alia5/VIIPER/internal/registry" // Register devices
+)
+
+func TestHandleTransfer(t *testing.T) {
+	c, err := composite.New(&device.CreateOptions{DeviceSpecific: `{"consumer": true}`})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"consumer": true}, c.GetDeviceSpecificArgs())
+	assert.Len(t, c.GetDescriptor().Interfaces, 3)
+	poll := func(ep uint32) []byte {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		return c.HandleTransfer(ctx, ep, usbip.DirIn, nil)
+	}
+
+	assert.Equal(t, keyboard.NewInputState().BuildReport(), poll(1), "initial keyboard report")
+	assert.Equal(t, mouse.NewInputState().BuildReport(), poll(2), "initial mouse report")
+	assert.Nil(t, poll(1))
+	assert.Nil(t, poll(3))
+
+	// Each function reports on its own endpoint.
+	kb := keyboard.PressKey(keyboard.KeyA)
+	kb.Consumer[0] = keyboard.ConsumerMute
+	c.Keyboard().UpdateInputState(kb)
+	assert.Equal(t, []byte{0x02, 0xE2, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, poll(3))
+	assert.Nil(t, poll(3))
+	assert.Equal(t, kb.BuildReport(), poll(1))
+
+	m := mouse.InputState{Buttons: mouse.BtnLeft, DX: 5}
+	c.Mouse().UpdateInputState(m)
+	assert.Equal(t, m.BuildReport(), poll(2))
+	assert.Equal(t, (&mouse.InputState{Buttons: mouse.BtnLeft}).BuildReport(), poll(2), "movement is not repeated")
+	assert.Nil(t, poll(1))
+
+	c.ResetInputState()
+	assert.Equal(t, keyboard.NewInputState().BuildReport(), poll(1))
+	assert.Equal(t, mouse.NewInputState().BuildReport(), poll(2))
+
+	plain, err := composite.New(nil)
+	require.NoError(t, err)
+	assert.Empty(t, plain.GetDeviceSpecificArgs())
+	assert.Len(t, plain.GetDescriptor().Interfaces, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Nil(t, plain.HandleTransfer(ctx, 3, usbip.DirIn, nil), "no consumer interface")
+}
+
+func TestWithoutConsumer(t *testing.T) {
+	media := keyboard.InputState{}
+	media.Consumer[0] = keyboard.ConsumerMute
+	media.System = keyboard.SysSleep
+	keyA := keyboard.PressKey(keyboard.KeyA)
+	read := func(kb *keyboard.Keyboard) []byte {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		return kb.ReadKeysReport(ctx)
+	}
+
+	c, err := composite.New(nil)
+	require.NoError(t, err)
+	assert.Equal(t, keyboard.NewInputState().BuildReport(), read(c.Keyboard()), "initial keyboard report")
+	c.Keyboard().UpdateInputState(media)
+	assert.Nil(t, read(c.Keyboard()), "keys did not change")
+	c.Keyboard().UpdateInputState(keyA)
+	assert.Equal(t, keyA.BuildReport(), read(c.Keyboard()))
+
+	// Consumer and system changes must not stay pending: in queued input mode
+	// they would keep the next states from being taken off the queue.
+	kb, err := keyboard.New(&device.CreateOptions{DeviceSpecific: `{"queueSize": 8}`})
+	require.NoError(t, err)
+	kb.SetControlReports(false)
+	assert.Equal(t, keyboard.NewInputState().BuildReport(), read(kb), "initial keyboard report")
+	kb.UpdateInputState(media)
+	kb.UpdateInputState(keyA)
+	assert.Equal(t, keyA.BuildReport(), read(kb))
+	length, _, _, ok := kb.InputQueueStatus()
+	require.True(t, ok)
+	assert.Zero(t, length, "queue drained")
+}
+
+func TestFrame(t *testing.T) {
+	f := composite.MouseFrame(&mouse.InputState{DX: -1})
+	data, err := f.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{composite.FunctionMouse, 9, 0, 0x00, 0xFF, 0xFF, 0, 0, 0, 0, 0, 0}, data)
+
+	var got composite.Frame
+	require.NoError(t, got.UnmarshalBinary(data))
+	assert.Equal(t, f, &got)
+
+	read, err := composite.ReadFrame(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, f, read)
+
+	_, err = composite.ReadFrame(bytes.NewReader(data[:5]))
+	assert.Error(t, err)
+}
+
+func TestStream(t *testing.T) {
+	s := viiperTesting.NewTestServer(t)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+
+	r := s.ApiServer.Router()
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	r.RegisterStream("bus/{busId}/{deviceid}", api.DeviceStreamHandler(s.UsbServer))
+	require.NoError(t, s.ApiServer.Start())
+
+	b, err := virtualbus.NewWithBusID(1)
+	require.NoError(t, err)
+	defer b.Close() //nolint:errcheck
+	require.NoError(t, s.UsbServer.AddBus(b))
+
+	client := viiperclient.New(s.ApiServer.Addr())
+	stream, _, err := client.AddDeviceAndConnect(context.Background(), b.BusID(), "composite", nil)
+	require.NoError(t, err)
+	defer stream.Close() //nolint:errcheck
+
+	usbipClient := viiperTesting.NewUsbIpClient(t, s.UsbServer.Addr())
+	imp, err := usbipClient.AttachDevice("1-1")
+	require.NoError(t, err)
+	defer imp.Conn.Close() //nolint:errcheck
+
+	// LED state is sent as a keyboard frame.
+	require.NoError(t, usbipClient.Submit(imp.Conn, usbip.DirOut, 1, []byte{0x01, keyboard.LEDCapsLock}, nil))
+	_ = stream.SetReadDeadline(time.Now().Add(750 * time.Millisecond))
+	f, err := composite.ReadFrame(stream)
+	require.NoError(t, err)
+	assert.Equal(t, &composite.Frame{Function: composite.FunctionKeyboard, Data: []byte{keyboard.LEDCapsLock}}, f)
+
+	require.NoError(t, stream.WriteBinary(&composite.Frame{Function: 0x7F, Data: []byte{1, 2, 3}}), "unknown functions are ignored")
+	kb := keyboard.PressKeyWithMod(keyboard.ModLeftShift, keyboard.KeyB)
+	require.NoError(t, stream.WriteBinary(composite.KeyboardFrame(&kb)))
+	got, err := usbipClient.PollInputReport(imp.Conn, kb.BuildReport(), 750*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, kb.BuildReport(), got)
+}
@@ -0,0 +1,13 @@
+package composite
+
+// Functions of the composite device, tagging the frames of the device stream.
+const (
+	FunctionKeyboard = 0x01
+	FunctionMouse    = 0x02
+)
+
+// FrameHeaderSize is the size of the frame header (function + length) on the device stream.
+const FrameHeaderSize = 3
+
+// MaxFrameSize is the largest payload that fits into a single stream frame.
+const MaxFrameSize = 0xFFFF
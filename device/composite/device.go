@@ -0,0 +1,263 @@
+// Package composite provides a composite USB device combining a HID keyboard
+// and a HID mouse, optionally with consumer and system control keys, behind a
+// single VID/PID.
+package composite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/device/keyboard"
+	"github.com/Alia5/VIIPER/device/mouse"
+	"github.com/Alia5/VIIPER/usb"
+	"github.com/Alia5/VIIPER/usb/hid"
+	"github.com/Alia5/VIIPER/usbip"
+)
+
+// Composite implements the Device interface for a keyboard and a mouse sharing
+// one USB device. Each function has its own HID interface:
+//
+//	Interface 0: keyboard, EP 0x81 IN, EP 0x01 OUT (LEDs)
+//	Interface 1: mouse, EP 0x82 IN
+//	Interface 2: consumer and system control, EP 0x83 IN (Options.Consumer)
+type Composite struct {
+	keyboard   *keyboard.Keyboard
+	mouse      *mouse.Mouse
+	consumer   bool
+	descriptor usb.Descriptor
+}
+
+// Options is the DeviceSpecific payload accepted by the composite device type.
+//
+// Example:
+//
+//	{"consumer": true}
+type Options struct {
+	// Consumer adds an interface for the media, browser and brightness keys
+	// (Consumer Control) and power, sleep and wake buttons (System Control)
+	// of keyboard input states. Without it they are not sent to the host.
+	Consumer bool `json:"consumer,omitempty"`
+}
+
+// New returns a new Composite device.
+func New(o *device.CreateOptions) (*Composite, error) {
+	var opts Options
+	if o != nil && o.DeviceSpecific != "" {
+		if err := json.Unmarshal([]byte(o.DeviceSpecific), &opts); err != nil {
+			return nil, fmt.Errorf("invalid JSON payload: %w", err)
+		}
+	}
+	kb, err := keyboard.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	kb.SetControlReports(opts.Consumer)
+	m, err := mouse.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	d := &Composite{
+		keyboard: kb,
+		mouse:    m,
+		consumer: opts.Consumer,
+	}
+	d.descriptor = newDescriptor(m.GetDescriptor().Interfaces[0].HID.ReportDescriptor, opts.Consumer)
+	if o != nil {
+		if o.IDVendor != nil {
+			d.descriptor.Device.IDVendor = *o.IDVendor
+		}
+		if o.IDProduct != nil {
+			d.descriptor.Device.IDProduct = *o.IDProduct
+		}
+	}
+	return d, nil
+}
+
+// Keyboard returns the keyboard function. Its input states and LED state are
+// those of the keyboard interface.
+func (c *Composite) Keyboard() *keyboard.Keyboard { return c.keyboard }
+
+// Mouse returns the mouse function.
+func (c *Composite) Mouse() *mouse.Mouse { return c.mouse }
+
+// ResetInputState releases all keys and buttons, see usb.NeutralStateDevice.
+func (c *Composite) ResetInputState() {
+	c.keyboard.ResetInputState()
+	c.mouse.ResetInputState()
+}
+
+// GetInputState returns the input states of the keyboard and the mouse.
+func (c *Composite) GetInputState() any {
+	return struct {
+		Keyboard any `json:"keyboard"`
+		Mouse    any `json:"mouse"`
+	}{c.keyboard.GetInputState(), c.mouse.GetInputState()}
+}
+
+// GetOutputState returns the LED state set by the host.
+func (c *Composite) GetOutputState() any {
+	return c.keyboard.GetLEDState()
+}
+
+// GetInputReport routes GET_REPORT(Input) requests to the function owning
+// the interface, see usb.InputReportDevice.
+func (c *Composite) GetInputReport(iface, reportID uint8) []byte {
+	switch iface {
+	case 0: // keyboard report (ID 1)
+		if reportID == 1 {
+			return c.keyboard.GetInputReport(iface, reportID)
+		}
+	case 1: // mouse report
+		return c.mouse.GetInputReport(iface, reportID)
+	case 2: // consumer and system control reports (IDs 2 and 3)
+		if reportID != 1 {
+			return c.keyboard.GetInputReport(iface, reportID)
+		}
+	}
+	return nil
+}
+
+// HandleTransfer routes interrupt transfers to the function owning the
+// endpoint.
+func (c *Composite) HandleTransfer(ctx context.Context, ep uint32, dir uint32, out []byte) []byte {
+	if dir == usbip.DirIn {
+		switch ep {
+		case 1: // 0x81 - keyboard input reports
+			return c.keyboard.ReadKeysReport(ctx)
+		case 2: // 0x82 - mouse input reports
+			return c.mouse.HandleTransfer(ctx, 1, dir, nil)
+		case 3: // 0x83 - consumer and system control input reports
+			if c.consumer {
+				return c.keyboard.ReadControlReport(ctx)
+			}
+		}
+		return nil
+	}
+	if ep == 1 {
+		// 0x01 - LED state from host
+		return c.keyboard.HandleTransfer(ctx, 1, dir, out)
+	}
+	return nil
+}
+
+func newDescriptor(mouseReport hid.ReportDescriptor, consumer bool) usb.Descriptor {
+	hidFunction := func(items []hid.Item) *usb.HIDFunction {
+		return &usb.HIDFunction{
+			Descriptor: usb.HIDDescriptor{
+				BcdHID:       0x0111,
+				BCountryCode: 0x00,
+				Descriptors: []usb.HIDSubDescriptor{
+					{Type: usb.ReportDescType}, // Length auto-filled from Report
+				},
+			},
+			ReportDescriptor: hid.ReportDescriptor{Items: items},
+		}
+	}
+	d := usb.Descriptor{
+		Device: usb.DeviceDescriptor{
+			BcdUSB:             0x0200,
+			BDeviceClass:       0x00, // Defined per interface
+			BDeviceSubClass:    0x00,
+			BDeviceProtocol:    0x00,
+			BMaxPacketSize0:    0x40, // 64 bytes
+			IDVendor:           0x2E8A,
+			IDProduct:          0x0014,
+			BcdDevice:          0x0100,
+			IManufacturer:      0x01,
+			IProduct:           0x02,
+			ISerialNumber:      0x03,
+			BNumConfigurations: 0x01,
+			Speed:              2, // Full speed
+		},
+		Interfaces: []usb.InterfaceConfig{
+			{
+				Descriptor: usb.InterfaceDescriptor{
+					BInterfaceNumber:   0x00,
+					BAlternateSetting:  0x00,
+					BNumEndpoints:      0x02,
+					BInterfaceClass:    0x03, // HID
+					BInterfaceSubClass: 0x00, // No Subclass
+					BInterfaceProtocol: 0x00, // None
+					IInterface:         0x00,
+				},
+				HID: hidFunction(keyboard.KeysReportItems()),
+				Endpoints: []usb.EndpointDescriptor{
+					{
+						BEndpointAddress: 0x81,
+						BMAttributes:     0x03, // Interrupt
+						WMaxPacketSize:   0x0040,
+						BInterval:        0x05, // 5 ms
+					},
+					{
+						BEndpointAddress: 0x01,
+						BMAttributes:     0x03, // Interrupt
+						WMaxPacketSize:   0x0008,
+						BInterval:        0x05, // 5 ms
+					},
+				},
+			},
+			{
+				Descriptor: usb.InterfaceDescriptor{
+					BInterfaceNumber:   0x01,
+					BAlternateSetting:  0x00,
+					BNumEndpoints:      0x01,
+					BInterfaceClass:    0x03, // HID
+					BInterfaceSubClass: 0x01, // Boot Interface
+					BInterfaceProtocol: 0x02, // Mouse
+					IInterface:         0x00,
+				},
+				HID: hidFunction(mouseReport.Items),
+				Endpoints: []usb.EndpointDescriptor{
+					{
+						BEndpointAddress: 0x82,
+						BMAttributes:     0x03,   // Interrupt
+						WMaxPacketSize:   0x0010, // 16 bytes (9 needed)
+						BInterval:        0x05,   // 5 ms
+					},
+				},
+			},
+		},
+		Strings: map[uint8]string{
+			0: "\u0409", // LangID: en-US (0x0409)
+			1: "VIIPER",
+			2: "HID Keyboard and Mouse",
+			3: "1337",
+		},
+	}
+	if consumer {
+		d.Interfaces = append(d.Interfaces, usb.InterfaceConfig{
+			Descriptor: usb.InterfaceDescriptor{
+				BInterfaceNumber:   0x02,
+				BAlternateSetting:  0x00,
+				BNumEndpoints:      0x01,
+				BInterfaceClass:    0x03, // HID
+				BInterfaceSubClass: 0x00, // No Subclass
+				BInterfaceProtocol: 0x00, // None
+				IInterface:         0x00,
+			},
+			HID: hidFunction(keyboard.ControlReportItems()),
+			Endpoints: []usb.EndpointDescriptor{
+				{
+					BEndpointAddress: 0x83,
+					BMAttributes:     0x03,   // Interrupt
+					WMaxPacketSize:   0x0010, // 16 bytes (9 needed)
+					BInterval:        0x05,   // 5 ms
+				},
+			},
+		})
+	}
+	return d
+}
+
+func (c *Composite) GetDescriptor() *usb.Descriptor {
+	return &c.descriptor
+}
+
+func (c *Composite) GetDeviceSpecificArgs() map[string]any {
+	if c.consumer {
+		return map[string]any{"consumer": true}
+	}
+	return map[string]any{}
+}
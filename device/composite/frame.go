@@ -0,0 +1,80 @@
+package composite
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/Alia5/VIIPER/device/keyboard"
+	"github.com/Alia5/VIIPER/device/mouse"
+)
+
+// Frame is the data of one function of the composite device, framed for the
+// device stream.
+//
+// Client -> server frames carry an input state in the stream format of the
+// function's own device type: a keyboard input state for FunctionKeyboard,
+// a mouse input state for FunctionMouse.
+// Server -> client frames carry the LED state the host set (FunctionKeyboard).
+//
+// viiper:wire composite c2s functionId:u8 length:u16 data:u8*length
+// viiper:wire composite s2c functionId:u8 length:u16 data:u8*length
+type Frame struct {
+	Function uint8
+	Data     []byte
+}
+
+// KeyboardFrame returns the frame setting the keyboard input state to st.
+func KeyboardFrame(st *keyboard.InputState) *Frame {
+	data, _ := st.MarshalBinary()
+	return &Frame{Function: FunctionKeyboard, Data: data}
+}
+
+// MouseFrame returns the frame setting the mouse input state to st.
+func MouseFrame(st *mouse.InputState) *Frame {
+	data, _ := st.MarshalBinary()
+	return &Frame{Function: FunctionMouse, Data: data}
+}
+
+// MarshalBinary encodes the frame: function (u8), length (u16 LE), data.
+func (f *Frame) MarshalBinary() ([]byte, error) {
+	if len(f.Data) > MaxFrameSize {
+		return nil, fmt.Errorf("frame too large: %d bytes", len(f.Data))
+	}
+	b := make([]byte, FrameHeaderSize+len(f.Data))
+	b[0] = f.Function
+	binary.LittleEndian.PutUint16(b[1:3], uint16(len(f.Data)))
+	copy(b[FrameHeaderSize:], f.Data)
+	return b, nil
+}
+
+// UnmarshalBinary decodes a single frame produced by MarshalBinary.
+func (f *Frame) UnmarshalBinary(data []byte) error {
+	if len(data) < FrameHeaderSize {
+		return io.ErrUnexpectedEOF
+	}
+	n := int(binary.LittleEndian.Uint16(data[1:3]))
+	if len(data) < FrameHeaderSize+n {
+		return io.ErrUnexpectedEOF
+	}
+	f.Function = data[0]
+	f.Data = append([]byte(nil), data[FrameHeaderSize:FrameHeaderSize+n]...)
+	return nil
+}
+
+// ReadFrame reads exactly one frame from r.
+func ReadFrame(r io.Reader) (*Frame, error) {
+	var hdr [FrameHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := int(binary.LittleEndian.Uint16(hdr[1:3]))
+	f := &Frame{Function: hdr[0], Data: make([]byte, n)}
+	if _, err := io.ReadFull(r, f.Data); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return f, nil
+}
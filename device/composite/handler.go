@@ -0,0 +1,78 @@
+package composite
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/device/keyboard"
+	"github.com/Alia5/VIIPER/device/mouse"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	"github.com/Alia5/VIIPER/usb"
+)
+
+func init() {
+	api.RegisterDevice("composite", &handler{})
+}
+
+type handler struct{}
+
+func (h *handler) CreateDevice(o *device.CreateOptions) (usb.Device, error) { return New(o) }
+
+func (h *handler) StreamHandler() api.StreamHandlerFunc {
+	return func(conn net.Conn, devPtr *usb.Device, logger *slog.Logger) error {
+		if devPtr == nil || *devPtr == nil {
+			return fmt.Errorf("nil device")
+		}
+		cdev, ok := (*devPtr).(*Composite)
+		if !ok {
+			return fmt.Errorf("device is not composite")
+		}
+
+		cdev.Keyboard().SetLEDCallback(func(led keyboard.LEDState) {
+			leds, _ := led.MarshalBinary()
+			data, _ := (&Frame{Function: FunctionKeyboard, Data: leds}).MarshalBinary()
+			if _, err := conn.Write(data); err != nil {
+				logger.Warn("failed to write LED state", "error", err)
+			}
+		})
+		defer cdev.Keyboard().SetLEDCallback(nil)
+
+		for {
+			f, err := ReadFrame(conn)
+			if err != nil {
+				if err == io.EOF {
+					logger.Info("client disconnected")
+					return nil
+				}
+				return fmt.Errorf("read frame: %w", err)
+			}
+			switch f.Function {
+			case FunctionKeyboard:
+				var state keyboard.InputState
+				if err := state.UnmarshalBinary(f.Data); err != nil {
+					return fmt.Errorf("unmarshal keyboard input state: %w", err)
+				}
+				cdev.Keyboard().UpdateInputState(state)
+			case FunctionMouse:
+				var state mouse.InputState
+				if err := state.UnmarshalBinary(f.Data); err != nil {
+					return fmt.Errorf("unmarshal mouse input state: %w", err)
+				}
+				cdev.Mouse().UpdateInputState(state)
+			default:
+				logger.Warn("ignoring frame for unknown function", "function", f.Function)
+				continue
+			}
+			if data, err := f.MarshalBinary(); err == nil {
+				api.RecordFrame(conn, data)
+			}
+		}
+	}
+}
+
+func (h *handler) UpdateMetaState(meta string, dev *usb.Device) error {
+	return device.ErrNoMetaState
+}
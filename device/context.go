@@ -3,6 +3,7 @@ package device
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/Alia5/VIIPER/usbip"
@@ -13,6 +14,8 @@ type contextKey int
 const (
 	ExportMetaKey contextKey = iota
 	ConnTimerKey
+	KeepAliveKey
+	AttachmentsKey
 )
 
 // GetDeviceMeta extracts the device metadata from a device context.
@@ -32,3 +35,76 @@ func GetConnTimer(ctx context.Context) *time.Timer {
 	}
 	return nil
 }
+
+// IsKeepAlive reports whether the device was added to stay on its bus without
+// a client stream, e.g. from a profile. Such devices carry no connection timer.
+func IsKeepAlive(ctx context.Context) bool {
+	keepAlive, _ := ctx.Value(KeepAliveKey).(bool)
+	return keepAlive
+}
+
+// Attachments holds the per-device state other packages keep for a device,
+// e.g. the server's failsafe policy. It lives as long as the device context,
+// so the state goes away with the device.
+// Packages key their values with an unexported key type.
+// A nil *Attachments stores nothing.
+type Attachments struct {
+	mu     sync.Mutex
+	values map[any]any
+}
+
+// WithAttachments returns a copy of ctx carrying new, empty attachments.
+func WithAttachments(ctx context.Context) context.Context {
+	return context.WithValue(ctx, AttachmentsKey, &Attachments{})
+}
+
+// GetAttachments extracts the attachments from a device context.
+// Returns nil if the context doesn't contain them.
+func GetAttachments(ctx context.Context) *Attachments {
+	if a, ok := ctx.Value(AttachmentsKey).(*Attachments); ok {
+		return a
+	}
+	return nil
+}
+
+// Load returns the value stored for key, or nil.
+func (a *Attachments) Load(key any) any {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.values[key]
+}
+
+// Store sets the value for key.
+func (a *Attachments) Store(key, value any) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.values == nil {
+		a.values = map[any]any{}
+	}
+	a.values[key] = value
+}
+
+// LoadOrStore returns the value stored for key. If there is none, it stores
+// and returns the result of newValue.
+func (a *Attachments) LoadOrStore(key any, newValue func() any) any {
+	if a == nil {
+		return newValue()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if v, ok := a.values[key]; ok {
+		return v
+	}
+	if a.values == nil {
+		a.values = map[any]any{}
+	}
+	v := newValue()
+	a.values[key] = v
+	return v
+}
@@ -0,0 +1,25 @@
+package customhid
+
+// HID report types. These match the report type encoded in the high byte of
+// wValue for GET_REPORT/SET_REPORT and double as the frame type on the device stream.
+const (
+	ReportTypeInput   = 0x01
+	ReportTypeOutput  = 0x02
+	ReportTypeFeature = 0x03
+)
+
+// Defaults used when the corresponding DeviceSpecific option is omitted.
+const (
+	DefaultVID           = 0x2E8A
+	DefaultPID           = 0x0020
+	DefaultBcdDevice     = 0x0100
+	DefaultInEndpoint    = 0x81
+	DefaultMaxPacketSize = 64
+	DefaultInterval      = 1 // ms
+)
+
+// MaxReportSize is the largest report payload that fits into a single stream frame.
+const MaxReportSize = 0xFFFF
+
+// ReportHeaderSize is the size of the frame header (type + length) on the device stream.
+const ReportHeaderSize = 3
@@ -0,0 +1,235 @@
+package customhid_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/device/customhid"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/usbip"
+	"github.com/Alia5/VIIPER/viiperclient"
+	"github.com/Alia5/VIIPER/virtualbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/Alia5/VIIPER/internal/registry" // Register devices
+)
+
+// 16 button "button box" with an 8 bit LED output report.
+const buttonBoxDescriptor = "05 01 09 05 a1 01 05 09 19 01 29 10 15 00 25 01 75 01 95 10 81 02 " +
+	"05 08 19 01 29 08 95 08 91 02 c0"
+
+func TestNewOptions(t *testing.T) {
+	type testCase struct {
+		name    string
+		opts    customhid.Options
+		wantErr bool
+		check   func(t *testing.T, d *customhid.CustomHID)
+	}
+
+	cases := []testCase{
+		{
+			name: "defaults",
+			check: func(t *testing.T, d *customhid.CustomHID) {
+				desc := d.GetDescriptor()
+				assert.Equal(t, uint16(customhid.DefaultVID), desc.Device.IDVendor)
+				assert.Equal(t, uint16(customhid.DefaultPID), desc.Device.IDProduct)
+				assert.Len(t, desc.Interfaces[0].Endpoints, 1)
+				assert.Equal(t, uint8(customhid.DefaultInEndpoint), desc.Interfaces[0].Endpoints[0].BEndpointAddress)
+				assert.False(t, d.UsesReportIDs())
+			},
+		},
+		{
+			name: "full layout",
+			opts: customhid.Options{
+				VendorID:         new(uint16(0x1209)),
+				ProductID:        new(uint16(0x0001)),
+				Manufacturer:     "ACME",
+				Product:          "Pedals",
+				SerialNumber:     "42",
+				ReportDescriptor: "0x05,0x01,0x09,0x04,0xa1,0x01,0x85,0x01,0x09,0x30,0x15,0x00,0x26,0xff,0x00,0x75,0x08,0x95,0x01,0x81,0x02,0xc0",
+				InEndpoint:       new(uint8(0x83)),
+				InMaxPacketSize:  new(uint16(8)),
+				OutEndpoint:      new(uint8(0x02)),
+				Interval:         new(uint8(4)),
+			},
+			check: func(t *testing.T, d *customhid.CustomHID) {
+				desc := d.GetDescriptor()
+				assert.Equal(t, uint16(0x1209), desc.Device.IDVendor)
+				assert.Equal(t, uint16(0x0001), desc.Device.IDProduct)
+				assert.Equal(t, "ACME", desc.Strings[1])
+				assert.Equal(t, "Pedals", desc.Strings[2])
+				assert.Equal(t, "42", desc.Strings[3])
+				eps := desc.Interfaces[0].Endpoints
+				if assert.Len(t, eps, 2) {
+					assert.Equal(t, uint8(0x83), eps[0].BEndpointAddress)
+					assert.Equal(t, uint16(8), eps[0].WMaxPacketSize)
+					assert.Equal(t, uint8(4), eps[0].BInterval)
+					assert.Equal(t, uint8(0x02), eps[1].BEndpointAddress)
+				}
+				rd, err := desc.Interfaces[0].HID.ReportBytes()
+				assert.NoError(t, err)
+				assert.Len(t, rd, 22)
+				assert.True(t, d.UsesReportIDs())
+			},
+		},
+		{
+			name:    "truncated descriptor",
+			opts:    customhid.Options{ReportDescriptor: "05 01 09"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid hex",
+			opts:    customhid.Options{ReportDescriptor: "zz"},
+			wantErr: true,
+		},
+		{
+			name:    "IN endpoint without direction bit",
+			opts:    customhid.Options{InEndpoint: new(uint8(0x01))},
+			wantErr: true,
+		},
+		{
+			name:    "packet size too large",
+			opts:    customhid.Options{InMaxPacketSize: new(uint16(512))},
+			wantErr: true,
+		},
+		{
+			name:    "empty feature report",
+			opts:    customhid.Options{FeatureReports: []string{""}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := json.Marshal(tc.opts)
+			require.NoError(t, err)
+			d, err := customhid.New(&device.CreateOptions{DeviceSpecific: string(b)})
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			tc.check(t, d)
+		})
+	}
+}
+
+func TestFeatureReports(t *testing.T) {
+	b, err := json.Marshal(customhid.Options{
+		ReportDescriptor: buttonBoxDescriptor,
+		FeatureReports:   []string{"01 02 03"},
+	})
+	require.NoError(t, err)
+	d, err := customhid.New(&device.CreateOptions{DeviceSpecific: string(b)})
+	require.NoError(t, err)
+
+	resp, handled := d.HandleControl(0xA1, 0x01, customhid.ReportTypeFeature<<8, 0, 64, nil)
+	assert.True(t, handled)
+	assert.Equal(t, []byte{0x01, 0x02, 0x03}, resp)
+
+	var got []customhid.Report
+	d.SetOutputCallback(func(r customhid.Report) { got = append(got, r) })
+	_, handled = d.HandleControl(0x21, 0x09, customhid.ReportTypeFeature<<8, 0, 2, []byte{0xAA, 0xBB})
+	assert.True(t, handled)
+	assert.Equal(t, []customhid.Report{{Type: customhid.ReportTypeFeature, Data: []byte{0xAA, 0xBB}}}, got)
+
+	resp, handled = d.HandleControl(0xA1, 0x01, customhid.ReportTypeFeature<<8, 0, 1, nil)
+	assert.True(t, handled)
+	assert.Equal(t, []byte{0xAA}, resp)
+
+	_, handled = d.HandleControl(0xA1, 0x01, customhid.ReportTypeInput<<8, 0, 2, nil)
+	assert.False(t, handled, "no input report sent yet")
+	d.UpdateInputState([]byte{0x05, 0x00})
+	resp, handled = d.HandleControl(0xA1, 0x01, customhid.ReportTypeInput<<8, 0, 2, nil)
+	assert.True(t, handled)
+	assert.Equal(t, []byte{0x05, 0x00}, resp)
+}
+
+func TestStream(t *testing.T) {
+	s := viiperTesting.NewTestServer(t)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+
+	r := s.ApiServer.Router()
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	r.RegisterStream("bus/{busId}/{deviceid}", api.DeviceStreamHandler(s.UsbServer))
+
+	if err := s.ApiServer.Start(); err != nil {
+		t.Fatalf("Failed to start API server: %v", err)
+	}
+
+	b, err := virtualbus.NewWithBusID(1)
+	if err != nil {
+		t.Fatalf("Failed to create virtual bus: %v", err)
+	}
+	defer b.Close() //nolint:errcheck
+	_ = s.UsbServer.AddBus(b)
+
+	opts, err := json.Marshal(customhid.Options{
+		ReportDescriptor: buttonBoxDescriptor,
+		InMaxPacketSize:  new(uint16(8)),
+		OutEndpoint:      new(uint8(0x01)),
+		OutMaxPacketSize: new(uint16(8)),
+	})
+	require.NoError(t, err)
+
+	client := viiperclient.New(s.ApiServer.Addr())
+	stream, _, err := client.AddDeviceAndConnect(context.Background(), b.BusID(), "customhid", &device.CreateOptions{
+		IDVendor:       new(uint16(0x1209)),
+		IDProduct:      new(uint16(0xB0B0)),
+		DeviceSpecific: string(opts),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stream.Close() //nolint:errcheck
+
+	usbipClient := viiperTesting.NewUsbIpClient(t, s.UsbServer.Addr())
+	devs, err := usbipClient.ListDevices()
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.Len(t, devs, 1) {
+		return
+	}
+	assert.Equal(t, uint16(0x1209), devs[0].IDVendor)
+	assert.Equal(t, uint16(0xB0B0), devs[0].IDProduct)
+	imp, err := usbipClient.AttachDevice(devs[0].BusID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if imp != nil && imp.Conn != nil {
+		defer imp.Conn.Close() //nolint:errcheck
+	}
+
+	t.Run("input reports", func(t *testing.T) {
+		for _, report := range [][]byte{{0x01, 0x00}, {0x00, 0x80}, {0xFF, 0xFF}} {
+			if !assert.NoError(t, stream.WriteBinary(&customhid.Report{Type: customhid.ReportTypeInput, Data: report})) {
+				return
+			}
+			got, err := usbipClient.PollInputReport(imp.Conn, report, 750*time.Millisecond)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, report, got)
+		}
+	})
+
+	t.Run("output report", func(t *testing.T) {
+		if !assert.NoError(t, usbipClient.Submit(imp.Conn, usbip.DirOut, 1, []byte{0x5A}, nil)) {
+			return
+		}
+		_ = stream.SetReadDeadline(time.Now().Add(750 * time.Millisecond))
+		got, err := customhid.ReadReport(stream)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, &customhid.Report{Type: customhid.ReportTypeOutput, Data: []byte{0x5A}}, got)
+	})
+}
@@ -0,0 +1,404 @@
+// Package customhid provides a generic, descriptor-driven HID device.
+//
+// The USB identity, strings, HID report descriptor and interrupt endpoint
+// layout are taken from the DeviceSpecific options at creation time, so odd
+// devices (button boxes, wheels, pedals, ...) can be emulated without adding
+// a dedicated device package. Reports are passed through verbatim.
+package customhid
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/usb"
+	"github.com/Alia5/VIIPER/usb/hid"
+	"github.com/Alia5/VIIPER/usbip"
+)
+
+const (
+	hidClassIN  = 0xA1
+	hidClassOUT = 0x21
+
+	hidGetReport = 0x01
+	hidSetReport = 0x09
+
+	// inputQueueSize bounds the number of pending input reports when the
+	// descriptor uses report IDs, so reports for different IDs are not dropped.
+	inputQueueSize = 16
+)
+
+// CustomHID implements a HID device whose descriptors are supplied at runtime.
+type CustomHID struct {
+	inputCh    chan []byte
+	descriptor usb.Descriptor
+	options    Options
+
+	inEP      uint32
+	outEP     uint32 // 0 if no interrupt OUT endpoint
+	reportIDs bool
+
+	mtx            sync.Mutex
+	inputReports   map[uint8][]byte
+	featureReports map[uint8][]byte
+	outputReports  map[uint8][]byte
+	outputFunc     func(Report)
+}
+
+// New returns a new CustomHID device configured from o.DeviceSpecific (see Options).
+func New(o *device.CreateOptions) (*CustomHID, error) {
+	var opts Options
+	if o != nil && o.DeviceSpecific != "" {
+		if err := json.Unmarshal([]byte(o.DeviceSpecific), &opts); err != nil {
+			return nil, fmt.Errorf("invalid JSON payload: %w", err)
+		}
+	}
+	if o != nil {
+		if o.IDVendor != nil {
+			opts.VendorID = o.IDVendor
+		}
+		if o.IDProduct != nil {
+			opts.ProductID = o.IDProduct
+		}
+	}
+
+	d := &CustomHID{
+		options:        opts,
+		inputReports:   map[uint8][]byte{},
+		outputReports:  map[uint8][]byte{},
+		featureReports: map[uint8][]byte{},
+	}
+	if err := d.buildDescriptor(); err != nil {
+		return nil, err
+	}
+
+	for i, v := range opts.FeatureReports {
+		data, err := parseHex(v)
+		if err != nil {
+			return nil, fmt.Errorf("feature report %d: %w", i, err)
+		}
+		if len(data) == 0 {
+			return nil, fmt.Errorf("feature report %d is empty", i)
+		}
+		d.SetFeatureReport(data)
+	}
+
+	if d.reportIDs {
+		d.inputCh = make(chan []byte, inputQueueSize)
+	} else {
+		d.inputCh = make(chan []byte, 1)
+	}
+	return d, nil
+}
+
+func (d *CustomHID) buildDescriptor() error {
+	opts := d.options
+
+	hidFn := &usb.HIDFunction{
+		Descriptor: usb.HIDDescriptor{
+			BcdHID:       0x0111,
+			BCountryCode: 0x00,
+			Descriptors: []usb.HIDSubDescriptor{
+				{Type: usb.ReportDescType},
+			},
+		},
+		ReportDescriptor: defaultReportDescriptor,
+	}
+	if opts.ReportDescriptor != "" {
+		raw, err := parseHex(opts.ReportDescriptor)
+		if err != nil {
+			return fmt.Errorf("report descriptor: %w", err)
+		}
+		if len(raw) == 0 {
+			return fmt.Errorf("report descriptor is empty")
+		}
+		hasIDs, err := scanReportDescriptor(raw)
+		if err != nil {
+			return fmt.Errorf("report descriptor: %w", err)
+		}
+		hidFn.ReportDescriptorBytes = raw
+		d.reportIDs = hasIDs
+	}
+
+	interval := uint8(DefaultInterval)
+	if opts.Interval != nil {
+		if *opts.Interval == 0 {
+			return fmt.Errorf("interval must be at least 1 ms")
+		}
+		interval = *opts.Interval
+	}
+
+	inAddr := uint8(DefaultInEndpoint)
+	if opts.InEndpoint != nil {
+		inAddr = *opts.InEndpoint
+	}
+	inSize, err := packetSize(opts.InMaxPacketSize)
+	if err != nil {
+		return fmt.Errorf("inMaxPacketSize: %w", err)
+	}
+	if inAddr&0x80 == 0 || inAddr&0x0F == 0 || inAddr&0x70 != 0 {
+		return fmt.Errorf("invalid IN endpoint address 0x%02x", inAddr)
+	}
+	endpoints := []usb.EndpointDescriptor{{
+		BEndpointAddress: inAddr,
+		BMAttributes:     0x03, // Interrupt
+		WMaxPacketSize:   inSize,
+		BInterval:        interval,
+	}}
+	d.inEP = uint32(inAddr & 0x0F)
+
+	if opts.OutEndpoint != nil {
+		outAddr := *opts.OutEndpoint
+		if outAddr&0x80 != 0 || outAddr&0x0F == 0 || outAddr&0x70 != 0 {
+			return fmt.Errorf("invalid OUT endpoint address 0x%02x", outAddr)
+		}
+		outSize, err := packetSize(opts.OutMaxPacketSize)
+		if err != nil {
+			return fmt.Errorf("outMaxPacketSize: %w", err)
+		}
+		endpoints = append(endpoints, usb.EndpointDescriptor{
+			BEndpointAddress: outAddr,
+			BMAttributes:     0x03, // Interrupt
+			WMaxPacketSize:   outSize,
+			BInterval:        interval,
+		})
+		d.outEP = uint32(outAddr & 0x0F)
+	}
+
+	d.descriptor = usb.Descriptor{
+		Device: usb.DeviceDescriptor{
+			BcdUSB:             0x0200,
+			BDeviceClass:       0x00,
+			BDeviceSubClass:    0x00,
+			BDeviceProtocol:    0x00,
+			BMaxPacketSize0:    0x40,
+			IDVendor:           valueOr(opts.VendorID, DefaultVID),
+			IDProduct:          valueOr(opts.ProductID, DefaultPID),
+			BcdDevice:          valueOr(opts.BcdDevice, DefaultBcdDevice),
+			IManufacturer:      0x01,
+			IProduct:           0x02,
+			ISerialNumber:      0x03,
+			BNumConfigurations: 0x01,
+			Speed:              2, // Full speed
+		},
+		Interfaces: []usb.InterfaceConfig{
+			{
+				Descriptor: usb.InterfaceDescriptor{
+					BInterfaceNumber:   0x00,
+					BAlternateSetting:  0x00,
+					BNumEndpoints:      uint8(len(endpoints)),
+					BInterfaceClass:    0x03, // HID
+					BInterfaceSubClass: 0x00,
+					BInterfaceProtocol: 0x00,
+					IInterface:         0x00,
+				},
+				HID:       hidFn,
+				Endpoints: endpoints,
+			},
+		},
+		Strings: map[uint8]string{
+			0: "\u0409", // LangID: en-US (0x0409)
+			1: stringOr(opts.Manufacturer, "VIIPER"),
+			2: stringOr(opts.Product, "Custom HID"),
+			3: stringOr(opts.SerialNumber, "1337"),
+		},
+	}
+	return nil
+}
+
+func packetSize(v *uint16) (uint16, error) {
+	if v == nil {
+		return DefaultMaxPacketSize, nil
+	}
+	if *v == 0 || *v > 64 {
+		return 0, fmt.Errorf("must be between 1 and 64 for full speed interrupt endpoints, got %d", *v)
+	}
+	return *v, nil
+}
+
+func valueOr[T any](v *T, def T) T {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+func stringOr(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// SetOutputCallback sets a callback that is invoked for output reports and
+// feature reports written by the host.
+func (d *CustomHID) SetOutputCallback(f func(Report)) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.outputFunc = f
+}
+
+// UsesReportIDs reports whether the report descriptor declares report IDs.
+// If it does, every report starts with its report ID byte.
+func (d *CustomHID) UsesReportIDs() bool { return d.reportIDs }
+
+// UpdateInputState queues a raw input report for the interrupt IN endpoint.
+func (d *CustomHID) UpdateInputState(report []byte) {
+	report = append([]byte(nil), report...)
+	d.mtx.Lock()
+	d.inputReports[d.reportID(report)] = report
+	d.mtx.Unlock()
+
+	for {
+		select {
+		case d.inputCh <- report:
+			return
+		default:
+		}
+		// Queue is full: drop the oldest pending report.
+		select {
+		case <-d.inputCh:
+		default:
+		}
+	}
+}
+
+// SetFeatureReport sets the response for GET_REPORT(Feature).
+func (d *CustomHID) SetFeatureReport(report []byte) {
+	report = append([]byte(nil), report...)
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.featureReports[d.reportID(report)] = report
+}
+
+func (d *CustomHID) reportID(report []byte) uint8 {
+	if !d.reportIDs || len(report) == 0 {
+		return 0
+	}
+	return report[0]
+}
+
+func (d *CustomHID) emitOutput(reportType uint8, data []byte) {
+	d.mtx.Lock()
+	if reportType == ReportTypeOutput && len(data) > 0 {
+		d.outputReports[d.reportID(data)] = append([]byte(nil), data...)
+	}
+	f := d.outputFunc
+	d.mtx.Unlock()
+	if f != nil {
+		f(Report{Type: reportType, Data: append([]byte(nil), data...)})
+	}
+}
+
+// GetInputState returns the last input report per report ID.
+func (d *CustomHID) GetInputState() any {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return maps.Clone(d.inputReports)
+}
+
+// GetOutputState returns the last output report per report ID, or nil if the
+// host has not sent any.
+func (d *CustomHID) GetOutputState() any {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if len(d.outputReports) == 0 {
+		return nil
+	}
+	return maps.Clone(d.outputReports)
+}
+
+func (d *CustomHID) HandleTransfer(ctx context.Context, ep uint32, dir uint32, out []byte) []byte {
+	if dir == usbip.DirIn {
+		if ep != d.inEP {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case report := <-d.inputCh:
+			return report
+		}
+	}
+	if d.outEP != 0 && ep == d.outEP && len(out) > 0 {
+		d.emitOutput(ReportTypeOutput, out)
+	}
+	return nil
+}
+
+func (d *CustomHID) HandleControl(bmRequestType, bRequest uint8, wValue, wIndex, wLength uint16, data []byte) ([]byte, bool) {
+	reportType := uint8(wValue >> 8)
+	reportID := uint8(wValue & 0xFF)
+
+	switch {
+	case bmRequestType == hidClassIN && bRequest == hidGetReport:
+		d.mtx.Lock()
+		defer d.mtx.Unlock()
+		var b []byte
+		var ok bool
+		switch reportType {
+		case ReportTypeInput:
+			b, ok = d.inputReports[reportID]
+		case ReportTypeFeature:
+			b, ok = d.featureReports[reportID]
+		}
+		if !ok {
+			return nil, false
+		}
+		if wLength > 0 && int(wLength) < len(b) {
+			b = b[:wLength]
+		}
+		return append([]byte(nil), b...), true
+	case bmRequestType == hidClassOUT && bRequest == hidSetReport:
+		switch reportType {
+		case ReportTypeOutput:
+			d.emitOutput(ReportTypeOutput, data)
+			return nil, true
+		case ReportTypeFeature:
+			d.mtx.Lock()
+			d.featureReports[reportID] = append([]byte(nil), data...)
+			d.mtx.Unlock()
+			d.emitOutput(ReportTypeFeature, data)
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+func (d *CustomHID) GetDescriptor() *usb.Descriptor {
+	return &d.descriptor
+}
+
+func (d *CustomHID) GetDeviceSpecificArgs() map[string]any {
+	var res map[string]any
+	bytes, err := json.Marshal(d.options)
+	if err != nil {
+		return map[string]any{}
+	}
+	if err := json.Unmarshal(bytes, &res); err != nil {
+		return map[string]any{}
+	}
+	return res
+}
+
+// defaultReportDescriptor is a vendor-defined ("raw HID") descriptor with a
+// 64 byte input and a 64 byte output report, used when no descriptor is given.
+var defaultReportDescriptor = hid.ReportDescriptor{
+	Items: []hid.Item{
+		hid.UsagePage{Page: 0xFF00}, // Vendor-defined
+		hid.Usage{Usage: 0x01},
+		hid.Collection{Kind: hid.CollectionApplication, Items: []hid.Item{
+			hid.LogicalMinimum{Min: 0},
+			hid.LogicalMaximum{Max: 255},
+			hid.ReportSize{Bits: 8},
+			hid.ReportCount{Count: 64},
+			hid.Usage{Usage: 0x02},
+			hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
+			hid.Usage{Usage: 0x03},
+			hid.Output{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
+		}},
+	},
+}
@@ -0,0 +1,75 @@
+package customhid
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	"github.com/Alia5/VIIPER/usb"
+)
+
+func init() {
+	api.RegisterDevice("customhid", &handler{})
+}
+
+type handler struct{}
+
+func (h *handler) CreateDevice(o *device.CreateOptions) (usb.Device, error) { return New(o) }
+
+func (h *handler) StreamHandler() api.StreamHandlerFunc {
+	return func(conn net.Conn, devPtr *usb.Device, logger *slog.Logger) error {
+		if devPtr == nil || *devPtr == nil {
+			return fmt.Errorf("nil device")
+		}
+		cdev, ok := (*devPtr).(*CustomHID)
+		if !ok {
+			return fmt.Errorf("%w: expected customhid", device.ErrWrongDeviceType)
+		}
+
+		var writeMu sync.Mutex
+		cdev.SetOutputCallback(func(report Report) {
+			data, err := report.MarshalBinary()
+			if err != nil {
+				logger.Error("failed to marshal report", "error", err)
+				return
+			}
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			if _, err := conn.Write(data); err != nil {
+				logger.Error("failed to send report", "error", err)
+			}
+		})
+		defer cdev.SetOutputCallback(nil)
+
+		for {
+			report, err := ReadReport(conn)
+			if err != nil {
+				if err == io.EOF {
+					logger.Info("client disconnected")
+					return nil
+				}
+				return fmt.Errorf("read report: %w", err)
+			}
+			switch report.Type {
+			case ReportTypeInput:
+				cdev.UpdateInputState(report.Data)
+			case ReportTypeFeature:
+				cdev.SetFeatureReport(report.Data)
+			default:
+				logger.Warn("ignoring report with unsupported type", "type", report.Type)
+				continue
+			}
+			if data, err := report.MarshalBinary(); err == nil {
+				api.RecordFrame(conn, data)
+			}
+		}
+	}
+}
+
+func (h *handler) UpdateMetaState(meta string, dev *usb.Device) error {
+	return device.ErrNoMetaState
+}
@@ -0,0 +1,90 @@
+package customhid
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Options is the DeviceSpecific payload accepted by the customhid device type.
+// All fields are optional; omitted fields fall back to the package defaults.
+//
+// Example:
+//
+//	{
+//	  "vendorId": 4617,
+//	  "productId": 1,
+//	  "product": "Button Box",
+//	  "reportDescriptor": "05 01 09 05 a1 01 05 09 19 01 29 10 15 00 25 01 75 01 95 10 81 02 c0",
+//	  "inMaxPacketSize": 8,
+//	  "interval": 4
+//	}
+type Options struct {
+	VendorID  *uint16 `json:"vendorId,omitempty"`
+	ProductID *uint16 `json:"productId,omitempty"`
+	BcdDevice *uint16 `json:"bcdDevice,omitempty"`
+
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Product      string `json:"product,omitempty"`
+	SerialNumber string `json:"serialNumber,omitempty"`
+
+	// ReportDescriptor is the raw HID report descriptor (0x22) as a hex string.
+	// Whitespace, commas and 0x prefixes are ignored.
+	// When empty, a vendor-defined 64 byte IN/OUT descriptor is used.
+	ReportDescriptor string `json:"reportDescriptor,omitempty"`
+
+	// InEndpoint is the address of the interrupt IN endpoint (e.g. 0x81).
+	InEndpoint      *uint8  `json:"inEndpoint,omitempty"`
+	InMaxPacketSize *uint16 `json:"inMaxPacketSize,omitempty"`
+	// OutEndpoint optionally adds an interrupt OUT endpoint (e.g. 0x02) for output reports.
+	// Without it, hosts deliver output reports via SET_REPORT on EP0.
+	OutEndpoint      *uint8  `json:"outEndpoint,omitempty"`
+	OutMaxPacketSize *uint16 `json:"outMaxPacketSize,omitempty"`
+	// Interval is the polling interval in ms used for all interrupt endpoints.
+	Interval *uint8 `json:"interval,omitempty"`
+
+	// FeatureReports seeds the GET_REPORT(Feature) responses as hex strings.
+	// When the descriptor declares report IDs, each report starts with its report ID.
+	FeatureReports []string `json:"featureReports,omitempty"`
+}
+
+// parseHex decodes a hex string such as "05 01 09 05", "0x05,0x01" or "05010905".
+func parseHex(s string) ([]byte, error) {
+	s = strings.NewReplacer("0x", "", "0X", "", ",", "", " ", "", "\t", "", "\n", "", "\r", "").Replace(s)
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex: %w", err)
+	}
+	return b, nil
+}
+
+// scanReportDescriptor walks the items of a raw HID report descriptor, rejecting
+// truncated items, and reports whether the descriptor declares report IDs.
+func scanReportDescriptor(b []byte) (hasReportIDs bool, err error) {
+	for i := 0; i < len(b); {
+		prefix := b[i]
+		if prefix == 0xFE { // long item: prefix, bDataSize, bLongItemTag, data
+			if i+2 >= len(b) {
+				return false, fmt.Errorf("truncated long item at offset %d", i)
+			}
+			next := i + 3 + int(b[i+1])
+			if next > len(b) {
+				return false, fmt.Errorf("truncated long item at offset %d", i)
+			}
+			i = next
+			continue
+		}
+		size := int(prefix & 0x03)
+		if size == 3 {
+			size = 4
+		}
+		if i+1+size > len(b) {
+			return false, fmt.Errorf("truncated item 0x%02x at offset %d", prefix, i)
+		}
+		if prefix&0xFC == 0x84 { // Global: Report ID
+			hasReportIDs = true
+		}
+		i += 1 + size
+	}
+	return hasReportIDs, nil
+}
@@ -0,0 +1,66 @@
+package customhid
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Report is a single HID report framed for the device stream.
+//
+// Client -> server frames carry input reports (ReportTypeInput) or feature
+// reports the host may read via GET_REPORT (ReportTypeFeature).
+// Server -> client frames carry output reports (ReportTypeOutput) and feature
+// reports written by the host via SET_REPORT (ReportTypeFeature).
+//
+// When the report descriptor declares report IDs, Data starts with the report ID.
+//
+// viiper:wire customhid c2s reportType:u8 length:u16 data:u8*length
+// viiper:wire customhid s2c reportType:u8 length:u16 data:u8*length
+type Report struct {
+	Type uint8
+	Data []byte
+}
+
+// MarshalBinary encodes the report as a frame: type (u8), length (u16 LE), data.
+func (r *Report) MarshalBinary() ([]byte, error) {
+	if len(r.Data) > MaxReportSize {
+		return nil, fmt.Errorf("report too large: %d bytes", len(r.Data))
+	}
+	b := make([]byte, ReportHeaderSize+len(r.Data))
+	b[0] = r.Type
+	binary.LittleEndian.PutUint16(b[1:3], uint16(len(r.Data)))
+	copy(b[ReportHeaderSize:], r.Data)
+	return b, nil
+}
+
+// UnmarshalBinary decodes a single frame produced by MarshalBinary.
+func (r *Report) UnmarshalBinary(data []byte) error {
+	if len(data) < ReportHeaderSize {
+		return io.ErrUnexpectedEOF
+	}
+	n := int(binary.LittleEndian.Uint16(data[1:3]))
+	if len(data) < ReportHeaderSize+n {
+		return io.ErrUnexpectedEOF
+	}
+	r.Type = data[0]
+	r.Data = append([]byte(nil), data[ReportHeaderSize:ReportHeaderSize+n]...)
+	return nil
+}
+
+// ReadReport reads exactly one framed report from r.
+func ReadReport(r io.Reader) (*Report, error) {
+	var hdr [ReportHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := int(binary.LittleEndian.Uint16(hdr[1:3]))
+	rep := &Report{Type: hdr[0], Data: make([]byte, n)}
+	if _, err := io.ReadFull(r, rep.Data); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return rep, nil
+}
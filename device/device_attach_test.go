@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Alia5/VIIPER/device"
 	"github.com/Alia5/VIIPER/internal/server/api"
 	"github.com/Alia5/VIIPER/internal/server/api/handler"
 	"github.com/Alia5/VIIPER/viiperclient"
@@ -16,6 +17,16 @@ import (
 	_ "github.com/Alia5/VIIPER/internal/registry" // Register devices
 )
 
+// requiredOptions holds the DeviceSpecific options of device types that
+// cannot be created without them.
+var requiredOptions = map[string]*device.CreateOptions{
+	// Vendor specific device with a single interface and no endpoints.
+	"clone": {DeviceSpecific: `{
+		"device": "12 01 00 02 ff 00 00 40 09 12 02 00 00 01 00 00 00 01",
+		"configuration": "09 02 12 00 01 01 00 80 32 09 04 00 00 00 ff 00 00 00"
+	}`},
+}
+
 func TestDeviceAttach(t *testing.T) {
 
 	deviceTypes := api.ListDeviceTypes()
@@ -56,7 +67,7 @@ func TestDeviceAttach(t *testing.T) {
 
 			c := viiperclient.New(s.ApiServer.Addr())
 
-			stream, addResp, err := c.AddDeviceAndConnect(context.Background(), b.BusID(), tc.deviceType, nil)
+			stream, addResp, err := c.AddDeviceAndConnect(context.Background(), b.BusID(), tc.deviceType, requiredOptions[tc.deviceType])
 			if !assert.NoError(t, err) {
 				t.Fatal()
 			}
@@ -0,0 +1,40 @@
+package digitizer
+
+// Pointer button bitmasks.
+const (
+	ButtonLeft    = 0x01
+	ButtonRight   = 0x02
+	ButtonMiddle  = 0x04
+	ButtonBack    = 0x08
+	ButtonForward = 0x10
+)
+
+const (
+	// AxisMax is the maximum pointer and contact coordinate. 0 is the left/top
+	// edge, AxisMax the right/bottom edge of the screen.
+	AxisMax = 32767
+	// MaxContacts is the number of simultaneous touch contacts.
+	MaxContacts = 10
+)
+
+const (
+	reportIDPointer         = 0x01
+	reportIDTouch           = 0x02
+	reportIDContactCountMax = 0x03
+
+	pointerReportSize = 10
+	touchReportSize   = 2 + MaxContacts*contactSize
+	contactSize       = 6
+
+	// Physical size of the touch screen in 0.1 mm.
+	physicalWidth  = 3450
+	physicalHeight = 1940
+)
+
+const (
+	hidClassIN = 0xA1
+
+	hidGetReport = 0x01
+
+	reportTypeFeature = 0x03
+)
@@ -0,0 +1,320 @@
+// Package digitizer provides a HID absolute pointer and 10-point touch screen
+// device implementation.
+package digitizer
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/usb"
+	"github.com/Alia5/VIIPER/usb/hid"
+	"github.com/Alia5/VIIPER/usbip"
+)
+
+// Digitizer implements a HID device with an absolute pointer (report ID 1)
+// and a multi-touch screen (report ID 2).
+//
+// Reports are built when the host polls: pointer moves are coalesced, wheel
+// deltas are summed, and every lifted contact is reported exactly once.
+type Digitizer struct {
+	descriptor usb.Descriptor
+
+	mu           sync.Mutex
+	wake         chan struct{}
+	inputState   InputState
+	pointerDirty bool
+	wheel, pan   int32
+	touchDirty   bool
+	reported     uint16 // contacts the host last saw touching
+}
+
+// New returns a new Digitizer device.
+func New(o *device.CreateOptions) (*Digitizer, error) {
+	d := &Digitizer{
+		descriptor: defaultDescriptor(),
+		wake:       make(chan struct{}, 1),
+	}
+	if o != nil {
+		if o.IDVendor != nil {
+			d.descriptor.Device.IDVendor = *o.IDVendor
+		}
+		if o.IDProduct != nil {
+			d.descriptor.Device.IDProduct = *o.IDProduct
+		}
+	}
+	return d, nil
+}
+
+// UpdateInputState updates the device's current input state (thread-safe).
+// Wheel and Pan are deltas and are added up until the host polls.
+func (d *Digitizer) UpdateInputState(state InputState) {
+	d.mu.Lock()
+	old := d.inputState
+	if state.Buttons != old.Buttons || state.X != old.X || state.Y != old.Y || state.Wheel != 0 || state.Pan != 0 {
+		d.pointerDirty = true
+	}
+	d.wheel += int32(state.Wheel)
+	d.pan += int32(state.Pan)
+	if state.Touch != old.Touch || state.TouchX != old.TouchX || state.TouchY != old.TouchY {
+		d.touchDirty = true
+	}
+	d.inputState = state
+	d.mu.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ResetInputState releases all buttons and contacts, see
+// usb.NeutralStateDevice. The pointer stays where it is.
+func (d *Digitizer) ResetInputState() {
+	st := *NewInputState()
+	d.mu.Lock()
+	st.X, st.Y = d.inputState.X, d.inputState.Y
+	d.mu.Unlock()
+	d.UpdateInputState(st)
+}
+
+// GetInputState returns the last input state set by the client.
+func (d *Digitizer) GetInputState() any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.inputState
+}
+
+// GetOutputState returns nil, the digitizer has no host output.
+func (d *Digitizer) GetOutputState() any { return nil }
+
+func (d *Digitizer) HandleTransfer(ctx context.Context, ep uint32, dir uint32, out []byte) []byte {
+	if dir != usbip.DirIn || ep != 1 {
+		return nil
+	}
+	for {
+		if r := d.nextReport(); r != nil {
+			return r
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-d.wake:
+		}
+	}
+}
+
+// IsMessageEndpoint reports true for the input endpoint: repeating a report
+// would repeat wheel deltas and contact lifts.
+func (d *Digitizer) IsMessageEndpoint(ep uint32) bool {
+	return ep == 1
+}
+
+func (d *Digitizer) nextReport() []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pointerDirty {
+		d.pointerDirty = false
+		st := d.inputState
+		st.Wheel = clampInt16(d.wheel)
+		st.Pan = clampInt16(d.pan)
+		d.wheel -= int32(st.Wheel)
+		d.pan -= int32(st.Pan)
+		if d.wheel != 0 || d.pan != 0 {
+			d.pointerDirty = true
+		}
+		return st.BuildPointerReport()
+	}
+	if d.touchDirty {
+		d.touchDirty = false
+		touch := d.inputState.Touch & (1<<MaxContacts - 1)
+		r := d.inputState.BuildTouchReport(touch | d.reported)
+		d.reported = touch
+		return r
+	}
+	return nil
+}
+
+func clampInt16(v int32) int16 {
+	return int16(max(math.MinInt16, min(math.MaxInt16, v)))
+}
+
+func (d *Digitizer) HandleControl(bmRequestType, bRequest uint8, wValue, wIndex, wLength uint16, data []byte) ([]byte, bool) {
+	reportType := uint8(wValue >> 8)
+	reportID := uint8(wValue & 0xFF)
+	if bmRequestType == hidClassIN && bRequest == hidGetReport &&
+		reportType == reportTypeFeature && reportID == reportIDContactCountMax {
+		return []byte{reportIDContactCountMax, MaxContacts}, true
+	}
+	return nil, false
+}
+
+// reportDescriptor describes an absolute pointer (report ID 1), a touch screen
+// with MaxContacts contacts (report ID 2) and its contact count maximum
+// feature (report ID 3).
+var reportDescriptor = hid.ReportDescriptor{
+	Items: []hid.Item{
+		hid.UsagePage{Page: hid.UsagePageGenericDesktop},
+		hid.Usage{Usage: hid.UsageMouse},
+		hid.Collection{Kind: hid.CollectionApplication, Items: []hid.Item{
+			hid.ReportID{ID: reportIDPointer},
+			hid.Usage{Usage: hid.UsagePointer},
+			hid.Collection{
+				Kind: hid.CollectionPhysical,
+				Items: []hid.Item{
+					hid.UsagePage{Page: hid.UsagePageButton},
+					hid.UsageMinimum{Min: 0x01}, // Button 1
+					hid.UsageMaximum{Max: 0x05}, // Button 5
+					hid.LogicalMinimum{Min: 0},
+					hid.LogicalMaximum{Max: 1},
+					hid.ReportCount{Count: 5},
+					hid.ReportSize{Bits: 1},
+					hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
+					hid.ReportCount{Count: 1},
+					hid.ReportSize{Bits: 3},
+					hid.Input{Flags: hid.MainConst},
+					hid.UsagePage{Page: hid.UsagePageGenericDesktop},
+					hid.Usage{Usage: hid.UsageX},
+					hid.Usage{Usage: hid.UsageY},
+					hid.LogicalMinimum{Min: 0},
+					hid.LogicalMaximum{Max: AxisMax},
+					hid.ReportSize{Bits: 16},
+					hid.ReportCount{Count: 2},
+					hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
+					hid.Usage{Usage: hid.UsageWheel},
+					hid.LogicalMinimum{Min: -32768},
+					hid.LogicalMaximum{Max: 32767},
+					hid.ReportSize{Bits: 16},
+					hid.ReportCount{Count: 1},
+					hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainRel},
+					hid.UsagePage{Page: hid.UsagePageConsumer},
+					hid.Usage{Usage: hid.UsageACPan},
+					hid.LogicalMinimum{Min: -32768},
+					hid.LogicalMaximum{Max: 32767},
+					hid.ReportSize{Bits: 16},
+					hid.ReportCount{Count: 1},
+					hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainRel},
+				},
+			},
+		}},
+		hid.UsagePage{Page: hid.UsagePageDigitizer},
+		hid.Usage{Usage: hid.UsageTouchScreen},
+		hid.Collection{Kind: hid.CollectionApplication, Items: touchItems()},
+	},
+}
+
+func touchItems() []hid.Item {
+	items := []hid.Item{hid.ReportID{ID: reportIDTouch}}
+	for range MaxContacts {
+		items = append(items,
+			hid.UsagePage{Page: hid.UsagePageDigitizer},
+			hid.Usage{Usage: hid.UsageFinger},
+			hid.Collection{Kind: hid.CollectionLogical, Items: []hid.Item{
+				hid.Usage{Usage: hid.UsageTipSwitch},
+				hid.LogicalMinimum{Min: 0},
+				hid.LogicalMaximum{Max: 1},
+				hid.ReportSize{Bits: 1},
+				hid.ReportCount{Count: 1},
+				hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
+				hid.ReportSize{Bits: 7},
+				hid.Input{Flags: hid.MainConst},
+				hid.Usage{Usage: hid.UsageContactIdentifier},
+				hid.LogicalMaximum{Max: MaxContacts - 1},
+				hid.ReportSize{Bits: 8},
+				hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
+				hid.UsagePage{Page: hid.UsagePageGenericDesktop},
+				hid.LogicalMaximum{Max: AxisMax},
+				hid.ReportSize{Bits: 16},
+				hid.Unit{Value: 0x11}, // cm
+				hid.UnitExponent{Exp: -2},
+				hid.PhysicalMinimum{Min: 0},
+				hid.PhysicalMaximum{Max: physicalWidth},
+				hid.Usage{Usage: hid.UsageX},
+				hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
+				hid.PhysicalMaximum{Max: physicalHeight},
+				hid.Usage{Usage: hid.UsageY},
+				hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
+				hid.Unit{Value: 0},
+				hid.UnitExponent{Exp: 0},
+				hid.PhysicalMaximum{Max: 0},
+			}},
+		)
+	}
+	return append(items,
+		hid.UsagePage{Page: hid.UsagePageDigitizer},
+		hid.Usage{Usage: hid.UsageContactCount},
+		hid.LogicalMaximum{Max: MaxContacts},
+		hid.ReportSize{Bits: 8},
+		hid.ReportCount{Count: 1},
+		hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
+		hid.ReportID{ID: reportIDContactCountMax},
+		hid.Usage{Usage: hid.UsageContactCountMaximum},
+		hid.Feature{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
+	)
+}
+
+func defaultDescriptor() usb.Descriptor {
+	return usb.Descriptor{
+		Device: usb.DeviceDescriptor{
+			BcdUSB:             0x0200,
+			BDeviceClass:       0x00,
+			BDeviceSubClass:    0x00,
+			BDeviceProtocol:    0x00,
+			BMaxPacketSize0:    0x40, // 64 bytes
+			IDVendor:           0x2E8A,
+			IDProduct:          0x0012,
+			BcdDevice:          0x0100,
+			IManufacturer:      0x01,
+			IProduct:           0x02,
+			ISerialNumber:      0x03,
+			BNumConfigurations: 0x01,
+			Speed:              2, // Full speed
+		},
+		Interfaces: []usb.InterfaceConfig{
+			{
+				Descriptor: usb.InterfaceDescriptor{
+					BInterfaceNumber:   0x00,
+					BAlternateSetting:  0x00,
+					BNumEndpoints:      0x01,
+					BInterfaceClass:    0x03, // HID
+					BInterfaceSubClass: 0x00, // No boot interface
+					BInterfaceProtocol: 0x00,
+					IInterface:         0x00,
+				},
+				HID: &usb.HIDFunction{
+					Descriptor: usb.HIDDescriptor{
+						BcdHID:       0x0111,
+						BCountryCode: 0x00,
+						Descriptors: []usb.HIDSubDescriptor{
+							{Type: usb.ReportDescType},
+						},
+					},
+					ReportDescriptor: reportDescriptor,
+				},
+				Endpoints: []usb.EndpointDescriptor{
+					{
+						BEndpointAddress: 0x81,
+						BMAttributes:     0x03,   // Interrupt
+						WMaxPacketSize:   0x0040, // 64 bytes (62 needed)
+						BInterval:        0x01,   // 1 ms
+					},
+				},
+			},
+		},
+		Strings: map[uint8]string{
+			0: "\u0409", // LangID: en-US (0x0409)
+			1: "VIIPER",
+			2: "HID Touch Screen",
+			3: "1337",
+		},
+	}
+}
+
+func (d *Digitizer) GetDescriptor() *usb.Descriptor {
+	return &d.descriptor
+}
+
+func (d *Digitizer) GetDeviceSpecificArgs() map[string]any {
+	return map[string]any{}
+}
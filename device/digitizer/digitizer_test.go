@@ -0,0 +1,184 @@
+package digitizer_test
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/device/digitizer"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/usbip"
+	"github.com/Alia5/VIIPER/viiperclient"
+	"github.com/Alia5/VIIPER/virtualbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/Alia5/VIIPER/internal/registry" // Register devices
+)
+
+func pointerReport(buttons uint8, x, y uint16, wheel, pan int16) []byte {
+	b := []byte{0x01, buttons}
+	b = binary.LittleEndian.AppendUint16(b, x)
+	b = binary.LittleEndian.AppendUint16(b, y)
+	b = binary.LittleEndian.AppendUint16(b, uint16(wheel))
+	return binary.LittleEndian.AppendUint16(b, uint16(pan))
+}
+
+type contact struct {
+	tip  bool
+	id   uint8
+	x, y uint16
+}
+
+func touchReport(contacts ...contact) []byte {
+	b := make([]byte, 62)
+	b[0] = 0x02
+	for i, c := range contacts {
+		s := b[1+i*6:]
+		if c.tip {
+			s[0] = 0x01
+		}
+		s[1] = c.id
+		binary.LittleEndian.PutUint16(s[2:4], c.x)
+		binary.LittleEndian.PutUint16(s[4:6], c.y)
+	}
+	b[61] = uint8(len(contacts))
+	return b
+}
+
+func TestInputReports(t *testing.T) {
+	type testCase struct {
+		name           string
+		inputState     digitizer.InputState
+		expectedReport []byte
+	}
+
+	// Touch states keep the pointer where the pointer cases left it, so only
+	// touch reports are produced.
+	twoFingers := digitizer.InputState{Buttons: digitizer.ButtonLeft, X: digitizer.AxisMax, Y: digitizer.AxisMax}
+	twoFingers.SetContact(0, 100, 200)
+	twoFingers.SetContact(3, digitizer.AxisMax, 0)
+	oneFinger := twoFingers
+	oneFinger.ReleaseContact(0)
+	noFinger := oneFinger
+	noFinger.ReleaseContact(3)
+
+	cases := []testCase{
+		{
+			name:           "pointer to center",
+			inputState:     digitizer.InputState{X: 16384, Y: 16384},
+			expectedReport: pointerReport(0, 16384, 16384, 0, 0),
+		},
+		{
+			name:           "pointer to bottom right, left button",
+			inputState:     digitizer.InputState{Buttons: digitizer.ButtonLeft, X: digitizer.AxisMax, Y: digitizer.AxisMax},
+			expectedReport: pointerReport(digitizer.ButtonLeft, digitizer.AxisMax, digitizer.AxisMax, 0, 0),
+		},
+		{
+			name:           "wheel",
+			inputState:     digitizer.InputState{Buttons: digitizer.ButtonLeft, X: digitizer.AxisMax, Y: digitizer.AxisMax, Wheel: -1},
+			expectedReport: pointerReport(digitizer.ButtonLeft, digitizer.AxisMax, digitizer.AxisMax, -1, 0),
+		},
+		{
+			name:       "two contacts",
+			inputState: twoFingers,
+			expectedReport: touchReport(
+				contact{tip: true, id: 0, x: 100, y: 200},
+				contact{tip: true, id: 3, x: digitizer.AxisMax, y: 0},
+			),
+		},
+		{
+			name:       "contact 0 lifted",
+			inputState: oneFinger,
+			expectedReport: touchReport(
+				contact{tip: false, id: 0, x: 100, y: 200},
+				contact{tip: true, id: 3, x: digitizer.AxisMax, y: 0},
+			),
+		},
+		{
+			name:           "all lifted",
+			inputState:     noFinger,
+			expectedReport: touchReport(contact{tip: false, id: 3, x: digitizer.AxisMax, y: 0}),
+		},
+	}
+
+	s := viiperTesting.NewTestServer(t)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+
+	r := s.ApiServer.Router()
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	r.RegisterStream("bus/{busId}/{deviceid}", api.DeviceStreamHandler(s.UsbServer))
+	require.NoError(t, s.ApiServer.Start())
+
+	b, err := virtualbus.NewWithBusID(1)
+	require.NoError(t, err)
+	defer b.Close() //nolint:errcheck
+	_ = s.UsbServer.AddBus(b)
+
+	client := viiperclient.New(s.ApiServer.Addr())
+	stream, _, err := client.AddDeviceAndConnect(context.Background(), b.BusID(), "digitizer", nil)
+	require.NoError(t, err)
+	defer stream.Close() //nolint:errcheck
+
+	usbipClient := viiperTesting.NewUsbIpClient(t, s.UsbServer.Addr())
+	devs, err := usbipClient.ListDevices()
+	require.NoError(t, err)
+	require.Len(t, devs, 1)
+	imp, err := usbipClient.AttachDevice(devs[0].BusID)
+	require.NoError(t, err)
+	defer imp.Conn.Close() //nolint:errcheck
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if !assert.NoError(t, stream.WriteBinary(&tc.inputState)) {
+				return
+			}
+			got, err := usbipClient.ReadInputReportWithTimeout(imp.Conn, 750*time.Millisecond)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tc.expectedReport, got)
+		})
+	}
+}
+
+func TestReportsBuiltOnPoll(t *testing.T) {
+	d, err := digitizer.New(nil)
+	require.NoError(t, err)
+	poll := func() []byte {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		return d.HandleTransfer(ctx, 1, usbip.DirIn, nil)
+	}
+
+	// Wheel deltas add up, the latest position wins.
+	d.UpdateInputState(digitizer.InputState{X: 1, Wheel: 2})
+	d.UpdateInputState(digitizer.InputState{X: 5, Wheel: 3, Pan: -1})
+	assert.Equal(t, pointerReport(0, 5, 0, 5, -1), poll())
+	assert.Nil(t, poll(), "deltas are reported once")
+
+	// A contact touching and lifting between polls is still reported lifted.
+	touched := digitizer.InputState{X: 5}
+	touched.SetContact(1, 10, 20)
+	d.UpdateInputState(touched)
+	assert.Equal(t, touchReport(contact{tip: true, id: 1, x: 10, y: 20}), poll())
+	moved := touched
+	moved.SetContact(1, 30, 40)
+	d.UpdateInputState(moved)
+	moved.ReleaseContact(1)
+	d.UpdateInputState(moved)
+	assert.Equal(t, touchReport(contact{tip: false, id: 1, x: 30, y: 40}), poll())
+	assert.Nil(t, poll())
+}
+
+func TestContactCountMaximum(t *testing.T) {
+	d, err := digitizer.New(nil)
+	require.NoError(t, err)
+	got, ok := d.HandleControl(0xA1, 0x01, 0x0303, 0, 2, nil)
+	assert.True(t, ok)
+	assert.Equal(t, []byte{0x03, digitizer.MaxContacts}, got)
+}
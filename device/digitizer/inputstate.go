@@ -0,0 +1,136 @@
+package digitizer
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// InputState represents the pointer and touch state used to build reports.
+// viiper:wire digitizer c2s buttons:u8 x:u16 y:u16 wheel:i16 pan:i16 touch:u16 touchX:u16*10 touchY:u16*10
+type InputState struct {
+	// Button bitfield: bit 0=Left, 1=Right, 2=Middle, 3=Back, 4=Forward
+	Buttons uint8 `json:"buttons"`
+	// Absolute pointer position: 0-32767
+	X uint16 `json:"x"`
+	Y uint16 `json:"y"`
+	// Wheel: signed 16-bit vertical scroll, relative
+	Wheel int16 `json:"wheel"`
+	// Pan: signed 16-bit horizontal scroll, relative
+	Pan int16 `json:"pan"`
+	// Touch: bit n set while contact n touches the screen
+	Touch uint16 `json:"touch"`
+	// Contact positions: 0-32767
+	TouchX [MaxContacts]uint16 `json:"touchX"`
+	TouchY [MaxContacts]uint16 `json:"touchY"`
+}
+
+// NewInputState returns an input state without pressed buttons and contacts.
+func NewInputState() *InputState { return &InputState{} }
+
+// SetContact marks contact i as touching at x/y.
+func (s *InputState) SetContact(i int, x, y uint16) {
+	if i < 0 || i >= MaxContacts {
+		return
+	}
+	s.Touch |= 1 << i
+	s.TouchX[i] = x
+	s.TouchY[i] = y
+}
+
+// ReleaseContact lifts contact i.
+func (s *InputState) ReleaseContact(i int) {
+	if i < 0 || i >= MaxContacts {
+		return
+	}
+	s.Touch &^= 1 << i
+}
+
+// BuildPointerReport encodes the pointer part of an InputState.
+//
+// Report layout (10 bytes):
+//
+//	Byte 0: Report ID (0x01)
+//	Byte 1: Button bitfield (bits 5-7=padding)
+//	Bytes 2-3: X (uint16 little-endian, 0 to 32767)
+//	Bytes 4-5: Y (uint16 little-endian, 0 to 32767)
+//	Bytes 6-7: Wheel (int16 little-endian)
+//	Bytes 8-9: Pan (int16 little-endian)
+func (s *InputState) BuildPointerReport() []byte {
+	b := make([]byte, pointerReportSize)
+	b[0] = reportIDPointer
+	b[1] = s.Buttons & 0x1F
+	binary.LittleEndian.PutUint16(b[2:4], min(s.X, AxisMax))
+	binary.LittleEndian.PutUint16(b[4:6], min(s.Y, AxisMax))
+	binary.LittleEndian.PutUint16(b[6:8], uint16(s.Wheel))
+	binary.LittleEndian.PutUint16(b[8:10], uint16(s.Pan))
+	return b
+}
+
+// BuildTouchReport encodes the contacts in mask, with their tip switch taken
+// from s.Touch. Contacts in mask but not in s.Touch are reported as lifted.
+//
+// Report layout (62 bytes):
+//
+//	Byte 0: Report ID (0x02)
+//	Then 10 contact slots of 6 bytes, used slots first:
+//	  Byte 0: Tip switch (bit 0)
+//	  Byte 1: Contact ID (0-9)
+//	  Bytes 2-3: X (uint16 little-endian, 0 to 32767)
+//	  Bytes 4-5: Y (uint16 little-endian, 0 to 32767)
+//	Byte 61: Contact count (number of used slots)
+func (s *InputState) BuildTouchReport(mask uint16) []byte {
+	b := make([]byte, touchReportSize)
+	b[0] = reportIDTouch
+	n := 0
+	for i := range MaxContacts {
+		if mask&(1<<i) == 0 {
+			continue
+		}
+		c := b[1+n*contactSize:]
+		if s.Touch&(1<<i) != 0 {
+			c[0] = 0x01
+		}
+		c[1] = uint8(i)
+		binary.LittleEndian.PutUint16(c[2:4], min(s.TouchX[i], AxisMax))
+		binary.LittleEndian.PutUint16(c[4:6], min(s.TouchY[i], AxisMax))
+		n++
+	}
+	b[touchReportSize-1] = uint8(n)
+	return b
+}
+
+// MarshalBinary encodes InputState to 51 bytes.
+func (s *InputState) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 11, 51)
+	b[0] = s.Buttons
+	binary.LittleEndian.PutUint16(b[1:3], s.X)
+	binary.LittleEndian.PutUint16(b[3:5], s.Y)
+	binary.LittleEndian.PutUint16(b[5:7], uint16(s.Wheel))
+	binary.LittleEndian.PutUint16(b[7:9], uint16(s.Pan))
+	binary.LittleEndian.PutUint16(b[9:11], s.Touch)
+	for _, v := range s.TouchX {
+		b = binary.LittleEndian.AppendUint16(b, v)
+	}
+	for _, v := range s.TouchY {
+		b = binary.LittleEndian.AppendUint16(b, v)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes 51 bytes into InputState.
+func (s *InputState) UnmarshalBinary(data []byte) error {
+	if len(data) < 51 {
+		return io.ErrUnexpectedEOF
+	}
+	s.Buttons = data[0]
+	s.X = binary.LittleEndian.Uint16(data[1:3])
+	s.Y = binary.LittleEndian.Uint16(data[3:5])
+	s.Wheel = int16(binary.LittleEndian.Uint16(data[5:7]))
+	s.Pan = int16(binary.LittleEndian.Uint16(data[7:9]))
+	s.Touch = binary.LittleEndian.Uint16(data[9:11])
+	for i := range MaxContacts {
+		s.TouchX[i] = binary.LittleEndian.Uint16(data[11+2*i:])
+		s.TouchY[i] = binary.LittleEndian.Uint16(data[31+2*i:])
+	}
+	return nil
+}
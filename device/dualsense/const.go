@@ -42,7 +42,7 @@ const (
 	InputReportSize  = 64
 	OutputReportSize = 64
 	InputStateSize   = 33
-	OutputStateSize  = 6
+	OutputStateSize  = 41
 )
 
 const (
@@ -91,6 +91,70 @@ const (
 
 const DPadMask uint8 = 0x0F
 
+// Valid flags of the output report, telling which of its sections the host
+// wants applied. See OutputState.ValidFlag0/1/2.
+const (
+	OutputFlag0CompatibleVibration uint8 = 0x01
+	OutputFlag0HapticsSelect       uint8 = 0x02
+	OutputFlag0RightTriggerEffect  uint8 = 0x04
+	OutputFlag0LeftTriggerEffect   uint8 = 0x08
+	OutputFlag0HeadphoneVolume     uint8 = 0x10
+	OutputFlag0SpeakerVolume       uint8 = 0x20
+	OutputFlag0MicVolume           uint8 = 0x40
+	OutputFlag0AudioControl        uint8 = 0x80
+
+	OutputFlag1MicMuteLED      uint8 = 0x01
+	OutputFlag1PowerSave       uint8 = 0x02
+	OutputFlag1Lightbar        uint8 = 0x04
+	OutputFlag1ReleaseLEDs     uint8 = 0x08
+	OutputFlag1PlayerIndicator uint8 = 0x10
+	OutputFlag1HapticLowPass   uint8 = 0x20
+	OutputFlag1MotorPower      uint8 = 0x40
+	OutputFlag1AudioControl2   uint8 = 0x80
+
+	OutputFlag2LightbarSetup        uint8 = 0x02
+	OutputFlag2CompatibleVibration2 uint8 = 0x04
+)
+
+// Adaptive trigger effect modes (first byte of a trigger effect block).
+// The meaning of the 10 parameter bytes depends on the mode.
+const (
+	TriggerModeOff             uint8 = 0x05
+	TriggerModeSimpleFeedback  uint8 = 0x01
+	TriggerModeSimpleWeapon    uint8 = 0x02
+	TriggerModeSimpleVibration uint8 = 0x06
+	TriggerModeLimitedFeedback uint8 = 0x11
+	TriggerModeLimitedWeapon   uint8 = 0x12
+	TriggerModeFeedback        uint8 = 0x21
+	TriggerModeBow             uint8 = 0x22
+	TriggerModeGalloping       uint8 = 0x23
+	TriggerModeWeapon          uint8 = 0x25
+	TriggerModeVibration       uint8 = 0x26
+	TriggerModeMachine         uint8 = 0x27
+)
+
+// TriggerEffectParams is the number of parameter bytes of a trigger effect.
+const TriggerEffectParams = 10
+
+// Mute LED modes.
+const (
+	MuteLEDOff   uint8 = 0x00
+	MuteLEDOn    uint8 = 0x01
+	MuteLEDPulse uint8 = 0x02
+)
+
+// Power save control bits.
+const (
+	PowerSaveDisableTouch   uint8 = 0x01
+	PowerSaveDisableMotion  uint8 = 0x02
+	PowerSaveDisableHaptics uint8 = 0x04
+	PowerSaveDisableAudio   uint8 = 0x08
+	PowerSaveMicMute        uint8 = 0x10
+	PowerSaveSpeakerMute    uint8 = 0x20
+	PowerSaveHeadphoneMute  uint8 = 0x40
+	PowerSaveHapticMute     uint8 = 0x80
+)
+
 // Gyro/Accel scale factors matching the USB report domain.
 //
 //	Gyro: BMI323 ±2000 dps passthrough = 16.384 LSB/dps
@@ -22,14 +22,17 @@ type DualSense struct {
 	inputState *InputState
 	metaState  *MetaState
 
-	outputFunc func(OutputState)
-	descriptor usb.Descriptor
+	outputFunc  func(OutputState)
+	outputState *OutputState
+	descriptor  usb.Descriptor
 
 	subcommand [2]byte
 
 	seqCounter    uint8
 	timestampBase time.Time
 
+	edge bool
+
 	mtx sync.Mutex
 }
 
@@ -89,6 +92,7 @@ func new(o *device.CreateOptions, edge bool) (*DualSense, error) {
 	d := &DualSense{
 		descriptor: defaultDescriptor,
 		metaState:  metaState,
+		edge:       edge,
 	}
 	d.descriptor.Device.IDProduct = DefaultPIDDS
 	if edge {
@@ -126,6 +130,8 @@ func (d *DualSense) SetMetaState(meta MetaState) {
 }
 
 func (d *DualSense) SetOutputCallback(f func(OutputState)) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
 	d.outputFunc = f
 }
 
@@ -140,10 +146,23 @@ func (d *DualSense) UpdateInputState(state *InputState) {
 	d.inputCh <- state
 }
 
+// ResetInputState releases all inputs, see usb.NeutralStateDevice.
+func (d *DualSense) ResetInputState() {
+	d.UpdateInputState(NewInputState())
+}
+
 func (d *DualSense) GetDescriptor() *usb.Descriptor {
 	return &d.descriptor
 }
 
+// DeviceType returns the registered device type name ("dualsense" or "dualsenseedge").
+func (d *DualSense) DeviceType() string {
+	if d.edge {
+		return "dualsenseedge"
+	}
+	return "dualsense"
+}
+
 func (d *DualSense) GetDeviceSpecificArgs() map[string]any {
 	var res map[string]any
 	d.mtx.Lock()
@@ -187,9 +206,7 @@ func (d *DualSense) HandleTransfer(ctx context.Context, ep uint32, dir uint32, o
 
 	if dir == usbip.DirOut && ep == 3 {
 		if len(out) >= 48 && out[0] == ReportIDOutput {
-			if d.outputFunc != nil {
-				d.outputFunc(parseOutputReport(out))
-			}
+			d.handleOutputReport(out)
 		}
 	}
 
@@ -239,9 +256,7 @@ func (d *DualSense) HandleControl(bmRequestType, bRequest uint8, wValue, wIndex,
 			case reportType == reportTypeFeature:
 				return nil, true
 			case reportType == reportTypeOutput && reportID == ReportIDOutput && len(data) >= 48:
-				if d.outputFunc != nil {
-					d.outputFunc(parseOutputReport(data))
-				}
+				d.handleOutputReport(data)
 				return nil, true
 			}
 		}
@@ -266,21 +281,88 @@ var featureGetHandlers = map[byte]func(*DualSense) []byte{
 	featureIDCommandResponse: (*DualSense).featureReportCommandResponse,
 }
 
+// GetInputState returns the current input state.
+func (d *DualSense) GetInputState() any {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return *d.inputState
+}
+
+// GetOutputState returns the last output report sent by the host, or nil if
+// none arrived yet.
+func (d *DualSense) GetOutputState() any {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.outputState == nil {
+		return nil
+	}
+	return *d.outputState
+}
+
+func (d *DualSense) handleOutputReport(report []byte) {
+	out := parseOutputReport(report)
+	d.mtx.Lock()
+	d.outputState = &out
+	f := d.outputFunc
+	d.mtx.Unlock()
+	if f != nil {
+		f(out)
+	}
+}
+
+// parseOutputReport decodes a USB output report (report ID included, at least
+// 48 bytes).
+//
+// Layout:
+//
+//	Byte 0: Report ID (0x02)
+//	Byte 1-2: Valid flags 0, 1
+//	Byte 3-4: Rumble right (small), left (large) motor
+//	Byte 5-8: Headphone, speaker, mic volume, audio control
+//	Byte 9: Mute LED
+//	Byte 10: Power save control
+//	Byte 11-21: Right trigger effect (mode + 10 parameter bytes)
+//	Byte 22-32: Left trigger effect
+//	Byte 33-36: Reserved
+//	Byte 37: Motor power reduction
+//	Byte 38: Audio control 2
+//	Byte 39: Valid flags 2
+//	Byte 42: Lightbar setup
+//	Byte 43: LED brightness
+//	Byte 44: Player LEDs
+//	Byte 45-47: Lightbar RGB
 func parseOutputReport(out []byte) OutputState {
 	feedback := OutputState{
 		RumbleSmall: out[3],
 		RumbleLarge: out[4],
+		ValidFlag0:  out[1],
+		ValidFlag1:  out[2],
+		ValidFlag2:  out[39],
+
+		HeadphoneVolume: out[5],
+		SpeakerVolume:   out[6],
+		MicVolume:       out[7],
+		AudioControl:    out[8],
+		MuteLed:         out[9],
+		PowerSave:       out[10],
+
+		RightTriggerMode: out[11],
+		LeftTriggerMode:  out[22],
+
+		MotorPower:    out[37],
+		AudioControl2: out[38],
+		LightbarSetup: out[42],
+		LedBrightness: out[43],
 	}
-	if len(out) > 2 {
-		flag1 := out[2]
-		if flag1&0x04 != 0 && len(out) > 47 {
-			feedback.LedRed = out[45]
-			feedback.LedGreen = out[46]
-			feedback.LedBlue = out[47]
-		}
-		if flag1&0x10 != 0 && len(out) > 44 {
-			feedback.PlayerLeds = out[44]
-		}
+	copy(feedback.RightTriggerParams[:], out[12:22])
+	copy(feedback.LeftTriggerParams[:], out[23:33])
+	if feedback.ValidFlag1&OutputFlag1Lightbar != 0 {
+		feedback.LedRed = out[45]
+		feedback.LedGreen = out[46]
+		feedback.LedBlue = out[47]
+	}
+	if feedback.ValidFlag1&OutputFlag1PlayerIndicator != 0 {
+		feedback.PlayerLeds = out[44]
 	}
 	return feedback
 }
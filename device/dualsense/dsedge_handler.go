@@ -135,6 +135,7 @@ func (h *dsedgehandler) StreamHandler() api.StreamHandlerFunc {
 				return fmt.Errorf("unmarshal input state: %w", err)
 			}
 			dse.UpdateInputState(&state)
+			api.RecordFrame(conn, buf)
 		}
 	}
 }
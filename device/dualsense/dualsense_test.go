@@ -0,0 +1,175 @@
+package dualsense_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/device/dualsense"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/usbip"
+	"github.com/Alia5/VIIPER/viiperclient"
+	"github.com/Alia5/VIIPER/virtualbus"
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/Alia5/VIIPER/internal/registry" // Register devices
+)
+
+func TestFeedback(t *testing.T) {
+	type testCase struct {
+		name        string
+		outputState dualsense.OutputState
+		outPacket   []byte
+	}
+
+	report := func(set func(b []byte)) []byte {
+		b := make([]byte, 48)
+		b[0] = dualsense.ReportIDOutput
+		set(b)
+		return b
+	}
+
+	cases := []testCase{
+		{
+			name:        "off",
+			outputState: dualsense.OutputState{},
+			outPacket:   report(func(b []byte) {}),
+		},
+		{
+			name: "rumble + lightbar + player leds",
+			outputState: dualsense.OutputState{
+				RumbleSmall: 0x12,
+				RumbleLarge: 0xFE,
+				LedRed:      0x01,
+				LedGreen:    0x02,
+				LedBlue:     0x03,
+				PlayerLeds:  0x04,
+				ValidFlag0:  dualsense.OutputFlag0CompatibleVibration | dualsense.OutputFlag0HapticsSelect,
+				ValidFlag1:  dualsense.OutputFlag1Lightbar | dualsense.OutputFlag1PlayerIndicator,
+			},
+			outPacket: report(func(b []byte) {
+				b[1] = dualsense.OutputFlag0CompatibleVibration | dualsense.OutputFlag0HapticsSelect
+				b[2] = dualsense.OutputFlag1Lightbar | dualsense.OutputFlag1PlayerIndicator
+				b[3], b[4] = 0x12, 0xFE
+				b[44] = 0x04
+				b[45], b[46], b[47] = 0x01, 0x02, 0x03
+			}),
+		},
+		{
+			name: "lightbar ignored without valid flag",
+			outputState: dualsense.OutputState{
+				LedBrightness: 0x02,
+			},
+			outPacket: report(func(b []byte) {
+				b[43] = 0x02
+				b[44] = 0x04
+				b[45], b[46], b[47] = 0x01, 0x02, 0x03
+			}),
+		},
+		{
+			name: "adaptive triggers + mute led + audio + power save",
+			outputState: dualsense.OutputState{
+				ValidFlag0: dualsense.OutputFlag0RightTriggerEffect | dualsense.OutputFlag0LeftTriggerEffect |
+					dualsense.OutputFlag0HeadphoneVolume | dualsense.OutputFlag0SpeakerVolume | dualsense.OutputFlag0MicVolume,
+				ValidFlag1:         dualsense.OutputFlag1MicMuteLED | dualsense.OutputFlag1PowerSave | dualsense.OutputFlag1MotorPower,
+				ValidFlag2:         dualsense.OutputFlag2LightbarSetup,
+				RightTriggerMode:   dualsense.TriggerModeWeapon,
+				RightTriggerParams: [10]byte{0x04, 0x00, 0x08, 0, 0, 0, 0, 0, 0, 0},
+				LeftTriggerMode:    dualsense.TriggerModeFeedback,
+				LeftTriggerParams:  [10]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				MuteLed:            dualsense.MuteLEDPulse,
+				PowerSave:          dualsense.PowerSaveMicMute,
+				HeadphoneVolume:    0x7C,
+				SpeakerVolume:      0x60,
+				MicVolume:          0x40,
+				AudioControl:       0x08,
+				AudioControl2:      0x01,
+				MotorPower:         0x23,
+				LightbarSetup:      0x02,
+			},
+			outPacket: report(func(b []byte) {
+				b[1] = 0x04 | 0x08 | 0x10 | 0x20 | 0x40
+				b[2] = 0x01 | 0x02 | 0x40
+				b[5], b[6], b[7], b[8] = 0x7C, 0x60, 0x40, 0x08
+				b[9] = 0x02
+				b[10] = 0x10
+				b[11] = 0x25
+				b[12], b[14] = 0x04, 0x08
+				b[22] = 0x21
+				copy(b[23:33], []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+				b[37] = 0x23
+				b[38] = 0x01
+				b[39] = 0x02
+				b[42] = 0x02
+			}),
+		},
+	}
+
+	s := viiperTesting.NewTestServer(t)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+
+	r := s.ApiServer.Router()
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	r.RegisterStream("bus/{busId}/{deviceid}", api.DeviceStreamHandler(s.UsbServer))
+
+	if err := s.ApiServer.Start(); err != nil {
+		t.Fatalf("Failed to start API server: %v", err)
+	}
+
+	b, err := virtualbus.NewWithBusID(1)
+	if err != nil {
+		t.Fatalf("Failed to create virtual bus: %v", err)
+	}
+	defer b.Close() //nolint:errcheck
+	_ = s.UsbServer.AddBus(b)
+
+	client := viiperclient.New(s.ApiServer.Addr())
+	stream, _, err := client.AddDeviceAndConnect(context.Background(), b.BusID(), "dualsense", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stream.Close() //nolint:errcheck
+
+	usbipClient := viiperTesting.NewUsbIpClient(t, s.UsbServer.Addr())
+	devs, err := usbipClient.ListDevices()
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.Len(t, devs, 1) {
+		return
+	}
+	imp, err := usbipClient.AttachDevice(devs[0].BusID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if imp != nil && imp.Conn != nil {
+		defer imp.Conn.Close() //nolint:errcheck
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if !assert.NoError(t, usbipClient.Submit(imp.Conn, usbip.DirOut, 3, tc.outPacket, nil)) {
+				return
+			}
+			var buf [dualsense.OutputStateSize]byte
+			_ = stream.SetReadDeadline(time.Now().Add(750 * time.Millisecond))
+			_, err := io.ReadFull(stream, buf[:])
+			if !assert.NoError(t, err) {
+				return
+			}
+			got := dualsense.OutputState{}
+			if !assert.NoError(t, got.UnmarshalBinary(buf[:])) {
+				return
+			}
+			assert.Equal(t, tc.outputState, got)
+
+			again, err := got.MarshalBinary()
+			assert.NoError(t, err)
+			assert.Equal(t, buf[:], again)
+		})
+	}
+}
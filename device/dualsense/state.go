@@ -11,19 +11,28 @@ import (
 // nolint
 // viiper:wire dualsense c2s stickLX:i8 stickLY:i8 stickRX:i8 stickRY:i8 buttons:u32 dpad:u8 triggerL2:u8 triggerR2:u8 touch1X:u16 touch1Y:u16 touch1Active:bool touch2X:u16 touch2Y:u16 touch2Active:bool gyroX:i16 gyroY:i16 gyroZ:i16 accelX:i16 accelY:i16 accelZ:i16
 type InputState struct {
-	LX, LY  int8
-	RX, RY  int8
-	Buttons uint32
-	DPad    uint8
-	L2, R2  uint8
-
-	Touch1X, Touch1Y uint16
-	Touch1Active     bool
-	Touch2X, Touch2Y uint16
-	Touch2Active     bool
-
-	GyroX, GyroY, GyroZ    int16
-	AccelX, AccelY, AccelZ int16
+	LX      int8   `json:"stickLX"`
+	LY      int8   `json:"stickLY"`
+	RX      int8   `json:"stickRX"`
+	RY      int8   `json:"stickRY"`
+	Buttons uint32 `json:"buttons"`
+	DPad    uint8  `json:"dpad"`
+	L2      uint8  `json:"triggerL2"`
+	R2      uint8  `json:"triggerR2"`
+
+	Touch1X      uint16 `json:"touch1X"`
+	Touch1Y      uint16 `json:"touch1Y"`
+	Touch1Active bool   `json:"touch1Active"`
+	Touch2X      uint16 `json:"touch2X"`
+	Touch2Y      uint16 `json:"touch2Y"`
+	Touch2Active bool   `json:"touch2Active"`
+
+	GyroX  int16 `json:"gyroX"`
+	GyroY  int16 `json:"gyroY"`
+	GyroZ  int16 `json:"gyroZ"`
+	AccelX int16 `json:"accelX"`
+	AccelY int16 `json:"accelY"`
+	AccelZ int16 `json:"accelZ"`
 }
 
 // NewInputState returns a DualSense input state in its neutral/resting state.
@@ -92,26 +101,77 @@ func (s *InputState) UnmarshalBinary(data []byte) error {
 	return nil
 }
 
+// OutputState is the decoded output report sent by the host.
+// The first six fields keep the layout of the original feedback packet,
+// the remaining fields carry the rest of the report: valid flags, adaptive
+// trigger effects, mute LED, audio volumes, power save and motor power.
+// The lightbar color (LedRed/Green/Blue) and PlayerLeds are only set if their
+// valid flag is set, as in the original feedback packet. All other sections
+// are decoded regardless of their valid flag; check ValidFlag0/1/2
+// (OutputFlag* constants) to tell which ones the host wants applied.
+//
 // nolint
-// viiper:wire dualsense s2c rumbleSmall:u8 rumbleLarge:u8 ledRed:u8 ledGreen:u8 ledBlue:u8 playerLeds:u8
+// viiper:wire dualsense s2c rumbleSmall:u8 rumbleLarge:u8 ledRed:u8 ledGreen:u8 ledBlue:u8 playerLeds:u8 validFlag0:u8 validFlag1:u8 validFlag2:u8 rightTriggerMode:u8 rightTriggerParams:u8*10 leftTriggerMode:u8 leftTriggerParams:u8*10 muteLed:u8 powerSave:u8 headphoneVolume:u8 speakerVolume:u8 micVolume:u8 audioControl:u8 audioControl2:u8 motorPower:u8 ledBrightness:u8 lightbarSetup:u8
 type OutputState struct {
-	RumbleSmall uint8
-	RumbleLarge uint8
-	LedRed      uint8
-	LedGreen    uint8
-	LedBlue     uint8
-	PlayerLeds  uint8
+	RumbleSmall uint8 `json:"rumbleSmall"`
+	RumbleLarge uint8 `json:"rumbleLarge"`
+	LedRed      uint8 `json:"ledRed"`
+	LedGreen    uint8 `json:"ledGreen"`
+	LedBlue     uint8 `json:"ledBlue"`
+	PlayerLeds  uint8 `json:"playerLeds"`
+
+	ValidFlag0 uint8 `json:"validFlag0"`
+	ValidFlag1 uint8 `json:"validFlag1"`
+	ValidFlag2 uint8 `json:"validFlag2"`
+
+	// Adaptive trigger effects: TriggerMode* and mode specific parameters.
+	RightTriggerMode   uint8                     `json:"rightTriggerMode"`
+	RightTriggerParams [TriggerEffectParams]byte `json:"rightTriggerParams"`
+	LeftTriggerMode    uint8                     `json:"leftTriggerMode"`
+	LeftTriggerParams  [TriggerEffectParams]byte `json:"leftTriggerParams"`
+
+	MuteLed         uint8 `json:"muteLed"`   // MuteLED* mode
+	PowerSave       uint8 `json:"powerSave"` // PowerSave* bits
+	HeadphoneVolume uint8 `json:"headphoneVolume"`
+	SpeakerVolume   uint8 `json:"speakerVolume"`
+	MicVolume       uint8 `json:"micVolume"`
+	AudioControl    uint8 `json:"audioControl"`
+	AudioControl2   uint8 `json:"audioControl2"`
+	MotorPower      uint8 `json:"motorPower"` // low nibble: rumble reduction, high nibble: trigger reduction
+	LedBrightness   uint8 `json:"ledBrightness"`
+	LightbarSetup   uint8 `json:"lightbarSetup"`
 }
 
 func (f *OutputState) MarshalBinary() ([]byte, error) {
-	return []byte{
+	b := make([]byte, 0, OutputStateSize)
+	b = append(b,
 		f.RumbleSmall,
 		f.RumbleLarge,
 		f.LedRed,
 		f.LedGreen,
 		f.LedBlue,
 		f.PlayerLeds,
-	}, nil
+		f.ValidFlag0,
+		f.ValidFlag1,
+		f.ValidFlag2,
+		f.RightTriggerMode,
+	)
+	b = append(b, f.RightTriggerParams[:]...)
+	b = append(b, f.LeftTriggerMode)
+	b = append(b, f.LeftTriggerParams[:]...)
+	b = append(b,
+		f.MuteLed,
+		f.PowerSave,
+		f.HeadphoneVolume,
+		f.SpeakerVolume,
+		f.MicVolume,
+		f.AudioControl,
+		f.AudioControl2,
+		f.MotorPower,
+		f.LedBrightness,
+		f.LightbarSetup,
+	)
+	return b, nil
 }
 
 func (f *OutputState) UnmarshalBinary(data []byte) error {
@@ -124,6 +184,23 @@ func (f *OutputState) UnmarshalBinary(data []byte) error {
 	f.LedGreen = data[3]
 	f.LedBlue = data[4]
 	f.PlayerLeds = data[5]
+	f.ValidFlag0 = data[6]
+	f.ValidFlag1 = data[7]
+	f.ValidFlag2 = data[8]
+	f.RightTriggerMode = data[9]
+	copy(f.RightTriggerParams[:], data[10:20])
+	f.LeftTriggerMode = data[20]
+	copy(f.LeftTriggerParams[:], data[21:31])
+	f.MuteLed = data[31]
+	f.PowerSave = data[32]
+	f.HeadphoneVolume = data[33]
+	f.SpeakerVolume = data[34]
+	f.MicVolume = data[35]
+	f.AudioControl = data[36]
+	f.AudioControl2 = data[37]
+	f.MotorPower = data[38]
+	f.LedBrightness = data[39]
+	f.LightbarSetup = data[40]
 	return nil
 }
 
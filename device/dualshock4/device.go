@@ -21,8 +21,9 @@ type DualShock4 struct {
 	inputState *InputState
 	metaState  *MetaState
 
-	outputFunc func(OutputState)
-	descriptor usb.Descriptor
+	outputFunc  func(OutputState)
+	outputState *OutputState
+	descriptor  usb.Descriptor
 
 	probeSelector       [3]byte
 	telemetrySubcommand byte
@@ -104,6 +105,8 @@ func (d *DualShock4) SetMetaState(meta MetaState) {
 }
 
 func (d *DualShock4) SetOutputCallback(f func(OutputState)) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
 	d.outputFunc = f
 }
 
@@ -118,6 +121,11 @@ func (d *DualShock4) UpdateInputState(state *InputState) {
 	d.inputCh <- state
 }
 
+// ResetInputState releases all inputs, see usb.NeutralStateDevice.
+func (d *DualShock4) ResetInputState() {
+	d.UpdateInputState(NewInputState())
+}
+
 func (d *DualShock4) GetDescriptor() *usb.Descriptor {
 	return &d.descriptor
 }
@@ -165,9 +173,7 @@ func (d *DualShock4) HandleTransfer(ctx context.Context, ep uint32, dir uint32,
 
 	if dir == usbip.DirOut && ep == 3 {
 		if len(out) >= 11 && out[0] == ReportIDOutput {
-			if d.outputFunc != nil {
-				d.outputFunc(parseOutputReport(out))
-			}
+			d.handleOutputReport(out)
 		}
 	}
 
@@ -227,9 +233,7 @@ func (d *DualShock4) HandleControl(bmRequestType, bRequest uint8, wValue, wIndex
 				}
 				return nil, true
 			case reportType == reportTypeOutput && reportID == ReportIDOutput && len(data) >= 11:
-				if d.outputFunc != nil {
-					d.outputFunc(parseOutputReport(data))
-				}
+				d.handleOutputReport(data)
 				return nil, true
 			}
 		}
@@ -260,6 +264,35 @@ var featureGetHandlers = map[byte]func(*DualShock4) []byte{
 	featureIDBoardInfo:     (*DualShock4).featureReportBoardInfo,
 }
 
+// GetInputState returns the current input state.
+func (d *DualShock4) GetInputState() any {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return *d.inputState
+}
+
+// GetOutputState returns the last output report sent by the host, or nil if
+// none arrived yet.
+func (d *DualShock4) GetOutputState() any {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.outputState == nil {
+		return nil
+	}
+	return *d.outputState
+}
+
+func (d *DualShock4) handleOutputReport(report []byte) {
+	out := parseOutputReport(report)
+	d.mtx.Lock()
+	d.outputState = &out
+	f := d.outputFunc
+	d.mtx.Unlock()
+	if f != nil {
+		f(out)
+	}
+}
+
 func parseOutputReport(data []byte) OutputState {
 	return OutputState{
 		RumbleSmall: data[4],
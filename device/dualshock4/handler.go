@@ -100,6 +100,7 @@ func (h *handler) StreamHandler() api.StreamHandlerFunc {
 				return fmt.Errorf("unmarshal input state: %w", err)
 			}
 			ds4.UpdateInputState(&state)
+			api.RecordFrame(conn, buf)
 		}
 	}
 }
@@ -109,9 +110,10 @@ func (h *handler) UpdateMetaState(meta string, dev *usb.Device) error {
 	if !ok {
 		return fmt.Errorf("%w: expected DualShock4", device.ErrWrongDeviceType)
 	}
-	var metaState MetaState
-	err := json.Unmarshal([]byte(meta), &metaState)
-	if err != nil {
+	ds4.mtx.Lock()
+	metaState := *ds4.metaState
+	ds4.mtx.Unlock()
+	if err := json.Unmarshal([]byte(meta), &metaState); err != nil {
 		return fmt.Errorf("unmarshal meta state: %w", err)
 	}
 	ds4.SetMetaState(metaState)
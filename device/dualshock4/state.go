@@ -11,19 +11,28 @@ import (
 // nolint
 // viiper:wire dualshock4 c2s stickLX:i8 stickLY:i8 stickRX:i8 stickRY:i8 buttons:u16 dpad:u8 triggerL2:u8 triggerR2:u8 touch1X:u16 touch1Y:u16 touch1Active:bool touch2X:u16 touch2Y:u16 touch2Active:bool gyroX:i16 gyroY:i16 gyroZ:i16 accelX:i16 accelY:i16 accelZ:i16
 type InputState struct {
-	LX, LY  int8
-	RX, RY  int8
-	Buttons uint16
-	DPad    uint8
-	L2, R2  uint8
+	LX      int8   `json:"stickLX"`
+	LY      int8   `json:"stickLY"`
+	RX      int8   `json:"stickRX"`
+	RY      int8   `json:"stickRY"`
+	Buttons uint16 `json:"buttons"`
+	DPad    uint8  `json:"dpad"`
+	L2      uint8  `json:"triggerL2"`
+	R2      uint8  `json:"triggerR2"`
 
-	Touch1X, Touch1Y uint16
-	Touch1Active     bool
-	Touch2X, Touch2Y uint16
-	Touch2Active     bool
+	Touch1X      uint16 `json:"touch1X"`
+	Touch1Y      uint16 `json:"touch1Y"`
+	Touch1Active bool   `json:"touch1Active"`
+	Touch2X      uint16 `json:"touch2X"`
+	Touch2Y      uint16 `json:"touch2Y"`
+	Touch2Active bool   `json:"touch2Active"`
 
-	GyroX, GyroY, GyroZ    int16
-	AccelX, AccelY, AccelZ int16
+	GyroX  int16 `json:"gyroX"`
+	GyroY  int16 `json:"gyroY"`
+	GyroZ  int16 `json:"gyroZ"`
+	AccelX int16 `json:"accelX"`
+	AccelY int16 `json:"accelY"`
+	AccelZ int16 `json:"accelZ"`
 }
 
 // NewInputState returns a DualShock 4 input state in its neutral/resting state.
@@ -99,13 +108,13 @@ func (s *InputState) UnmarshalBinary(data []byte) error {
 // nolint
 // viiper:wire dualshock4 s2c rumbleSmall:u8 rumbleLarge:u8 ledRed:u8 ledGreen:u8 ledBlue:u8 flashOn:u8 flashOff:u8
 type OutputState struct {
-	RumbleSmall uint8 // (0-255)
-	RumbleLarge uint8 // (0-255)
-	LedRed      uint8 // (0-255)
-	LedGreen    uint8 // (0-255)
-	LedBlue     uint8 // (0-255)
-	FlashOn     uint8 // (units of 2.5ms)
-	FlashOff    uint8 // (units of 2.5ms)
+	RumbleSmall uint8 `json:"rumbleSmall"` // (0-255)
+	RumbleLarge uint8 `json:"rumbleLarge"` // (0-255)
+	LedRed      uint8 `json:"ledRed"`      // (0-255)
+	LedGreen    uint8 `json:"ledGreen"`    // (0-255)
+	LedBlue     uint8 `json:"ledBlue"`     // (0-255)
+	FlashOn     uint8 `json:"flashOn"`     // (units of 2.5ms)
+	FlashOff    uint8 `json:"flashOff"`    // (units of 2.5ms)
 }
 
 func (f *OutputState) MarshalBinary() ([]byte, error) {
@@ -3,3 +3,11 @@ package device
 import "errors"
 
 var ErrWrongDeviceType = errors.New("wrong device type")
+
+// ErrNoMetaState is returned by DeviceHandler.UpdateMetaState for device types
+// without runtime meta state (battery, serial, ...).
+var ErrNoMetaState = errors.New("device has no meta state")
+
+// ErrNoDataDir is returned by CreateOptions.DataFile if the server has no
+// directory for device files configured.
+var ErrNoDataDir = errors.New("device files are disabled: no data directory configured")
@@ -0,0 +1,128 @@
+package joystick
+
+// Default USB identity.
+const (
+	DefaultVID = 0x2E8A
+	DefaultPID = 0x0013
+)
+
+// Limits and defaults of the DeviceSpecific options.
+const (
+	MaxAxes    = 8
+	MaxButtons = 128
+	MaxHats    = 4
+
+	DefaultAxes    = 6
+	DefaultButtons = 32
+	DefaultHats    = 1
+)
+
+// Axis indices into InputState.Axes, in report order.
+const (
+	AxisX = iota
+	AxisY
+	AxisZ
+	AxisRx
+	AxisRy
+	AxisRz
+	AxisSlider
+	AxisDial
+)
+
+// Axis value range (signed 16-bit).
+const (
+	AxisMin = -32768
+	AxisMax = 32767
+)
+
+// Hat switch positions, clockwise in 45° steps. HatCentered reports the null state.
+const (
+	HatCentered  = 0x00
+	HatUp        = 0x01
+	HatUpRight   = 0x02
+	HatRight     = 0x03
+	HatDownRight = 0x04
+	HatDown      = 0x05
+	HatDownLeft  = 0x06
+	HatLeft      = 0x07
+	HatUpLeft    = 0x08
+)
+
+// PID (force feedback) report IDs. Output reports are forwarded to the
+// client as PIDReport, see pid.go for their layouts.
+const (
+	PIDReportSetEffect        = 0x11
+	PIDReportSetEnvelope      = 0x12
+	PIDReportSetCondition     = 0x13
+	PIDReportSetPeriodic      = 0x14
+	PIDReportSetConstantForce = 0x15
+	PIDReportSetRampForce     = 0x16
+	PIDReportEffectOperation  = 0x1A
+	PIDReportBlockFree        = 0x1B
+	PIDReportDeviceControl    = 0x1C
+	PIDReportDeviceGain       = 0x1D
+	PIDReportCreateNewEffect  = 0x21
+	PIDReportBlockLoad        = 0x22
+	PIDReportPool             = 0x23
+)
+
+// Effect types of PIDReportSetEffect and PIDReportCreateNewEffect.
+const (
+	EffectConstant     = 0x01
+	EffectRamp         = 0x02
+	EffectSquare       = 0x03
+	EffectSine         = 0x04
+	EffectTriangle     = 0x05
+	EffectSawtoothUp   = 0x06
+	EffectSawtoothDown = 0x07
+	EffectSpring       = 0x08
+	EffectDamper       = 0x09
+	EffectInertia      = 0x0A
+	EffectFriction     = 0x0B
+)
+
+// Effect operations of PIDReportEffectOperation.
+const (
+	EffectOpStart     = 0x01
+	EffectOpStartSolo = 0x02
+	EffectOpStop      = 0x03
+)
+
+// Device control commands of PIDReportDeviceControl.
+const (
+	ControlEnableActuators  = 0x01
+	ControlDisableActuators = 0x02
+	ControlStopAllEffects   = 0x03
+	ControlReset            = 0x04
+	ControlPause            = 0x05
+	ControlContinue         = 0x06
+)
+
+// MaxEffects is the number of effect blocks the device can hold.
+const MaxEffects = 40
+
+// Block load status of PIDReportBlockLoad.
+const (
+	blockLoadSuccess = 0x01
+	blockLoadFull    = 0x02
+	blockLoadError   = 0x03
+)
+
+const (
+	reportIDInput    = 0x01
+	reportIDPIDState = 0x02
+
+	// effectBlockSize is the nominal RAM pool use of one effect.
+	effectBlockSize = 0x10
+	ramPoolSize     = MaxEffects * effectBlockSize
+
+	hidClassIN  = 0xA1
+	hidClassOUT = 0x21
+
+	hidGetReport = 0x01
+	hidSetReport = 0x09
+
+	reportTypeInput   = 0x01
+	reportTypeOutput  = 0x02
+	reportTypeFeature = 0x03
+)
@@ -0,0 +1,333 @@
+// Package joystick provides a generic HID joystick whose number of axes,
+// buttons and POV hats is chosen at creation time, with optional PID force
+// feedback.
+package joystick
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/usb"
+	"github.com/Alia5/VIIPER/usb/hid"
+	"github.com/Alia5/VIIPER/usbip"
+)
+
+// Joystick implements a HID joystick with a configurable report layout.
+type Joystick struct {
+	inputCh    chan InputState
+	descriptor usb.Descriptor
+	config     config
+
+	stateMu    sync.Mutex
+	inputState InputState
+
+	mtx           sync.Mutex
+	pid           pidState
+	outputReports map[uint8][]byte
+	outputFunc    func(PIDReport)
+}
+
+// New returns a new Joystick configured from o.DeviceSpecific (see Options).
+func New(o *device.CreateOptions) (*Joystick, error) {
+	var opts Options
+	if o != nil && o.DeviceSpecific != "" {
+		if err := json.Unmarshal([]byte(o.DeviceSpecific), &opts); err != nil {
+			return nil, fmt.Errorf("invalid JSON payload: %w", err)
+		}
+	}
+	c, err := opts.config()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Joystick{
+		config:        c,
+		descriptor:    buildDescriptor(c),
+		outputReports: map[uint8][]byte{},
+	}
+	if o != nil {
+		if o.IDVendor != nil {
+			d.descriptor.Device.IDVendor = *o.IDVendor
+		}
+		if o.IDProduct != nil {
+			d.descriptor.Device.IDProduct = *o.IDProduct
+		}
+	}
+	d.inputCh = make(chan InputState, 1)
+	d.inputCh <- *NewInputState()
+	return d, nil
+}
+
+// ReportSize returns the size of the input report, including the report ID.
+func (j *Joystick) ReportSize() int { return j.config.reportSize() }
+
+// SetOutputCallback sets a callback that is invoked for every force feedback
+// report written by the host.
+func (j *Joystick) SetOutputCallback(f func(PIDReport)) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	j.outputFunc = f
+}
+
+func (j *Joystick) UpdateInputState(state InputState) {
+	j.stateMu.Lock()
+	j.inputState = state
+	j.stateMu.Unlock()
+	select {
+	case <-j.inputCh:
+	default:
+	}
+	j.inputCh <- state
+}
+
+// ResetInputState releases all inputs, see usb.NeutralStateDevice.
+func (j *Joystick) ResetInputState() {
+	j.UpdateInputState(*NewInputState())
+}
+
+// GetInputState returns the last input state set by the client.
+func (j *Joystick) GetInputState() any {
+	j.stateMu.Lock()
+	defer j.stateMu.Unlock()
+	return j.inputState
+}
+
+// GetOutputState returns the last force feedback report per report ID, or
+// nil if the host has not sent any.
+func (j *Joystick) GetOutputState() any {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	if len(j.outputReports) == 0 {
+		return nil
+	}
+	return maps.Clone(j.outputReports)
+}
+
+func (j *Joystick) HandleTransfer(ctx context.Context, ep uint32, dir uint32, out []byte) []byte {
+	if dir == usbip.DirIn {
+		if ep != 1 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case st := <-j.inputCh:
+			return st.buildReport(j.config)
+		}
+	}
+	if ep == 2 && j.config.ffb {
+		j.handleOutput(out)
+	}
+	return nil
+}
+
+func (j *Joystick) HandleControl(bmRequestType, bRequest uint8, wValue, wIndex, wLength uint16, data []byte) ([]byte, bool) {
+	reportType := uint8(wValue >> 8)
+	reportID := uint8(wValue & 0xFF)
+
+	switch {
+	case bmRequestType == hidClassIN && bRequest == hidGetReport:
+		var b []byte
+		switch {
+		case reportType == reportTypeInput && reportID == reportIDInput:
+			j.stateMu.Lock()
+			st := j.inputState
+			j.stateMu.Unlock()
+			b = st.buildReport(j.config)
+		case !j.config.ffb:
+			return nil, false
+		case reportType == reportTypeInput && reportID == reportIDPIDState:
+			j.mtx.Lock()
+			b = j.pid.stateReport()
+			j.mtx.Unlock()
+		case reportType == reportTypeFeature && reportID == PIDReportBlockLoad:
+			j.mtx.Lock()
+			b = j.pid.blockLoadReport()
+			j.mtx.Unlock()
+		case reportType == reportTypeFeature && reportID == PIDReportPool:
+			j.mtx.Lock()
+			b = j.pid.poolReport()
+			j.mtx.Unlock()
+		default:
+			return nil, false
+		}
+		if wLength > 0 && int(wLength) < len(b) {
+			b = b[:wLength]
+		}
+		return b, true
+	case bmRequestType == hidClassOUT && bRequest == hidSetReport && j.config.ffb:
+		switch {
+		case reportType == reportTypeOutput:
+			j.handleOutput(data)
+			return nil, true
+		case reportType == reportTypeFeature && reportID == PIDReportCreateNewEffect:
+			j.mtx.Lock()
+			j.pid.createEffect(data)
+			j.mtx.Unlock()
+			j.emitOutput(data)
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+// handleOutput applies a PID output report and forwards it to the client.
+func (j *Joystick) handleOutput(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	j.mtx.Lock()
+	j.pid.output(data)
+	j.outputReports[data[0]] = append([]byte(nil), data...)
+	j.mtx.Unlock()
+	j.emitOutput(data)
+}
+
+func (j *Joystick) emitOutput(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	j.mtx.Lock()
+	f := j.outputFunc
+	j.mtx.Unlock()
+	if f != nil {
+		f(PIDReport{ReportID: data[0], Data: append([]byte(nil), data[1:]...)})
+	}
+}
+
+func (j *Joystick) GetDescriptor() *usb.Descriptor {
+	return &j.descriptor
+}
+
+func (j *Joystick) GetDeviceSpecificArgs() map[string]any {
+	return map[string]any{
+		"axes":          j.config.axes,
+		"buttons":       j.config.buttons,
+		"hats":          j.config.hats,
+		"forceFeedback": j.config.ffb,
+	}
+}
+
+// reportItems returns the HID report descriptor items for the layout c.
+func reportItems(c config) []hid.Item {
+	axisUsages := []uint16{
+		hid.UsageX, hid.UsageY, hid.UsageZ, hid.UsageRx,
+		hid.UsageRy, hid.UsageRz, hid.UsageSlider, hid.UsageDial,
+	}
+
+	items := []hid.Item{hid.ReportID{ID: reportIDInput}}
+	if c.axes > 0 {
+		items = append(items, usages(axisUsages[:c.axes]...)...)
+		items = append(items, field(AxisMin, AxisMax, 16, uint16(c.axes),
+			hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs})...)
+	}
+	if c.buttons > 0 {
+		items = append(items,
+			hid.UsagePage{Page: hid.UsagePageButton},
+			hid.UsageMinimum{Min: 0x01},
+			hid.UsageMaximum{Max: uint16(c.buttons)},
+		)
+		items = append(items, field(0, 1, 1, uint16(c.buttons),
+			hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs})...)
+		if pad := (8 - c.buttons%8) % 8; pad > 0 {
+			items = append(items, hid.ReportCount{Count: uint16(pad)}, hid.Input{Flags: hid.MainConst})
+		}
+		items = append(items, hid.UsagePage{Page: hid.UsagePageGenericDesktop})
+	}
+	if c.hats > 0 {
+		for range c.hats {
+			items = append(items, hid.Usage{Usage: hid.UsageHatSwitch})
+		}
+		items = append(items,
+			hid.PhysicalMinimum{Min: 0},
+			hid.PhysicalMaximum{Max: 315},
+			hid.Unit{Value: unitDegrees},
+		)
+		items = append(items, field(HatUp, HatUpLeft, 4, uint16(c.hats),
+			hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs | hid.MainNullState})...)
+		if c.hats%2 != 0 {
+			items = append(items, hid.ReportCount{Count: 1}, hid.Input{Flags: hid.MainConst})
+		}
+		items = append(items, hid.PhysicalMaximum{Max: 0}, hid.Unit{Value: 0})
+	}
+	if c.ffb {
+		items = append(items, pidItems()...)
+	}
+
+	return []hid.Item{
+		hid.UsagePage{Page: hid.UsagePageGenericDesktop},
+		hid.Usage{Usage: hid.UsageJoystick},
+		hid.Collection{Kind: hid.CollectionApplication, Items: items},
+	}
+}
+
+func buildDescriptor(c config) usb.Descriptor {
+	endpoints := []usb.EndpointDescriptor{
+		{
+			BEndpointAddress: 0x81,
+			BMAttributes:     0x03,   // Interrupt
+			WMaxPacketSize:   0x0040, // 64 bytes (at most 35 needed)
+			BInterval:        0x05,   // 5 ms
+		},
+	}
+	if c.ffb {
+		endpoints = append(endpoints, usb.EndpointDescriptor{
+			BEndpointAddress: 0x02,
+			BMAttributes:     0x03,   // Interrupt
+			WMaxPacketSize:   0x0040, // 64 bytes
+			BInterval:        0x05,   // 5 ms
+		})
+	}
+
+	return usb.Descriptor{
+		Device: usb.DeviceDescriptor{
+			BcdUSB:             0x0200,
+			BDeviceClass:       0x00,
+			BDeviceSubClass:    0x00,
+			BDeviceProtocol:    0x00,
+			BMaxPacketSize0:    0x40, // 64 bytes
+			IDVendor:           DefaultVID,
+			IDProduct:          DefaultPID,
+			BcdDevice:          0x0100,
+			IManufacturer:      0x01,
+			IProduct:           0x02,
+			ISerialNumber:      0x03,
+			BNumConfigurations: 0x01,
+			Speed:              2, // Full speed
+		},
+		Interfaces: []usb.InterfaceConfig{
+			{
+				Descriptor: usb.InterfaceDescriptor{
+					BInterfaceNumber:   0x00,
+					BAlternateSetting:  0x00,
+					BNumEndpoints:      uint8(len(endpoints)),
+					BInterfaceClass:    0x03, // HID
+					BInterfaceSubClass: 0x00,
+					BInterfaceProtocol: 0x00,
+					IInterface:         0x00,
+				},
+				HID: &usb.HIDFunction{
+					Descriptor: usb.HIDDescriptor{
+						BcdHID:       0x0111,
+						BCountryCode: 0x00,
+						Descriptors: []usb.HIDSubDescriptor{
+							{Type: usb.ReportDescType},
+						},
+					},
+					ReportDescriptor: hid.ReportDescriptor{Items: reportItems(c)},
+				},
+				Endpoints: endpoints,
+			},
+		},
+		Strings: map[uint8]string{
+			0: "\u0409", // LangID: en-US (0x0409)
+			1: "VIIPER",
+			2: "HID Joystick",
+			3: "1337",
+		},
+	}
+}
@@ -0,0 +1,94 @@
+package joystick
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	"github.com/Alia5/VIIPER/usb"
+)
+
+func init() {
+	api.RegisterDevice("joystick", &handler{})
+}
+
+type handler struct{}
+
+func (h *handler) CreateDevice(o *device.CreateOptions) (usb.Device, error) { return New(o) }
+
+func (h *handler) StreamHandler() api.StreamHandlerFunc {
+	return func(conn net.Conn, devPtr *usb.Device, logger *slog.Logger) error {
+		if devPtr == nil || *devPtr == nil {
+			return fmt.Errorf("nil device")
+		}
+		jdev, ok := (*devPtr).(*Joystick)
+		if !ok {
+			return fmt.Errorf("%w: expected joystick", device.ErrWrongDeviceType)
+		}
+
+		var writeMu sync.Mutex
+		jdev.SetOutputCallback(func(report PIDReport) {
+			data, err := report.MarshalBinary()
+			if err != nil {
+				logger.Error("failed to marshal PID report", "error", err)
+				return
+			}
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			if _, err := conn.Write(data); err != nil {
+				logger.Error("failed to send PID report", "error", err)
+			}
+		})
+		defer jdev.SetOutputCallback(nil)
+
+		for {
+			packet, err := readPacket(conn)
+			if err != nil {
+				if err == io.EOF {
+					logger.Info("client disconnected")
+					return nil
+				}
+				return fmt.Errorf("read input state: %w", err)
+			}
+
+			var state InputState
+			if err := state.UnmarshalBinary(packet); err != nil {
+				return fmt.Errorf("unmarshal input state: %w", err)
+			}
+			jdev.UpdateInputState(state)
+			api.RecordFrame(conn, packet)
+		}
+	}
+}
+
+// readPacket reads one variable-length input state packet.
+func readPacket(r io.Reader) ([]byte, error) {
+	var packet []byte
+	// axis count, button byte count, hat count; each followed by its data
+	for i, width := range []int{2, 1, 1} {
+		count := make([]byte, 1)
+		if _, err := io.ReadFull(r, count); err != nil {
+			if i > 0 && err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		data := make([]byte, width*int(count[0]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		packet = append(append(packet, count...), data...)
+	}
+	return packet, nil
+}
+
+func (h *handler) UpdateMetaState(meta string, dev *usb.Device) error {
+	return device.ErrNoMetaState
+}
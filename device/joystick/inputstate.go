@@ -0,0 +1,173 @@
+package joystick
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// InputState represents the joystick state used to build a report.
+// Axes, buttons and hats beyond the device's configuration are ignored.
+// viiper:wire joystick c2s axisCount:u8 axes:i16*axisCount buttonBytes:u8 buttons:u8*buttonBytes hatCount:u8 hats:u8*hatCount
+type InputState struct {
+	// Axes: -32768 to 32767, see Axis* for the order
+	Axes [MaxAxes]int16 `json:"axes"`
+	// Buttons: bitmap, bit n = button n+1
+	Buttons [MaxButtons / 8]uint8 `json:"buttons"`
+	// Hats: Hat* positions, HatCentered = released
+	Hats [MaxHats]uint8 `json:"hats"`
+}
+
+// NewInputState returns a centered joystick state without pressed buttons.
+func NewInputState() *InputState { return &InputState{} }
+
+// SetButton presses or releases button i (0-based).
+func (s *InputState) SetButton(i int, pressed bool) {
+	if i < 0 || i >= MaxButtons {
+		return
+	}
+	if pressed {
+		s.Buttons[i/8] |= 1 << (i % 8)
+	} else {
+		s.Buttons[i/8] &^= 1 << (i % 8)
+	}
+}
+
+// Button reports whether button i (0-based) is pressed.
+func (s *InputState) Button(i int) bool {
+	if i < 0 || i >= MaxButtons {
+		return false
+	}
+	return s.Buttons[i/8]&(1<<(i%8)) != 0
+}
+
+// buildReport encodes the input report for the layout c.
+//
+// Report layout:
+//
+//	Byte 0: Report ID (0x01)
+//	Axes: int16 each, little-endian
+//	Buttons: 1 bit each, padded to a full byte
+//	Hats: 4 bits each, padded to a full byte
+func (s *InputState) buildReport(c config) []byte {
+	b := make([]byte, 1, c.reportSize())
+	b[0] = reportIDInput
+	for i := range c.axes {
+		b = binary.LittleEndian.AppendUint16(b, uint16(s.Axes[i]))
+	}
+	buttons := s.Buttons[:(c.buttons+7)/8]
+	b = append(b, buttons...)
+	if c.buttons%8 != 0 {
+		b[len(b)-1] &= 1<<(c.buttons%8) - 1
+	}
+	for i := 0; i < c.hats; i += 2 {
+		v := hatValue(s.Hats[i])
+		if i+1 < c.hats {
+			v |= hatValue(s.Hats[i+1]) << 4
+		}
+		b = append(b, v)
+	}
+	return b
+}
+
+func hatValue(v uint8) uint8 {
+	if v > HatUpLeft {
+		return HatCentered
+	}
+	return v
+}
+
+// MarshalBinary encodes InputState to the wire format with all axes, buttons and hats.
+//
+// Wire format:
+//
+//	Byte 0: Axis count (0-8)
+//	Next 2*count bytes: Axes (int16, little-endian)
+//	Next byte: Button byte count (0-16)
+//	Next count bytes: Button bitmap
+//	Next byte: Hat count (0-4)
+//	Next count bytes: Hats
+func (s *InputState) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 3+2*MaxAxes+len(s.Buttons)+MaxHats)
+	b = append(b, MaxAxes)
+	for _, v := range s.Axes {
+		b = binary.LittleEndian.AppendUint16(b, uint16(v))
+	}
+	b = append(b, uint8(len(s.Buttons)))
+	b = append(b, s.Buttons[:]...)
+	b = append(b, MaxHats)
+	b = append(b, s.Hats[:]...)
+	return b, nil
+}
+
+// UnmarshalBinary decodes the variable-length wire format into InputState.
+// Omitted axes, buttons and hats are reset.
+func (s *InputState) UnmarshalBinary(data []byte) error {
+	*s = InputState{}
+	if len(data) < 1 {
+		return io.ErrUnexpectedEOF
+	}
+	n := int(data[0])
+	if n > MaxAxes {
+		return fmt.Errorf("too many axes: %d > %d", n, MaxAxes)
+	}
+	data = data[1:]
+	if len(data) < 2*n+1 {
+		return io.ErrUnexpectedEOF
+	}
+	for i := range n {
+		s.Axes[i] = int16(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+	data = data[2*n:]
+
+	n = int(data[0])
+	if n > len(s.Buttons) {
+		return fmt.Errorf("too many button bytes: %d > %d", n, len(s.Buttons))
+	}
+	data = data[1:]
+	if len(data) < n+1 {
+		return io.ErrUnexpectedEOF
+	}
+	copy(s.Buttons[:], data[:n])
+	data = data[n:]
+
+	n = int(data[0])
+	if n > MaxHats {
+		return fmt.Errorf("too many hats: %d > %d", n, MaxHats)
+	}
+	data = data[1:]
+	if len(data) < n {
+		return io.ErrUnexpectedEOF
+	}
+	copy(s.Hats[:], data[:n])
+	return nil
+}
+
+// PIDReport is a force feedback report written by the host, starting at the
+// byte after the report ID. See PIDReport* for the report IDs.
+// viiper:wire joystick s2c reportId:u8 length:u8 data:u8*length
+type PIDReport struct {
+	ReportID uint8
+	Data     []byte
+}
+
+// MarshalBinary encodes the report as report ID (u8), length (u8), data.
+func (r *PIDReport) MarshalBinary() ([]byte, error) {
+	if len(r.Data) > 0xFF {
+		return nil, fmt.Errorf("report too large: %d bytes", len(r.Data))
+	}
+	b := make([]byte, 2, 2+len(r.Data))
+	b[0] = r.ReportID
+	b[1] = uint8(len(r.Data))
+	return append(b, r.Data...), nil
+}
+
+// UnmarshalBinary decodes a report produced by MarshalBinary.
+func (r *PIDReport) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || len(data) < 2+int(data[1]) {
+		return io.ErrUnexpectedEOF
+	}
+	r.ReportID = data[0]
+	r.Data = append([]byte(nil), data[2:2+int(data[1])]...)
+	return nil
+}
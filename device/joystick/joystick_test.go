@@ -0,0 +1,324 @@
+package joystick_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/device/joystick"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/usbip"
+	"github.com/Alia5/VIIPER/viiperclient"
+	"github.com/Alia5/VIIPER/virtualbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/Alia5/VIIPER/internal/registry" // Register devices
+)
+
+func newJoystick(t *testing.T, opts joystick.Options) *joystick.Joystick {
+	t.Helper()
+	b, err := json.Marshal(opts)
+	require.NoError(t, err)
+	d, err := joystick.New(&device.CreateOptions{DeviceSpecific: string(b)})
+	require.NoError(t, err)
+	return d
+}
+
+func TestNewOptions(t *testing.T) {
+	type testCase struct {
+		name       string
+		opts       joystick.Options
+		wantErr    bool
+		reportSize int
+		endpoints  int
+	}
+
+	cases := []testCase{
+		{name: "defaults", reportSize: 1 + 12 + 4 + 1, endpoints: 1},
+		{name: "buttons only", opts: joystick.Options{Axes: new(uint8(0)), Buttons: new(uint8(3)), Hats: new(uint8(0))}, reportSize: 2, endpoints: 1},
+		{name: "maximum", opts: joystick.Options{Axes: new(uint8(8)), Buttons: new(uint8(128)), Hats: new(uint8(4))}, reportSize: 35, endpoints: 1},
+		{name: "force feedback", opts: joystick.Options{ForceFeedback: true}, reportSize: 18, endpoints: 2},
+		{name: "too many axes", opts: joystick.Options{Axes: new(uint8(9))}, wantErr: true},
+		{name: "too many buttons", opts: joystick.Options{Buttons: new(uint8(129))}, wantErr: true},
+		{name: "too many hats", opts: joystick.Options{Hats: new(uint8(5))}, wantErr: true},
+		{name: "empty", opts: joystick.Options{Axes: new(uint8(0)), Buttons: new(uint8(0)), Hats: new(uint8(0))}, wantErr: true},
+		{name: "force feedback without axes", opts: joystick.Options{Axes: new(uint8(1)), ForceFeedback: true}, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := json.Marshal(tc.opts)
+			require.NoError(t, err)
+			d, err := joystick.New(&device.CreateOptions{DeviceSpecific: string(b)})
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.reportSize, d.ReportSize())
+			desc := d.GetDescriptor()
+			assert.Len(t, desc.Interfaces[0].Endpoints, tc.endpoints)
+			_, err = desc.Interfaces[0].HID.ReportBytes()
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestInputReports(t *testing.T) {
+	type testCase struct {
+		name           string
+		inputState     func() joystick.InputState
+		expectedReport []byte
+	}
+
+	// 3 axes, 10 buttons, 3 hats: 1 + 6 + 2 + 2 bytes
+	cases := []testCase{
+		{
+			name:           "neutral",
+			inputState:     func() joystick.InputState { return *joystick.NewInputState() },
+			expectedReport: []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		},
+		{
+			name: "axes",
+			inputState: func() joystick.InputState {
+				s := joystick.NewInputState()
+				s.Axes[joystick.AxisX] = joystick.AxisMax
+				s.Axes[joystick.AxisY] = joystick.AxisMin
+				s.Axes[joystick.AxisZ] = -2
+				s.Axes[joystick.AxisRx] = 1234 // not part of the layout
+				return *s
+			},
+			expectedReport: []byte{0x01, 0xFF, 0x7F, 0x00, 0x80, 0xFE, 0xFF, 0x00, 0x00, 0x00, 0x00},
+		},
+		{
+			name: "buttons",
+			inputState: func() joystick.InputState {
+				s := joystick.NewInputState()
+				s.SetButton(0, true)
+				s.SetButton(9, true)
+				s.SetButton(10, true) // not part of the layout
+				return *s
+			},
+			expectedReport: []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x02, 0x00, 0x00},
+		},
+		{
+			name: "hats",
+			inputState: func() joystick.InputState {
+				s := joystick.NewInputState()
+				s.Hats = [joystick.MaxHats]uint8{joystick.HatUp, joystick.HatDownLeft, joystick.HatUpLeft, joystick.HatRight}
+				return *s
+			},
+			expectedReport: []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x61, 0x08},
+		},
+		{
+			name: "invalid hat is centered",
+			inputState: func() joystick.InputState {
+				s := joystick.NewInputState()
+				s.Hats[0] = 0x0F
+				return *s
+			},
+			expectedReport: []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		},
+	}
+
+	s := viiperTesting.NewTestServer(t)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+
+	r := s.ApiServer.Router()
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	r.RegisterStream("bus/{busId}/{deviceid}", api.DeviceStreamHandler(s.UsbServer))
+
+	if err := s.ApiServer.Start(); err != nil {
+		t.Fatalf("Failed to start API server: %v", err)
+	}
+
+	b, err := virtualbus.NewWithBusID(1)
+	if err != nil {
+		t.Fatalf("Failed to create virtual bus: %v", err)
+	}
+	defer b.Close() //nolint:errcheck
+	_ = s.UsbServer.AddBus(b)
+
+	opts, err := json.Marshal(joystick.Options{Axes: new(uint8(3)), Buttons: new(uint8(10)), Hats: new(uint8(3))})
+	require.NoError(t, err)
+
+	client := viiperclient.New(s.ApiServer.Addr())
+	stream, _, err := client.AddDeviceAndConnect(context.Background(), b.BusID(), "joystick", &device.CreateOptions{
+		DeviceSpecific: string(opts),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stream.Close() //nolint:errcheck
+
+	usbipClient := viiperTesting.NewUsbIpClient(t, s.UsbServer.Addr())
+	devs, err := usbipClient.ListDevices()
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.Len(t, devs, 1) {
+		return
+	}
+	imp, err := usbipClient.AttachDevice(devs[0].BusID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if imp != nil && imp.Conn != nil {
+		defer imp.Conn.Close() //nolint:errcheck
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := tc.inputState()
+			if !assert.NoError(t, stream.WriteBinary(&state)) {
+				return
+			}
+			got, err := usbipClient.PollInputReport(imp.Conn, tc.expectedReport, 750*time.Millisecond)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tc.expectedReport, got)
+		})
+	}
+}
+
+func TestWireFormat(t *testing.T) {
+	var s joystick.InputState
+	require.NoError(t, s.UnmarshalBinary([]byte{
+		0x02, 0x01, 0x00, 0xFF, 0xFF, // 2 axes
+		0x01, 0x05, // 1 button byte
+		0x00, // no hats
+	}))
+	assert.Equal(t, int16(1), s.Axes[joystick.AxisX])
+	assert.Equal(t, int16(-1), s.Axes[joystick.AxisY])
+	assert.True(t, s.Button(0))
+	assert.False(t, s.Button(1))
+	assert.True(t, s.Button(2))
+
+	b, err := s.MarshalBinary()
+	require.NoError(t, err)
+	var rt joystick.InputState
+	require.NoError(t, rt.UnmarshalBinary(b))
+	assert.Equal(t, s, rt)
+
+	assert.Error(t, rt.UnmarshalBinary([]byte{0x09}), "too many axes")
+	assert.ErrorIs(t, rt.UnmarshalBinary([]byte{0x01, 0x00}), io.ErrUnexpectedEOF)
+}
+
+func TestForceFeedback(t *testing.T) {
+	const (
+		getReport = 0xA1
+		setReport = 0x21
+		feature   = 0x03 << 8
+		output    = 0x02 << 8
+	)
+
+	_, handled := newJoystick(t, joystick.Options{}).HandleControl(getReport, 0x01, feature|joystick.PIDReportPool, 0, 64, nil)
+	assert.False(t, handled, "no PID reports without force feedback")
+
+	d := newJoystick(t, joystick.Options{ForceFeedback: true})
+	var got []joystick.PIDReport
+	d.SetOutputCallback(func(r joystick.PIDReport) { got = append(got, r) })
+
+	resp, handled := d.HandleControl(getReport, 0x01, feature|joystick.PIDReportPool, 0, 64, nil)
+	assert.True(t, handled)
+	assert.Equal(t, []byte{joystick.PIDReportPool, 0x80, 0x02, joystick.MaxEffects, 0x01}, resp)
+
+	for block := uint8(1); block <= 2; block++ {
+		_, handled = d.HandleControl(setReport, 0x09, feature|joystick.PIDReportCreateNewEffect, 0, 4,
+			[]byte{joystick.PIDReportCreateNewEffect, joystick.EffectConstant, 0x00, 0x00})
+		assert.True(t, handled)
+		resp, handled = d.HandleControl(getReport, 0x01, feature|joystick.PIDReportBlockLoad, 0, 64, nil)
+		assert.True(t, handled)
+		free := uint16(joystick.MaxEffects-block) * 0x10
+		assert.Equal(t, []byte{joystick.PIDReportBlockLoad, block, 0x01, uint8(free), uint8(free >> 8)}, resp)
+	}
+
+	_, handled = d.HandleControl(setReport, 0x09, output|joystick.PIDReportBlockFree, 0, 2, []byte{joystick.PIDReportBlockFree, 0x01})
+	assert.True(t, handled)
+	_, handled = d.HandleControl(setReport, 0x09, feature|joystick.PIDReportCreateNewEffect, 0, 4,
+		[]byte{joystick.PIDReportCreateNewEffect, joystick.EffectSine, 0x00, 0x00})
+	assert.True(t, handled)
+	resp, _ = d.HandleControl(getReport, 0x01, feature|joystick.PIDReportBlockLoad, 0, 64, nil)
+	assert.Equal(t, uint8(1), resp[1], "freed block is reused")
+
+	_, handled = d.HandleControl(setReport, 0x09, feature|joystick.PIDReportCreateNewEffect, 0, 4,
+		[]byte{joystick.PIDReportCreateNewEffect, 0x7F, 0x00, 0x00})
+	assert.True(t, handled)
+	resp, _ = d.HandleControl(getReport, 0x01, feature|joystick.PIDReportBlockLoad, 0, 64, nil)
+	assert.Equal(t, []byte{0x00, 0x03}, resp[1:3], "unknown effect type fails to load")
+
+	d.HandleTransfer(context.Background(), 2, usbip.DirOut, []byte{joystick.PIDReportSetConstantForce, 0x01, 0x10, 0x27})
+	assert.Equal(t, map[uint8][]byte{
+		joystick.PIDReportBlockFree:        {joystick.PIDReportBlockFree, 0x01},
+		joystick.PIDReportSetConstantForce: {joystick.PIDReportSetConstantForce, 0x01, 0x10, 0x27},
+	}, d.GetOutputState())
+
+	if assert.Len(t, got, 6) {
+		assert.Equal(t, joystick.PIDReport{ReportID: joystick.PIDReportCreateNewEffect, Data: []byte{joystick.EffectConstant, 0x00, 0x00}}, got[0])
+		assert.Equal(t, joystick.PIDReport{ReportID: joystick.PIDReportSetConstantForce, Data: []byte{0x01, 0x10, 0x27}}, got[5])
+	}
+}
+
+func TestForceFeedbackStream(t *testing.T) {
+	s := viiperTesting.NewTestServer(t)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+
+	r := s.ApiServer.Router()
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	r.RegisterStream("bus/{busId}/{deviceid}", api.DeviceStreamHandler(s.UsbServer))
+
+	if err := s.ApiServer.Start(); err != nil {
+		t.Fatalf("Failed to start API server: %v", err)
+	}
+
+	b, err := virtualbus.NewWithBusID(1)
+	if err != nil {
+		t.Fatalf("Failed to create virtual bus: %v", err)
+	}
+	defer b.Close() //nolint:errcheck
+	_ = s.UsbServer.AddBus(b)
+
+	client := viiperclient.New(s.ApiServer.Addr())
+	stream, _, err := client.AddDeviceAndConnect(context.Background(), b.BusID(), "joystick", &device.CreateOptions{
+		DeviceSpecific: `{"forceFeedback": true}`,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stream.Close() //nolint:errcheck
+
+	usbipClient := viiperTesting.NewUsbIpClient(t, s.UsbServer.Addr())
+	devs, err := usbipClient.ListDevices()
+	if !assert.NoError(t, err) || !assert.Len(t, devs, 1) {
+		return
+	}
+	imp, err := usbipClient.AttachDevice(devs[0].BusID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if imp != nil && imp.Conn != nil {
+		defer imp.Conn.Close() //nolint:errcheck
+	}
+
+	op := []byte{joystick.PIDReportEffectOperation, 0x01, joystick.EffectOpStart, 0x01}
+	if !assert.NoError(t, usbipClient.Submit(imp.Conn, usbip.DirOut, 2, op, nil)) {
+		return
+	}
+	_ = stream.SetReadDeadline(time.Now().Add(750 * time.Millisecond))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(stream, buf); !assert.NoError(t, err) {
+		return
+	}
+	var report joystick.PIDReport
+	require.NoError(t, report.UnmarshalBinary(buf))
+	assert.Equal(t, joystick.PIDReport{ReportID: joystick.PIDReportEffectOperation, Data: op[1:]}, report)
+}
@@ -0,0 +1,63 @@
+package joystick
+
+import "fmt"
+
+// Options is the DeviceSpecific payload accepted by the joystick device type.
+// All fields are optional; omitted fields fall back to the package defaults.
+//
+// Example:
+//
+//	{"axes": 4, "buttons": 64, "hats": 2, "forceFeedback": true}
+type Options struct {
+	// Axes is the number of 16-bit axes (0-8), in the order X, Y, Z, Rx, Ry, Rz, Slider, Dial.
+	Axes *uint8 `json:"axes,omitempty"`
+	// Buttons is the number of buttons (0-128).
+	Buttons *uint8 `json:"buttons,omitempty"`
+	// Hats is the number of POV hat switches (0-4).
+	Hats *uint8 `json:"hats,omitempty"`
+	// ForceFeedback adds a PID force feedback collection and an interrupt OUT endpoint.
+	ForceFeedback bool `json:"forceFeedback,omitempty"`
+}
+
+// config is the validated layout of a joystick.
+type config struct {
+	axes, buttons, hats int
+	ffb                 bool
+}
+
+func (o Options) config() (config, error) {
+	c := config{
+		axes:    int(valueOr(o.Axes, DefaultAxes)),
+		buttons: int(valueOr(o.Buttons, DefaultButtons)),
+		hats:    int(valueOr(o.Hats, DefaultHats)),
+		ffb:     o.ForceFeedback,
+	}
+	if c.axes > MaxAxes {
+		return c, fmt.Errorf("axes must be between 0 and %d, got %d", MaxAxes, c.axes)
+	}
+	if c.buttons > MaxButtons {
+		return c, fmt.Errorf("buttons must be between 0 and %d, got %d", MaxButtons, c.buttons)
+	}
+	if c.hats > MaxHats {
+		return c, fmt.Errorf("hats must be between 0 and %d, got %d", MaxHats, c.hats)
+	}
+	if c.axes+c.buttons+c.hats == 0 {
+		return c, fmt.Errorf("joystick needs at least one axis, button or hat")
+	}
+	if c.ffb && c.axes < 2 {
+		return c, fmt.Errorf("force feedback needs at least 2 axes")
+	}
+	return c, nil
+}
+
+// reportSize returns the size of the input report including the report ID.
+func (c config) reportSize() int {
+	return 1 + 2*c.axes + (c.buttons+7)/8 + (c.hats+1)/2
+}
+
+func valueOr[T any](v *T, def T) T {
+	if v == nil {
+		return def
+	}
+	return *v
+}
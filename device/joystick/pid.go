@@ -0,0 +1,412 @@
+package joystick
+
+import (
+	"encoding/binary"
+
+	"github.com/Alia5/VIIPER/usb/hid"
+)
+
+// PID usages, see "Device Class Definition for Physical Interface Devices" 1.0.
+const (
+	pidUsageSetEffectReport        = 0x21
+	pidUsageEffectBlockIndex       = 0x22
+	pidUsageParameterBlockOffset   = 0x23
+	pidUsageEffectType             = 0x25
+	pidUsageETConstantForce        = 0x26
+	pidUsageETRamp                 = 0x27
+	pidUsageETSquare               = 0x30
+	pidUsageETSine                 = 0x31
+	pidUsageETTriangle             = 0x32
+	pidUsageETSawtoothUp           = 0x33
+	pidUsageETSawtoothDown         = 0x34
+	pidUsageETSpring               = 0x40
+	pidUsageETDamper               = 0x41
+	pidUsageETInertia              = 0x42
+	pidUsageETFriction             = 0x43
+	pidUsageDuration               = 0x50
+	pidUsageSamplePeriod           = 0x51
+	pidUsageGain                   = 0x52
+	pidUsageTriggerButton          = 0x53
+	pidUsageTriggerRepeatInterval  = 0x54
+	pidUsageAxesEnable             = 0x55
+	pidUsageDirectionEnable        = 0x56
+	pidUsageDirection              = 0x57
+	pidUsageSetEnvelopeReport      = 0x5A
+	pidUsageAttackLevel            = 0x5B
+	pidUsageAttackTime             = 0x5C
+	pidUsageFadeLevel              = 0x5D
+	pidUsageFadeTime               = 0x5E
+	pidUsageSetConditionReport     = 0x5F
+	pidUsageCPOffset               = 0x60
+	pidUsagePositiveCoefficient    = 0x61
+	pidUsageNegativeCoefficient    = 0x62
+	pidUsagePositiveSaturation     = 0x63
+	pidUsageNegativeSaturation     = 0x64
+	pidUsageDeadBand               = 0x65
+	pidUsageSetPeriodicReport      = 0x6E
+	pidUsageOffset                 = 0x6F
+	pidUsageMagnitude              = 0x70
+	pidUsagePhase                  = 0x71
+	pidUsagePeriod                 = 0x72
+	pidUsageSetConstantForceReport = 0x73
+	pidUsageSetRampForceReport     = 0x74
+	pidUsageRampStart              = 0x75
+	pidUsageRampEnd                = 0x76
+	pidUsageEffectOperationReport  = 0x77
+	pidUsageEffectOperation        = 0x78
+	pidUsageOpEffectStart          = 0x79
+	pidUsageOpEffectStartSolo      = 0x7A
+	pidUsageOpEffectStop           = 0x7B
+	pidUsageLoopCount              = 0x7C
+	pidUsageDeviceGainReport       = 0x7D
+	pidUsageDeviceGain             = 0x7E
+	pidUsagePoolReport             = 0x7F
+	pidUsageRAMPoolSize            = 0x80
+	pidUsageSimultaneousEffectsMax = 0x83
+	pidUsageBlockLoadReport        = 0x89
+	pidUsageBlockLoadStatus        = 0x8B
+	pidUsageBlockLoadSuccess       = 0x8C
+	pidUsageBlockLoadFull          = 0x8D
+	pidUsageBlockLoadError         = 0x8E
+	pidUsageBlockFreeReport        = 0x90
+	pidUsageStateReport            = 0x92
+	pidUsageEffectPlaying          = 0x94
+	pidUsageDeviceControlReport    = 0x95
+	pidUsageDeviceControl          = 0x96
+	pidUsageDCEnableActuators      = 0x97
+	pidUsageDCDeviceContinue       = 0x9C
+	pidUsageDevicePaused           = 0x9F
+	pidUsageActuatorsEnabled       = 0xA0
+	pidUsageSafetySwitch           = 0xA4
+	pidUsageActuatorOverrideSwitch = 0xA5
+	pidUsageActuatorPower          = 0xA6
+	pidUsageStartDelay             = 0xA7
+	pidUsageDeviceManagedPool      = 0xA9
+	pidUsageSharedParameterBlocks  = 0xAA
+	pidUsageCreateNewEffectReport  = 0xAB
+	pidUsageRAMPoolAvailable       = 0xAC
+
+	usageByteCount = 0x3B // Generic Desktop
+)
+
+const (
+	unitSeconds = 0x1001 // SI linear, time
+	unitDegrees = 0x14   // English rotation, angular position
+)
+
+// effectTypeUsages are the usages of Effect* 1..11, in order.
+var effectTypeUsages = []uint16{
+	pidUsageETConstantForce, pidUsageETRamp, pidUsageETSquare, pidUsageETSine,
+	pidUsageETTriangle, pidUsageETSawtoothUp, pidUsageETSawtoothDown,
+	pidUsageETSpring, pidUsageETDamper, pidUsageETInertia, pidUsageETFriction,
+}
+
+func usages(us ...uint16) []hid.Item {
+	items := make([]hid.Item, len(us))
+	for i, u := range us {
+		items[i] = hid.Usage{Usage: u}
+	}
+	return items
+}
+
+func usageRange(min, max uint16) []hid.Item {
+	var us []uint16
+	for u := min; u <= max; u++ {
+		us = append(us, u)
+	}
+	return usages(us...)
+}
+
+// pidReport wraps items into a logical collection for the report with the given ID.
+func pidReport(usage uint16, id uint8, items ...hid.Item) []hid.Item {
+	return []hid.Item{
+		hid.Usage{Usage: usage},
+		hid.Collection{Kind: hid.CollectionLogical, Items: append([]hid.Item{hid.ReportID{ID: id}}, items...)},
+	}
+}
+
+// field declares count fields of size bits with the logical range min..max.
+func field(min, max int32, bits uint8, count uint16, main hid.Item) []hid.Item {
+	return []hid.Item{
+		hid.LogicalMinimum{Min: min},
+		hid.LogicalMaximum{Max: max},
+		hid.ReportSize{Bits: bits},
+		hid.ReportCount{Count: count},
+		main,
+	}
+}
+
+// selector declares an 8-bit array field selecting one of the usages.
+func selector(usage uint16, main hid.Item, us ...uint16) []hid.Item {
+	return []hid.Item{
+		hid.Usage{Usage: usage},
+		hid.Collection{Kind: hid.CollectionLogical, Items: append(usages(us...), field(1, int32(len(us)), 8, 1, main)...)},
+	}
+}
+
+func join(parts ...[]hid.Item) []hid.Item {
+	var items []hid.Item
+	for _, p := range parts {
+		items = append(items, p...)
+	}
+	return items
+}
+
+// pidItems returns the PID force feedback reports. All fields are byte
+// aligned; multi-byte values are little-endian.
+func pidItems() []hid.Item {
+	out := hid.Output{Flags: hid.MainData | hid.MainVar | hid.MainAbs}
+	outArray := hid.Output{Flags: hid.MainData | hid.MainArray | hid.MainAbs}
+	feature := hid.Feature{Flags: hid.MainData | hid.MainVar | hid.MainAbs}
+	featureArray := hid.Feature{Flags: hid.MainData | hid.MainArray | hid.MainAbs}
+	blockIndex := func(main hid.Item) []hid.Item {
+		return join([]hid.Item{hid.Usage{Usage: pidUsageEffectBlockIndex}}, field(1, MaxEffects, 8, 1, main))
+	}
+
+	return join(
+		[]hid.Item{hid.UsagePage{Page: hid.UsagePagePID}},
+
+		// PID State (input 0x02): paused, actuators enabled, safety switch,
+		// actuator override, actuator power, 3 bits padding; effect playing
+		// (bit 0) and effect block index (bits 1-7)
+		pidReport(pidUsageStateReport, reportIDPIDState, join(
+			usages(pidUsageDevicePaused, pidUsageActuatorsEnabled, pidUsageSafetySwitch,
+				pidUsageActuatorOverrideSwitch, pidUsageActuatorPower),
+			field(0, 1, 1, 5, hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs}),
+			[]hid.Item{hid.ReportCount{Count: 3}, hid.Input{Flags: hid.MainConst}},
+			usages(pidUsageEffectPlaying),
+			field(0, 1, 1, 1, hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs}),
+			usages(pidUsageEffectBlockIndex),
+			field(1, MaxEffects, 7, 1, hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs}),
+		)...),
+
+		// Set Effect (output 0x11): block index u8, effect type u8,
+		// duration, trigger repeat interval, sample period, start delay u16 (ms),
+		// gain u8, trigger button u8, axes enable X/Y + direction enable bits,
+		// direction X/Y u8 (0-255 = 0-360°)
+		pidReport(pidUsageSetEffectReport, PIDReportSetEffect, join(
+			blockIndex(out),
+			selector(pidUsageEffectType, outArray, effectTypeUsages...),
+			usages(pidUsageDuration, pidUsageTriggerRepeatInterval, pidUsageSamplePeriod, pidUsageStartDelay),
+			[]hid.Item{hid.Unit{Value: unitSeconds}, hid.UnitExponent{Exp: -3}},
+			field(0, 0x7FFF, 16, 4, out),
+			[]hid.Item{hid.Unit{Value: 0}, hid.UnitExponent{Exp: 0}},
+			usages(pidUsageGain),
+			field(0, 255, 8, 1, out),
+			usages(pidUsageTriggerButton),
+			field(0, 8, 8, 1, out),
+			[]hid.Item{
+				hid.Usage{Usage: pidUsageAxesEnable},
+				hid.Collection{Kind: hid.CollectionLogical, Items: join(
+					[]hid.Item{
+						hid.ExtendedUsage{Page: hid.UsagePageGenericDesktop, Usage: hid.UsageX},
+						hid.ExtendedUsage{Page: hid.UsagePageGenericDesktop, Usage: hid.UsageY},
+					},
+					field(0, 1, 1, 2, out),
+				)},
+			},
+			usages(pidUsageDirectionEnable),
+			field(0, 1, 1, 1, out),
+			[]hid.Item{hid.ReportCount{Count: 5}, hid.Output{Flags: hid.MainConst}},
+			[]hid.Item{
+				hid.Usage{Usage: pidUsageDirection},
+				hid.Collection{Kind: hid.CollectionLogical, Items: join(
+					[]hid.Item{
+						hid.ExtendedUsage{Page: hid.UsagePageOrdinal, Usage: 1},
+						hid.ExtendedUsage{Page: hid.UsagePageOrdinal, Usage: 2},
+						hid.Unit{Value: unitDegrees},
+						hid.PhysicalMinimum{Min: 0},
+						hid.PhysicalMaximum{Max: 360},
+					},
+					field(0, 255, 8, 2, out),
+					[]hid.Item{hid.Unit{Value: 0}, hid.PhysicalMaximum{Max: 0}},
+				)},
+			},
+		)...),
+
+		// Set Envelope (output 0x12): block index u8, attack level, fade level
+		// u16 (0-10000), attack time, fade time u16 (ms)
+		pidReport(pidUsageSetEnvelopeReport, PIDReportSetEnvelope, join(
+			blockIndex(out),
+			usages(pidUsageAttackLevel, pidUsageFadeLevel),
+			field(0, 10000, 16, 2, out),
+			usages(pidUsageAttackTime, pidUsageFadeTime),
+			[]hid.Item{hid.Unit{Value: unitSeconds}, hid.UnitExponent{Exp: -3}},
+			field(0, 0x7FFF, 16, 2, out),
+			[]hid.Item{hid.Unit{Value: 0}, hid.UnitExponent{Exp: 0}},
+		)...),
+
+		// Set Condition (output 0x13): block index u8, axis u8 (0 = X, 1 = Y),
+		// center point offset, positive and negative coefficient i16
+		// (-10000-10000), positive and negative saturation, dead band u16 (0-10000)
+		pidReport(pidUsageSetConditionReport, PIDReportSetCondition, join(
+			blockIndex(out),
+			usages(pidUsageParameterBlockOffset),
+			field(0, 1, 8, 1, out),
+			usages(pidUsageCPOffset, pidUsagePositiveCoefficient, pidUsageNegativeCoefficient),
+			field(-10000, 10000, 16, 3, out),
+			usages(pidUsagePositiveSaturation, pidUsageNegativeSaturation, pidUsageDeadBand),
+			field(0, 10000, 16, 3, out),
+		)...),
+
+		// Set Periodic (output 0x14): block index u8, magnitude u16 (0-10000),
+		// offset i16 (-10000-10000), phase u16 (0-35999 = 0-359.99°), period u16 (ms)
+		pidReport(pidUsageSetPeriodicReport, PIDReportSetPeriodic, join(
+			blockIndex(out),
+			usages(pidUsageMagnitude),
+			field(0, 10000, 16, 1, out),
+			usages(pidUsageOffset),
+			field(-10000, 10000, 16, 1, out),
+			usages(pidUsagePhase),
+			[]hid.Item{hid.Unit{Value: unitDegrees}, hid.UnitExponent{Exp: -2}},
+			field(0, 35999, 16, 1, out),
+			usages(pidUsagePeriod),
+			[]hid.Item{hid.Unit{Value: unitSeconds}, hid.UnitExponent{Exp: -3}},
+			field(0, 0x7FFF, 16, 1, out),
+			[]hid.Item{hid.Unit{Value: 0}, hid.UnitExponent{Exp: 0}},
+		)...),
+
+		// Set Constant Force (output 0x15): block index u8, magnitude i16 (-10000-10000)
+		pidReport(pidUsageSetConstantForceReport, PIDReportSetConstantForce, join(
+			blockIndex(out),
+			usages(pidUsageMagnitude),
+			field(-10000, 10000, 16, 1, out),
+		)...),
+
+		// Set Ramp Force (output 0x16): block index u8, ramp start, ramp end i16 (-10000-10000)
+		pidReport(pidUsageSetRampForceReport, PIDReportSetRampForce, join(
+			blockIndex(out),
+			usages(pidUsageRampStart, pidUsageRampEnd),
+			field(-10000, 10000, 16, 2, out),
+		)...),
+
+		// Effect Operation (output 0x1A): block index u8, EffectOp* u8, loop count u8
+		pidReport(pidUsageEffectOperationReport, PIDReportEffectOperation, join(
+			blockIndex(out),
+			selector(pidUsageEffectOperation, outArray, pidUsageOpEffectStart, pidUsageOpEffectStartSolo, pidUsageOpEffectStop),
+			usages(pidUsageLoopCount),
+			field(0, 255, 8, 1, out),
+		)...),
+
+		// Block Free (output 0x1B): block index u8
+		pidReport(pidUsageBlockFreeReport, PIDReportBlockFree, blockIndex(out)...),
+
+		// Device Control (output 0x1C): DeviceControl* u8
+		pidReport(pidUsageDeviceControlReport, PIDReportDeviceControl,
+			selector(pidUsageDeviceControl, outArray, pidUsageDCEnableActuators, 0x98, 0x99, 0x9A, 0x9B, pidUsageDCDeviceContinue)...),
+
+		// Device Gain (output 0x1D): gain u8
+		pidReport(pidUsageDeviceGainReport, PIDReportDeviceGain, join(
+			usages(pidUsageDeviceGain),
+			field(0, 255, 8, 1, out),
+		)...),
+
+		// Create New Effect (feature 0x21): effect type u8, byte count u16
+		pidReport(pidUsageCreateNewEffectReport, PIDReportCreateNewEffect, join(
+			selector(pidUsageEffectType, featureArray, effectTypeUsages...),
+			[]hid.Item{hid.ExtendedUsage{Page: hid.UsagePageGenericDesktop, Usage: usageByteCount}},
+			field(0, 511, 16, 1, feature),
+		)...),
+
+		// Block Load (feature 0x22): block index u8, status u8, RAM pool available u16
+		pidReport(pidUsageBlockLoadReport, PIDReportBlockLoad, join(
+			blockIndex(feature),
+			selector(pidUsageBlockLoadStatus, featureArray, pidUsageBlockLoadSuccess, pidUsageBlockLoadFull, pidUsageBlockLoadError),
+			usages(pidUsageRAMPoolAvailable),
+			field(0, 0xFFFF, 16, 1, feature),
+		)...),
+
+		// PID Pool (feature 0x23): RAM pool size u16, simultaneous effects u8,
+		// device managed pool and shared parameter blocks bits
+		pidReport(pidUsagePoolReport, PIDReportPool, join(
+			usages(pidUsageRAMPoolSize),
+			field(0, 0xFFFF, 16, 1, feature),
+			usages(pidUsageSimultaneousEffectsMax),
+			field(0, 255, 8, 1, feature),
+			usages(pidUsageDeviceManagedPool, pidUsageSharedParameterBlocks),
+			field(0, 1, 1, 2, feature),
+			[]hid.Item{hid.ReportCount{Count: 6}, hid.Feature{Flags: hid.MainConst}},
+		)...),
+	)
+}
+
+// pidState tracks the effect blocks and device state managed by the host.
+type pidState struct {
+	allocated  [MaxEffects]bool
+	lastBlock  uint8
+	loadStatus uint8
+	actuators  bool
+	paused     bool
+}
+
+// createEffect allocates an effect block for a Create New Effect report.
+func (p *pidState) createEffect(data []byte) {
+	p.lastBlock = 0
+	if len(data) < 2 || data[1] < EffectConstant || data[1] > EffectFriction {
+		p.loadStatus = blockLoadError
+		return
+	}
+	for i, used := range p.allocated {
+		if !used {
+			p.allocated[i] = true
+			p.lastBlock = uint8(i + 1)
+			p.loadStatus = blockLoadSuccess
+			return
+		}
+	}
+	p.loadStatus = blockLoadFull
+}
+
+// output applies an output report (starting with its report ID).
+func (p *pidState) output(data []byte) {
+	if len(data) < 2 {
+		return
+	}
+	switch data[0] {
+	case PIDReportBlockFree:
+		if i := int(data[1]) - 1; i >= 0 && i < MaxEffects {
+			p.allocated[i] = false
+		}
+	case PIDReportDeviceControl:
+		switch data[1] {
+		case ControlEnableActuators:
+			p.actuators = true
+		case ControlDisableActuators:
+			p.actuators = false
+		case ControlReset:
+			p.allocated = [MaxEffects]bool{}
+			p.paused = false
+		case ControlPause:
+			p.paused = true
+		case ControlContinue:
+			p.paused = false
+		}
+	}
+}
+
+func (p *pidState) blockLoadReport() []byte {
+	free := 0
+	for _, used := range p.allocated {
+		if !used {
+			free++
+		}
+	}
+	b := []byte{PIDReportBlockLoad, p.lastBlock, p.loadStatus}
+	return binary.LittleEndian.AppendUint16(b, uint16(free*effectBlockSize))
+}
+
+func (p *pidState) poolReport() []byte {
+	b := binary.LittleEndian.AppendUint16([]byte{PIDReportPool}, ramPoolSize)
+	return append(b, MaxEffects, 0x01) // device managed pool
+}
+
+func (p *pidState) stateReport() []byte {
+	var flags uint8
+	if p.paused {
+		flags |= 0x01
+	}
+	if p.actuators {
+		flags |= 0x02 | 0x10 // actuators enabled, actuator power
+	}
+	return []byte{reportIDPIDState, flags, 0x00}
+}
@@ -21,6 +21,56 @@ const (
 	LEDKana       = 0x10
 )
 
+// ConsumerMaxKeys is the number of Consumer Page usages reported at once.
+const ConsumerMaxKeys = 4
+
+// Consumer Page usages (media, browser and brightness keys).
+// Any other usage up to 0x3FF can be sent as well.
+const (
+	ConsumerBrightnessUp   = 0x006F
+	ConsumerBrightnessDown = 0x0070
+	ConsumerPlay           = 0x00B0
+	ConsumerPause          = 0x00B1
+	ConsumerRecord         = 0x00B2
+	ConsumerFastForward    = 0x00B3
+	ConsumerRewind         = 0x00B4
+	ConsumerNextTrack      = 0x00B5
+	ConsumerPrevTrack      = 0x00B6
+	ConsumerStop           = 0x00B7
+	ConsumerEject          = 0x00B8
+	ConsumerPlayPause      = 0x00CD
+	ConsumerMute           = 0x00E2
+	ConsumerVolumeUp       = 0x00E9
+	ConsumerVolumeDown     = 0x00EA
+	ConsumerMediaSelect    = 0x0183
+	ConsumerMail           = 0x018A
+	ConsumerCalculator     = 0x0192
+	ConsumerMyComputer     = 0x0194
+	ConsumerBrowserSearch  = 0x0221
+	ConsumerBrowserHome    = 0x0223
+	ConsumerBrowserBack    = 0x0224
+	ConsumerBrowserForward = 0x0225
+	ConsumerBrowserStop    = 0x0226
+	ConsumerBrowserRefresh = 0x0227
+	ConsumerBookmarks      = 0x022A
+)
+
+// System Control bitmasks (power, sleep and wake buttons)
+const (
+	SysPowerDown = 0x01
+	SysSleep     = 0x02
+	SysWakeUp    = 0x04
+)
+
+// Report IDs
+const (
+	reportIDKeyboard = 0x01
+	reportIDConsumer = 0x02
+	reportIDSystem   = 0x03
+)
+
+const consumerMaxUsage = 0x03FF
+
 // HID Usage codes for keyboard keys (USB HID Keyboard/Keypad usage page)
 const (
 	// Letters A-Z
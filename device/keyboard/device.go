@@ -3,6 +3,9 @@ package keyboard
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
 	"sync"
 	"sync/atomic"
 
@@ -12,21 +15,51 @@ import (
 	"github.com/Alia5/VIIPER/usbip"
 )
 
-// Keyboard implements the Device interface for a full HID keyboard with LED support.
+// Keyboard implements the Device interface for a full HID keyboard with LED support,
+// consumer (media) keys and system control buttons.
 type Keyboard struct {
 	tick        uint64
-	inputCh     chan InputState
+	wake        chan struct{} // closed and replaced when the state changes
 	stateMu     sync.Mutex
+	inputState  InputState
+	reportState InputState // state the reports are built from
+	pending     uint8      // bit per report ID not yet sent to the host
+	reports     uint8      // bit per report ID sent to the host at all
+	queue       *device.InputQueue[InputState]
 	ledState    uint8
 	ledCallback func(LEDState)
 	descriptor  usb.Descriptor
 }
 
+// Options is the DeviceSpecific payload accepted by the keyboard device type.
+//
+// Example:
+//
+//	{"queueSize": 256}
+type Options struct {
+	// QueueSize enables queued input mode: up to QueueSize input states are
+	// sent to the host in order, so a press and release between two host
+	// polls is not lost. 0 (default) only sends the latest state.
+	QueueSize uint16 `json:"queueSize,omitempty"`
+}
+
 // New returns a new Keyboard device.
 func New(o *device.CreateOptions) (*Keyboard, error) {
+	var opts Options
+	if o != nil && o.DeviceSpecific != "" {
+		if err := json.Unmarshal([]byte(o.DeviceSpecific), &opts); err != nil {
+			return nil, fmt.Errorf("invalid JSON payload: %w", err)
+		}
+	}
+	if opts.QueueSize > device.MaxInputQueueSize {
+		return nil, fmt.Errorf("queueSize must be between 0 and %d, got %d", device.MaxInputQueueSize, opts.QueueSize)
+	}
 	d := &Keyboard{
 		descriptor: defaultDescriptor,
 	}
+	if opts.QueueSize > 0 {
+		d.queue = device.NewInputQueue[InputState](int(opts.QueueSize))
+	}
 	if o != nil {
 		if o.IDVendor != nil {
 			d.descriptor.Device.IDVendor = *o.IDVendor
@@ -35,13 +68,30 @@ func New(o *device.CreateOptions) (*Keyboard, error) {
 			d.descriptor.Device.IDProduct = *o.IDProduct
 		}
 	}
-	d.inputCh = make(chan InputState, 1)
-	d.inputCh <- *NewInputState()
+	d.wake = make(chan struct{})
+	d.pending = 1 << reportIDKeyboard
+	d.reports = 1<<reportIDKeyboard | 1<<reportIDConsumer | 1<<reportIDSystem
 	return d, nil
 }
 
+// SetControlReports sets whether the consumer and system control reports are
+// sent to the host (default true). Composite devices without an interface for
+// them turn them off, so changes to consumer usages and system buttons are not
+// left pending.
+func (k *Keyboard) SetControlReports(enabled bool) {
+	k.stateMu.Lock()
+	defer k.stateMu.Unlock()
+	k.reports = 1 << reportIDKeyboard
+	if enabled {
+		k.reports |= 1<<reportIDConsumer | 1<<reportIDSystem
+	}
+	k.pending &= k.reports
+}
+
 // SetLEDCallback sets a callback that will be invoked when LED state changes.
 func (k *Keyboard) SetLEDCallback(f func(LEDState)) {
+	k.stateMu.Lock()
+	defer k.stateMu.Unlock()
 	k.ledCallback = f
 }
 
@@ -59,101 +109,343 @@ func (k *Keyboard) GetLEDState() LEDState {
 }
 
 // UpdateInputState updates the device's current input state (thread-safe).
+// Only reports whose part of the state changed are sent to the host.
+// In queued input mode the state is sent after all states queued before it.
+// If the queue is full, state is merged into the last queued state, see
+// foldState.
 func (k *Keyboard) UpdateInputState(state InputState) {
-	select {
-	case <-k.inputCh:
-	default:
+	k.stateMu.Lock()
+	k.inputState = state
+	if k.queue != nil {
+		k.queue.Push(state, foldState)
+	} else {
+		k.setReportState(state)
+	}
+	close(k.wake)
+	k.wake = make(chan struct{})
+	k.stateMu.Unlock()
+}
+
+// ResetInputState releases all inputs, see usb.NeutralStateDevice.
+func (k *Keyboard) ResetInputState() {
+	k.UpdateInputState(*NewInputState())
+}
+
+// foldState merges st into last, the last state of a full input queue.
+// Keys, modifiers, consumer usages and system buttons pressed in either stay
+// pressed, so a press is not lost even if its release is folded in as well.
+// Once the queue has drained, the current input state is sent, releasing
+// them, see nextReport.
+func foldState(last *InputState, st InputState) {
+	last.Modifiers |= st.Modifiers
+	for i := range last.KeyBitmap {
+		last.KeyBitmap[i] |= st.KeyBitmap[i]
+	}
+	last.System |= st.System
+	merged := st.Consumer
+	for _, u := range last.ConsumerUsages() {
+		if slices.Contains(merged[:], u) {
+			continue
+		}
+		if i := slices.Index(merged[:], 0); i >= 0 {
+			merged[i] = u
+		}
 	}
-	k.inputCh <- state
+	last.Consumer = merged
+}
+
+// setReportState builds the next reports from state and marks those whose
+// part of it changed as pending.
+// Caller must hold stateMu.
+func (k *Keyboard) setReportState(state InputState) {
+	prev := k.reportState
+	k.reportState = state
+	if state.Modifiers != prev.Modifiers || state.KeyBitmap != prev.KeyBitmap {
+		k.pending |= 1 << reportIDKeyboard
+	}
+	if state.Consumer != prev.Consumer {
+		k.pending |= 1 << reportIDConsumer
+	}
+	if state.System != prev.System {
+		k.pending |= 1 << reportIDSystem
+	}
+	k.pending &= k.reports
+}
+
+// nextReport returns the next pending report of those selected by mask (bit
+// per report ID), or nil.
+// In queued input mode, the next queued state is taken once all reports of
+// the current one are sent. Once the queue is empty, the current input state
+// is sent if it differs from the last queued one, which happens if states
+// were folded into it.
+// Caller must hold stateMu.
+func (k *Keyboard) nextReport(mask uint8) []byte {
+	for k.pending == 0 && k.queue != nil {
+		st, ok := k.queue.Pop()
+		if !ok {
+			if k.reportState != k.inputState {
+				k.setReportState(k.inputState)
+			}
+			break
+		}
+		k.setReportState(st)
+	}
+	pending := k.pending & mask
+	switch {
+	case pending&(1<<reportIDKeyboard) != 0:
+		k.pending &^= 1 << reportIDKeyboard
+		return k.reportState.BuildReport()
+	case pending&(1<<reportIDConsumer) != 0:
+		k.pending &^= 1 << reportIDConsumer
+		return k.reportState.BuildConsumerReport()
+	case pending&(1<<reportIDSystem) != 0:
+		k.pending &^= 1 << reportIDSystem
+		return k.reportState.BuildSystemReport()
+	}
+	return nil
+}
+
+// readReport blocks until a report selected by mask is pending and returns
+// it, or nil once ctx is done.
+func (k *Keyboard) readReport(ctx context.Context, mask uint8) []byte {
+	for {
+		k.stateMu.Lock()
+		report := k.nextReport(mask)
+		wake := k.wake
+		k.stateMu.Unlock()
+		if report != nil {
+			return report
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-wake:
+		}
+	}
+}
+
+// ReadKeysReport blocks until the keyboard report (modifiers and keys) changed
+// and returns it, or nil once ctx is done.
+// It is meant for composite devices sending the keyboard report on an
+// interface of its own, see KeysReportItems.
+func (k *Keyboard) ReadKeysReport(ctx context.Context) []byte {
+	return k.readReport(ctx, 1<<reportIDKeyboard)
+}
+
+// ReadControlReport blocks until the consumer or system control report changed
+// and returns it, or nil once ctx is done.
+// It is meant for composite devices sending these reports on an interface of
+// their own, see ControlReportItems.
+func (k *Keyboard) ReadControlReport(ctx context.Context) []byte {
+	return k.readReport(ctx, 1<<reportIDConsumer|1<<reportIDSystem)
+}
+
+// InputQueueStatus implements usb.QueuedInputDevice.
+func (k *Keyboard) InputQueueStatus() (length, capacity int, overflows uint64, ok bool) {
+	k.stateMu.Lock()
+	defer k.stateMu.Unlock()
+	if k.queue == nil {
+		return 0, 0, 0, false
+	}
+	return k.queue.Len(), k.queue.Cap(), k.queue.Overflows(), true
+}
+
+// GetInputState returns the current modifiers, pressed keys, consumer usages
+// and system control buttons.
+func (k *Keyboard) GetInputState() any {
+	k.stateMu.Lock()
+	st := k.inputState
+	k.stateMu.Unlock()
+	keys := []int{}
+	for _, key := range st.PressedKeys() {
+		keys = append(keys, int(key))
+	}
+	consumer := []int{}
+	for _, u := range st.ConsumerUsages() {
+		consumer = append(consumer, int(u))
+	}
+	return struct {
+		Modifiers uint8 `json:"modifiers"`
+		Keys      []int `json:"keys"`
+		Consumer  []int `json:"consumer"`
+		System    uint8 `json:"system"`
+	}{st.Modifiers, keys, consumer, st.System}
+}
+
+// GetInputReport returns the keyboard (report ID 1), consumer (2) or system
+// control (3) report of the state last sent to the host, see
+// usb.InputReportDevice.
+func (k *Keyboard) GetInputReport(iface, reportID uint8) []byte {
+	k.stateMu.Lock()
+	defer k.stateMu.Unlock()
+	if k.reports&(1<<reportID) == 0 {
+		return nil
+	}
+	switch reportID {
+	case reportIDKeyboard:
+		return k.reportState.BuildReport()
+	case reportIDConsumer:
+		return k.reportState.BuildConsumerReport()
+	case reportIDSystem:
+		return k.reportState.BuildSystemReport()
+	}
+	return nil
+}
+
+// GetOutputState returns the LED state set by the host.
+func (k *Keyboard) GetOutputState() any {
+	return k.GetLEDState()
 }
 
 // HandleTransfer implements interrupt IN/OUT for Keyboard.
 func (k *Keyboard) HandleTransfer(ctx context.Context, ep uint32, dir uint32, out []byte) []byte {
 	if dir == usbip.DirIn {
 		switch ep {
-		case 1: // 0x81 - keyboard input reports
+		case 1: // 0x81 - keyboard, consumer and system control input reports
 			atomic.AddUint64(&k.tick, 1)
-			select {
-			case <-ctx.Done():
-				return nil
-			case st := <-k.inputCh:
-				return st.BuildReport()
-			}
+			return k.readReport(ctx, 1<<reportIDKeyboard|1<<reportIDConsumer|1<<reportIDSystem)
 		default:
 			return nil
 		}
 	}
 	if dir == usbip.DirOut && ep == 1 {
-		// 0x01 - LED state from host
-		if len(out) >= 1 {
-			k.stateMu.Lock()
-			k.ledState = out[0]
-			k.stateMu.Unlock()
-
-			if k.ledCallback != nil {
-				k.ledCallback(LEDState{
-					NumLock:    out[0]&LEDNumLock != 0,
-					CapsLock:   out[0]&LEDCapsLock != 0,
-					ScrollLock: out[0]&LEDScrollLock != 0,
-					Compose:    out[0]&LEDCompose != 0,
-					Kana:       out[0]&LEDKana != 0,
-				})
-			}
+		// 0x01 - LED state from host, prefixed with the keyboard report ID.
+		// A single byte without it is accepted as well, as sent before the
+		// report descriptor had report IDs.
+		var leds uint8
+		switch {
+		case len(out) >= 2 && out[0] == reportIDKeyboard:
+			leds = out[1]
+		case len(out) == 1:
+			leds = out[0]
+		default:
+			return nil
+		}
+		k.stateMu.Lock()
+		k.ledState = leds
+		ledCallback := k.ledCallback
+		k.stateMu.Unlock()
+
+		if ledCallback != nil {
+			ledCallback(LEDState{
+				NumLock:    leds&LEDNumLock != 0,
+				CapsLock:   leds&LEDCapsLock != 0,
+				ScrollLock: leds&LEDScrollLock != 0,
+				Compose:    leds&LEDCompose != 0,
+				Kana:       leds&LEDKana != 0,
+			})
 		}
 	}
 	return nil
 }
 
-// HID Report Descriptor for a full keyboard with 256-bit key bitmap and LED output.
-var reportDescriptor = hid.ReportDescriptor{
-	Items: []hid.Item{
-		hid.UsagePage{Page: hid.UsagePageGenericDesktop},
-		hid.Usage{Usage: hid.UsageKeyboard},
-		hid.Collection{
-			Kind: hid.CollectionApplication,
-			Items: []hid.Item{
-				// Input Report: Modifiers (1 byte)
-				hid.UsagePage{Page: hid.UsagePageKeyboard},
-				hid.UsageMinimum{Min: 0xE0}, // Left Control
-				hid.UsageMaximum{Max: 0xE7}, // Right GUI
-				hid.LogicalMinimum{Min: 0},
-				hid.LogicalMaximum{Max: 1},
-				hid.ReportSize{Bits: 1},
-				hid.ReportCount{Count: 8},
-				hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
-
-				// Input Report: Reserved byte (1 byte)
-				hid.ReportSize{Bits: 8},
-				hid.ReportCount{Count: 1},
-				hid.Input{Flags: hid.MainConst},
-
-				// Input Report: Key array bitmap (32 bytes = 256 bits)
-				hid.UsagePage{Page: hid.UsagePageKeyboard},
-				hid.UsageMinimum{Min: 0x00},
-				hid.UsageMaximum{Max: 0xFF},
-				hid.LogicalMinimum{Min: 0},
-				hid.LogicalMaximum{Max: 1},
-				hid.ReportSize{Bits: 1},
-				hid.ReportCount{Count: 256},
-				hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
-
-				// Output Report: LEDs (1 byte)
-				hid.UsagePage{Page: hid.UsagePageLEDs},
-				hid.UsageMinimum{Min: 0x01}, // Num Lock
-				hid.UsageMaximum{Max: 0x05}, // Kana
-				hid.LogicalMinimum{Min: 0},
-				hid.LogicalMaximum{Max: 1},
-				hid.ReportSize{Bits: 1},
-				hid.ReportCount{Count: 5},
-				hid.Output{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
-				hid.ReportSize{Bits: 3},
-				hid.ReportCount{Count: 1},
-				hid.Output{Flags: hid.MainConst},
-			},
+// keysReportItems is the keyboard collection with a 256-bit key bitmap and LED
+// output.
+var keysReportItems = []hid.Item{
+	hid.UsagePage{Page: hid.UsagePageGenericDesktop},
+	hid.Usage{Usage: hid.UsageKeyboard},
+	hid.Collection{
+		Kind: hid.CollectionApplication,
+		Items: []hid.Item{
+			hid.ReportID{ID: reportIDKeyboard},
+
+			// Input Report: Modifiers (1 byte)
+			hid.UsagePage{Page: hid.UsagePageKeyboard},
+			hid.UsageMinimum{Min: 0xE0}, // Left Control
+			hid.UsageMaximum{Max: 0xE7}, // Right GUI
+			hid.LogicalMinimum{Min: 0},
+			hid.LogicalMaximum{Max: 1},
+			hid.ReportSize{Bits: 1},
+			hid.ReportCount{Count: 8},
+			hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
+
+			// Input Report: Reserved byte (1 byte)
+			hid.ReportSize{Bits: 8},
+			hid.ReportCount{Count: 1},
+			hid.Input{Flags: hid.MainConst},
+
+			// Input Report: Key array bitmap (32 bytes = 256 bits)
+			hid.UsagePage{Page: hid.UsagePageKeyboard},
+			hid.UsageMinimum{Min: 0x00},
+			hid.UsageMaximum{Max: 0xFF},
+			hid.LogicalMinimum{Min: 0},
+			hid.LogicalMaximum{Max: 1},
+			hid.ReportSize{Bits: 1},
+			hid.ReportCount{Count: 256},
+			hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
+
+			// Output Report: LEDs (1 byte)
+			hid.UsagePage{Page: hid.UsagePageLEDs},
+			hid.UsageMinimum{Min: 0x01}, // Num Lock
+			hid.UsageMaximum{Max: 0x05}, // Kana
+			hid.LogicalMinimum{Min: 0},
+			hid.LogicalMaximum{Max: 1},
+			hid.ReportSize{Bits: 1},
+			hid.ReportCount{Count: 5},
+			hid.Output{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
+			hid.ReportSize{Bits: 3},
+			hid.ReportCount{Count: 1},
+			hid.Output{Flags: hid.MainConst},
 		},
 	},
 }
 
+// controlReportItems are the Consumer Control and System Control collections,
+// on report IDs of their own.
+var controlReportItems = []hid.Item{
+	hid.UsagePage{Page: hid.UsagePageConsumer},
+	hid.Usage{Usage: hid.UsageConsumerControl},
+	hid.Collection{
+		Kind: hid.CollectionApplication,
+		Items: []hid.Item{
+			hid.ReportID{ID: reportIDConsumer},
+
+			// Input Report: Consumer usage array (4x 16 bit)
+			hid.UsageMinimum{Min: 0x00},
+			hid.UsageMaximum{Max: consumerMaxUsage},
+			hid.LogicalMinimum{Min: 0},
+			hid.LogicalMaximum{Max: consumerMaxUsage},
+			hid.ReportSize{Bits: 16},
+			hid.ReportCount{Count: ConsumerMaxKeys},
+			hid.Input{Flags: hid.MainData | hid.MainArray | hid.MainAbs},
+		},
+	},
+
+	hid.UsagePage{Page: hid.UsagePageGenericDesktop},
+	hid.Usage{Usage: hid.UsageSystemControl},
+	hid.Collection{
+		Kind: hid.CollectionApplication,
+		Items: []hid.Item{
+			hid.ReportID{ID: reportIDSystem},
+
+			// Input Report: Power Down, Sleep, Wake Up (3 bits)
+			hid.UsageMinimum{Min: hid.UsageSystemPowerDown},
+			hid.UsageMaximum{Max: hid.UsageSystemWakeUp},
+			hid.LogicalMinimum{Min: 0},
+			hid.LogicalMaximum{Max: 1},
+			hid.ReportSize{Bits: 1},
+			hid.ReportCount{Count: 3},
+			hid.Input{Flags: hid.MainData | hid.MainVar | hid.MainAbs},
+			hid.ReportSize{Bits: 5},
+			hid.ReportCount{Count: 1},
+			hid.Input{Flags: hid.MainConst},
+		},
+	},
+}
+
+// HID Report Descriptor for a full keyboard with 256-bit key bitmap and LED output,
+// plus Consumer Control and System Control collections on their own report IDs.
+var reportDescriptor = hid.ReportDescriptor{Items: slices.Concat(keysReportItems, controlReportItems)}
+
+// KeysReportItems returns the report descriptor items of the keyboard report
+// (report ID 1), for composite devices, see ReadKeysReport.
+func KeysReportItems() []hid.Item { return slices.Clone(keysReportItems) }
+
+// ControlReportItems returns the report descriptor items of the consumer and
+// system control reports (report IDs 2 and 3), for composite devices, see
+// ReadControlReport.
+func ControlReportItems() []hid.Item { return slices.Clone(controlReportItems) }
+
 // Descriptor defines the static USB descriptor for the keyboard.
 var defaultDescriptor = usb.Descriptor{
 	Device: usb.DeviceDescriptor{
@@ -221,5 +513,8 @@ func (k *Keyboard) GetDescriptor() *usb.Descriptor {
 }
 
 func (k *Keyboard) GetDeviceSpecificArgs() map[string]any {
+	if k.queue != nil {
+		return map[string]any{"queueSize": k.queue.Cap()}
+	}
 	return map[string]any{}
 }
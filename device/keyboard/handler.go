@@ -1,10 +1,12 @@
 package keyboard
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"time"
 
 	"github.com/Alia5/VIIPER/device"
 	"github.com/Alia5/VIIPER/internal/server/api"
@@ -15,6 +17,15 @@ func init() {
 	api.RegisterDevice("keyboard", &handler{})
 }
 
+// frameTailTimeout is how long the rest of an input frame may take to arrive
+// once its keys were read. Clients still sending the old frame format
+// (modifiers, count and keys only) never send it.
+const frameTailTimeout = time.Second
+
+// errLegacyFrame is returned for input frames missing the consumer and system
+// control fields.
+var errLegacyFrame = errors.New("incomplete input frame: expected consumerCount, consumer usages and system byte after the keys (old frame format?)")
+
 type handler struct{}
 
 func (h *handler) CreateDevice(o *device.CreateOptions) (usb.Device, error) { return New(o) }
@@ -31,23 +42,8 @@ func (h *handler) StreamHandler() api.StreamHandlerFunc {
 
 		// Set LED callback to write LED state to client
 		kdev.SetLEDCallback(func(led LEDState) {
-			ledByte := uint8(0)
-			if led.NumLock {
-				ledByte |= LEDNumLock
-			}
-			if led.CapsLock {
-				ledByte |= LEDCapsLock
-			}
-			if led.ScrollLock {
-				ledByte |= LEDScrollLock
-			}
-			if led.Compose {
-				ledByte |= LEDCompose
-			}
-			if led.Kana {
-				ledByte |= LEDKana
-			}
-			if _, err := conn.Write([]byte{ledByte}); err != nil {
+			data, _ := led.MarshalBinary()
+			if _, err := conn.Write(data); err != nil {
 				logger.Warn("failed to write LED state", "error", err)
 			}
 		})
@@ -74,18 +70,48 @@ func (h *handler) StreamHandler() api.StreamHandlerFunc {
 				}
 			}
 
+			// Read consumer usages and system control byte
+			if err := conn.SetReadDeadline(time.Now().Add(frameTailTimeout)); err != nil {
+				return fmt.Errorf("set read deadline: %w", err)
+			}
+			consumerCount := make([]byte, 1)
+			if _, err := io.ReadFull(conn, consumerCount); err != nil {
+				return frameTailError("read consumer count", err)
+			}
+			if consumerCount[0] > ConsumerMaxKeys {
+				return fmt.Errorf("too many consumer usages: %d > %d (old frame format?)", consumerCount[0], ConsumerMaxKeys)
+			}
+			tail := make([]byte, 2*int(consumerCount[0])+1)
+			if _, err := io.ReadFull(conn, tail); err != nil {
+				return frameTailError("read consumer usages", err)
+			}
+			if err := conn.SetReadDeadline(time.Time{}); err != nil {
+				return fmt.Errorf("clear read deadline: %w", err)
+			}
+
 			// Build full packet and unmarshal
-			fullPacket := append(header, keys...)
+			fullPacket := append(append(append(header, keys...), consumerCount...), tail...)
 			var state InputState
 			if err := state.UnmarshalBinary(fullPacket); err != nil {
 				return fmt.Errorf("unmarshal input state: %w", err)
 			}
 
 			kdev.UpdateInputState(state)
+			api.RecordFrame(conn, fullPacket)
 		}
 	}
 }
 
+// frameTailError wraps err, reading the rest of an input frame, as
+// errLegacyFrame if the rest did not arrive in time.
+func frameTailError(what string, err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errLegacyFrame
+	}
+	return fmt.Errorf("%s: %w", what, err)
+}
+
 func (h *handler) UpdateMetaState(meta string, dev *usb.Device) error {
-	return nil
+	return device.ErrNoMetaState
 }
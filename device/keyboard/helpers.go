@@ -17,6 +17,8 @@ func NeedsShift(c byte) bool {
 // TypeString converts a string into a sequence of InputState press/release pairs.
 // Automatically handles shift modifiers for uppercase letters and symbols.
 // Returns a slice of states alternating between press and release.
+// Only ASCII on a US layout is supported; see Layout.TypeString for other
+// layouts and non-ASCII text.
 //
 // Example:
 //
@@ -1,15 +1,21 @@
 package keyboard
 
 import (
+	"encoding/binary"
+	"fmt"
 	"io"
 )
 
 // InputState represents the keyboard state used to build a report.
 // Internally uses a 256-bit bitmap for N-key rollover support.
-// viiper:wire keyboard c2s modifiers:u8 count:u8 keys:u8*count
+// Consumer Page usages and System Control buttons are sent in their own reports.
+// viiper:wire keyboard c2s modifiers:u8 count:u8 keys:u8*count consumerCount:u8 consumer:u16*consumerCount system:u8
 type InputState struct {
 	Modifiers uint8     // bit 0-7: LCtrl, LShift, LAlt, LGui, RCtrl, RShift, RAlt, RGui
 	KeyBitmap [32]uint8 // 256 bits for HID usage codes 0x00-0xFF
+	// Consumer holds the pressed Consumer Page usages, 0 = unused slot
+	Consumer [ConsumerMaxKeys]uint16
+	System   uint8 // bit 0-2: Power Down, Sleep, Wake Up
 }
 
 // NewInputState returns a keyboard input state in its neutral/resting state.
@@ -18,11 +24,32 @@ func NewInputState() *InputState { return &InputState{} }
 // LEDState represents the state of keyboard LEDs controlled by the host.
 // viiper:wire keyboard s2c leds:u8
 type LEDState struct {
-	NumLock    bool
-	CapsLock   bool
-	ScrollLock bool
-	Compose    bool
-	Kana       bool
+	NumLock    bool `json:"numLock"`
+	CapsLock   bool `json:"capsLock"`
+	ScrollLock bool `json:"scrollLock"`
+	Compose    bool `json:"compose"`
+	Kana       bool `json:"kana"`
+}
+
+// MarshalBinary encodes LEDState into a 1-byte LED bitmask.
+func (ls *LEDState) MarshalBinary() ([]byte, error) {
+	var b uint8
+	if ls.NumLock {
+		b |= LEDNumLock
+	}
+	if ls.CapsLock {
+		b |= LEDCapsLock
+	}
+	if ls.ScrollLock {
+		b |= LEDScrollLock
+	}
+	if ls.Compose {
+		b |= LEDCompose
+	}
+	if ls.Kana {
+		b |= LEDKana
+	}
+	return []byte{b}, nil
 }
 
 // UnmarshalBinary decodes a 1-byte LED bitmask into LEDState.
@@ -40,29 +67,63 @@ func (ls *LEDState) UnmarshalBinary(data []byte) error {
 	return nil
 }
 
-// BuildReport encodes an InputState into the 34-byte HID keyboard report.
+// BuildReport encodes an InputState into the 35-byte HID keyboard report.
 //
-// Report layout (34 bytes):
+// Report layout (35 bytes):
 //
-//	Byte 0: Modifiers (8 bits)
-//	Byte 1: Reserved (0x00)
-//	Bytes 2-33: Key bitmap (256 bits, 32 bytes)
+//	Byte 0: Report ID (0x01)
+//	Byte 1: Modifiers (8 bits)
+//	Byte 2: Reserved (0x00)
+//	Bytes 3-34: Key bitmap (256 bits, 32 bytes)
 func (kb *InputState) BuildReport() []byte {
-	b := make([]byte, 34)
-	b[0] = kb.Modifiers
-	b[1] = 0x00 // Reserved
-	copy(b[2:34], kb.KeyBitmap[:])
+	b := make([]byte, 35)
+	b[0] = reportIDKeyboard
+	b[1] = kb.Modifiers
+	b[2] = 0x00 // Reserved
+	copy(b[3:35], kb.KeyBitmap[:])
 	return b
 }
 
-// MarshalBinary encodes InputState to variable-length wire format.
+// BuildConsumerReport encodes the Consumer Page usages into the 9-byte
+// consumer control report.
 //
-// Wire format:
+// Report layout (9 bytes):
 //
-//	Byte 0: Modifiers
-//	Byte 1: Key count
-//	Bytes 2+: Key codes (HID usage codes of pressed keys)
-func (kb *InputState) MarshalBinary() ([]byte, error) {
+//	Byte 0: Report ID (0x02)
+//	Bytes 1-8: Pressed usages (4x uint16, unused slots 0)
+func (kb *InputState) BuildConsumerReport() []byte {
+	b := make([]byte, 1, 1+2*ConsumerMaxKeys)
+	b[0] = reportIDConsumer
+	for _, u := range kb.ConsumerUsages() {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return b[:cap(b)]
+}
+
+// BuildSystemReport encodes the System Control buttons into the 2-byte
+// system control report.
+//
+// Report layout (2 bytes):
+//
+//	Byte 0: Report ID (0x03)
+//	Byte 1: Power Down (bit 0), Sleep (bit 1), Wake Up (bit 2)
+func (kb *InputState) BuildSystemReport() []byte {
+	return []byte{reportIDSystem, kb.System & (SysPowerDown | SysSleep | SysWakeUp)}
+}
+
+// ConsumerUsages returns the pressed Consumer Page usages, skipping unused slots.
+func (kb *InputState) ConsumerUsages() []uint16 {
+	var usages []uint16
+	for _, u := range kb.Consumer {
+		if u != 0 {
+			usages = append(usages, u)
+		}
+	}
+	return usages
+}
+
+// PressedKeys returns the HID usage codes of all pressed keys in ascending order.
+func (kb *InputState) PressedKeys() []uint8 {
 	var keys []uint8
 	for i := 0; i < 256; i++ {
 		byteIdx := i / 8
@@ -71,11 +132,31 @@ func (kb *InputState) MarshalBinary() ([]byte, error) {
 			keys = append(keys, uint8(i))
 		}
 	}
+	return keys
+}
 
-	b := make([]byte, 2+len(keys))
+// MarshalBinary encodes InputState to variable-length wire format.
+//
+// Wire format:
+//
+//	Byte 0: Modifiers
+//	Byte 1: Key count
+//	Bytes 2+: Key codes (HID usage codes of pressed keys)
+//	Next byte: Consumer usage count (0-4)
+//	Next 2*count bytes: Consumer usages (uint16, little-endian)
+//	Last byte: System Control bitfield
+func (kb *InputState) MarshalBinary() ([]byte, error) {
+	keys := kb.PressedKeys()
+	consumer := kb.ConsumerUsages()
+	b := make([]byte, 2+len(keys), 2+len(keys)+2+2*len(consumer))
 	b[0] = kb.Modifiers
 	b[1] = uint8(len(keys))
 	copy(b[2:], keys)
+	b = append(b, uint8(len(consumer)))
+	for _, u := range consumer {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	b = append(b, kb.System)
 	return b, nil
 }
 
@@ -86,6 +167,9 @@ func (kb *InputState) MarshalBinary() ([]byte, error) {
 //	Byte 0: Modifiers
 //	Byte 1: Key count
 //	Bytes 2+: Key codes (HID usage codes of pressed keys)
+//	Next byte: Consumer usage count (0-4)
+//	Next 2*count bytes: Consumer usages (uint16, little-endian)
+//	Last byte: System Control bitfield
 func (kb *InputState) UnmarshalBinary(data []byte) error {
 	if len(data) < 2 {
 		return io.ErrUnexpectedEOF
@@ -94,7 +178,15 @@ func (kb *InputState) UnmarshalBinary(data []byte) error {
 	kb.Modifiers = data[0]
 	keyCount := int(data[1])
 
-	if len(data) < 2+keyCount {
+	if len(data) < 2+keyCount+1 {
+		return io.ErrUnexpectedEOF
+	}
+	consumerCount := int(data[2+keyCount])
+	if consumerCount > ConsumerMaxKeys {
+		return fmt.Errorf("too many consumer usages: %d > %d", consumerCount, ConsumerMaxKeys)
+	}
+	consumer := data[2+keyCount+1:]
+	if len(consumer) < 2*consumerCount+1 {
 		return io.ErrUnexpectedEOF
 	}
 
@@ -109,5 +201,11 @@ func (kb *InputState) UnmarshalBinary(data []byte) error {
 		kb.KeyBitmap[byteIdx] |= 1 << bitIdx
 	}
 
+	kb.Consumer = [ConsumerMaxKeys]uint16{}
+	for i := range consumerCount {
+		kb.Consumer[i] = binary.LittleEndian.Uint16(consumer[2*i:])
+	}
+	kb.System = consumer[2*consumerCount]
+
 	return nil
 }
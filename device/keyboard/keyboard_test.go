@@ -3,13 +3,17 @@ package keyboard_test
 import (
 	"context"
 	"io"
+	"log/slog"
+	"net"
 	"testing"
 	"time"
 
 	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/device"
 	"github.com/Alia5/VIIPER/device/keyboard"
 	"github.com/Alia5/VIIPER/internal/server/api"
 	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/usb"
 	"github.com/Alia5/VIIPER/usbip"
 	"github.com/Alia5/VIIPER/viiperclient"
 	"github.com/Alia5/VIIPER/virtualbus"
@@ -32,32 +36,32 @@ func TestInputReports(t *testing.T) {
 				Modifiers: 0,
 				KeyBitmap: [32]uint8{},
 			},
-			expectedReport: []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+			expectedReport: []byte{0x01, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
 		},
 		{
 			name:           "C",
 			inputState:     keyboard.PressKey(keyboard.KeyC),
-			expectedReport: []byte{0x00, 0x00, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			expectedReport: []byte{0x01, 0x00, 0x00, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
 		},
 		{
 			name:           "CTRL+C",
 			inputState:     keyboard.PressKeyWithMod(keyboard.ModLeftCtrl, keyboard.KeyC),
-			expectedReport: []byte{0x01, 0x00, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			expectedReport: []byte{0x01, 0x01, 0x00, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
 		},
 		{
 			name:           "SHIFT+C",
 			inputState:     keyboard.PressKeyWithMod(keyboard.ModLeftShift, keyboard.KeyC),
-			expectedReport: []byte{0x02, 0x00, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			expectedReport: []byte{0x01, 0x02, 0x00, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
 		},
 		{
 			name:           "ALT+C",
 			inputState:     keyboard.PressKeyWithMod(keyboard.ModLeftAlt, keyboard.KeyC),
-			expectedReport: []byte{0x04, 0x00, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			expectedReport: []byte{0x01, 0x04, 0x00, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
 		},
 		{
 			name:           "WASD",
 			inputState:     keyboard.PressKey(keyboard.KeyW, keyboard.KeyA, keyboard.KeyS, keyboard.KeyD),
-			expectedReport: []byte{0x00, 0x00, 0x90, 0x00, 0x40, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			expectedReport: []byte{0x01, 0x00, 0x00, 0x90, 0x00, 0x40, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
 		},
 	}
 
@@ -129,30 +133,35 @@ func TestLEDs(t *testing.T) {
 		{
 			name:      "off",
 			ledMask:   0x00,
-			outPacket: []byte{0x00},
+			outPacket: []byte{0x01, 0x00},
 		},
 		{
 			name:      "numlock",
 			ledMask:   keyboard.LEDNumLock,
-			outPacket: []byte{keyboard.LEDNumLock},
+			outPacket: []byte{0x01, keyboard.LEDNumLock},
 		},
 		{
 			name:      "capslock",
 			ledMask:   keyboard.LEDCapsLock,
-			outPacket: []byte{keyboard.LEDCapsLock},
+			outPacket: []byte{0x01, keyboard.LEDCapsLock},
 		},
 		{
 			name:      "scrolllock",
 			ledMask:   keyboard.LEDScrollLock,
-			outPacket: []byte{keyboard.LEDScrollLock},
+			outPacket: []byte{0x01, keyboard.LEDScrollLock},
 		},
 		{
 			name:    "all",
 			ledMask: keyboard.LEDNumLock | keyboard.LEDCapsLock | keyboard.LEDScrollLock | keyboard.LEDCompose | keyboard.LEDKana,
 			outPacket: []byte{
-				keyboard.LEDNumLock | keyboard.LEDCapsLock | keyboard.LEDScrollLock | keyboard.LEDCompose | keyboard.LEDKana,
+				0x01, keyboard.LEDNumLock | keyboard.LEDCapsLock | keyboard.LEDScrollLock | keyboard.LEDCompose | keyboard.LEDKana,
 			},
 		},
+		{
+			name:      "without report id",
+			ledMask:   keyboard.LEDCapsLock,
+			outPacket: []byte{keyboard.LEDCapsLock},
+		},
 	}
 
 	s := viiperTesting.NewTestServer(t)
@@ -212,3 +221,234 @@ func TestLEDs(t *testing.T) {
 		})
 	}
 }
+
+func TestConsumerAndSystemReports(t *testing.T) {
+	kb, err := keyboard.New(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	poll := func() []byte {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		return kb.HandleTransfer(ctx, 1, usbip.DirIn, nil)
+	}
+
+	empty := keyboard.InputState{}
+	assert.Equal(t, empty.BuildReport(), poll(), "initial keyboard report")
+	assert.Nil(t, poll())
+
+	// Only the changed reports are sent.
+	state := keyboard.InputState{Consumer: [keyboard.ConsumerMaxKeys]uint16{keyboard.ConsumerVolumeUp, 0, keyboard.ConsumerBrowserBack}}
+	kb.UpdateInputState(state)
+	assert.Equal(t, []byte{0x02, 0xE9, 0x00, 0x24, 0x02, 0x00, 0x00, 0x00, 0x00}, poll())
+	assert.Nil(t, poll())
+
+	state.System = keyboard.SysSleep
+	kb.UpdateInputState(state)
+	assert.Equal(t, []byte{0x03, keyboard.SysSleep}, poll())
+
+	state = keyboard.PressKey(keyboard.KeyA)
+	kb.UpdateInputState(state)
+	assert.Equal(t, state.BuildReport(), poll())
+	assert.Equal(t, []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, poll())
+	assert.Equal(t, []byte{0x03, 0x00}, poll())
+	assert.Nil(t, poll())
+}
+
+func TestGetInputReport(t *testing.T) {
+	kb, err := keyboard.New(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	state := keyboard.PressKey(keyboard.KeyA)
+	state.Consumer[0] = keyboard.ConsumerMute
+	kb.UpdateInputState(state)
+
+	assert.Equal(t, state.BuildReport(), kb.GetInputReport(0, 1))
+	assert.Equal(t, state.BuildConsumerReport(), kb.GetInputReport(0, 2))
+	assert.Equal(t, state.BuildSystemReport(), kb.GetInputReport(0, 3))
+	assert.Nil(t, kb.GetInputReport(0, 4))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, state.BuildReport(), kb.HandleTransfer(ctx, 1, usbip.DirIn, nil), "GET_REPORT does not consume pending reports")
+
+	kb.SetControlReports(false)
+	assert.Nil(t, kb.GetInputReport(0, 2))
+}
+
+func TestQueuedInput(t *testing.T) {
+	kb, err := keyboard.New(&device.CreateOptions{DeviceSpecific: `{"queueSize": 3}`})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]any{"queueSize": 3}, kb.GetDeviceSpecificArgs())
+	poll := func() []byte {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		return kb.HandleTransfer(ctx, 1, usbip.DirIn, nil)
+	}
+	empty := keyboard.InputState{}
+	assert.Equal(t, empty.BuildReport(), poll(), "initial keyboard report")
+
+	// A press and release between two polls reaches the host.
+	a, b := keyboard.PressKey(keyboard.KeyA), keyboard.PressKey(keyboard.KeyB)
+	kb.UpdateInputState(a)
+	kb.UpdateInputState(empty)
+	kb.UpdateInputState(b)
+	length, capacity, overflows, ok := kb.InputQueueStatus()
+	assert.True(t, ok)
+	assert.Equal(t, 3, length)
+	assert.Equal(t, 3, capacity)
+	assert.Equal(t, uint64(0), overflows)
+
+	assert.Equal(t, a.BuildReport(), poll())
+	assert.Equal(t, empty.BuildReport(), poll())
+	assert.Equal(t, b.BuildReport(), poll())
+	assert.Nil(t, poll())
+
+	// Overflowing states are merged into the last queued one, keeping their
+	// key presses; the final state is sent once the queue has drained.
+	for _, st := range []keyboard.InputState{a, empty, a, b, empty} {
+		kb.UpdateInputState(st)
+	}
+	length, _, overflows, _ = kb.InputQueueStatus()
+	assert.Equal(t, 3, length)
+	assert.Equal(t, uint64(2), overflows)
+	ab := keyboard.PressKey(keyboard.KeyA, keyboard.KeyB)
+	assert.Equal(t, a.BuildReport(), poll())
+	assert.Equal(t, empty.BuildReport(), poll())
+	assert.Equal(t, ab.BuildReport(), poll(), "the tap of b is kept")
+	assert.Equal(t, empty.BuildReport(), poll(), "the final release is sent")
+	assert.Nil(t, poll())
+
+	_, err = keyboard.New(&device.CreateOptions{DeviceSpecific: `{"queueSize": 5000}`})
+	assert.Error(t, err)
+	kb, err = keyboard.New(nil)
+	if assert.NoError(t, err) {
+		_, _, _, ok = kb.InputQueueStatus()
+		assert.False(t, ok)
+	}
+}
+
+func TestLayouts(t *testing.T) {
+	stroke := func(mods, key uint8) keyboard.Keystroke { return keyboard.Keystroke{Modifiers: mods, Key: key} }
+	shift, altGr := uint8(keyboard.ModLeftShift), uint8(keyboard.ModRightAlt)
+	cases := []struct {
+		layout string
+		char   rune
+		want   []keyboard.Keystroke
+	}{
+		{"us", 'a', []keyboard.Keystroke{stroke(0, keyboard.KeyA)}},
+		{"us", 'A', []keyboard.Keystroke{stroke(shift, keyboard.KeyA)}},
+		{"us", '@', []keyboard.Keystroke{stroke(shift, keyboard.Key2)}},
+		{"uk", '"', []keyboard.Keystroke{stroke(shift, keyboard.Key2)}},
+		{"uk", '€', []keyboard.Keystroke{stroke(altGr, keyboard.Key4)}},
+		{"uk", '#', []keyboard.Keystroke{stroke(0, keyboard.KeyNonUSHash)}},
+		{"de", 'z', []keyboard.Keystroke{stroke(0, keyboard.KeyY)}},
+		{"de", '@', []keyboard.Keystroke{stroke(altGr, keyboard.KeyQ)}},
+		{"de", 'ß', []keyboard.Keystroke{stroke(0, keyboard.KeyMinus)}},
+		{"de", 'é', []keyboard.Keystroke{stroke(0, keyboard.KeyEqual), stroke(0, keyboard.KeyE)}},
+		{"de", 'È', []keyboard.Keystroke{stroke(shift, keyboard.KeyEqual), stroke(shift, keyboard.KeyE)}},
+		{"de", '^', []keyboard.Keystroke{stroke(0, keyboard.KeyGrave), stroke(0, keyboard.KeySpace)}},
+		{"fr", 'a', []keyboard.Keystroke{stroke(0, keyboard.KeyQ)}},
+		{"fr", '1', []keyboard.Keystroke{stroke(shift, keyboard.Key1)}},
+		{"fr", 'é', []keyboard.Keystroke{stroke(0, keyboard.Key2)}},
+		{"fr", 'ê', []keyboard.Keystroke{stroke(0, keyboard.KeyLeftBrace), stroke(0, keyboard.KeyE)}},
+		{"fr", 'ï', []keyboard.Keystroke{stroke(shift, keyboard.KeyLeftBrace), stroke(0, keyboard.KeyI)}},
+		{"fr", '^', []keyboard.Keystroke{stroke(altGr, keyboard.Key9)}},
+		{"fr", '~', []keyboard.Keystroke{stroke(altGr, keyboard.Key2), stroke(0, keyboard.KeySpace)}},
+		{"es", 'ñ', []keyboard.Keystroke{stroke(0, keyboard.KeySemicolon)}},
+		{"es", 'á', []keyboard.Keystroke{stroke(0, keyboard.KeyApostrophe), stroke(0, keyboard.KeyA)}},
+		{"es", 'ü', []keyboard.Keystroke{stroke(shift, keyboard.KeyApostrophe), stroke(0, keyboard.KeyU)}},
+		{"es", 'õ', []keyboard.Keystroke{stroke(altGr, keyboard.Key4), stroke(0, keyboard.KeyO)}},
+	}
+	for _, tc := range cases {
+		l, ok := keyboard.LookupLayout(tc.layout)
+		if !assert.True(t, ok, tc.layout) {
+			continue
+		}
+		got, ok := l.Strokes(tc.char)
+		assert.True(t, ok, "%s %q", tc.layout, tc.char)
+		assert.Equal(t, tc.want, got, "%s %q", tc.layout, tc.char)
+	}
+
+	assert.Equal(t, []string{"de", "es", "fr", "uk", "us"}, keyboard.LayoutNames())
+	_, ok := keyboard.LookupLayout("xx")
+	assert.False(t, ok)
+	de, ok := keyboard.LookupLayout("DE")
+	if !assert.True(t, ok) {
+		return
+	}
+
+	states, err := de.TypeString("Zé\r\n")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []keyboard.InputState{
+			keyboard.PressKeyWithMod(keyboard.ModLeftShift, keyboard.KeyY), keyboard.Release(),
+			keyboard.PressKey(keyboard.KeyEqual), keyboard.Release(),
+			keyboard.PressKey(keyboard.KeyE), keyboard.Release(),
+			keyboard.PressKey(keyboard.KeyEnter), keyboard.Release(),
+		}, states)
+	}
+	_, err = de.TypeString("a日b日")
+	assert.ErrorContains(t, err, `cannot type "日"`)
+
+	// The US layout types the same as TypeString.
+	us, _ := keyboard.LookupLayout("us")
+	ascii := "Hello, World! ~`{}|\"?"
+	states, err = us.TypeString(ascii)
+	if assert.NoError(t, err) {
+		assert.Equal(t, keyboard.TypeString(ascii), states)
+	}
+}
+
+func TestLegacyFrameFormat(t *testing.T) {
+	kb, err := keyboard.New(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	dev := usb.Device(kb)
+	server, client := net.Pipe()
+	defer client.Close() // nolint
+
+	done := make(chan error, 1)
+	go func() {
+		done <- api.GetRegistration("keyboard").StreamHandler()(server, &dev, slog.New(slog.DiscardHandler))
+	}()
+
+	// Modifiers, count and keys only, as sent before consumer and system
+	// control support.
+	_, err = client.Write([]byte{keyboard.ModLeftShift, 1, keyboard.KeyA})
+	if !assert.NoError(t, err) {
+		return
+	}
+	select {
+	case err := <-done:
+		assert.ErrorContains(t, err, "old frame format")
+	case <-time.After(3 * time.Second):
+		t.Fatal("stream handler did not reject the old frame format")
+	}
+}
+
+func TestWireFormat(t *testing.T) {
+	state := keyboard.PressKeyWithMod(keyboard.ModLeftShift, keyboard.KeyA)
+	state.Consumer[1] = keyboard.ConsumerPlayPause
+	state.System = keyboard.SysPowerDown
+
+	b, err := state.MarshalBinary()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []byte{keyboard.ModLeftShift, 1, keyboard.KeyA, 1, 0xCD, 0x00, keyboard.SysPowerDown}, b)
+
+	var got keyboard.InputState
+	if !assert.NoError(t, got.UnmarshalBinary(b)) {
+		return
+	}
+	assert.Equal(t, state.KeyBitmap, got.KeyBitmap)
+	assert.Equal(t, []uint16{keyboard.ConsumerPlayPause}, got.ConsumerUsages())
+	assert.Equal(t, state.System, got.System)
+
+	assert.Error(t, got.UnmarshalBinary([]byte{0, 0, 5, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}))
+	assert.ErrorIs(t, got.UnmarshalBinary([]byte{0, 0, 1, 0xCD}), io.ErrUnexpectedEOF)
+}
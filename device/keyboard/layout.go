@@ -0,0 +1,215 @@
+package keyboard
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Keystroke is a key pressed together with modifiers.
+type Keystroke struct {
+	Modifiers uint8
+	Key       uint8
+}
+
+// Layout maps characters to the keystrokes typing them on a host that uses a
+// given keyboard layout. Layouts follow the Windows definitions; AltGr is sent
+// as right Alt.
+type Layout struct {
+	Name  string
+	chars map[rune][]Keystroke
+}
+
+// LookupLayout returns the layout with the given name (us, uk, de, fr, es),
+// case-insensitive.
+func LookupLayout(name string) (*Layout, bool) {
+	l, ok := layouts[strings.ToLower(name)]
+	return l, ok
+}
+
+// LayoutNames returns the names of all layouts, sorted.
+func LayoutNames() []string {
+	return slices.Sorted(maps.Keys(layouts))
+}
+
+// Strokes returns the keystrokes typing r, one after the other. Characters
+// typed with a dead key take two keystrokes.
+func (l *Layout) Strokes(r rune) ([]Keystroke, bool) {
+	s, ok := l.chars[r]
+	return s, ok
+}
+
+// TypeString converts s into a sequence of InputState press/release pairs
+// typing it on a host using layout l.
+// "\r" is skipped, so "\r\n" types a single Enter.
+// It fails if s contains characters the layout cannot type.
+func (l *Layout) TypeString(s string) ([]InputState, error) {
+	var states []InputState
+	var missing []rune
+	for _, r := range s {
+		if r == '\r' {
+			continue
+		}
+		strokes, ok := l.chars[r]
+		if !ok {
+			if !slices.Contains(missing, r) {
+				missing = append(missing, r)
+			}
+			continue
+		}
+		for _, k := range strokes {
+			states = append(states, PressKeyWithMod(k.Modifiers, k.Key), Release())
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("layout %s cannot type %q", l.Name, string(missing))
+	}
+	return states, nil
+}
+
+// keyLevels holds the characters of a key: plain, with Shift, with AltGr and
+// with Shift+AltGr. 0 means none.
+type keyLevels [4]rune
+
+var levelModifiers = [4]uint8{0, ModLeftShift, ModRightAlt, ModLeftShift | ModRightAlt}
+
+// Spacing forms of the accents of dead keys.
+const (
+	accentGrave      = '`'
+	accentAcute      = '´'
+	accentCircumflex = '^'
+	accentDiaeresis  = '¨'
+	accentTilde      = '~'
+)
+
+// composed lists, per accent, pairs of a base character and the character a
+// dead key followed by it produces.
+var composed = map[rune]string{
+	accentGrave:      "aàeèiìoòuùAÀEÈIÌOÒUÙ",
+	accentAcute:      "aáeéiíoóuúyýAÁEÉIÍOÓUÚYÝ",
+	accentCircumflex: "aâeêiîoôuûAÂEÊIÎOÔUÛ",
+	accentDiaeresis:  "aäeëiïoöuüyÿAÄEËIÏOÖUÜYŸ",
+	accentTilde:      "aãnñoõAÃNÑOÕ",
+}
+
+// newLayout builds a layout from the characters on each key and its dead
+// keys. A dead key followed by a base character types the accented one, and
+// followed by Space the accent itself.
+func newLayout(name string, keys map[uint8]keyLevels, dead map[rune]Keystroke) *Layout {
+	l := &Layout{Name: name, chars: map[rune][]Keystroke{
+		' ':  {{Key: KeySpace}},
+		'\n': {{Key: KeyEnter}},
+		'\t': {{Key: KeyTab}},
+	}}
+	// Prefer the key needing the fewest modifiers if a character is on several.
+	codes := slices.Sorted(maps.Keys(keys))
+	for level, mods := range levelModifiers {
+		for _, code := range codes {
+			r := keys[code][level]
+			if _, ok := l.chars[r]; r != 0 && !ok {
+				l.chars[r] = []Keystroke{{Modifiers: mods, Key: code}}
+			}
+		}
+	}
+	for _, accent := range slices.Sorted(maps.Keys(dead)) {
+		dk := dead[accent]
+		if _, ok := l.chars[accent]; !ok {
+			l.chars[accent] = []Keystroke{dk, {Key: KeySpace}}
+		}
+		pairs := []rune(composed[accent])
+		for i := 0; i+1 < len(pairs); i += 2 {
+			base, r := pairs[i], pairs[i+1]
+			bs, ok := l.chars[base]
+			if _, exists := l.chars[r]; exists || !ok || len(bs) != 1 {
+				continue
+			}
+			l.chars[r] = []Keystroke{dk, bs[0]}
+		}
+	}
+	return l
+}
+
+// letters returns the keys of the letters a-z at their US positions, with
+// overrides replacing or adding keys.
+func letters(overrides map[uint8]keyLevels) map[uint8]keyLevels {
+	keys := map[uint8]keyLevels{}
+	for i := range rune(26) {
+		keys[uint8(KeyA+i)] = keyLevels{'a' + i, 'A' + i}
+	}
+	maps.Copy(keys, overrides)
+	return keys
+}
+
+var layouts = map[string]*Layout{
+	"us": newLayout("us", letters(map[uint8]keyLevels{
+		Key1: {'1', '!'}, Key2: {'2', '@'}, Key3: {'3', '#'}, Key4: {'4', '$'}, Key5: {'5', '%'},
+		Key6: {'6', '^'}, Key7: {'7', '&'}, Key8: {'8', '*'}, Key9: {'9', '('}, Key0: {'0', ')'},
+		KeyMinus: {'-', '_'}, KeyEqual: {'=', '+'},
+		KeyLeftBrace: {'[', '{'}, KeyRightBrace: {']', '}'}, KeyBackslash: {'\\', '|'},
+		KeySemicolon: {';', ':'}, KeyApostrophe: {'\'', '"'}, KeyGrave: {'`', '~'},
+		KeyComma: {',', '<'}, KeyPeriod: {'.', '>'}, KeySlash: {'/', '?'},
+	}), nil),
+
+	"uk": newLayout("uk", letters(map[uint8]keyLevels{
+		KeyA: {'a', 'A', 'á', 'Á'}, KeyE: {'e', 'E', 'é', 'É'}, KeyI: {'i', 'I', 'í', 'Í'},
+		KeyO: {'o', 'O', 'ó', 'Ó'}, KeyU: {'u', 'U', 'ú', 'Ú'},
+		Key1: {'1', '!'}, Key2: {'2', '"'}, Key3: {'3', '£'}, Key4: {'4', '$', '€'}, Key5: {'5', '%'},
+		Key6: {'6', '^'}, Key7: {'7', '&'}, Key8: {'8', '*'}, Key9: {'9', '('}, Key0: {'0', ')'},
+		KeyMinus: {'-', '_'}, KeyEqual: {'=', '+'},
+		KeyLeftBrace: {'[', '{'}, KeyRightBrace: {']', '}'}, KeyNonUSHash: {'#', '~'},
+		KeySemicolon: {';', ':'}, KeyApostrophe: {'\'', '@'}, KeyGrave: {'`', '¬', '¦'},
+		KeyComma: {',', '<'}, KeyPeriod: {'.', '>'}, KeySlash: {'/', '?'},
+		KeyNonUSBackslash: {'\\', '|'},
+	}), nil),
+
+	"de": newLayout("de", letters(map[uint8]keyLevels{
+		KeyY: {'z', 'Z'}, KeyZ: {'y', 'Y'},
+		KeyQ: {'q', 'Q', '@'}, KeyE: {'e', 'E', '€'}, KeyM: {'m', 'M', 'µ'},
+		Key1: {'1', '!'}, Key2: {'2', '"', '²'}, Key3: {'3', '§', '³'}, Key4: {'4', '$'}, Key5: {'5', '%'},
+		Key6: {'6', '&'}, Key7: {'7', '/', '{'}, Key8: {'8', '(', '['}, Key9: {'9', ')', ']'}, Key0: {'0', '=', '}'},
+		KeyMinus:     {'ß', '?', '\\'},
+		KeyLeftBrace: {'ü', 'Ü'}, KeyRightBrace: {'+', '*', '~'}, KeyNonUSHash: {'#', '\''},
+		KeySemicolon: {'ö', 'Ö'}, KeyApostrophe: {'ä', 'Ä'}, KeyGrave: {0, '°'},
+		KeyComma: {',', ';'}, KeyPeriod: {'.', ':'}, KeySlash: {'-', '_'},
+		KeyNonUSBackslash: {'<', '>', '|'},
+	}), map[rune]Keystroke{
+		accentCircumflex: {Key: KeyGrave},
+		accentAcute:      {Key: KeyEqual},
+		accentGrave:      {Modifiers: ModLeftShift, Key: KeyEqual},
+	}),
+
+	"fr": newLayout("fr", letters(map[uint8]keyLevels{
+		KeyQ: {'a', 'A'}, KeyA: {'q', 'Q'}, KeyW: {'z', 'Z'}, KeyZ: {'w', 'W'},
+		KeySemicolon: {'m', 'M'}, KeyM: {',', '?'}, KeyE: {'e', 'E', '€'},
+		Key1: {'&', '1'}, Key2: {'é', '2'}, Key3: {'"', '3', '#'}, Key4: {'\'', '4', '{'}, Key5: {'(', '5', '['},
+		Key6: {'-', '6', '|'}, Key7: {'è', '7'}, Key8: {'_', '8', '\\'}, Key9: {'ç', '9', '^'}, Key0: {'à', '0', '@'},
+		KeyMinus: {')', '°', ']'}, KeyEqual: {'=', '+', '}'},
+		KeyRightBrace: {'$', '£', '¤'}, KeyNonUSHash: {'*', 'µ'},
+		KeyApostrophe: {'ù', '%'}, KeyGrave: {'²'},
+		KeyComma: {';', '.'}, KeyPeriod: {':', '/'}, KeySlash: {'!', '§'},
+		KeyNonUSBackslash: {'<', '>'},
+	}), map[rune]Keystroke{
+		accentCircumflex: {Key: KeyLeftBrace},
+		accentDiaeresis:  {Modifiers: ModLeftShift, Key: KeyLeftBrace},
+		accentTilde:      {Modifiers: ModRightAlt, Key: Key2},
+		accentGrave:      {Modifiers: ModRightAlt, Key: Key7},
+	}),
+
+	"es": newLayout("es", letters(map[uint8]keyLevels{
+		KeyE: {'e', 'E', '€'},
+		Key1: {'1', '!', '|'}, Key2: {'2', '"', '@'}, Key3: {'3', '·', '#'}, Key4: {'4', '$'}, Key5: {'5', '%'},
+		Key6: {'6', '&', '¬'}, Key7: {'7', '/'}, Key8: {'8', '('}, Key9: {'9', ')'}, Key0: {'0', '='},
+		KeyMinus: {'\'', '?'}, KeyEqual: {'¡', '¿'},
+		KeyLeftBrace: {0, 0, '['}, KeyRightBrace: {'+', '*', ']'}, KeyNonUSHash: {'ç', 'Ç', '}'},
+		KeySemicolon: {'ñ', 'Ñ'}, KeyApostrophe: {0, 0, '{'}, KeyGrave: {'º', 'ª', '\\'},
+		KeyComma: {',', ';'}, KeyPeriod: {'.', ':'}, KeySlash: {'-', '_'},
+		KeyNonUSBackslash: {'<', '>'},
+	}), map[rune]Keystroke{
+		accentGrave:      {Key: KeyLeftBrace},
+		accentCircumflex: {Modifiers: ModLeftShift, Key: KeyLeftBrace},
+		accentAcute:      {Key: KeyApostrophe},
+		accentDiaeresis:  {Modifiers: ModLeftShift, Key: KeyApostrophe},
+		accentTilde:      {Modifiers: ModRightAlt, Key: Key4},
+	}),
+}
@@ -3,6 +3,10 @@ package mouse
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
 	"sync/atomic"
 
 	"github.com/Alia5/VIIPER/device"
@@ -16,11 +20,37 @@ import (
 type Mouse struct {
 	tick       uint64
 	inputCh    chan InputState
+	stateMu    sync.Mutex
+	inputState InputState
+	queue      *device.InputQueue[InputState]
+	wake       chan struct{}
 	descriptor usb.Descriptor
 }
 
+// Options is the DeviceSpecific payload accepted by the mouse device type.
+//
+// Example:
+//
+//	{"queueSize": 256}
+type Options struct {
+	// QueueSize enables queued input mode: up to QueueSize input states are
+	// sent to the host in order. Movement and wheel deltas sent faster than
+	// the host polls are summed instead of replaced, button changes are kept.
+	// 0 (default) only sends the latest state.
+	QueueSize uint16 `json:"queueSize,omitempty"`
+}
+
 // New returns a new Mouse device.
 func New(o *device.CreateOptions) (*Mouse, error) {
+	var opts Options
+	if o != nil && o.DeviceSpecific != "" {
+		if err := json.Unmarshal([]byte(o.DeviceSpecific), &opts); err != nil {
+			return nil, fmt.Errorf("invalid JSON payload: %w", err)
+		}
+	}
+	if opts.QueueSize > device.MaxInputQueueSize {
+		return nil, fmt.Errorf("queueSize must be between 0 and %d, got %d", device.MaxInputQueueSize, opts.QueueSize)
+	}
 	d := &Mouse{
 		descriptor: defaultDescriptor,
 	}
@@ -32,12 +62,38 @@ func New(o *device.CreateOptions) (*Mouse, error) {
 			d.descriptor.Device.IDProduct = *o.IDProduct
 		}
 	}
+	if opts.QueueSize > 0 {
+		d.queue = device.NewInputQueue[InputState](int(opts.QueueSize))
+		d.queue.Push(*NewInputState(), nil)
+		d.wake = make(chan struct{}, 1)
+		return d, nil
+	}
 	d.inputCh = make(chan InputState, 1)
 	d.inputCh <- *NewInputState()
 	return d, nil
 }
 
+// UpdateInputState updates the device's current input state (thread-safe).
+// In queued input mode the state is sent after all states queued before it;
+// its deltas are added to the last queued state if the buttons did not change.
 func (m *Mouse) UpdateInputState(state InputState) {
+	m.stateMu.Lock()
+	m.inputState = state
+	if m.queue != nil {
+		if last := m.queue.Last(); last == nil || last.Buttons != state.Buttons || !last.add(state) {
+			m.queue.Push(state, func(last *InputState, st InputState) {
+				last.Buttons = st.Buttons
+				last.addSaturated(st)
+			})
+		}
+		m.stateMu.Unlock()
+		select {
+		case m.wake <- struct{}{}:
+		default:
+		}
+		return
+	}
+	m.stateMu.Unlock()
 	select {
 	case <-m.inputCh:
 	default:
@@ -45,16 +101,57 @@ func (m *Mouse) UpdateInputState(state InputState) {
 	m.inputCh <- state
 }
 
+// ResetInputState releases all inputs, see usb.NeutralStateDevice.
+func (m *Mouse) ResetInputState() {
+	m.UpdateInputState(*NewInputState())
+}
+
+// GetInputState returns the last input state set by the client. Movement and
+// wheel deltas are reported once, so the host may already have consumed them.
+func (m *Mouse) GetInputState() any {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	return m.inputState
+}
+
+// InputQueueStatus implements usb.QueuedInputDevice.
+func (m *Mouse) InputQueueStatus() (length, capacity int, overflows uint64, ok bool) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	if m.queue == nil {
+		return 0, 0, 0, false
+	}
+	return m.queue.Len(), m.queue.Cap(), m.queue.Overflows(), true
+}
+
+// GetInputReport returns a report of the pressed buttons without movement,
+// see usb.InputReportDevice. The mouse report has no report ID.
+func (m *Mouse) GetInputReport(iface, reportID uint8) []byte {
+	if reportID != 0 {
+		return nil
+	}
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	st := InputState{Buttons: m.inputState.Buttons}
+	return st.BuildReport()
+}
+
+// GetOutputState returns nil, the mouse has no host output.
+func (m *Mouse) GetOutputState() any { return nil }
+
 func (m *Mouse) HandleTransfer(ctx context.Context, ep uint32, dir uint32, out []byte) []byte {
 	if dir == usbip.DirIn {
 		switch ep {
 		case 1: // 0x81 - main input reports
 			atomic.AddUint64(&m.tick, 1)
+			if m.queue != nil {
+				return m.nextQueuedReport(ctx)
+			}
 			select {
 			case <-ctx.Done():
 				return nil
 			case st := <-m.inputCh:
-				if st.DX != 0 || st.DY != 0 || st.Wheel != 0 || st.Pan != 0 {
+				if st.hasMotion() {
 					zeroed := InputState{Buttons: st.Buttons}
 					select {
 					case m.inputCh <- zeroed:
@@ -70,6 +167,55 @@ func (m *Mouse) HandleTransfer(ctx context.Context, ep uint32, dir uint32, out [
 	return nil
 }
 
+// nextQueuedReport blocks until a state is queued and returns its report.
+func (m *Mouse) nextQueuedReport(ctx context.Context) []byte {
+	for {
+		m.stateMu.Lock()
+		st, ok := m.queue.Pop()
+		if ok && st.hasMotion() && m.queue.Len() == 0 {
+			// Like in the unqueued mode, follow up with a report without
+			// motion, so the deltas are not repeated.
+			m.queue.Push(InputState{Buttons: st.Buttons}, nil)
+		}
+		m.stateMu.Unlock()
+		if ok {
+			return st.BuildReport()
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-m.wake:
+		}
+	}
+}
+
+// hasMotion reports whether st moves the pointer or a wheel.
+func (st *InputState) hasMotion() bool {
+	return st.DX != 0 || st.DY != 0 || st.Wheel != 0 || st.Pan != 0
+}
+
+// add adds the deltas of o to st, unless one of the sums does not fit int16.
+func (st *InputState) add(o InputState) bool {
+	dx, dy := int32(st.DX)+int32(o.DX), int32(st.DY)+int32(o.DY)
+	wheel, pan := int32(st.Wheel)+int32(o.Wheel), int32(st.Pan)+int32(o.Pan)
+	for _, v := range []int32{dx, dy, wheel, pan} {
+		if v < math.MinInt16 || v > math.MaxInt16 {
+			return false
+		}
+	}
+	st.DX, st.DY, st.Wheel, st.Pan = int16(dx), int16(dy), int16(wheel), int16(pan)
+	return true
+}
+
+// addSaturated adds the deltas of o to st, clamping them to int16.
+func (st *InputState) addSaturated(o InputState) {
+	clamp := func(a, b int16) int16 {
+		return int16(max(math.MinInt16, min(math.MaxInt16, int32(a)+int32(b))))
+	}
+	st.DX, st.DY = clamp(st.DX, o.DX), clamp(st.DY, o.DY)
+	st.Wheel, st.Pan = clamp(st.Wheel, o.Wheel), clamp(st.Pan, o.Pan)
+}
+
 // HID Report Descriptor for a 5-button mouse with vertical and horizontal wheels.
 // Boot protocol compatible.
 var reportDescriptor = hid.ReportDescriptor{
@@ -180,5 +326,8 @@ func (m *Mouse) GetDescriptor() *usb.Descriptor {
 }
 
 func (m *Mouse) GetDeviceSpecificArgs() map[string]any {
+	if m.queue != nil {
+		return map[string]any{"queueSize": m.queue.Cap()}
+	}
 	return map[string]any{}
 }
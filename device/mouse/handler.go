@@ -44,10 +44,11 @@ func (h *handler) StreamHandler() api.StreamHandlerFunc {
 				return fmt.Errorf("unmarshal input state: %w", err)
 			}
 			mdev.UpdateInputState(state)
+			api.RecordFrame(conn, buf)
 		}
 	}
 }
 
 func (h *handler) UpdateMetaState(meta string, dev *usb.Device) error {
-	return nil
+	return device.ErrNoMetaState
 }
@@ -8,13 +8,14 @@ import (
 // viiper:wire mouse c2s buttons:u8 dx:i16 dy:i16 wheel:i16 pan:i16
 type InputState struct {
 	// Button bitfield: bit 0=Left, 1=Right, 2=Middle, 3=Back, 4=Forward
-	Buttons uint8
+	Buttons uint8 `json:"buttons"`
 	// Delta X/Y: signed 16-bit relative movement
-	DX, DY int16
+	DX int16 `json:"dx"`
+	DY int16 `json:"dy"`
 	// Wheel: signed 16-bit vertical scroll
-	Wheel int16
+	Wheel int16 `json:"wheel"`
 	// Pan: signed 16-bit horizontal scroll
-	Pan int16
+	Pan int16 `json:"pan"`
 }
 
 // NewInputState returns a mouse input state in its neutral/resting state.
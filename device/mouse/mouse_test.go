@@ -6,9 +6,11 @@ import (
 	"time"
 
 	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/device"
 	"github.com/Alia5/VIIPER/device/mouse"
 	"github.com/Alia5/VIIPER/internal/server/api"
 	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/usbip"
 	"github.com/Alia5/VIIPER/viiperclient"
 	"github.com/Alia5/VIIPER/virtualbus"
 	"github.com/stretchr/testify/assert"
@@ -192,3 +194,54 @@ func TestInputReports(t *testing.T) {
 		})
 	}
 }
+
+func TestQueuedInput(t *testing.T) {
+	m, err := mouse.New(&device.CreateOptions{DeviceSpecific: `{"queueSize": 4}`})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]any{"queueSize": 4}, m.GetDeviceSpecificArgs())
+	poll := func() []byte {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		return m.HandleTransfer(ctx, 1, usbip.DirIn, nil)
+	}
+	assert.Equal(t, mouse.NewInputState().BuildReport(), poll(), "initial report")
+	assert.Nil(t, poll())
+
+	// Deltas between two polls are summed, button changes are kept.
+	m.UpdateInputState(mouse.InputState{DX: 10, Wheel: 1})
+	m.UpdateInputState(mouse.InputState{DX: 5, DY: -3, Wheel: 1})
+	m.UpdateInputState(mouse.InputState{Buttons: mouse.BtnLeft})
+	m.UpdateInputState(mouse.InputState{})
+	length, capacity, overflows, ok := m.InputQueueStatus()
+	assert.True(t, ok)
+	assert.Equal(t, 3, length)
+	assert.Equal(t, 4, capacity)
+	assert.Equal(t, uint64(0), overflows)
+
+	assert.Equal(t, (&mouse.InputState{DX: 15, DY: -3, Wheel: 2}).BuildReport(), poll())
+	assert.Equal(t, (&mouse.InputState{Buttons: mouse.BtnLeft}).BuildReport(), poll())
+	assert.Equal(t, (&mouse.InputState{}).BuildReport(), poll())
+	assert.Nil(t, poll())
+
+	// Sums that do not fit int16 are queued separately.
+	m.UpdateInputState(mouse.InputState{DX: 30000})
+	m.UpdateInputState(mouse.InputState{DX: 30000})
+	assert.Equal(t, (&mouse.InputState{DX: 30000}).BuildReport(), poll())
+	assert.Equal(t, (&mouse.InputState{DX: 30000}).BuildReport(), poll())
+	assert.Equal(t, (&mouse.InputState{}).BuildReport(), poll(), "movement is not repeated")
+	assert.Nil(t, poll())
+
+	// Overflowing states are folded into the last queued one.
+	for i := range 6 {
+		m.UpdateInputState(mouse.InputState{Buttons: uint8(i % 2), DX: 1})
+	}
+	length, _, overflows, _ = m.InputQueueStatus()
+	assert.Equal(t, 4, length)
+	assert.Equal(t, uint64(2), overflows)
+	for range 3 {
+		poll()
+	}
+	assert.Equal(t, (&mouse.InputState{Buttons: mouse.BtnLeft, DX: 3}).BuildReport(), poll())
+}
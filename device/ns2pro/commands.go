@@ -34,19 +34,40 @@ func (d *NS2Pro) handlePlayerLEDCommand(seq, sub uint8, out []byte) {
 	d.enqueueResponse(commandHeader(cmdPlayerLED, seq, sub))
 }
 
+// handleFlashCommand serves flash reads, writes and sector erases.
+//
+// Request layout (after the 8-byte command header):
+//
+//	Byte 8: Length (reads: 0 means flashBlockSize)
+//	Byte 12-15: Address (little-endian)
+//	Byte 16+: Data (writes)
 func (d *NS2Pro) handleFlashCommand(seq, sub uint8, out []byte) {
-	if sub != subFlashRead || len(out) < 16 {
+	if len(out) < 16 {
 		d.enqueueResponse(commandHeader(cmdFlash, seq, sub))
 		return
 	}
-
 	address := binary.LittleEndian.Uint32(out[12:16])
-	resp := make([]byte, 16+flashBlockSize)
-	copy(resp[0:8], commandHeader(cmdFlash, seq, sub))
-	resp[8] = flashBlockSize
-	binary.LittleEndian.PutUint32(resp[12:16], address)
-	copy(resp[16:], d.minimalFlashBlock(address))
-	d.enqueueResponse(resp)
+
+	switch sub {
+	case subFlashRead:
+		n := int(out[8])
+		if n == 0 || n > flashBlockSize {
+			n = flashBlockSize
+		}
+		resp := make([]byte, 16+n)
+		copy(resp[0:8], commandHeader(cmdFlash, seq, sub))
+		resp[8] = uint8(n)
+		binary.LittleEndian.PutUint32(resp[12:16], address)
+		copy(resp[16:], d.ReadFlash(address, n))
+		d.enqueueResponse(resp)
+		return
+	case subFlashWrite:
+		n := min(int(out[8]), len(out)-16)
+		d.WriteFlash(address, out[16:16+n])
+	case subFlashErase:
+		d.eraseFlashSector(address)
+	}
+	d.enqueueResponse(commandHeader(cmdFlash, seq, sub))
 }
 
 func (d *NS2Pro) handleUSBCommand(seq, sub uint8, out []byte) {
@@ -109,7 +109,9 @@ const (
 )
 
 const (
-	subFlashRead = 0x01
+	subFlashRead  = 0x01
+	subFlashErase = 0x02
+	subFlashWrite = 0x03
 
 	subUSBEnableReports = 0x03
 	subUSBSelectReport  = 0x0A
@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"os"
 	"sync"
 	"time"
 
@@ -23,6 +25,7 @@ type NS2Pro struct {
 	outputMu       sync.RWMutex
 	outputCallback func(OutputState)
 	outputVersion  uint64
+	outputState    OutputState
 	descriptor     usb.Descriptor
 
 	protoMu           sync.Mutex
@@ -35,6 +38,15 @@ type NS2Pro struct {
 	motionStart       time.Time
 	lastMotionTS      uint32
 	bulkInQueue       [][]byte
+
+	flashMu    sync.Mutex
+	flash      []byte
+	flashFile  string
+	flashDirty bool
+	flashTimer *time.Timer
+	flashSave  sync.Mutex // serializes saves of the image
+
+	logger *slog.Logger
 }
 
 func New(o *device.CreateOptions) (*NS2Pro, error) {
@@ -59,6 +71,16 @@ func New(o *device.CreateOptions) (*NS2Pro, error) {
 		if newMeta.BatteryVolts != 0 {
 			metaState.BatteryVolts = newMeta.BatteryVolts
 		}
+		metaState.FlashFile = newMeta.FlashFile
+		metaState.CalibrationFile = newMeta.CalibrationFile
+	}
+	flashFile, calibrationFile, err := flashPaths(o, metaState)
+	if err != nil {
+		return nil, err
+	}
+	flash, err := loadFlashImage(flashFile, calibrationFile)
+	if err != nil {
+		return nil, fmt.Errorf("load flash image: %w", err)
 	}
 
 	inputCh := make(chan struct{}, 1)
@@ -72,6 +94,9 @@ func New(o *device.CreateOptions) (*NS2Pro, error) {
 		activeReportID: ReportIDPro,
 		featureFlags:   FeatureButtons | FeatureSticks,
 		motionStart:    time.Now(),
+		flash:          flash,
+		flashFile:      flashFile,
+		logger:         o.GetLogger(),
 	}
 	serialEnding := DefaultSerialEnding
 	if len(metaState.SerialNumber) >= 2 {
@@ -87,6 +112,13 @@ func New(o *device.CreateOptions) (*NS2Pro, error) {
 			d.descriptor.Device.IDProduct = *o.IDProduct
 		}
 	}
+	if d.flashFile != "" {
+		if _, err := os.Stat(d.flashFile); os.IsNotExist(err) {
+			if err := d.SaveFlash(d.flashFile); err != nil {
+				return nil, fmt.Errorf("save flash image: %w", err)
+			}
+		}
+	}
 	return d, nil
 }
 
@@ -116,9 +148,19 @@ func (d *NS2Pro) UpdateInputState(state InputState) {
 	}
 }
 
+// ResetInputState releases all inputs, see usb.NeutralStateDevice.
+func (d *NS2Pro) ResetInputState() {
+	d.UpdateInputState(*NewInputState())
+}
+
 func (d *NS2Pro) SetMetaState(meta MetaState) {
 	d.stateMu.Lock()
 	defer d.stateMu.Unlock()
+	if d.metaState != nil {
+		// The flash image is set up at creation only.
+		meta.FlashFile = d.metaState.FlashFile
+		meta.CalibrationFile = d.metaState.CalibrationFile
+	}
 	d.metaState = &meta
 	if d.descriptor.Strings != nil {
 		serialEnding := DefaultSerialEnding
@@ -269,6 +311,25 @@ func (d *NS2Pro) serialNumber() string {
 	return d.metaState.SerialNumber
 }
 
+// GetInputState returns the current input state.
+func (d *NS2Pro) GetInputState() any {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+	return *d.inputState
+}
+
+// GetOutputState returns the last rumble and player LED state set by the host,
+// merged into one OutputState. Flags tells which of them were received, nil is
+// returned if neither was.
+func (d *NS2Pro) GetOutputState() any {
+	d.outputMu.RLock()
+	defer d.outputMu.RUnlock()
+	if d.outputState.Flags == 0 {
+		return nil
+	}
+	return d.outputState
+}
+
 func (d *NS2Pro) handleOutputReport(out []byte) {
 	if len(out) == 0 {
 		return
@@ -292,9 +353,17 @@ func (d *NS2Pro) handleOutputReport(out []byte) {
 }
 
 func (d *NS2Pro) emitOutput(feedback OutputState) {
-	d.outputMu.RLock()
+	d.outputMu.Lock()
+	if feedback.Flags&OutputFlagRumble != 0 {
+		d.outputState.LeftRumble = feedback.LeftRumble
+		d.outputState.RightRumble = feedback.RightRumble
+	}
+	if feedback.Flags&OutputFlagLED != 0 {
+		d.outputState.PlayerLedMask = feedback.PlayerLedMask
+	}
+	d.outputState.Flags |= feedback.Flags
 	callback := d.outputCallback
-	d.outputMu.RUnlock()
+	d.outputMu.Unlock()
 	if callback != nil {
 		callback(feedback)
 	}
@@ -1,21 +1,227 @@
 package ns2pro
 
-func (d *NS2Pro) minimalFlashBlock(address uint32) []byte {
-	block := make([]byte, 0x40)
-	switch address {
-	case 0x13000:
-		serial := d.serialNumber()
-		if serial == "" {
-			serial = DefaultSerial
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Alia5/VIIPER/device"
+)
+
+// Flash layout of the emulated SPI flash.
+const (
+	// FlashSize is the size of the emulated flash image. Addresses wrap around
+	// like on the real chip.
+	FlashSize = 0x200000
+
+	flashSectorSize = 0x1000
+
+	flashFactoryCalibration = 0x13000 // serial, IMU and stick factory calibration
+	flashSerial             = 0x13002
+	flashSerialSize         = 16
+	flashLeftStickFactory   = 0x13080
+	flashRightStickFactory  = 0x130C0
+	flashUserCalibration    = 0x1FC000 // user stick calibration written by the host
+
+	// flashSaveDelay is the delay after the last write or erase before the
+	// flash image is saved. Calibration flows write several blocks in a row.
+	flashSaveDelay = time.Second
+)
+
+// calibrationSectors are the sectors copied when seeding calibration from a
+// dump of a real controller.
+var calibrationSectors = []uint32{flashFactoryCalibration, flashUserCalibration}
+
+// defaultFlashImage returns a flash image with VIIPER's factory calibration.
+// Gyro/accel bias and user calibration are left zeroed intentionally: no bias
+// and no user calibration magic.
+func defaultFlashImage() []byte {
+	img := make([]byte, FlashSize)
+	encodeStickCalibration(img[flashLeftStickFactory+0x28:], StickCenter, StickCenter, 2047, 2047, 2048, 2048)
+	encodeStickCalibration(img[flashRightStickFactory+0x28:], StickCenter, StickCenter, 2047, 2047, 2048, 2048)
+	return img
+}
+
+// flashPaths resolves the flash and calibration file names of meta in the
+// data directory of o.
+func flashPaths(o *device.CreateOptions, meta *MetaState) (flashFile, calibrationFile string, err error) {
+	if meta.FlashFile != "" {
+		if flashFile, err = o.DataFile(meta.FlashFile); err != nil {
+			return "", "", fmt.Errorf("flash_file: %w", err)
+		}
+	}
+	if meta.CalibrationFile != "" {
+		if calibrationFile, err = o.DataFile(meta.CalibrationFile); err != nil {
+			return "", "", fmt.Errorf("calibration_file: %w", err)
+		}
+	}
+	return flashFile, calibrationFile, nil
+}
+
+// loadFlashImage builds the flash image of a new device.
+// An existing flashFile is loaded as is. Otherwise the default image is used,
+// with the calibration sectors taken from calibrationFile if given.
+func loadFlashImage(flashFile, calibrationFile string) ([]byte, error) {
+	if flashFile != "" {
+		img, err := readFlashFile(flashFile)
+		if err == nil {
+			return img, nil
 		}
-		copy(block[2:], []byte(serial))
-	case 0x13080, 0x130C0:
-		encodeStickCalibration(block[0x28:], StickCenter, StickCenter, 2047, 2047, 2048, 2048)
-	case 0x13040, 0x13100, 0x1FC040, 0x1FC080:
-		// Zeroed data is intentional: no gyro/accel bias and no user calibration magic.
-	default:
-	}
-	return block
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	img := defaultFlashImage()
+	if calibrationFile != "" {
+		dump, err := readFlashFile(calibrationFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range calibrationSectors {
+			copy(img[addr:addr+flashSectorSize], dump[addr:addr+flashSectorSize])
+		}
+	}
+	return img, nil
+}
+
+// readFlashFile reads a raw flash image. Files shorter than FlashSize are
+// padded with zeroes.
+func readFlashFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+	img := make([]byte, FlashSize)
+	if _, err := io.ReadFull(f, img); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("read flash image %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// SaveFlash writes the flash image to path.
+func (d *NS2Pro) SaveFlash(path string) error {
+	d.flashSave.Lock()
+	defer d.flashSave.Unlock()
+	d.flashMu.Lock()
+	img := append([]byte(nil), d.flash...)
+	d.flashMu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(img); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadFlash returns n bytes of flash starting at address.
+// The serial number region always reflects the device's MetaState.
+func (d *NS2Pro) ReadFlash(address uint32, n int) []byte {
+	out := make([]byte, n)
+	d.flashMu.Lock()
+	for i := range out {
+		out[i] = d.flash[(address+uint32(i))%FlashSize]
+	}
+	d.flashMu.Unlock()
+
+	serial := d.serialNumber()
+	if serial == "" {
+		serial = DefaultSerial
+	}
+	var serialBytes [flashSerialSize]byte
+	copy(serialBytes[:], serial)
+	for i := range out {
+		if off := (address + uint32(i)) % FlashSize; off >= flashSerial && off < flashSerial+flashSerialSize {
+			out[i] = serialBytes[off-flashSerial]
+		}
+	}
+	return out
+}
+
+// WriteFlash writes data to flash at address. If the device was created with
+// a flash_file, the image is saved to it shortly after, see FlushFlash.
+func (d *NS2Pro) WriteFlash(address uint32, data []byte) {
+	d.flashMu.Lock()
+	defer d.flashMu.Unlock()
+	for i, b := range data {
+		d.flash[(address+uint32(i))%FlashSize] = b
+	}
+	d.markFlashDirty()
+}
+
+// eraseFlashSector sets the sector containing address to 0xFF.
+func (d *NS2Pro) eraseFlashSector(address uint32) {
+	start := (address % FlashSize) &^ (flashSectorSize - 1)
+	d.flashMu.Lock()
+	defer d.flashMu.Unlock()
+	for i := start; i < start+flashSectorSize; i++ {
+		d.flash[i] = 0xFF
+	}
+	d.markFlashDirty()
+}
+
+// markFlashDirty schedules saving the image to the flash file.
+// The caller must hold flashMu.
+func (d *NS2Pro) markFlashDirty() {
+	if d.flashFile == "" {
+		return
+	}
+	d.flashDirty = true
+	if d.flashTimer == nil {
+		d.flashTimer = time.AfterFunc(flashSaveDelay, func() { _ = d.flushFlash() })
+		return
+	}
+	d.flashTimer.Reset(flashSaveDelay)
+}
+
+// flushFlash is FlushFlash, logging failures.
+func (d *NS2Pro) flushFlash() error {
+	err := d.FlushFlash()
+	if err != nil {
+		d.logger.Warn("failed to save ns2pro flash image", "file", d.flashFile, "error", err)
+	}
+	return err
+}
+
+// FlushFlash saves the flash image to the flash file if it changed since it
+// was last saved.
+func (d *NS2Pro) FlushFlash() error {
+	d.flashMu.Lock()
+	dirty := d.flashDirty
+	d.flashDirty = false
+	d.flashMu.Unlock()
+	if !dirty {
+		return nil
+	}
+	if err := d.SaveFlash(d.flashFile); err != nil {
+		d.flashMu.Lock()
+		d.flashDirty = true
+		d.flashMu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close saves pending flash changes; failures are also logged. The device is
+// closed when it is removed from its bus.
+func (d *NS2Pro) Close() error {
+	d.flashMu.Lock()
+	if d.flashTimer != nil {
+		d.flashTimer.Stop()
+	}
+	d.flashMu.Unlock()
+	return d.flushFlash()
 }
 
 func encodeStickCalibration(out []byte, neutralX, neutralY, maxX, maxY, minX, minY uint16) {
@@ -115,6 +115,7 @@ func (h *handler) StreamHandler() api.StreamHandlerFunc {
 				return fmt.Errorf("unmarshal input state: %w", err)
 			}
 			ns2.UpdateInputState(state)
+			api.RecordFrame(conn, buf)
 		}
 	}
 }
@@ -125,7 +126,9 @@ func (h *handler) UpdateMetaState(meta string, dev *usb.Device) error {
 		return fmt.Errorf("%w: expected ns2pro", device.ErrWrongDeviceType)
 	}
 
-	metaState := *defaultMetaState()
+	ns2.stateMu.Lock()
+	metaState := *ns2.metaState
+	ns2.stateMu.Unlock()
 	if err := json.Unmarshal([]byte(meta), &metaState); err != nil {
 		return fmt.Errorf("unmarshal meta state: %w", err)
 	}
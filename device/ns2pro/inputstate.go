@@ -8,13 +8,19 @@ import (
 // nolint
 // viiper:wire ns2pro c2s buttons:u32 lx:u16 ly:u16 rx:u16 ry:u16 accelX:i16 accelY:i16 accelZ:i16 gyroX:i16 gyroY:i16 gyroZ:i16
 type InputState struct {
-	Buttons uint32
+	Buttons uint32 `json:"buttons"`
 
-	LX, LY uint16
-	RX, RY uint16
+	LX uint16 `json:"lx"`
+	LY uint16 `json:"ly"`
+	RX uint16 `json:"rx"`
+	RY uint16 `json:"ry"`
 
-	AccelX, AccelY, AccelZ int16
-	GyroX, GyroY, GyroZ    int16
+	AccelX int16 `json:"accelX"`
+	AccelY int16 `json:"accelY"`
+	AccelZ int16 `json:"accelZ"`
+	GyroX  int16 `json:"gyroX"`
+	GyroY  int16 `json:"gyroY"`
+	GyroZ  int16 `json:"gyroZ"`
 }
 
 // NewInputState returns an NS2 Pro input state in its neutral/resting state.
@@ -35,6 +41,17 @@ type MetaState struct {
 	Charging      bool   `json:"charging"`
 	ExternalPower bool   `json:"external_power"`
 	BatteryVolts  uint16 `json:"battery_volts"`
+
+	// FlashFile is the name of a raw flash image (FlashSize bytes) in the
+	// server's data directory backing the emulated flash. It is loaded at
+	// creation if it exists and saved shortly after flash writes by the host.
+	// Only used at creation.
+	FlashFile string `json:"flash_file,omitempty"`
+	// CalibrationFile is the name of a raw flash dump of a real controller in
+	// the server's data directory. Its factory and user calibration sectors
+	// seed the flash image, unless FlashFile already exists. Only used at
+	// creation.
+	CalibrationFile string `json:"calibration_file,omitempty"`
 }
 
 func defaultMetaState() *MetaState {
@@ -83,10 +100,10 @@ func (s *InputState) UnmarshalBinary(data []byte) error {
 // nolint
 // viiper:wire ns2pro s2c leftRumble:u8*16 rightRumble:u8*16 flags:u8 playerLedMask:u8
 type OutputState struct {
-	LeftRumble    [16]byte
-	RightRumble   [16]byte
-	Flags         uint8
-	PlayerLedMask uint8
+	LeftRumble    [16]byte `json:"leftRumble"`
+	RightRumble   [16]byte `json:"rightRumble"`
+	Flags         uint8    `json:"flags"`
+	PlayerLedMask uint8    `json:"playerLedMask"`
 }
 
 func (o *OutputState) MarshalBinary() ([]byte, error) {
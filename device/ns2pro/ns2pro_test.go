@@ -1,17 +1,21 @@
 package ns2pro
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 	"unicode/utf16"
 
 	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/device"
 	"github.com/Alia5/VIIPER/internal/server/api"
 	apihandler "github.com/Alia5/VIIPER/internal/server/api/handler"
 	"github.com/Alia5/VIIPER/usb"
@@ -241,6 +245,87 @@ func TestFlashSerialUsesMetaStateSerial(t *testing.T) {
 	assert.Equal(t, "CUSTOM-NS2PRO-AB", string(flash[2:18]))
 }
 
+func TestFlashImage(t *testing.T) {
+	dir := t.TempDir()
+	flashFile := filepath.Join(dir, "ns2pro.bin")
+	opts := &device.CreateOptions{DeviceSpecific: `{"flash_file":"ns2pro.bin"}`, DataDir: dir}
+
+	dev, err := New(opts)
+	require.NoError(t, err)
+	info, err := os.Stat(flashFile)
+	require.NoError(t, err, "image is saved at creation")
+	assert.Equal(t, int64(FlashSize), info.Size())
+	saved, err := os.ReadFile(flashFile)
+	require.NoError(t, err)
+
+	readFlash := func(dev *NS2Pro, address uint32, n uint8) []byte {
+		cmd := flashReadCommand(address)
+		cmd[8] = n
+		dev.HandleTransfer(context.Background(), 2, usbip.DirOut, cmd)
+		resp := dev.HandleTransfer(context.Background(), 2, usbip.DirIn, nil)
+		require.Len(t, resp, 16+int(n))
+		assert.Equal(t, n, resp[8])
+		return resp[16:]
+	}
+
+	userCal := []byte{0xB2, 0xA1, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09}
+	dev.HandleTransfer(context.Background(), 2, usbip.DirOut, flashWriteCommand(0x1FC040, userCal))
+	assert.Equal(t, []byte{0x02, 0x01, 0x01, subFlashWrite}, dev.HandleTransfer(context.Background(), 2, usbip.DirIn, nil)[0:4])
+	assert.Equal(t, userCal, readFlash(dev, 0x1FC040, uint8(len(userCal))))
+	assert.Equal(t, userCal[2:6], readFlash(dev, 0x1FC042, 4), "unaligned read")
+
+	unchanged, err := os.ReadFile(flashFile)
+	require.NoError(t, err)
+	assert.Equal(t, saved, unchanged, "writes are saved deferred")
+	require.NoError(t, dev.Close())
+
+	reloaded, err := New(opts)
+	require.NoError(t, err)
+	assert.Equal(t, userCal, readFlash(reloaded, 0x1FC040, uint8(len(userCal))), "writes persist")
+	assert.Equal(t, "VIIPER-NS2PRO-00", string(readFlash(reloaded, 0x13000, 0x40)[2:18]))
+
+	dev.HandleTransfer(context.Background(), 2, usbip.DirOut, flashWriteCommand(0x1FC000, nil, subFlashErase))
+	dev.HandleTransfer(context.Background(), 2, usbip.DirIn, nil)
+	assert.Equal(t, bytes.Repeat([]byte{0xFF}, 16), readFlash(dev, 0x1FC040, 16), "sector erased")
+	require.NoError(t, dev.Close())
+}
+
+func TestFlashCalibrationSeed(t *testing.T) {
+	dump := make([]byte, FlashSize)
+	copy(dump[0x13002:], "REAL-SERIAL-0001")
+	copy(dump[0x13040:], []byte{0x11, 0x22, 0x33, 0x44})
+	copy(dump[0x130A8:], []byte{0x01, 0x88, 0x7F, 0xFF, 0xF5, 0x6F, 0x3C, 0xA3, 0x4C})
+	copy(dump[0x1FC040:], []byte{0xB2, 0xA1, 0x55})
+	copy(dump[0x40000:], []byte{0xEE})
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "dump.bin"), dump, 0o600))
+
+	dev, err := New(&device.CreateOptions{DeviceSpecific: `{"calibration_file":"dump.bin"}`, DataDir: dir})
+	require.NoError(t, err)
+
+	assert.Equal(t, dump[0x13040:0x13044], dev.ReadFlash(0x13040, 4), "IMU calibration")
+	assert.Equal(t, dump[0x130A8:0x130B1], dev.ReadFlash(0x130A8, 9), "stick calibration")
+	assert.Equal(t, dump[0x1FC040:0x1FC043], dev.ReadFlash(0x1FC040, 3), "user calibration")
+	assert.Equal(t, []byte{0x00}, dev.ReadFlash(0x40000, 1), "only calibration is seeded")
+	assert.Equal(t, DefaultSerial, string(dev.ReadFlash(0x13002, 16)), "serial follows meta state")
+}
+
+func TestFlashFileNames(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"/etc/passwd", "../ns2pro.bin", "sub/ns2pro.bin", `sub\ns2pro.bin`, "..", "."} {
+		_, err := New(&device.CreateOptions{DeviceSpecific: fmt.Sprintf(`{"flash_file":%q}`, name), DataDir: dir})
+		assert.Error(t, err, name)
+		_, err = New(&device.CreateOptions{DeviceSpecific: fmt.Sprintf(`{"calibration_file":%q}`, name), DataDir: dir})
+		assert.Error(t, err, name)
+	}
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = New(&device.CreateOptions{DeviceSpecific: `{"flash_file":"ns2pro.bin"}`})
+	assert.ErrorIs(t, err, device.ErrNoDataDir)
+}
+
 func TestSDLUSBInitializationSequence(t *testing.T) {
 	dev, err := New(nil)
 	require.NoError(t, err)
@@ -346,6 +431,31 @@ func TestPlayerLEDOutput(t *testing.T) {
 	assert.Equal(t, []byte{0x09, 0x01, 0x12, 0x07}, resp[:4])
 }
 
+func TestOutputStateMergesRumbleAndLEDs(t *testing.T) {
+	dev, err := New(nil)
+	require.NoError(t, err)
+	assert.Nil(t, dev.GetOutputState())
+
+	dev.HandleTransfer(context.Background(), 2, usbip.DirOut, []byte{0x09, 0x91, 0x12, 0x07, 0x00, 0x08, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00})
+	payload := make([]byte, OutputRumbleSize)
+	payload[0] = 0x42
+	payload[16] = 0x24
+	_, handled := dev.HandleControl(0x21, 0x09, 0x0202, 0, 0, payload)
+	require.True(t, handled)
+
+	got, ok := dev.GetOutputState().(OutputState)
+	require.True(t, ok)
+	assert.Equal(t, byte(OutputFlagRumble|OutputFlagLED), got.Flags)
+	assert.Equal(t, byte(0x06), got.PlayerLedMask)
+	assert.Equal(t, byte(0x42), got.LeftRumble[0])
+	assert.Equal(t, byte(0x24), got.RightRumble[0])
+
+	in := *NewInputState()
+	in.Buttons = 0x01
+	dev.UpdateInputState(in)
+	assert.Equal(t, in, dev.GetInputState())
+}
+
 func TestMicrosoftOS10WinUSBDescriptor(t *testing.T) {
 	desc := MakeDescriptor()
 	require.NotNil(t, desc.MicrosoftOS10)
@@ -493,6 +603,16 @@ func flashReadCommand(address uint32) []byte {
 	return cmd
 }
 
+func flashWriteCommand(address uint32, data []byte, sub ...uint8) []byte {
+	cmd := flashReadCommand(address)
+	cmd[3] = subFlashWrite
+	if len(sub) > 0 {
+		cmd[3] = sub[0]
+	}
+	cmd[8] = uint8(len(data))
+	return append(cmd, data...)
+}
+
 func mustHexBytes(t *testing.T, s string) []byte {
 	t.Helper()
 	out, err := hex.DecodeString(s)
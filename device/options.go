@@ -1,7 +1,41 @@
 package device
 
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
 type CreateOptions struct {
 	IDVendor       *uint16
 	IDProduct      *uint16
 	DeviceSpecific string
+	// DataDir is the server directory that files named in DeviceSpecific
+	// (flash images, profiles, ...) are resolved in, see DataFile.
+	// Empty disables such files.
+	DataDir string
+	// Logger receives the log output of the device. Nil discards it.
+	Logger *slog.Logger
+}
+
+// DataFile returns the path of the file name inside DataDir.
+// DeviceSpecific comes from API clients, so only plain file names are
+// accepted: absolute paths, directories and ".." are rejected.
+func (o *CreateOptions) DataFile(name string) (string, error) {
+	if o == nil || o.DataDir == "" {
+		return "", ErrNoDataDir
+	}
+	if !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid file name %q: must be a file in the data directory", name)
+	}
+	return filepath.Join(o.DataDir, name), nil
+}
+
+// GetLogger returns Logger, or a logger discarding all output if it is nil.
+func (o *CreateOptions) GetLogger() *slog.Logger {
+	if o == nil || o.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return o.Logger
 }
@@ -0,0 +1,66 @@
+package device
+
+// MaxInputQueueSize is the largest queueSize accepted by devices with a queued
+// input mode.
+const MaxInputQueueSize = 4096
+
+// InputQueue is a bounded FIFO of input states, used by devices in queued
+// input mode so states pushed faster than the host polls are not dropped.
+//
+// It is not safe for concurrent use; devices guard it with their state lock.
+type InputQueue[T any] struct {
+	items     []T // ring buffer
+	head, n   int
+	overflows uint64
+}
+
+// NewInputQueue returns an empty queue holding at most size states.
+func NewInputQueue[T any](size int) *InputQueue[T] {
+	return &InputQueue[T]{items: make([]T, size)}
+}
+
+// Push appends st and reports whether it fit. If the queue is full, st is
+// folded into the last queued state with fold instead and the overflow is
+// counted.
+func (q *InputQueue[T]) Push(st T, fold func(last *T, st T)) bool {
+	if q.n < len(q.items) {
+		q.items[(q.head+q.n)%len(q.items)] = st
+		q.n++
+		return true
+	}
+	q.overflows++
+	fold(q.Last(), st)
+	return false
+}
+
+// Pop removes and returns the oldest state.
+func (q *InputQueue[T]) Pop() (T, bool) {
+	var zero T
+	if q.n == 0 {
+		return zero, false
+	}
+	st := q.items[q.head]
+	q.items[q.head] = zero
+	q.head = (q.head + 1) % len(q.items)
+	q.n--
+	return st, true
+}
+
+// Last returns the newest queued state, or nil if the queue is empty.
+// Devices may modify it to merge a new state into it.
+func (q *InputQueue[T]) Last() *T {
+	if q.n == 0 {
+		return nil
+	}
+	return &q.items[(q.head+q.n-1)%len(q.items)]
+}
+
+// Len returns the number of queued states.
+func (q *InputQueue[T]) Len() int { return q.n }
+
+// Cap returns the maximum number of queued states.
+func (q *InputQueue[T]) Cap() int { return len(q.items) }
+
+// Overflows returns how many states were folded into the last one because
+// the queue was full.
+func (q *InputQueue[T]) Overflows() uint64 { return q.overflows }
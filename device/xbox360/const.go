@@ -18,3 +18,39 @@ const (
 	ButtonX         = 0x4000
 	ButtonY         = 0x8000
 )
+
+// LED ring animations, as sent by the host in the LED output packet.
+const (
+	LEDOff              = 0x00
+	LEDBlinkAll         = 0x01
+	LEDFlashPlayer1     = 0x02 // flashes, then player 1 on
+	LEDFlashPlayer2     = 0x03
+	LEDFlashPlayer3     = 0x04
+	LEDFlashPlayer4     = 0x05
+	LEDPlayer1          = 0x06
+	LEDPlayer2          = 0x07
+	LEDPlayer3          = 0x08
+	LEDPlayer4          = 0x09
+	LEDRotating         = 0x0A
+	LEDBlinkCurrent     = 0x0B // blinks the current player, then returns to the previous state
+	LEDSlowBlinkCurrent = 0x0C
+	LEDAlternating      = 0x0D // 1+4 and 2+3 alternating, then returns to the previous state
+)
+
+// Host->Device packet types on EP 0x01.
+const (
+	outPacketRumble = 0x00
+	outPacketLED    = 0x01
+)
+
+// Security (XSM3) vendor requests on interface 3.
+const (
+	securityInterface = 0x03
+
+	securityGetSerial     = 0x81
+	securityInitChallenge = 0x82
+	securityGetResponse   = 0x83
+	securityAccept        = 0x84
+	securityGetState      = 0x86
+	securityVerify        = 0x87
+)
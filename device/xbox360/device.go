@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"sync/atomic"
 
 	"github.com/Alia5/VIIPER/device"
@@ -16,7 +17,15 @@ type Xbox360 struct {
 	tick       uint64
 	inputCh    chan InputState
 	rumbleFunc func(XRumbleState)
+	outputFunc func(OutputState)
 	descriptor usb.Descriptor
+
+	stateMu     sync.Mutex
+	inputState  InputState
+	outputState *OutputState
+
+	securityMu      sync.Mutex
+	securityPending uint8 // last challenge or verify request awaiting its response
 }
 
 type Xbox360CreateOptions struct {
@@ -53,11 +62,24 @@ func New(o *device.CreateOptions) (*Xbox360, error) {
 
 // SetRumbleCallback sets a callback that will be invoked when rumble commands arrive.
 func (x *Xbox360) SetRumbleCallback(f func(XRumbleState)) {
+	x.stateMu.Lock()
 	x.rumbleFunc = f
+	x.stateMu.Unlock()
+}
+
+// SetOutputCallback sets a callback that will be invoked with the complete
+// output state whenever rumble or LED ring commands arrive.
+func (x *Xbox360) SetOutputCallback(f func(OutputState)) {
+	x.stateMu.Lock()
+	x.outputFunc = f
+	x.stateMu.Unlock()
 }
 
 // UpdateInputState updates the device's current input state (thread-safe).
 func (x *Xbox360) UpdateInputState(state InputState) {
+	x.stateMu.Lock()
+	x.inputState = state
+	x.stateMu.Unlock()
 	select {
 	case <-x.inputCh:
 	default:
@@ -65,6 +87,29 @@ func (x *Xbox360) UpdateInputState(state InputState) {
 	x.inputCh <- state
 }
 
+// ResetInputState releases all inputs, see usb.NeutralStateDevice.
+func (x *Xbox360) ResetInputState() {
+	x.UpdateInputState(*NewInputState())
+}
+
+// GetInputState returns the current input state.
+func (x *Xbox360) GetInputState() any {
+	x.stateMu.Lock()
+	defer x.stateMu.Unlock()
+	return x.inputState
+}
+
+// GetOutputState returns the current rumble and LED ring state, or nil if the
+// host has not sent either yet.
+func (x *Xbox360) GetOutputState() any {
+	x.stateMu.Lock()
+	defer x.stateMu.Unlock()
+	if x.outputState == nil {
+		return nil
+	}
+	return *x.outputState
+}
+
 // HandleTransfer implements interrupt IN/OUT for Xbox360.
 func (x *Xbox360) HandleTransfer(ctx context.Context, ep uint32, dir uint32, out []byte) []byte {
 	if dir == usbip.DirIn {
@@ -78,28 +123,55 @@ func (x *Xbox360) HandleTransfer(ctx context.Context, ep uint32, dir uint32, out
 				return st.BuildReport()
 			}
 		default:
+			// Headset (0x82, 0x83) and plug-in module (0x84) endpoints.
+			// With nothing plugged in, a real controller NAKs them.
+			<-ctx.Done()
 			return nil
 		}
 	}
 	if dir == usbip.DirOut && ep == 1 {
-		// Host->Device output reports used by the wired Xbox 360 controller include
-		// an 8-byte rumble packet: [0]=ReportID(0x00), [1]=Len(0x08), [2]=Reserved/Status(0x00),
-		// [3]=Left (low-frequency/large) motor 0-255, [4]=Right (high-frequency/small) motor 0-255,
-		// [5..7]=Reserved (often 0x00).
-		// Some other outbound reports (e.g. LED control) use different IDs/lengths; we ignore those here.
-		if len(out) >= 8 && out[0] == 0x00 && out[1] == 0x08 {
-			rumble := XRumbleState{
-				LeftMotor:  out[3], // big / low-frequency motor
-				RightMotor: out[4], // small / high-frequency motor
-			}
-			if x.rumbleFunc != nil {
-				x.rumbleFunc(rumble)
-			}
-		}
+		x.handleOutput(out)
 	}
+	// Headset OUT data (0x02, 0x03) is accepted and dropped.
 	return nil
 }
 
+// handleOutput decodes Host->Device packets on EP 0x01:
+//
+//	Rumble: [0]=0x00, [1]=Len(0x08), [2]=Reserved(0x00),
+//	        [3]=Left (low-frequency/large) motor 0-255,
+//	        [4]=Right (high-frequency/small) motor 0-255, [5..7]=Reserved
+//	LED:    [0]=0x01, [1]=Len(0x03), [2]=Animation (LED* constants)
+func (x *Xbox360) handleOutput(out []byte) {
+	var rumble *XRumbleState
+	x.stateMu.Lock()
+	state := OutputState{}
+	if x.outputState != nil {
+		state = *x.outputState
+	}
+	switch {
+	case len(out) >= 8 && out[0] == outPacketRumble && out[1] == 0x08:
+		state.LeftMotor = out[3]  // big / low-frequency motor
+		state.RightMotor = out[4] // small / high-frequency motor
+		rumble = &XRumbleState{LeftMotor: out[3], RightMotor: out[4]}
+	case len(out) >= 3 && out[0] == outPacketLED && out[1] == 0x03:
+		state.LED = out[2]
+	default:
+		x.stateMu.Unlock()
+		return
+	}
+	x.outputState = &state
+	rumbleFunc, outputFunc := x.rumbleFunc, x.outputFunc
+	x.stateMu.Unlock()
+
+	if rumble != nil && rumbleFunc != nil {
+		rumbleFunc(*rumble)
+	}
+	if outputFunc != nil {
+		outputFunc(state)
+	}
+}
+
 func MakeDescriptor() usb.Descriptor {
 	return usb.Descriptor{
 		Device: usb.DeviceDescriptor{
@@ -211,6 +283,7 @@ func MakeDescriptor() usb.Descriptor {
 			1: "©Microsoft Corporation",
 			2: "VIIPER Controller", //"Controller",
 			3: "296013F",
+			4: "Xbox Security Method 3, Version 1.00, \u00a9 2005 Microsoft Corporation. All rights reserved.",
 		},
 	}
 }
@@ -245,5 +318,8 @@ func (x *Xbox360) HandleControl(bmRequestType, bRequest uint8, wValue, wIndex, w
 			extra[0], extra[1], extra[2], extra[3], extra[4], extra[5],
 		}, true
 	}
+	if bmRequestType&0x1F == 0x01 && wIndex&0xFF == securityInterface {
+		return x.handleSecurity(bmRequestType, bRequest, wLength)
+	}
 	return nil, false
 }
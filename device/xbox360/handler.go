@@ -29,14 +29,14 @@ func (h *handler) StreamHandler() api.StreamHandlerFunc {
 			return fmt.Errorf("device is not xbox360")
 		}
 
-		xdev.SetRumbleCallback(func(rumble XRumbleState) {
-			data, err := rumble.MarshalBinary()
+		xdev.SetOutputCallback(func(output OutputState) {
+			data, err := output.MarshalBinary()
 			if err != nil {
-				logger.Error("failed to marshal rumble", "error", err)
+				logger.Error("failed to marshal output", "error", err)
 				return
 			}
 			if _, err := conn.Write(data); err != nil {
-				logger.Error("failed to send rumble", "error", err)
+				logger.Error("failed to send output", "error", err)
 			}
 		})
 
@@ -55,10 +55,11 @@ func (h *handler) StreamHandler() api.StreamHandlerFunc {
 				return fmt.Errorf("unmarshal input state: %w", err)
 			}
 			xdev.UpdateInputState(state)
+			api.RecordFrame(conn, buf)
 		}
 	}
 }
 
 func (h *handler) UpdateMetaState(meta string, dev *usb.Device) error {
-	return nil
+	return device.ErrNoMetaState
 }
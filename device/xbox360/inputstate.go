@@ -10,13 +10,16 @@ import (
 // viiper:wire xbox360 c2s buttons:u32 lt:u8 rt:u8 lx:i16 ly:i16 rx:i16 ry:i16 reserved:u8*6
 type InputState struct {
 	// Button bitfield (lower 16 bits used typically), higher bits reserved
-	Buttons uint32
+	Buttons uint32 `json:"buttons"`
 	// Triggers: 0-255
-	LT, RT uint8
+	LT uint8 `json:"lt"`
+	RT uint8 `json:"rt"`
 	// Sticks: signed 16-bit little endian values
-	LX, LY   int16
-	RX, RY   int16
-	Reserved [6]byte
+	LX       int16   `json:"lx"`
+	LY       int16   `json:"ly"`
+	RX       int16   `json:"rx"`
+	RY       int16   `json:"ry"`
+	Reserved [6]byte `json:"-"`
 }
 
 // NewInputState returns an Xbox 360 input state in its neutral/resting state.
@@ -99,17 +102,13 @@ func (x *InputState) UnmarshalBinary(data []byte) error {
 	return nil
 }
 
-// XRumbleState is the wire format for rumble/motor commands sent from device to client.
-// Total size: 2 bytes (fixed).
-// Layout:
-//
-//	LeftMotor: 1 byte (0-255)
-//	RightMotor: 1 byte (0-255)
-//
-// viiper:wire xbox360 s2c left:u8 right:u8
+// XRumbleState is a rumble/motor command sent by the host, as passed to
+// rumble callbacks.
+// It used to be the 2-byte server -> client stream packet; the stream now
+// sends OutputState, which starts with the same two bytes.
 type XRumbleState struct {
-	LeftMotor  uint8
-	RightMotor uint8
+	LeftMotor  uint8 `json:"left"`
+	RightMotor uint8 `json:"right"`
 }
 
 // MarshalBinary encodes XRumbleState to 2 bytes.
@@ -126,3 +125,48 @@ func (r *XRumbleState) UnmarshalBinary(data []byte) error {
 	r.RightMotor = data[1]
 	return nil
 }
+
+// OutputState is the wire format for host output sent from device to client.
+// It is sent whenever the host changes rumble or the LED ring and always
+// carries the complete current state.
+// Total size: 3 bytes (fixed).
+// Layout:
+//
+//	LeftMotor: 1 byte (0-255)
+//	RightMotor: 1 byte (0-255)
+//	LED: 1 byte, LED ring animation (LED* constants)
+//
+// viiper:wire xbox360 s2c left:u8 right:u8 led:u8
+type OutputState struct {
+	LeftMotor  uint8 `json:"left"`
+	RightMotor uint8 `json:"right"`
+	LED        uint8 `json:"led"`
+}
+
+// Player returns the player number (1-4) the LED ring shows, or 0 if the
+// current animation does not indicate a player.
+func (o *OutputState) Player() int {
+	switch {
+	case o.LED >= LEDFlashPlayer1 && o.LED <= LEDFlashPlayer4:
+		return int(o.LED-LEDFlashPlayer1) + 1
+	case o.LED >= LEDPlayer1 && o.LED <= LEDPlayer4:
+		return int(o.LED-LEDPlayer1) + 1
+	}
+	return 0
+}
+
+// MarshalBinary encodes OutputState to 3 bytes.
+func (o *OutputState) MarshalBinary() ([]byte, error) {
+	return []byte{o.LeftMotor, o.RightMotor, o.LED}, nil
+}
+
+// UnmarshalBinary decodes 3 bytes into OutputState.
+func (o *OutputState) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 {
+		return io.ErrUnexpectedEOF
+	}
+	o.LeftMotor = data[0]
+	o.RightMotor = data[1]
+	o.LED = data[2]
+	return nil
+}
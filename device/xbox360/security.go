@@ -0,0 +1,74 @@
+package xbox360
+
+import "encoding/binary"
+
+// Sizes of the responses to challenge init and verify requests.
+const (
+	securityChallengeResponseSize = 0x2E
+	securityVerifyResponseSize    = 0x16
+)
+
+// Values returned by the "get state" request.
+const (
+	securityStateIdle  = 0x01
+	securityStateReady = 0x02
+)
+
+// handleSecurity answers the XSM3 vendor requests on the security interface.
+// The responses are canned: VIIPER does not implement the console
+// authentication crypto, so an Xbox 360 console will not accept them. Hosts
+// that only check that the interface is present and responding are satisfied.
+func (x *Xbox360) handleSecurity(bmRequestType, bRequest uint8, wLength uint16) ([]byte, bool) {
+	x.securityMu.Lock()
+	defer x.securityMu.Unlock()
+
+	in := bmRequestType&0x80 != 0
+	switch {
+	case in && bRequest == securityGetSerial:
+		return truncate(x.securityID(), wLength), true
+	case in && bRequest == securityGetState:
+		state := uint8(securityStateIdle)
+		if x.securityPending != 0 {
+			state = securityStateReady
+		}
+		return truncate([]byte{state, 0x00}, wLength), true
+	case in && bRequest == securityGetResponse:
+		size := 0
+		switch x.securityPending {
+		case securityInitChallenge:
+			size = securityChallengeResponseSize
+		case securityVerify:
+			size = securityVerifyResponseSize
+		}
+		x.securityPending = 0
+		return truncate(make([]byte, size), wLength), true
+	case !in && (bRequest == securityInitChallenge || bRequest == securityVerify):
+		x.securityPending = bRequest
+		return nil, true
+	case !in && bRequest == securityAccept:
+		x.securityPending = 0
+		return nil, true
+	}
+	return nil, false
+}
+
+// securityID builds the 29-byte identification block returned for the "get
+// serial" request from the device descriptor.
+func (x *Xbox360) securityID() []byte {
+	d := x.descriptor.Device
+	b := make([]byte, 0x1D)
+	copy(b[0:5], []byte{0x49, 0x4B, 0x00, 0x00, 0x17}) // header
+	copy(b[5:13], x.descriptor.Strings[3])             // serial
+	binary.LittleEndian.PutUint16(b[13:15], d.IDVendor)
+	binary.LittleEndian.PutUint16(b[15:17], d.IDProduct)
+	b[17] = x.descriptor.Interfaces[0].ClassDescriptors[0].Payload[2] // subtype
+	binary.LittleEndian.PutUint16(b[18:20], d.BcdDevice)
+	return b
+}
+
+func truncate(b []byte, n uint16) []byte {
+	if len(b) > int(n) {
+		return b[:n]
+	}
+	return b
+}
@@ -384,37 +384,39 @@ func TestInputReports(t *testing.T) {
 
 }
 
-func TestRumble(t *testing.T) {
+func TestOutput(t *testing.T) {
 
 	type testCase struct {
 		name        string
-		rumbleState xbox360.XRumbleState
+		outputState xbox360.OutputState
 		outPacket   []byte
 	}
+	// Cases run in order; every message carries the complete output state.
 	cases := []testCase{
 		{
-			name: "off",
-			rumbleState: xbox360.XRumbleState{
-				LeftMotor:  0,
-				RightMotor: 0,
-			},
-			outPacket: []byte{0x00, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			name:        "rumble off",
+			outputState: xbox360.OutputState{LeftMotor: 0, RightMotor: 0},
+			outPacket:   []byte{0x00, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
 		},
 		{
-			name: "mid",
-			rumbleState: xbox360.XRumbleState{
-				LeftMotor:  128,
-				RightMotor: 128,
-			},
-			outPacket: []byte{0x00, 0x08, 0x00, 0x80, 0x80, 0x00, 0x00, 0x00},
+			name:        "rumble mid",
+			outputState: xbox360.OutputState{LeftMotor: 128, RightMotor: 128},
+			outPacket:   []byte{0x00, 0x08, 0x00, 0x80, 0x80, 0x00, 0x00, 0x00},
 		},
 		{
-			name: "full",
-			rumbleState: xbox360.XRumbleState{
-				LeftMotor:  255,
-				RightMotor: 255,
-			},
-			outPacket: []byte{0x00, 0x08, 0x00, 0xff, 0xff, 0x00, 0x00, 0x00},
+			name:        "led player 2 keeps rumble",
+			outputState: xbox360.OutputState{LeftMotor: 128, RightMotor: 128, LED: xbox360.LEDPlayer2},
+			outPacket:   []byte{0x01, 0x03, xbox360.LEDPlayer2},
+		},
+		{
+			name:        "rumble full keeps led",
+			outputState: xbox360.OutputState{LeftMotor: 255, RightMotor: 255, LED: xbox360.LEDPlayer2},
+			outPacket:   []byte{0x00, 0x08, 0x00, 0xff, 0xff, 0x00, 0x00, 0x00},
+		},
+		{
+			name:        "led rotating",
+			outputState: xbox360.OutputState{LeftMotor: 255, RightMotor: 255, LED: xbox360.LEDRotating},
+			outPacket:   []byte{0x01, 0x03, xbox360.LEDRotating},
 		},
 	}
 
@@ -465,15 +467,74 @@ func TestRumble(t *testing.T) {
 			if !assert.NoError(t, usbipClient.Submit(imp.Conn, usbip.DirOut, 1, tc.outPacket, nil)) {
 				return
 			}
-			var buf [2]byte
+			var buf [3]byte
 			_ = stream.SetReadDeadline(time.Now().Add(750 * time.Millisecond))
 			_, err := io.ReadFull(stream, buf[:])
 			if !assert.NoError(t, err) {
 				return
 			}
-			got := xbox360.XRumbleState{LeftMotor: buf[0], RightMotor: buf[1]}
-			assert.Equal(t, tc.rumbleState, got)
+			var got xbox360.OutputState
+			assert.NoError(t, got.UnmarshalBinary(buf[:]))
+			assert.Equal(t, tc.outputState, got)
 		})
 	}
 
 }
+
+func TestOutputStatePlayer(t *testing.T) {
+	cases := []struct {
+		led    uint8
+		player int
+	}{
+		{xbox360.LEDOff, 0},
+		{xbox360.LEDFlashPlayer1, 1},
+		{xbox360.LEDFlashPlayer4, 4},
+		{xbox360.LEDPlayer1, 1},
+		{xbox360.LEDPlayer3, 3},
+		{xbox360.LEDRotating, 0},
+	}
+	for _, tc := range cases {
+		o := xbox360.OutputState{LED: tc.led}
+		assert.Equal(t, tc.player, o.Player(), "led %#x", tc.led)
+	}
+}
+
+func TestSecurityInterface(t *testing.T) {
+	d, err := xbox360.New(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	const iface = 0x03
+
+	desc := d.GetDescriptor()
+	assert.Equal(t, "Xbox Security Method 3, Version 1.00, © 2005 Microsoft Corporation. All rights reserved.",
+		desc.Strings[desc.Interfaces[iface].Descriptor.IInterface], "interface string of a real controller")
+
+	id, ok := d.HandleControl(0xC1, 0x81, 0, iface, 0x1D, nil)
+	assert.True(t, ok)
+	assert.Len(t, id, 0x1D)
+	assert.Equal(t, []byte{0x5E, 0x04, 0x8E, 0x02}, id[13:17])
+
+	state, ok := d.HandleControl(0xC1, 0x86, 0, iface, 2, nil)
+	assert.True(t, ok)
+	assert.Equal(t, []byte{0x01, 0x00}, state)
+
+	_, ok = d.HandleControl(0x41, 0x82, 0, iface, 0x22, make([]byte, 0x22))
+	assert.True(t, ok)
+	state, _ = d.HandleControl(0xC1, 0x86, 0, iface, 2, nil)
+	assert.Equal(t, []byte{0x02, 0x00}, state)
+	resp, ok := d.HandleControl(0xC1, 0x83, 0, iface, 0x2E, nil)
+	assert.True(t, ok)
+	assert.Len(t, resp, 0x2E)
+
+	_, ok = d.HandleControl(0x41, 0x87, 0, iface, 0x16, make([]byte, 0x16))
+	assert.True(t, ok)
+	resp, _ = d.HandleControl(0xC1, 0x83, 0, iface, 0x2E, nil)
+	assert.Len(t, resp, 0x16)
+
+	_, ok = d.HandleControl(0x41, 0x84, 0, iface, 0, nil)
+	assert.True(t, ok)
+
+	_, ok = d.HandleControl(0xC1, 0x81, 0, 0x00, 0x1D, nil)
+	assert.False(t, ok, "security requests are only answered on interface 3")
+}
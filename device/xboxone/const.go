@@ -0,0 +1,93 @@
+package xboxone
+
+const (
+	DefaultVID = 0x045E
+	DefaultPID = 0x0B12 // Xbox Series X|S controller
+)
+
+// Button bitmasks of InputState.Buttons.
+// The lower 16 bits match the GIP input packet.
+const (
+	ButtonMenu       = 0x00000004
+	ButtonView       = 0x00000008
+	ButtonA          = 0x00000010
+	ButtonB          = 0x00000020
+	ButtonX          = 0x00000040
+	ButtonY          = 0x00000080
+	ButtonDPadUp     = 0x00000100
+	ButtonDPadDown   = 0x00000200
+	ButtonDPadLeft   = 0x00000400
+	ButtonDPadRight  = 0x00000800
+	ButtonLShoulder  = 0x00001000
+	ButtonRShoulder  = 0x00002000
+	ButtonLThumb     = 0x00004000
+	ButtonRThumb     = 0x00008000
+	ButtonGuide      = 0x00010000 // sent as GIP virtual key
+	ButtonShare      = 0x00020000
+	ButtonPaddle1    = 0x00040000 // upper right
+	ButtonPaddle2    = 0x00080000 // lower right
+	ButtonPaddle3    = 0x00100000 // upper left
+	ButtonPaddle4    = 0x00200000 // lower left
+	ButtonPaddleMask = ButtonPaddle1 | ButtonPaddle2 | ButtonPaddle3 | ButtonPaddle4
+)
+
+// TriggerMax is the maximum trigger value.
+const TriggerMax = 1023
+
+// Guide button LED modes, as sent by the host in the LED command.
+const (
+	LEDOff         = 0x00
+	LEDOn          = 0x01
+	LEDBlinkFast   = 0x02
+	LEDBlinkNormal = 0x03
+	LEDBlinkSlow   = 0x04
+	LEDFadeSlow    = 0x08
+	LEDFadeFast    = 0x09
+)
+
+// GIP commands.
+const (
+	gipCmdAck        = 0x01
+	gipCmdAnnounce   = 0x02
+	gipCmdStatus     = 0x03
+	gipCmdIdentify   = 0x04
+	gipCmdPower      = 0x05
+	gipCmdAuth       = 0x06
+	gipCmdVirtualKey = 0x07
+	gipCmdRumble     = 0x09
+	gipCmdLED        = 0x0A
+	gipCmdInput      = 0x20
+)
+
+// GIP header option bits.
+const (
+	gipOptAck        = 0x10
+	gipOptInternal   = 0x20
+	gipOptChunkStart = 0x40
+	gipOptChunk      = 0x80
+)
+
+// Power modes of the power command.
+const (
+	gipPowerOn    = 0x00
+	gipPowerSleep = 0x01
+	gipPowerOff   = 0x04
+)
+
+// Motor mask bits of the rumble command.
+const (
+	gipMotorRight        = 0x01
+	gipMotorLeft         = 0x02
+	gipMotorRightTrigger = 0x04
+	gipMotorLeftTrigger  = 0x08
+)
+
+const (
+	gipVirtualKeyGuide = 0x5B
+
+	// maxPacketSize is the endpoint's wMaxPacketSize.
+	maxPacketSize = 64
+	// inputPayloadSize is the payload length of the input packet.
+	// Layout as sent by Series X|S controllers, see BuildReport.
+	inputPayloadSize = 0x2C
+)
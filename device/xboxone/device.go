@@ -0,0 +1,302 @@
+// Package xboxone provides an Xbox One / Series X|S controller device
+// implementation speaking the Game Input Protocol (GIP).
+package xboxone
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/usb"
+	"github.com/Alia5/VIIPER/usbip"
+)
+
+// XboxOne is a wired Xbox One / Series X|S controller.
+//
+// Like the real controller, it announces itself once the host starts reading,
+// answers the host's identify request, and only sends input packets after the
+// host powered it on.
+type XboxOne struct {
+	descriptor usb.Descriptor
+	outputFunc func(OutputState)
+
+	mu          sync.Mutex
+	wake        chan struct{}
+	pending     [][]byte // GIP packets waiting for the host, sent before input
+	powered     bool
+	inputDirty  bool
+	inputState  InputState
+	outputState *OutputState
+	inputSeq    uint8
+	seq         uint8
+}
+
+// New returns a new XboxOne device.
+func New(o *device.CreateOptions) (*XboxOne, error) {
+	d := &XboxOne{
+		descriptor: MakeDescriptor(),
+		wake:       make(chan struct{}, 1),
+	}
+	if o != nil {
+		if o.IDVendor != nil {
+			d.descriptor.Device.IDVendor = *o.IDVendor
+		}
+		if o.IDProduct != nil {
+			d.descriptor.Device.IDProduct = *o.IDProduct
+		}
+	}
+	dd := d.descriptor.Device
+	d.queue(gipHeader{Command: gipCmdAnnounce, Options: gipOptInternal}, announcePayload(dd.IDVendor, dd.IDProduct, dd.BcdDevice))
+	return d, nil
+}
+
+// SetOutputCallback sets a callback that will be invoked with the complete
+// output state whenever rumble or LED commands arrive.
+func (x *XboxOne) SetOutputCallback(f func(OutputState)) {
+	x.mu.Lock()
+	x.outputFunc = f
+	x.mu.Unlock()
+}
+
+// UpdateInputState updates the device's current input state (thread-safe).
+// Guide button changes are sent to the host as virtual key packets.
+func (x *XboxOne) UpdateInputState(state InputState) {
+	x.mu.Lock()
+	if (state.Buttons^x.inputState.Buttons)&ButtonGuide != 0 && x.powered {
+		var pressed uint8
+		if state.Buttons&ButtonGuide != 0 {
+			pressed = 1
+		}
+		x.queueLocked(gipHeader{Command: gipCmdVirtualKey, Options: gipOptInternal}, []byte{pressed, gipVirtualKeyGuide})
+	}
+	x.inputState = state
+	x.inputDirty = true
+	x.mu.Unlock()
+	x.signal()
+}
+
+// ResetInputState releases all inputs, see usb.NeutralStateDevice.
+func (x *XboxOne) ResetInputState() {
+	x.UpdateInputState(*NewInputState())
+}
+
+// GetInputState returns the current input state.
+func (x *XboxOne) GetInputState() any {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.inputState
+}
+
+// GetOutputState returns the current rumble and LED state, or nil if the host
+// has not sent either yet.
+func (x *XboxOne) GetOutputState() any {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.outputState == nil {
+		return nil
+	}
+	return *x.outputState
+}
+
+// HandleTransfer implements the GIP interrupt endpoints.
+func (x *XboxOne) HandleTransfer(ctx context.Context, ep uint32, dir uint32, out []byte) []byte {
+	if ep != 2 {
+		return nil
+	}
+	if dir == usbip.DirOut {
+		x.handlePacket(out)
+		return nil
+	}
+	for {
+		if pkt := x.nextPacket(); pkt != nil {
+			return pkt
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-x.wake:
+		}
+	}
+}
+
+// nextPacket returns the next packet for the host, or nil if there is none.
+func (x *XboxOne) nextPacket() []byte {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if len(x.pending) > 0 {
+		pkt := x.pending[0]
+		x.pending = x.pending[1:]
+		return pkt
+	}
+	if x.powered && x.inputDirty {
+		x.inputDirty = false
+		x.inputSeq = nextSeq(x.inputSeq)
+		return x.inputState.BuildReport(x.inputSeq)
+	}
+	return nil
+}
+
+// handlePacket processes a GIP packet sent by the host.
+func (x *XboxOne) handlePacket(b []byte) {
+	h, payload, err := parseGIP(b)
+	if err != nil {
+		return
+	}
+
+	x.mu.Lock()
+	if h.Options&gipOptAck != 0 {
+		x.queueLocked(gipHeader{Command: gipCmdAck, Options: gipOptInternal, Sequence: h.Sequence}, ackPayload(h, h.Offset+h.Length))
+	}
+	var output *OutputState
+	switch h.Command {
+	case gipCmdIdentify:
+		x.seq = nextSeq(x.seq)
+		x.pending = append(x.pending, chunkGIP(gipCmdIdentify, gipOptInternal, x.seq, identifyMessage(x.descriptor.Device.BcdDevice))...)
+	case gipCmdPower:
+		if len(payload) > 0 {
+			switch payload[0] {
+			case gipPowerOn:
+				x.powered = true
+				x.inputDirty = true
+			case gipPowerSleep, gipPowerOff:
+				x.powered = false
+			}
+		}
+	case gipCmdRumble:
+		// [0]=0x00, [1]=motor mask, [2]=left trigger, [3]=right trigger,
+		// [4]=left motor, [5]=right motor, [6]=duration, [7]=delay, [8]=repeat
+		if len(payload) >= 6 {
+			state := x.currentOutput()
+			mask := payload[1]
+			if mask&gipMotorLeftTrigger != 0 {
+				state.LeftTrigger = payload[2]
+			}
+			if mask&gipMotorRightTrigger != 0 {
+				state.RightTrigger = payload[3]
+			}
+			if mask&gipMotorLeft != 0 {
+				state.LeftMotor = payload[4]
+			}
+			if mask&gipMotorRight != 0 {
+				state.RightMotor = payload[5]
+			}
+			output = &state
+		}
+	case gipCmdLED:
+		// [0]=0x00, [1]=mode, [2]=brightness
+		if len(payload) >= 3 {
+			state := x.currentOutput()
+			state.LEDMode = payload[1]
+			state.LEDBrightness = payload[2]
+			output = &state
+		}
+	}
+	if output != nil {
+		x.outputState = output
+	}
+	outputFunc := x.outputFunc
+	x.mu.Unlock()
+	x.signal()
+
+	if output != nil && outputFunc != nil {
+		outputFunc(*output)
+	}
+}
+
+func (x *XboxOne) currentOutput() OutputState {
+	if x.outputState == nil {
+		return OutputState{}
+	}
+	return *x.outputState
+}
+
+func (x *XboxOne) queue(h gipHeader, payload []byte) {
+	x.mu.Lock()
+	x.queueLocked(h, payload)
+	x.mu.Unlock()
+	x.signal()
+}
+
+// queueLocked queues a packet for the host. Packets without a sequence
+// number get the next one.
+func (x *XboxOne) queueLocked(h gipHeader, payload []byte) {
+	if h.Sequence == 0 {
+		x.seq = nextSeq(x.seq)
+		h.Sequence = x.seq
+	}
+	x.pending = append(x.pending, appendGIP(nil, h, payload))
+}
+
+func (x *XboxOne) signal() {
+	select {
+	case x.wake <- struct{}{}:
+	default:
+	}
+}
+
+// nextSeq returns the sequence number following s. 0 is skipped.
+func nextSeq(s uint8) uint8 {
+	s++
+	if s == 0 {
+		s = 1
+	}
+	return s
+}
+
+func MakeDescriptor() usb.Descriptor {
+	return usb.Descriptor{
+		Device: usb.DeviceDescriptor{
+			BcdUSB:             0x0200,
+			BDeviceClass:       0xff,
+			BDeviceSubClass:    0x47,
+			BDeviceProtocol:    0xd0,
+			BMaxPacketSize0:    0x40,
+			IDVendor:           DefaultVID,
+			IDProduct:          DefaultPID,
+			BcdDevice:          0x0511,
+			IManufacturer:      0x01,
+			IProduct:           0x02,
+			ISerialNumber:      0x03,
+			BNumConfigurations: 0x01,
+			Speed:              2, // Full speed
+		},
+		Interfaces: []usb.InterfaceConfig{
+			// Interface 0: ff/47/d0, GIP data
+			{
+				Descriptor: usb.InterfaceDescriptor{
+					BInterfaceNumber:   0x00,
+					BAlternateSetting:  0x00,
+					BNumEndpoints:      0x02,
+					BInterfaceClass:    0xff,
+					BInterfaceSubClass: 0x47,
+					BInterfaceProtocol: 0xd0,
+					IInterface:         0x00,
+				},
+				Endpoints: []usb.EndpointDescriptor{
+					{BEndpointAddress: 0x02, BMAttributes: 0x03, WMaxPacketSize: maxPacketSize, BInterval: 0x04},
+					{BEndpointAddress: 0x82, BMAttributes: 0x03, WMaxPacketSize: maxPacketSize, BInterval: 0x04},
+				},
+			},
+		},
+		Strings: map[uint8]string{
+			0: "\u0409", // LangID: en-US (0x0409)
+			1: "Microsoft",
+			2: "VIIPER Controller",
+			3: "3039373130303436",
+		},
+	}
+}
+
+func (x *XboxOne) GetDescriptor() *usb.Descriptor {
+	return &x.descriptor
+}
+
+func (x *XboxOne) GetDeviceSpecificArgs() map[string]any {
+	return map[string]any{}
+}
+
+// IsMessageEndpoint reports true for the GIP IN endpoint: repeating a previous
+// packet (e.g. an announce or ack) would confuse the host.
+func (x *XboxOne) IsMessageEndpoint(ep uint32) bool {
+	return ep == 2
+}
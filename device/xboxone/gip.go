@@ -0,0 +1,152 @@
+package xboxone
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// gipHeader is the header of a GIP packet:
+//
+//	[0]  command
+//	[1]  options (gipOpt* bits, low nibble is the client ID)
+//	[2]  sequence number
+//	[3+] payload length, varint
+//	[..] chunk offset, varint, only present if options has gipOptChunk
+type gipHeader struct {
+	Command  uint8
+	Options  uint8
+	Sequence uint8
+	Length   uint32
+	Offset   uint32
+}
+
+var errShortPacket = errors.New("short GIP packet")
+
+// parseGIP splits a GIP packet into header and payload.
+func parseGIP(b []byte) (gipHeader, []byte, error) {
+	if len(b) < 4 {
+		return gipHeader{}, nil, errShortPacket
+	}
+	h := gipHeader{Command: b[0], Options: b[1], Sequence: b[2]}
+	n, l := readVarint(b[3:])
+	if l == 0 {
+		return gipHeader{}, nil, errShortPacket
+	}
+	h.Length = n
+	pos := 3 + l
+	if h.Options&gipOptChunk != 0 {
+		off, l := readVarint(b[pos:])
+		if l == 0 {
+			return gipHeader{}, nil, errShortPacket
+		}
+		h.Offset = off
+		pos += l
+	}
+	payload := b[pos:]
+	if uint32(len(payload)) < h.Length {
+		return gipHeader{}, nil, errShortPacket
+	}
+	return h, payload[:h.Length], nil
+}
+
+// appendGIP appends a GIP packet with header h and payload to b.
+// h.Length is taken from the payload.
+func appendGIP(b []byte, h gipHeader, payload []byte) []byte {
+	b = append(b, h.Command, h.Options, h.Sequence)
+	b = binary.AppendUvarint(b, uint64(len(payload)))
+	if h.Options&gipOptChunk != 0 {
+		b = binary.AppendUvarint(b, uint64(h.Offset))
+	}
+	return append(b, payload...)
+}
+
+func readVarint(b []byte) (uint32, int) {
+	v, n := binary.Uvarint(b)
+	if n <= 0 || v > 1<<28 {
+		return 0, 0
+	}
+	return uint32(v), n
+}
+
+// chunkGIP splits a message that does not fit into one packet into chunks.
+// The first chunk carries the total length as offset, the following ones
+// their offset, and an empty chunk at the total length ends the message.
+func chunkGIP(cmd, options uint8, seq uint8, msg []byte) [][]byte {
+	const chunkSize = maxPacketSize - 8 // header with two 2-byte varints, rounded up
+	var packets [][]byte
+	for off := 0; off < len(msg); off += chunkSize {
+		end := min(off+chunkSize, len(msg))
+		h := gipHeader{Command: cmd, Options: options | gipOptChunk, Sequence: seq, Offset: uint32(off)}
+		if off == 0 {
+			h.Options |= gipOptChunkStart | gipOptAck
+			h.Offset = uint32(len(msg))
+		}
+		packets = append(packets, appendGIP(nil, h, msg[off:end]))
+	}
+	h := gipHeader{Command: cmd, Options: options | gipOptChunk, Sequence: seq, Offset: uint32(len(msg))}
+	return append(packets, appendGIP(nil, h, nil))
+}
+
+// ackPayload builds the payload acknowledging a packet with header h.
+func ackPayload(h gipHeader, received uint32) []byte {
+	p := []byte{0x00, h.Command, h.Options & gipOptInternal}
+	p = binary.LittleEndian.AppendUint16(p, uint16(received))
+	p = binary.LittleEndian.AppendUint16(p, 0)
+	return binary.LittleEndian.AppendUint16(p, 0)
+}
+
+// gamepadClass and gamepadInterface identify the device as a gamepad in the
+// identify message.
+var (
+	gamepadClass     = "Windows.Xbox.Input.Gamepad"
+	gamepadInterface = [16]byte{
+		0x2C, 0x40, 0x2E, 0x08, 0xDF, 0x07, 0xE1, 0x45,
+		0xA5, 0xAB, 0xA3, 0x12, 0x7A, 0xF1, 0x97, 0xB5,
+	}
+)
+
+// announcePayload builds the payload of the announce packet a controller
+// sends when it is plugged in.
+//
+//	[0..5]   address, all zero for wired controllers
+//	[6..7]   reserved
+//	[8..9]   vendor ID
+//	[10..11] product ID
+//	[12..19] firmware version (major, minor, build, revision)
+//	[20..27] hardware version (major, minor, build, revision)
+func announcePayload(vid, pid, bcdDevice uint16) []byte {
+	p := make([]byte, 8, 28)
+	p = binary.LittleEndian.AppendUint16(p, vid)
+	p = binary.LittleEndian.AppendUint16(p, pid)
+	for _, v := range []uint16{bcdDevice >> 8, bcdDevice & 0xFF, 0, 0, 1, 0, 0, 0} {
+		p = binary.LittleEndian.AppendUint16(p, v)
+	}
+	return p
+}
+
+// identifyMessage builds the message answering the host's identify request.
+// It starts with 16 reserved bytes followed by the offsets of the external
+// commands, firmware versions, audio formats, output and input capabilities,
+// classes, interfaces and HID descriptor sections. Offset 0 means absent.
+func identifyMessage(bcdDevice uint16) []byte {
+	const (
+		offFirmware   = 16 + 2
+		offClasses    = 16 + 10
+		offInterfaces = 16 + 12
+	)
+	msg := make([]byte, 32)
+
+	binary.LittleEndian.PutUint16(msg[offFirmware:], uint16(len(msg)))
+	msg = append(msg, 1)
+	msg = binary.LittleEndian.AppendUint16(msg, bcdDevice>>8)
+	msg = binary.LittleEndian.AppendUint16(msg, bcdDevice&0xFF)
+
+	binary.LittleEndian.PutUint16(msg[offClasses:], uint16(len(msg)))
+	msg = append(msg, 1)
+	msg = binary.LittleEndian.AppendUint16(msg, uint16(len(gamepadClass)))
+	msg = append(msg, gamepadClass...)
+
+	binary.LittleEndian.PutUint16(msg[offInterfaces:], uint16(len(msg)))
+	msg = append(msg, 1)
+	return append(msg, gamepadInterface[:]...)
+}
@@ -0,0 +1,134 @@
+package xboxone
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// InputState represents the controller state used to build a report.
+// viiper:wire xboxone c2s buttons:u32 lt:u16 rt:u16 lx:i16 ly:i16 rx:i16 ry:i16
+type InputState struct {
+	// Button bitfield, see Button* constants
+	Buttons uint32 `json:"buttons"`
+	// Triggers: 0-1023
+	LT uint16 `json:"lt"`
+	RT uint16 `json:"rt"`
+	// Sticks: signed 16-bit, 0 is center, up is positive
+	LX int16 `json:"lx"`
+	LY int16 `json:"ly"`
+	RX int16 `json:"rx"`
+	RY int16 `json:"ry"`
+}
+
+// NewInputState returns an input state in its neutral/resting state.
+func NewInputState() *InputState { return &InputState{} }
+
+// BuildReport encodes an InputState into a 48-byte GIP input packet.
+// Layout (indices in the returned slice):
+//
+//	 0: 0x20              - Command (input)
+//	 1: 0x00              - Options
+//	 2: seq               - Sequence number
+//	 3: 0x2C              - Payload size (44 bytes)
+//	 4-5: Buttons (low 16 bits)
+//	 6-7: LT (little-endian uint16, 0-1023)
+//	 8-9: RT (little-endian uint16, 0-1023)
+//	10-11: LX (little-endian int16)
+//	12-13: LY (little-endian int16)
+//	14-15: RX (little-endian int16)
+//	16-17: RY (little-endian int16)
+//	18: Paddles (bit 0-3: P1-P4, Elite Series 2 layout)
+//	30: Share (bit 0)
+//
+// The guide button is not part of the input packet.
+func (x *InputState) BuildReport(seq uint8) []byte {
+	b := make([]byte, 4+inputPayloadSize)
+	b[0] = gipCmdInput
+	b[1] = 0x00
+	b[2] = seq
+	b[3] = inputPayloadSize
+	binary.LittleEndian.PutUint16(b[4:6], uint16(x.Buttons&0xFFFF))
+	binary.LittleEndian.PutUint16(b[6:8], min(x.LT, TriggerMax))
+	binary.LittleEndian.PutUint16(b[8:10], min(x.RT, TriggerMax))
+	binary.LittleEndian.PutUint16(b[10:12], uint16(x.LX))
+	binary.LittleEndian.PutUint16(b[12:14], uint16(x.LY))
+	binary.LittleEndian.PutUint16(b[14:16], uint16(x.RX))
+	binary.LittleEndian.PutUint16(b[16:18], uint16(x.RY))
+	b[18] = uint8((x.Buttons & ButtonPaddleMask) / ButtonPaddle1)
+	if x.Buttons&ButtonShare != 0 {
+		b[30] = 0x01
+	}
+	return b
+}
+
+// MarshalBinary encodes InputState to 16 bytes.
+func (x *InputState) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint32(b[0:4], x.Buttons)
+	binary.LittleEndian.PutUint16(b[4:6], x.LT)
+	binary.LittleEndian.PutUint16(b[6:8], x.RT)
+	binary.LittleEndian.PutUint16(b[8:10], uint16(x.LX))
+	binary.LittleEndian.PutUint16(b[10:12], uint16(x.LY))
+	binary.LittleEndian.PutUint16(b[12:14], uint16(x.RX))
+	binary.LittleEndian.PutUint16(b[14:16], uint16(x.RY))
+	return b, nil
+}
+
+// UnmarshalBinary decodes 16 bytes into InputState.
+func (x *InputState) UnmarshalBinary(data []byte) error {
+	if len(data) < 16 {
+		return io.ErrUnexpectedEOF
+	}
+	x.Buttons = binary.LittleEndian.Uint32(data[0:4])
+	x.LT = binary.LittleEndian.Uint16(data[4:6])
+	x.RT = binary.LittleEndian.Uint16(data[6:8])
+	x.LX = int16(binary.LittleEndian.Uint16(data[8:10]))
+	x.LY = int16(binary.LittleEndian.Uint16(data[10:12]))
+	x.RX = int16(binary.LittleEndian.Uint16(data[12:14]))
+	x.RY = int16(binary.LittleEndian.Uint16(data[14:16]))
+	return nil
+}
+
+// OutputState is the wire format for host output sent from device to client.
+// It is sent whenever the host changes rumble or the guide button LED and
+// always carries the complete current state.
+// Total size: 6 bytes (fixed).
+// Layout:
+//
+//	LeftTrigger: 1 byte, left impulse trigger motor
+//	RightTrigger: 1 byte, right impulse trigger motor
+//	LeftMotor: 1 byte, left (low-frequency/large) motor
+//	RightMotor: 1 byte, right (high-frequency/small) motor
+//	LEDMode: 1 byte, guide button LED mode (LED* constants)
+//	LEDBrightness: 1 byte
+//
+// Motor values are passed through as sent by the host, which commonly uses 0-100.
+//
+// viiper:wire xboxone s2c leftTrigger:u8 rightTrigger:u8 left:u8 right:u8 ledMode:u8 ledBrightness:u8
+type OutputState struct {
+	LeftTrigger   uint8 `json:"leftTrigger"`
+	RightTrigger  uint8 `json:"rightTrigger"`
+	LeftMotor     uint8 `json:"left"`
+	RightMotor    uint8 `json:"right"`
+	LEDMode       uint8 `json:"ledMode"`
+	LEDBrightness uint8 `json:"ledBrightness"`
+}
+
+// MarshalBinary encodes OutputState to 6 bytes.
+func (o *OutputState) MarshalBinary() ([]byte, error) {
+	return []byte{o.LeftTrigger, o.RightTrigger, o.LeftMotor, o.RightMotor, o.LEDMode, o.LEDBrightness}, nil
+}
+
+// UnmarshalBinary decodes 6 bytes into OutputState.
+func (o *OutputState) UnmarshalBinary(data []byte) error {
+	if len(data) < 6 {
+		return io.ErrUnexpectedEOF
+	}
+	o.LeftTrigger = data[0]
+	o.RightTrigger = data[1]
+	o.LeftMotor = data[2]
+	o.RightMotor = data[3]
+	o.LEDMode = data[4]
+	o.LEDBrightness = data[5]
+	return nil
+}
@@ -0,0 +1,199 @@
+package xboxone_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/device/xboxone"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/usbip"
+	"github.com/Alia5/VIIPER/viiperclient"
+	"github.com/Alia5/VIIPER/virtualbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/Alia5/VIIPER/internal/registry" // Register devices
+)
+
+func TestGIP(t *testing.T) {
+	s := viiperTesting.NewTestServer(t)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+
+	r := s.ApiServer.Router()
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	r.RegisterStream("bus/{busId}/{deviceid}", api.DeviceStreamHandler(s.UsbServer))
+	require.NoError(t, s.ApiServer.Start())
+
+	b, err := virtualbus.NewWithBusID(1)
+	require.NoError(t, err)
+	defer b.Close() //nolint:errcheck
+	_ = s.UsbServer.AddBus(b)
+
+	client := viiperclient.New(s.ApiServer.Addr())
+	stream, _, err := client.AddDeviceAndConnect(context.Background(), b.BusID(), "xboxone", nil)
+	require.NoError(t, err)
+	defer stream.Close() //nolint:errcheck
+
+	usbipClient := viiperTesting.NewUsbIpClient(t, s.UsbServer.Addr())
+	devs, err := usbipClient.ListDevices()
+	require.NoError(t, err)
+	require.Len(t, devs, 1)
+	imp, err := usbipClient.AttachDevice(devs[0].BusID)
+	require.NoError(t, err)
+	defer imp.Conn.Close() //nolint:errcheck
+
+	var seq uint32 = 0x1000
+	read := func() []byte {
+		t.Helper()
+		seq++
+		data, err := readPacket(imp.Conn, seq)
+		require.NoError(t, err)
+		return data
+	}
+	write := func(pkt []byte) {
+		t.Helper()
+		require.NoError(t, usbipClient.Submit(imp.Conn, usbip.DirOut, 2, pkt, nil))
+	}
+	readOutput := func() xboxone.OutputState {
+		t.Helper()
+		var buf [6]byte
+		_ = stream.SetReadDeadline(time.Now().Add(750 * time.Millisecond))
+		_, err := io.ReadFull(stream, buf[:])
+		require.NoError(t, err)
+		var o xboxone.OutputState
+		require.NoError(t, o.UnmarshalBinary(buf[:]))
+		return o
+	}
+
+	t.Run("announce", func(t *testing.T) {
+		pkt := read()
+		require.Len(t, pkt, 4+28)
+		assert.Equal(t, []byte{0x02, 0x20}, pkt[0:2])
+		assert.Equal(t, uint8(28), pkt[3])
+		assert.Equal(t, uint16(xboxone.DefaultVID), binary.LittleEndian.Uint16(pkt[12:14]))
+		assert.Equal(t, uint16(xboxone.DefaultPID), binary.LittleEndian.Uint16(pkt[14:16]))
+	})
+
+	t.Run("identify", func(t *testing.T) {
+		write([]byte{0x04, 0x30, 0x07, 0x00})
+		ack := read()
+		assert.Equal(t, []byte{0x01, 0x20, 0x07, 0x09, 0x00, 0x04, 0x20, 0x00, 0x00}, ack[:9])
+
+		var msg []byte
+		total := -1
+		for range 16 {
+			pkt := read()
+			require.Equal(t, uint8(0x04), pkt[0])
+			require.NotZero(t, pkt[1]&0x80, "identify must be chunked")
+			length, n := binary.Uvarint(pkt[3:])
+			offset, m := binary.Uvarint(pkt[3+n:])
+			payload := pkt[3+n+m:]
+			require.Len(t, payload, int(length))
+			if pkt[1]&0x40 != 0 {
+				total = int(offset)
+			} else {
+				require.Equal(t, len(msg), int(offset))
+			}
+			if length == 0 {
+				break
+			}
+			msg = append(msg, payload...)
+		}
+		assert.Equal(t, total, len(msg))
+		assert.True(t, bytes.Contains(msg, []byte("Windows.Xbox.Input.Gamepad")))
+	})
+
+	t.Run("input after power on", func(t *testing.T) {
+		write([]byte{0x05, 0x20, 0x01, 0x01, 0x00})
+		pkt := read()
+		require.Len(t, pkt, 48)
+		assert.Equal(t, []byte{0x20, 0x00}, pkt[0:2])
+		assert.Equal(t, uint8(0x2C), pkt[3])
+		assert.Equal(t, make([]byte, 44), pkt[4:])
+
+		state := xboxone.InputState{
+			Buttons: xboxone.ButtonA | xboxone.ButtonDPadLeft | xboxone.ButtonShare | xboxone.ButtonPaddle2,
+			LT:      xboxone.TriggerMax,
+			RT:      2000, // clamped
+			LX:      -32768,
+			RY:      1000,
+		}
+		require.NoError(t, stream.WriteBinary(&state))
+		pkt = read()
+		require.Len(t, pkt, 48)
+		assert.Equal(t, uint16(xboxone.ButtonA|xboxone.ButtonDPadLeft), binary.LittleEndian.Uint16(pkt[4:6]))
+		assert.Equal(t, uint16(1023), binary.LittleEndian.Uint16(pkt[6:8]))
+		assert.Equal(t, uint16(1023), binary.LittleEndian.Uint16(pkt[8:10]))
+		assert.Equal(t, int16(-32768), int16(binary.LittleEndian.Uint16(pkt[10:12])))
+		assert.Equal(t, int16(1000), int16(binary.LittleEndian.Uint16(pkt[16:18])))
+		assert.Equal(t, uint8(0x02), pkt[18], "paddles")
+		assert.Equal(t, uint8(0x01), pkt[30], "share")
+	})
+
+	t.Run("guide", func(t *testing.T) {
+		require.NoError(t, stream.WriteBinary(&xboxone.InputState{Buttons: xboxone.ButtonGuide}))
+		pkt := read()
+		assert.Equal(t, []byte{0x07, 0x20}, pkt[0:2])
+		assert.Equal(t, []byte{0x02, 0x01, 0x5B}, pkt[3:])
+		pkt = read()
+		assert.Equal(t, uint8(0x20), pkt[0])
+		assert.Equal(t, []byte{0x00, 0x00}, pkt[4:6], "guide is not part of the input packet")
+
+		require.NoError(t, stream.WriteBinary(&xboxone.InputState{}))
+		pkt = read()
+		assert.Equal(t, []byte{0x02, 0x00, 0x5B}, pkt[3:])
+		read()
+	})
+
+	t.Run("rumble", func(t *testing.T) {
+		write([]byte{0x09, 0x00, 0x02, 0x09, 0x00, 0x0F, 10, 20, 30, 40, 0xFF, 0x00, 0xFF})
+		assert.Equal(t, xboxone.OutputState{LeftTrigger: 10, RightTrigger: 20, LeftMotor: 30, RightMotor: 40}, readOutput())
+
+		// only the main motors
+		write([]byte{0x09, 0x00, 0x03, 0x09, 0x00, 0x03, 0, 0, 50, 60, 0xFF, 0x00, 0xFF})
+		assert.Equal(t, xboxone.OutputState{LeftTrigger: 10, RightTrigger: 20, LeftMotor: 50, RightMotor: 60}, readOutput())
+	})
+
+	t.Run("led", func(t *testing.T) {
+		write([]byte{0x0A, 0x20, 0x04, 0x03, 0x00, xboxone.LEDBlinkSlow, 0x14})
+		assert.Equal(t, xboxone.OutputState{
+			LeftTrigger: 10, RightTrigger: 20, LeftMotor: 50, RightMotor: 60,
+			LEDMode: xboxone.LEDBlinkSlow, LEDBrightness: 0x14,
+		}, readOutput())
+	})
+}
+
+func readPacket(conn net.Conn, seq uint32) ([]byte, error) {
+	cmd := usbip.CmdSubmit{
+		Basic:             usbip.HeaderBasic{Command: usbip.CmdSubmitCode, Seqnum: seq, Devid: 0, Dir: usbip.DirIn, Ep: 2},
+		TransferBufferLen: 64,
+	}
+	_ = conn.SetDeadline(time.Now().Add(750 * time.Millisecond))
+	defer conn.SetDeadline(time.Time{}) //nolint:errcheck
+	if err := cmd.Write(conn); err != nil {
+		return nil, err
+	}
+	var retHdr [48]byte
+	if err := usbip.ReadExactly(conn, retHdr[:]); err != nil {
+		return nil, err
+	}
+	if gotCmd := binary.BigEndian.Uint32(retHdr[0:4]); gotCmd != usbip.RetSubmitCode {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if status := int32(binary.BigEndian.Uint32(retHdr[20:24])); status != 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data := make([]byte, binary.BigEndian.Uint32(retHdr[24:28]))
+	if err := usbip.ReadExactly(conn, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
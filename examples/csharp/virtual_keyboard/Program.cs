@@ -128,7 +128,10 @@ static async Task Send(ViiperDevice dev, byte modifiers, byte[] keys)
     {
         Modifiers = modifiers,
         Count = (byte)keys.Length,
-        Keys = keys
+        Keys = keys,
+        Consumercount = 0,
+        Consumer = Array.Empty<ushort>(),
+        System = 0
     };
     await dev.SendAsync(input);
 }
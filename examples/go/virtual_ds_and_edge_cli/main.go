@@ -125,8 +125,9 @@ func main() {
 			select {
 			case feedback := <-feedbackCh:
 				f := feedback.(*dualsense.OutputState)
-				fmt.Printf("[Output] Rumble: S=%d L=%d, LED: R=%d G=%d B=%d, Player LEDs: %d\n",
-					f.RumbleSmall, f.RumbleLarge, f.LedRed, f.LedGreen, f.LedBlue, f.PlayerLeds)
+				fmt.Printf("[Output] Rumble: S=%d L=%d, LED: R=%d G=%d B=%d, Player LEDs: %d, Triggers: L=0x%02x R=0x%02x, Mute LED: %d\n",
+					f.RumbleSmall, f.RumbleLarge, f.LedRed, f.LedGreen, f.LedBlue, f.PlayerLeds,
+					f.LeftTriggerMode, f.RightTriggerMode, f.MuteLed)
 			case err := <-errCh:
 				if err != nil {
 					fmt.Printf("[Output read error] %v\n", err)
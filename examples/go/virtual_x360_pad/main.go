@@ -82,13 +82,13 @@ func main() {
 		}
 	}()
 
-	// Start event-driven rumble reading
-	rumbleCh, errCh := stream.StartReading(ctx, 10, func(r *bufio.Reader) (encoding.BinaryUnmarshaler, error) {
-		var b [2]byte
+	// Start event-driven output (rumble + LED ring) reading
+	outputCh, errCh := stream.StartReading(ctx, 10, func(r *bufio.Reader) (encoding.BinaryUnmarshaler, error) {
+		var b [3]byte
 		if _, err := io.ReadFull(r, b[:]); err != nil {
 			return nil, err
 		}
-		msg := new(xbox360.XRumbleState)
+		msg := new(xbox360.OutputState)
 		if err := msg.UnmarshalBinary(b[:]); err != nil {
 			return nil, err
 		}
@@ -98,10 +98,10 @@ func main() {
 	go func() {
 		for {
 			select {
-			case msg := <-rumbleCh:
+			case msg := <-outputCh:
 				if msg != nil {
-					rumble := msg.(*xbox360.XRumbleState)
-					fmt.Printf("← Rumble: Left=%d, Right=%d\n", rumble.LeftMotor, rumble.RightMotor)
+					output := msg.(*xbox360.OutputState)
+					fmt.Printf("← Rumble: Left=%d, Right=%d, LED=%#x (player %d)\n", output.LeftMotor, output.RightMotor, output.LED, output.Player())
 				}
 			case err := <-errCh:
 				if err != nil {
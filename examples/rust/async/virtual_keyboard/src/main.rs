@@ -153,6 +153,9 @@ async fn type_string(stream: &mut viiper_client::AsyncDeviceStream, text: &str)
             modifiers: mods,
             count: 1,
             keys: vec![key],
+            consumer_count: 0,
+            consumer: vec![],
+            system: 0,
         };
         stream.send(&down).await?;
         sleep(Duration::from_millis(100)).await;
@@ -162,6 +165,9 @@ async fn type_string(stream: &mut viiper_client::AsyncDeviceStream, text: &str)
             modifiers: 0,
             count: 0,
             keys: vec![],
+            consumer_count: 0,
+            consumer: vec![],
+            system: 0,
         };
         stream.send(&up).await?;
         sleep(Duration::from_millis(100)).await;
@@ -174,6 +180,9 @@ async fn press_key(stream: &mut viiper_client::AsyncDeviceStream, key: u8) -> Re
         modifiers: 0,
         count: 1,
         keys: vec![key],
+        consumer_count: 0,
+        consumer: vec![],
+        system: 0,
     };
     stream.send(&press).await?;
     sleep(Duration::from_millis(100)).await;
@@ -182,6 +191,9 @@ async fn press_key(stream: &mut viiper_client::AsyncDeviceStream, key: u8) -> Re
         modifiers: 0,
         count: 0,
         keys: vec![],
+        consumer_count: 0,
+        consumer: vec![],
+        system: 0,
     };
     stream.send(&release).await?;
     Ok(())
@@ -162,6 +162,9 @@ fn type_string(
             modifiers: mods,
             count: 1,
             keys: vec![key],
+            consumer_count: 0,
+            consumer: vec![],
+            system: 0,
         };
         stream.send(&down)?;
         thread::sleep(Duration::from_millis(100));
@@ -171,6 +174,9 @@ fn type_string(
             modifiers: 0,
             count: 0,
             keys: vec![],
+            consumer_count: 0,
+            consumer: vec![],
+            system: 0,
         };
         stream.send(&up)?;
         thread::sleep(Duration::from_millis(100));
@@ -186,6 +192,9 @@ fn press_key(
         modifiers: 0,
         count: 1,
         keys: vec![key],
+        consumer_count: 0,
+        consumer: vec![],
+        system: 0,
     };
     stream.send(&press)?;
     thread::sleep(Duration::from_millis(100));
@@ -194,6 +203,9 @@ fn press_key(
         modifiers: 0,
         count: 0,
         keys: vec![],
+        consumer_count: 0,
+        consumer: vec![],
+        system: 0,
     };
     stream.send(&release)?;
     Ok(())
@@ -72,12 +72,13 @@ async function main() {
     }
   };
 
-  // Start event-driven rumble reading (2 bytes per rumble state)
+  // Start event-driven output reading (3 bytes: rumble left/right, LED ring)
   dev.on("output", (buf: Buffer) => {
-    if (buf.length >= 2) {
+    if (buf.length >= 3) {
       const leftMotor = buf.readUInt8(0);
       const rightMotor = buf.readUInt8(1);
-      console.log(`← Rumble: Left=${leftMotor}, Right=${rightMotor}`);
+      const led = buf.readUInt8(2);
+      console.log(`← Rumble: Left=${leftMotor}, Right=${rightMotor}, LED=${led}`);
     }
   });
 
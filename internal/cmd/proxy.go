@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/Alia5/VIIPER/internal/log"
+	"github.com/Alia5/VIIPER/internal/pcap"
 	"github.com/Alia5/VIIPER/internal/server/proxy"
 )
 
@@ -17,6 +19,9 @@ type Proxy struct {
 	ListenAddr        string        `help:"Proxy listen address" default:":3241" env:"VIIPER_PROXY_ADDR"`
 	UpstreamAddr      string        `help:"Upstream USB-IP server address" required:"" env:"VIIPER_PROXY_UPSTREAM"`
 	ConnectionTimeout time.Duration `help:"Connection timeout" default:"30s" env:"VIIPER_PROXY_TIMEOUT"`
+	Pcap              string        `help:"Capture the proxied USB-IP traffic to this pcapng file (Linux usbmon link type, open with Wireshark)" env:"VIIPER_PROXY_PCAP"`
+	CaptureProfile    string        `help:"Record the descriptors and control responses of the proxied device to this JSON file, for use with the clone device type" env:"VIIPER_PROXY_CAPTURE_PROFILE"`
+	Faults            string        `help:"Inject the delays, drops and disconnects described in this file (json|yaml|toml) into proxied connections" env:"VIIPER_PROXY_FAULTS"`
 }
 
 // Run is called by Kong when the proxy command is executed.
@@ -30,6 +35,27 @@ func (p *Proxy) Run(logger *slog.Logger, rawLogger log.RawLogger) error {
 
 	logger.Info("Starting VIIPER USB-IP proxy", "listen", p.ListenAddr, "upstream", p.UpstreamAddr)
 	proxySrv := proxy.New(p.ListenAddr, p.UpstreamAddr, p.ConnectionTimeout, logger, rawLogger)
+	if p.Pcap != "" {
+		capture, f, err := pcap.Create(p.Pcap)
+		if err != nil {
+			return fmt.Errorf("failed to create pcap file: %w", err)
+		}
+		defer f.Close() //nolint:errcheck
+		proxySrv.SetCapture(capture)
+		logger.Info("Capturing USB-IP traffic", "pcap", p.Pcap)
+	}
+	if p.CaptureProfile != "" {
+		proxySrv.SetProfileRecorder(proxy.NewProfileRecorder(p.CaptureProfile))
+		logger.Info("Recording device profile", "path", p.CaptureProfile)
+	}
+	if p.Faults != "" {
+		faults, err := proxy.LoadFaults(p.Faults)
+		if err != nil {
+			return fmt.Errorf("failed to load faults: %w", err)
+		}
+		proxySrv.SetFaults(faults)
+		logger.Warn("Injecting faults into proxied connections", "path", p.Faults, "rules", len(faults.Rules))
+	}
 
 	proxyErrCh := make(chan error, 1)
 	go func() {
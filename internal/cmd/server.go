@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -13,9 +15,11 @@ import (
 
 	"github.com/Alia5/VIIPER/internal/configpaths"
 	"github.com/Alia5/VIIPER/internal/log"
+	"github.com/Alia5/VIIPER/internal/pcap"
 	"github.com/Alia5/VIIPER/internal/server/api"
 	"github.com/Alia5/VIIPER/internal/server/api/auth"
 	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/internal/server/topology"
 	"github.com/Alia5/VIIPER/internal/server/usb"
 	"github.com/Alia5/VIIPER/internal/tray"
 	"github.com/Alia5/VIIPER/internal/util"
@@ -27,6 +31,11 @@ type Server struct {
 	USBServerConfig   usb.ServerConfig `embed:"" prefix:"usb."`
 	APIServerConfig   api.ServerConfig `embed:"" prefix:"api."`
 	ConnectionTimeout time.Duration    `help:"ConnectionTimeout operation timeout" default:"30s" env:"VIIPER_CONNECTION_TIMEOUT"`
+
+	Profile             string        `help:"Create the buses and devices declared in this file (json|yaml|toml) at startup and keep them alive" env:"VIIPER_PROFILE"`
+	StateFile           string        `help:"Persist buses and devices to this file (json|yaml|toml) and restore them at startup" env:"VIIPER_STATE_FILE"`
+	StateRestoreTimeout time.Duration `help:"Time restored devices wait for a client stream before they are removed" default:"1m" env:"VIIPER_STATE_RESTORE_TIMEOUT"`
+	Pcap                string        `help:"Capture all USB-IP traffic to this pcapng file (Linux usbmon link type, open with Wireshark)" env:"VIIPER_PCAP"`
 }
 
 // Run is called by Kong when the server command is executed.
@@ -76,6 +85,15 @@ func (s *Server) StartServer(ctx context.Context, logger *slog.Logger, rawLogger
 	}
 
 	usbSrv := usb.New(s.USBServerConfig, logger, rawLogger)
+	if s.Pcap != "" {
+		capture, f, err := pcap.Create(s.Pcap)
+		if err != nil {
+			return fmt.Errorf("failed to create pcap file: %w", err)
+		}
+		defer f.Close() //nolint:errcheck
+		usbSrv.SetCapture(capture)
+		logger.Info("Capturing USB-IP traffic", "pcap", s.Pcap)
+	}
 
 	usbErrCh := make(chan error, 1)
 	go func() {
@@ -88,6 +106,27 @@ func (s *Server) StartServer(ctx context.Context, logger *slog.Logger, rawLogger
 	case <-usbSrv.Ready():
 	}
 
+	if s.Profile != "" {
+		p, err := topology.LoadProfile(s.Profile)
+		if err != nil {
+			_ = usbSrv.Close()
+			return fmt.Errorf("failed to read profile: %w", err)
+		}
+		if err := topology.ApplyProfile(usbSrv, p, s.APIServerConfig.DeviceDataDir, logger); err != nil {
+			logger.Warn("failed to create some profile devices", "path", s.Profile, "error", err)
+		}
+	}
+
+	if s.StateFile != "" {
+		if st, err := topology.Load(s.StateFile); err == nil {
+			if err := topology.Restore(usbSrv, st, s.StateRestoreTimeout, s.APIServerConfig.DeviceDataDir, logger); err != nil {
+				logger.Warn("failed to restore some devices from state file", "path", s.StateFile, "error", err)
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			logger.Error("failed to read state file", "path", s.StateFile, "error", err)
+		}
+	}
+
 	if s.APIServerConfig.Addr == "" {
 		logger.Error("API server address must be set (default :3242).")
 		return fmt.Errorf("API server address must be set (default :3242).") // nolint
@@ -102,7 +141,15 @@ func (s *Server) StartServer(ctx context.Context, logger *slog.Logger, rawLogger
 	r.Register("bus/{id}/list", handler.BusDevicesList(usbSrv))
 	r.Register("bus/{id}/add", handler.BusDeviceAdd(usbSrv, apiSrv))
 	r.Register("bus/{id}/remove", handler.BusDeviceRemove(usbSrv))
+	r.Register("bus/{id}/{deviceid}/state", handler.DeviceState(usbSrv))
+	r.Register("bus/{id}/{deviceid}/meta", handler.DeviceUpdateMeta(usbSrv))
+	r.Register("bus/{id}/{deviceid}/type", handler.DeviceTypeText(usbSrv))
+	r.Register("bus/{id}/{deviceid}/record/start", handler.DeviceRecordStart(usbSrv))
+	r.Register("bus/{id}/{deviceid}/record/stop", handler.DeviceRecordStop(usbSrv))
+	r.Register("bus/{id}/{deviceid}/replay", handler.DeviceReplay(usbSrv, apiSrv))
+	r.Register("bus/{id}/{deviceid}/replay/stop", handler.DeviceReplayStop(usbSrv))
 	r.RegisterStream("bus/{busId}/{deviceid}", api.DeviceStreamHandler(usbSrv))
+	r.RegisterStream("events", api.EventStreamHandler(usbSrv))
 
 	if s.APIServerConfig.AutoAttachLocalClient {
 		logger.Info("Auto-attach is enabled, checking prerequisites...")
@@ -125,6 +172,17 @@ func (s *Server) StartServer(ctx context.Context, logger *slog.Logger, rawLogger
 		return err
 	}
 
+	stopPersisting := func() {}
+	if s.StateFile != "" {
+		persistCtx, stopPersist := context.WithCancel(ctx)
+		persistDone := topology.Persist(persistCtx, usbSrv, s.StateFile, logger)
+		// The final snapshot must be taken before the servers shut down.
+		stopPersisting = func() {
+			stopPersist()
+			<-persistDone
+		}
+	}
+
 	if util.IsRunFromGUI() {
 		go (func() {
 			time.Sleep(250 * time.Millisecond)
@@ -134,6 +192,7 @@ func (s *Server) StartServer(ctx context.Context, logger *slog.Logger, rawLogger
 
 	select {
 	case <-ctx.Done():
+		stopPersisting()
 		if apiSrv != nil {
 			apiSrv.Close()
 		}
@@ -141,6 +200,7 @@ func (s *Server) StartServer(ctx context.Context, logger *slog.Logger, rawLogger
 		_ = <-usbErrCh // nolint
 		return nil
 	case err := <-usbErrCh:
+		stopPersisting()
 		if apiSrv != nil {
 			apiSrv.Close()
 		}
@@ -5,6 +5,16 @@ import (
 	"unicode"
 )
 
+// ToTypeName converts a Go type name to the name of the generated type.
+// Exported Go identifiers (e.g. "MacroFrame") are kept as they are, so
+// references match the DTO declarations.
+func ToTypeName(s string) string {
+	if s != "" && unicode.IsUpper(rune(s[0])) && !strings.ContainsAny(s, "_- ") {
+		return s
+	}
+	return ToPascalCase(s)
+}
+
 func ToPascalCase(s string) string {
 	if s == "" {
 		return ""
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/Alia5/VIIPER/internal/codegen/common"
 	"github.com/Alia5/VIIPER/internal/codegen/meta"
 	"github.com/Alia5/VIIPER/internal/codegen/scanner"
 )
@@ -175,7 +176,7 @@ func generateClient(logger *slog.Logger, projectDir string, md *meta.Metadata) e
 
 func generateMethodParams(route scanner.RouteInfo) string {
 	var params []string
-	for key := range route.PathParams {
+	for _, key := range common.ExtractPathParams(route.Path) {
 		params = append(params, fmt.Sprintf("uint %s", toCamelCase(key)))
 	}
 	switch route.Payload.Kind {
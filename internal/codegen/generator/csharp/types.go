@@ -9,6 +9,7 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/Alia5/VIIPER/internal/codegen/common"
 	"github.com/Alia5/VIIPER/internal/codegen/meta"
 )
 
@@ -92,7 +93,8 @@ func fieldTypeToCSharp(field interface{}) string {
 	}
 
 	if typeKind == "struct" {
-		return toPascalCase(typeStr)
+		base, _, _ := common.NormalizeGoType(typeStr)
+		return common.ToTypeName(base)
 	}
 
 	return goTypeToCSharp(typeStr)
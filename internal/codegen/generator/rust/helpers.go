@@ -41,7 +41,7 @@ func goTypeToRust(goType string) string {
 	case "float64":
 		rustType = "f64"
 	default:
-		rustType = common.ToPascalCase(base)
+		rustType = common.ToTypeName(base)
 	}
 
 	if isSlice {
@@ -109,7 +109,7 @@ func toScreamingSnakeCase(s string) string {
 func generateMethodParamsRust(route scanner.RouteInfo) string {
 	var params []string
 
-	for key := range route.PathParams {
+	for _, key := range common.ExtractPathParams(route.Path) {
 		params = append(params, fmt.Sprintf("%s: u32", common.ToSnakeCase(key)))
 	}
 
@@ -140,7 +140,7 @@ func generatePathRust(route scanner.RouteInfo) string {
 	var args []string
 
 	formatStr = path
-	for key := range route.PathParams {
+	for _, key := range common.ExtractPathParams(route.Path) {
 		placeholder := fmt.Sprintf("{%s}", key)
 		formatStr = strings.Replace(formatStr, placeholder, "{}", 1)
 		args = append(args, common.ToSnakeCase(key))
@@ -175,7 +175,7 @@ func generateClient(logger *slog.Logger, srcDir string, md *meta.Metadata) error
 
 func generateMethodParamsTS(route scanner.RouteInfo) string {
 	var params []string
-	for key := range route.PathParams {
+	for _, key := range common.ExtractPathParams(route.Path) {
 		params = append(params, fmt.Sprintf("%s: number", common.ToCamelCase(key)))
 	}
 	switch route.Payload.Kind {
@@ -70,7 +70,8 @@ func fieldTypeToTS(field interface{}) string {
 		return goTypeToTS(elem) + "[]"
 	}
 	if typeKind == "struct" {
-		return common.ToPascalCase(typeStr)
+		base, _, _ := common.NormalizeGoType(typeStr)
+		return common.ToTypeName(base)
 	}
 	return goTypeToTS(typeStr)
 }
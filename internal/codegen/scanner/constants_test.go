@@ -42,9 +42,9 @@ func TestScanXbox360Constants(t *testing.T) {
 		t.Fatalf("Failed to scan xbox360 constants: %v", err)
 	}
 
-	// Should find 15 button constants
-	if len(result.Constants) != 15 {
-		t.Errorf("Expected 15 button constants, got %d", len(result.Constants))
+	// Should find 15 button and 14 LED constants
+	if len(result.Constants) != 29 {
+		t.Errorf("Expected 29 constants, got %d", len(result.Constants))
 	}
 
 	// Xbox360 has no maps
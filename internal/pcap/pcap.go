@@ -0,0 +1,112 @@
+// Package pcap writes USB-IP traffic as pcapng captures.
+//
+// URBs are reconstructed from CMD_SUBMIT/RET_SUBMIT and written with the Linux
+// usbmon link type (LINKTYPE_USB_LINUX_MMAPPED), so captures of VIIPER devices
+// or proxied real hardware can be analysed with Wireshark's USB dissectors.
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	blockSectionHeader  = 0x0A0D0D0A
+	blockInterfaceDesc  = 0x00000001
+	blockEnhancedPacket = 0x00000006
+
+	byteOrderMagic = 0x1A2B3C4D
+
+	// LinkTypeUSBLinuxMmapped is the usbmon link type with the 64-byte header.
+	LinkTypeUSBLinuxMmapped = 220
+
+	snapLen = 0x40000
+)
+
+// Writer writes a pcapng capture with a single usbmon interface.
+// It is safe for concurrent use.
+type Writer struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// NewWriter writes the section header and interface description to w and
+// returns a Writer for the packets.
+func NewWriter(w io.Writer) (*Writer, error) {
+	shb := make([]byte, 0, 28)
+	shb = binary.LittleEndian.AppendUint32(shb, byteOrderMagic)
+	shb = binary.LittleEndian.AppendUint16(shb, 1) // major version
+	shb = binary.LittleEndian.AppendUint16(shb, 0) // minor version
+	shb = binary.LittleEndian.AppendUint64(shb, 0xFFFFFFFFFFFFFFFF)
+
+	idb := make([]byte, 0, 8)
+	idb = binary.LittleEndian.AppendUint16(idb, LinkTypeUSBLinuxMmapped)
+	idb = binary.LittleEndian.AppendUint16(idb, 0) // reserved
+	idb = binary.LittleEndian.AppendUint32(idb, snapLen)
+
+	pw := &Writer{w: w}
+	if err := pw.writeBlock(blockSectionHeader, shb); err != nil {
+		return nil, err
+	}
+	if err := pw.writeBlock(blockInterfaceDesc, idb); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// WritePacket writes one usbmon packet captured at ts.
+func (w *Writer) WritePacket(ts time.Time, data []byte) error {
+	if len(data) > snapLen {
+		data = data[:snapLen]
+	}
+	us := uint64(ts.UnixMicro())
+	body := make([]byte, 0, 20+len(data)+3)
+	body = binary.LittleEndian.AppendUint32(body, 0) // interface ID
+	body = binary.LittleEndian.AppendUint32(body, uint32(us>>32))
+	body = binary.LittleEndian.AppendUint32(body, uint32(us))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(data)))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(data)))
+	body = append(body, data...)
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	return w.writeBlock(blockEnhancedPacket, body)
+}
+
+// writeBlock frames body as a pcapng block. After the first error, every
+// further write fails with it, so a broken file is not appended to.
+func (w *Writer) writeBlock(blockType uint32, body []byte) error {
+	total := uint32(12 + len(body))
+	b := make([]byte, 0, total)
+	b = binary.LittleEndian.AppendUint32(b, blockType)
+	b = binary.LittleEndian.AppendUint32(b, total)
+	b = append(b, body...)
+	b = binary.LittleEndian.AppendUint32(b, total)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	_, w.err = w.w.Write(b)
+	return w.err
+}
+
+// Create creates (or truncates) the capture file at path and writes its
+// headers. The returned Closer closes the file.
+func Create(path string) (*Writer, io.Closer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644) // nolint
+	if err != nil {
+		return nil, nil, err
+	}
+	w, err := NewWriter(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	return w, f, nil
+}
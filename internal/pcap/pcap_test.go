@@ -0,0 +1,187 @@
+package pcap_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/Alia5/VIIPER/internal/pcap"
+	"github.com/Alia5/VIIPER/usbip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type block struct {
+	typ  uint32
+	body []byte
+}
+
+func readBlocks(t *testing.T, b []byte) []block {
+	t.Helper()
+	var blocks []block
+	for len(b) > 0 {
+		require.GreaterOrEqual(t, len(b), 12)
+		typ := binary.LittleEndian.Uint32(b[0:4])
+		total := binary.LittleEndian.Uint32(b[4:8])
+		require.Zero(t, total%4, "block length must be a multiple of 4")
+		require.GreaterOrEqual(t, uint32(len(b)), total)
+		require.Equal(t, total, binary.LittleEndian.Uint32(b[total-4:total]))
+		blocks = append(blocks, block{typ: typ, body: b[8 : total-4]})
+		b = b[total:]
+	}
+	return blocks
+}
+
+// packets returns the usbmon packets of a capture.
+func packets(t *testing.T, b []byte) [][]byte {
+	t.Helper()
+	blocks := readBlocks(t, b)
+	require.GreaterOrEqual(t, len(blocks), 2)
+	assert.Equal(t, uint32(0x0A0D0D0A), blocks[0].typ)
+	assert.Equal(t, uint32(0x1A2B3C4D), binary.LittleEndian.Uint32(blocks[0].body[0:4]))
+	assert.Equal(t, uint32(1), blocks[1].typ)
+	assert.Equal(t, uint16(pcap.LinkTypeUSBLinuxMmapped), binary.LittleEndian.Uint16(blocks[1].body[0:2]))
+
+	var out [][]byte
+	for _, blk := range blocks[2:] {
+		require.Equal(t, uint32(6), blk.typ)
+		capLen := binary.LittleEndian.Uint32(blk.body[12:16])
+		out = append(out, blk.body[20:20+capLen])
+	}
+	return out
+}
+
+func cmdSubmit(seq, dir, ep, length uint32, setup [8]byte, payload []byte) []byte {
+	var buf bytes.Buffer
+	c := usbip.CmdSubmit{
+		Basic:             usbip.HeaderBasic{Command: usbip.CmdSubmitCode, Seqnum: seq, Devid: 1<<16 | 2, Dir: dir, Ep: ep},
+		TransferBufferLen: length,
+		Interval:          4,
+		Setup:             setup,
+	}
+	_ = c.Write(&buf)
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func retSubmit(seq uint32, status int32, payload []byte, actualLen uint32) []byte {
+	var buf bytes.Buffer
+	r := usbip.RetSubmit{
+		Basic:        usbip.HeaderBasic{Command: usbip.RetSubmitCode, Seqnum: seq},
+		Status:       status,
+		ActualLength: actualLen,
+	}
+	_ = r.Write(&buf)
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func TestStream(t *testing.T) {
+	var out bytes.Buffer
+	w, err := pcap.NewWriter(&out)
+	require.NoError(t, err)
+	s := w.NewStream()
+
+	// Import handshake is skipped.
+	importReq := make([]byte, 40)
+	binary.BigEndian.PutUint16(importReq[0:2], usbip.Version)
+	binary.BigEndian.PutUint16(importReq[2:4], usbip.OpReqImport)
+	importRep := make([]byte, 320)
+	binary.BigEndian.PutUint16(importRep[0:2], usbip.Version)
+	binary.BigEndian.PutUint16(importRep[2:4], usbip.OpRepImport)
+
+	getDescriptor := [8]byte{0x80, 0x06, 0x00, 0x01, 0x00, 0x00, 0x12, 0x00}
+	c2s := append(importReq, cmdSubmit(1, usbip.DirIn, 0, 18, getDescriptor, nil)...)
+	c2s = append(c2s, cmdSubmit(2, usbip.DirOut, 2, 3, [8]byte{}, []byte{0xAA, 0xBB, 0xCC})...)
+	c2s = append(c2s, cmdSubmit(3, usbip.DirIn, 1, 64, [8]byte{}, nil)...)
+	var unlink bytes.Buffer
+	_ = (&usbip.CmdUnlink{Basic: usbip.HeaderBasic{Command: usbip.CmdUnlinkCode, Seqnum: 4}, UnlinkSeqnum: 3}).Write(&unlink)
+	c2s = append(c2s, unlink.Bytes()...)
+
+	desc := bytes.Repeat([]byte{0x12}, 18)
+	s2c := append(importRep, retSubmit(1, 0, desc, 18)...)
+	s2c = append(s2c, retSubmit(2, 0, nil, 3)...)
+	var unlinkRet bytes.Buffer
+	_ = (&usbip.RetUnlink{Basic: usbip.HeaderBasic{Command: usbip.RetUnlinkCode, Seqnum: 4}, Status: -104}).Write(&unlinkRet)
+	s2c = append(s2c, unlinkRet.Bytes()...)
+
+	// Feed in odd chunks to exercise reassembly, interleaving both directions.
+	for len(c2s) > 0 || len(s2c) > 0 {
+		n := min(len(c2s), 7)
+		s.Feed(true, c2s[:n])
+		c2s = c2s[n:]
+		n = min(len(s2c), 11)
+		s.Feed(false, s2c[:n])
+		s2c = s2c[n:]
+	}
+
+	pkts := packets(t, out.Bytes())
+	require.Len(t, pkts, 6)
+
+	type event struct {
+		seq      uint64
+		typ      byte
+		xferType uint8
+		ep       uint8
+		status   int32
+		length   uint32
+		data     []byte
+	}
+	decode := func(p []byte) event {
+		require.GreaterOrEqual(t, len(p), 64)
+		assert.Equal(t, uint8(2), p[11], "devnum")
+		assert.Equal(t, uint16(1), binary.LittleEndian.Uint16(p[12:14]), "busnum")
+		e := event{
+			seq:      binary.LittleEndian.Uint64(p[0:8]),
+			typ:      p[8],
+			xferType: p[9],
+			ep:       p[10],
+			status:   int32(binary.LittleEndian.Uint32(p[28:32])),
+			length:   binary.LittleEndian.Uint32(p[32:36]),
+		}
+		if len(p) > 64 {
+			e.data = p[64:]
+		}
+		assert.Equal(t, uint32(len(e.data)), binary.LittleEndian.Uint32(p[36:40]), "len_cap")
+		return e
+	}
+
+	var got []event
+	for _, p := range pkts {
+		got = append(got, decode(p))
+	}
+	want := []event{
+		{seq: 1, typ: 'S', xferType: 2, ep: 0x80, status: -115, length: 18},
+		{seq: 1, typ: 'C', xferType: 2, ep: 0x80, status: 0, length: 18, data: desc},
+		{seq: 2, typ: 'S', xferType: 1, ep: 0x02, status: -115, length: 3, data: []byte{0xAA, 0xBB, 0xCC}},
+		{seq: 3, typ: 'S', xferType: 1, ep: 0x81, status: -115, length: 64},
+		{seq: 2, typ: 'C', xferType: 1, ep: 0x02, status: 0, length: 3},
+		{seq: 3, typ: 'C', xferType: 1, ep: 0x81, status: -104, length: 0},
+	}
+	assert.ElementsMatch(t, want, got)
+	assert.Equal(t, getDescriptor[:], pkts[0][40:48], "setup packet of the control transfer")
+	assert.Equal(t, uint8(0), pkts[0][14], "setup flag")
+}
+
+func TestStreamDevlistIgnored(t *testing.T) {
+	var out bytes.Buffer
+	w, err := pcap.NewWriter(&out)
+	require.NoError(t, err)
+	s := w.NewStream()
+
+	req := make([]byte, 8)
+	binary.BigEndian.PutUint16(req[0:2], usbip.Version)
+	binary.BigEndian.PutUint16(req[2:4], usbip.OpReqDevlist)
+	rep := make([]byte, 12, 12+312)
+	binary.BigEndian.PutUint16(rep[0:2], usbip.Version)
+	binary.BigEndian.PutUint16(rep[2:4], usbip.OpRepDevlist)
+	binary.BigEndian.PutUint32(rep[8:12], 1)
+	rep = append(rep, cmdSubmit(1, usbip.DirIn, 1, 8, [8]byte{}, nil)...) // device entry bytes
+	s.Feed(true, req)
+	s.Feed(false, rep)
+
+	assert.Empty(t, packets(t, out.Bytes()))
+
+	var nilStream *pcap.Stream
+	assert.NotPanics(t, func() { nilStream.Feed(true, req) })
+}
@@ -0,0 +1,123 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/Alia5/VIIPER/internal/urb"
+	"github.com/Alia5/VIIPER/usbip"
+)
+
+// usbmon event types and transfer types.
+const (
+	eventSubmit   = 'S'
+	eventComplete = 'C'
+
+	xferIsochronous = 0
+	xferInterrupt   = 1
+	xferControl     = 2
+
+	// usbmon header size of LINKTYPE_USB_LINUX_MMAPPED
+	usbmonHeaderSize = 64
+
+	errInProgress = -115 // -EINPROGRESS, status of submitted URBs
+)
+
+// Stream captures the URBs of one USB-IP connection. Feed it the raw bytes of
+// both directions in the order they were read; incomplete packets are buffered
+// until the rest arrives.
+//
+// USB-IP does not carry endpoint types, so endpoint 0 is captured as control,
+// URBs with iso packets as isochronous and everything else as interrupt
+// transfers. Management operations (device list, import) are skipped.
+type Stream struct {
+	urbs *urb.Stream
+}
+
+// NewStream returns a Stream writing to w. A nil Writer returns a nil Stream,
+// which ignores everything fed to it.
+func (w *Writer) NewStream() *Stream {
+	if w == nil {
+		return nil
+	}
+	return &Stream{urbs: urb.NewStream(usbmon{w: w})}
+}
+
+// Feed processes data read from one direction of the connection.
+func (s *Stream) Feed(clientToServer bool, data []byte) {
+	if s == nil {
+		return
+	}
+	s.urbs.Feed(clientToServer, data)
+}
+
+// usbmon writes the URB events of a stream as usbmon packets.
+type usbmon struct {
+	w *Writer
+}
+
+func (u usbmon) Imported(time.Time, urb.Import) {}
+
+func (u usbmon) Submitted(ts time.Time, seq uint32, s *urb.Submit) {
+	hdr := header(eventSubmit, seq, s, ts, errInProgress, s.Length)
+	binary.LittleEndian.PutUint32(hdr[52:56], s.StartFrame)
+	binary.LittleEndian.PutUint32(hdr[56:60], s.Flags)
+	switch hdr[9] {
+	case xferControl:
+		hdr[14] = 0
+		copy(hdr[40:48], s.Setup[:])
+	case xferIsochronous:
+		binary.LittleEndian.PutUint32(hdr[44:48], s.NumPackets)
+	}
+	u.write(ts, hdr, s.Data, '<')
+}
+
+func (u usbmon) Completed(ts time.Time, seq uint32, s *urb.Submit, c *urb.Complete) {
+	hdr := header(eventComplete, seq, s, ts, c.Status, c.Length)
+	binary.LittleEndian.PutUint32(hdr[52:56], c.StartFrame)
+	if hdr[9] == xferIsochronous {
+		binary.LittleEndian.PutUint32(hdr[40:44], c.ErrorCount)
+		binary.LittleEndian.PutUint32(hdr[44:48], c.NumPackets)
+	}
+	u.write(ts, hdr, c.Data, '>')
+}
+
+// header builds the usbmon header of an event without data or setup packet.
+func header(event byte, seq uint32, s *urb.Submit, ts time.Time, status int32, length uint32) []byte {
+	h := make([]byte, usbmonHeaderSize)
+	binary.LittleEndian.PutUint64(h[0:8], uint64(seq))
+	h[8] = event
+	h[9] = xferType(s)
+	h[10] = s.Ep
+	h[11] = uint8(s.Devid)
+	binary.LittleEndian.PutUint16(h[12:14], uint16(s.Devid>>16))
+	h[14] = '-' // no setup packet
+	binary.LittleEndian.PutUint64(h[16:24], uint64(ts.Unix()))
+	binary.LittleEndian.PutUint32(h[24:28], uint32(ts.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(h[28:32], uint32(status))
+	binary.LittleEndian.PutUint32(h[32:36], length)
+	binary.LittleEndian.PutUint32(h[48:52], uint32(s.Interval))
+	return h
+}
+
+func xferType(s *urb.Submit) uint8 {
+	switch {
+	case s.Ep&0x0F == 0:
+		return xferControl
+	case usbip.IsIsochronous(s.NumPackets):
+		return xferIsochronous
+	}
+	return xferInterrupt
+}
+
+// write completes hdr with the captured data and writes the packet.
+// noData is the usbmon data flag used when there is no data.
+func (u usbmon) write(ts time.Time, hdr, data []byte, noData byte) {
+	if len(data) > 0 {
+		hdr[15] = 0
+	} else {
+		hdr[15] = noData
+	}
+	binary.LittleEndian.PutUint32(hdr[36:40], uint32(len(data)))
+	_ = u.w.WritePacket(ts, append(hdr, data...))
+}
@@ -1,10 +1,16 @@
 package registry
 
 import (
+	_ "github.com/Alia5/VIIPER/device/clone"
+	_ "github.com/Alia5/VIIPER/device/composite"
+	_ "github.com/Alia5/VIIPER/device/customhid"
+	_ "github.com/Alia5/VIIPER/device/digitizer"
 	_ "github.com/Alia5/VIIPER/device/dualsense"
 	_ "github.com/Alia5/VIIPER/device/dualshock4"
+	_ "github.com/Alia5/VIIPER/device/joystick"
 	_ "github.com/Alia5/VIIPER/device/keyboard"
 	_ "github.com/Alia5/VIIPER/device/mouse"
 	_ "github.com/Alia5/VIIPER/device/ns2pro"
 	_ "github.com/Alia5/VIIPER/device/xbox360"
+	_ "github.com/Alia5/VIIPER/device/xboxone"
 )
@@ -1,9 +1,11 @@
 package auth
 
 import (
+	"crypto/hmac"
 	"crypto/pbkdf2"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 )
 
@@ -12,6 +14,7 @@ const (
 	Base62Chars      = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
 	PBKDF2Iterations = 100000
 	PBKDF2Salt       = "VIIPER-Key-v1"
+	HTTPTokenContext = "VIIPER-HTTP-v1"
 )
 
 // GenerateKey creates a random 16-char base62 key
@@ -53,3 +56,15 @@ func DeriveSessionKey(key, serverNonce, clientNonce []byte) []byte {
 	h.Write([]byte("VIIPER-Session-v1"))
 	return h.Sum(nil)
 }
+
+// DeriveHTTPToken creates the bearer token of the HTTP gateway from the password.
+// HTTP is not encrypted, so the password itself is never sent over it.
+func DeriveHTTPToken(password string) (string, error) {
+	key, err := DeriveKey(password)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(HTTPTokenContext))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
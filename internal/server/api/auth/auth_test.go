@@ -94,3 +94,13 @@ func TestDeriveSessionKey(t *testing.T) {
 	sessionKey3 := auth.DeriveSessionKey(key, serverNonce, clientNonce)
 	assert.NotEqual(t, sessionKey, sessionKey3)
 }
+
+func TestDeriveHTTPToken(t *testing.T) {
+	token, err := auth.DeriveHTTPToken("password123")
+	assert.NoError(t, err)
+	assert.Equal(t, "c7169fb0ab51d85dbc7492d65a8d9400996eee1b10df0c77e5090f70f7027a16", token)
+	assert.NotContains(t, token, "password123")
+
+	_, err = auth.DeriveHTTPToken("")
+	assert.Error(t, err)
+}
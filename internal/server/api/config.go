@@ -8,6 +8,12 @@ type ServerConfig struct {
 	DeviceHandlerConnectTimeout time.Duration `help:"Time before auto-cleanup occurs when device handler has no active connection" default:"5s" env:"VIIPER_API_DEVICE_HANDLER_TIMEOUT"`
 	AutoAttachLocalClient       bool          `help:"Controls usbip-client on localhost to auto-attach devices added to the virtual bus" default:"true" env:"VIIPER_API_AUTO_ATTACH_LOCAL_CLIENT"`
 	RequireLocalHostAuth        bool          `help:"Require authentication for clients connecting from localhost" default:"false" env:"VIIPER_API_REQUIRE_LOCALHOST_AUTH"`
+	HTTPAddr                    string        `help:"HTTP/WebSocket gateway listen address (default: disabled)" env:"VIIPER_API_HTTP_ADDR"`
+	HTTPAllowedOrigins          []string      `help:"Browser origins allowed to use the HTTP gateway (* allows any)" env:"VIIPER_API_HTTP_ALLOWED_ORIGINS"`
+	HTTPAllowedHosts            []string      `help:"Host names the HTTP gateway may be reached by, besides localhost and IP addresses" env:"VIIPER_API_HTTP_ALLOWED_HOSTS"`
+	DeviceDataDir               string        `help:"Directory of the files devices may name in their device specific options, e.g. ns2pro flash images and clone profiles (default: such files are rejected)" env:"VIIPER_API_DEVICE_DATA_DIR"`
+	FailsafeOnDisconnect        bool          `help:"Reset devices to a neutral input state (nothing pressed, sticks centered) when their client stream disconnects" default:"false" env:"VIIPER_API_FAILSAFE_ON_DISCONNECT"`
+	InputWatchdog               time.Duration `help:"Reset devices to a neutral input state if their client stream sends nothing for this long (0 disables)" default:"0s" env:"VIIPER_API_INPUT_WATCHDOG"`
 	ConnectionTimeout           time.Duration `kong:"-"`
 	PlatformOpts                `embed:""`
 	// password for api (remote) server auth (ALWAYS read from file)
@@ -50,6 +50,20 @@ func ListDeviceTypes() []string {
 	return types
 }
 
+// DeviceTyper is implemented by devices that are registered under a name
+// other than their package name (e.g. "dualsenseedge").
+type DeviceTyper interface {
+	DeviceType() string
+}
+
+// DeviceType returns the name the type of dev is registered under.
+func DeviceType(dev any) string {
+	if t, ok := dev.(DeviceTyper); ok {
+		return t.DeviceType()
+	}
+	return inferDeviceType(dev)
+}
+
 // GetStreamHandler retrieves the stream handler for a registered device type.
 // Returns nil if not found. Name lookup is case-insensitive.
 func GetStreamHandler(name string) StreamHandlerFunc {
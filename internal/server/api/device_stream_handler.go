@@ -22,7 +22,7 @@ func DeviceStreamHandler(srv *usb.Server) StreamHandlerFunc {
 			return fmt.Errorf("nil device")
 		}
 
-		deviceType := inferDeviceType(*dev)
+		deviceType := DeviceType(*dev)
 		reg := GetRegistration(deviceType)
 		if reg == nil {
 			return fmt.Errorf("no handler for device type: %s", deviceType)
@@ -35,6 +35,21 @@ func DeviceStreamHandler(srv *usb.Server) StreamHandlerFunc {
 	}
 }
 
+// frameRecorder is implemented by device stream connections that record
+// macros.
+type frameRecorder interface {
+	RecordFrame(data []byte)
+}
+
+// RecordFrame records data, one complete input frame read from conn, for a
+// macro recording of the device. Stream handlers call it for every frame they
+// decoded and applied to their device.
+func RecordFrame(conn net.Conn, data []byte) {
+	if r, ok := conn.(frameRecorder); ok {
+		r.RecordFrame(data)
+	}
+}
+
 func inferDeviceType(dev any) string {
 	if dev == nil {
 		return ""
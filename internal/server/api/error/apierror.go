@@ -17,6 +17,12 @@ func ErrInternal(detail string) viipertypes.APIError {
 func ErrUnauthorized(detail string) viipertypes.APIError {
 	return viipertypes.APIError{Status: 401, Title: "Unauthorized", Detail: detail}
 }
+func ErrForbidden(detail string) viipertypes.APIError {
+	return viipertypes.APIError{Status: 403, Title: "Forbidden", Detail: detail}
+}
+func ErrMethodNotAllowed(detail string) viipertypes.APIError {
+	return viipertypes.APIError{Status: 405, Title: "Method Not Allowed", Detail: detail}
+}
 
 // WrapError normalizes any error into viipertypes.ApiError.
 func WrapError(err error) viipertypes.APIError {
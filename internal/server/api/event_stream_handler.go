@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/Alia5/VIIPER/internal/server/usb"
+	pusb "github.com/Alia5/VIIPER/usb"
+	"github.com/Alia5/VIIPER/viipertypes"
+)
+
+// eventBufferSize is the number of events a subscriber may lag behind before
+// it is disconnected.
+const eventBufferSize = 256
+
+// EventStreamHandler returns a stream handler that pushes bus/device lifecycle
+// events as newline-delimited JSON until the client disconnects.
+func EventStreamHandler(srv *usb.Server) StreamHandlerFunc {
+	return func(conn net.Conn, _ *pusb.Device, logger *slog.Logger) error {
+		defer conn.Close() //nolint:errcheck
+
+		events, unsubscribe := srv.SubscribeEvents(eventBufferSize)
+		defer unsubscribe()
+
+		// Clients never send anything; a read only returns once they disconnect.
+		disconnected := make(chan struct{})
+		go func() {
+			_, _ = io.Copy(io.Discard, conn)
+			close(disconnected)
+		}()
+
+		send := func(ev viipertypes.Event) error {
+			b, err := json.Marshal(ev)
+			if err != nil {
+				return fmt.Errorf("marshal event: %w", err)
+			}
+			if _, err := conn.Write(append(b, '\n')); err != nil {
+				return fmt.Errorf("write event: %w", err)
+			}
+			return nil
+		}
+		if err := send(viipertypes.Event{Type: viipertypes.EventSubscribed, Timestamp: time.Now().UnixMilli()}); err != nil {
+			return err
+		}
+
+		for {
+			select {
+			case <-disconnected:
+				logger.Info("event subscriber disconnected")
+				return nil
+			case ev, ok := <-events:
+				if !ok {
+					return fmt.Errorf("event subscriber too slow")
+				}
+				if err := send(ev); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package api_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	_ "github.com/Alia5/VIIPER/internal/registry" // Register devices
+	"github.com/Alia5/VIIPER/internal/server/api"
+	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/viiperclient"
+	"github.com/Alia5/VIIPER/viipertypes"
+)
+
+func TestEventStreamHandler(t *testing.T) {
+	s := viiperTesting.NewTestServer(t)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+
+	r := s.ApiServer.Router()
+	r.Register("bus/create", handler.BusCreate(s.UsbServer))
+	r.Register("bus/remove", handler.BusRemove(s.UsbServer))
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	r.Register("bus/{id}/remove", handler.BusDeviceRemove(s.UsbServer))
+	r.RegisterStream("events", api.EventStreamHandler(s.UsbServer))
+	require.NoError(t, s.ApiServer.Start())
+
+	client := viiperclient.New(s.ApiServer.Addr())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events, err := client.OpenEventStream(ctx)
+	require.NoError(t, err)
+	defer events.Close() //nolint:errcheck
+
+	next := func(t *testing.T) *viipertypes.Event {
+		t.Helper()
+		_ = events.SetReadDeadline(time.Now().Add(2 * time.Second))
+		ev, err := events.Next()
+		require.NoError(t, err)
+		assert.NotZero(t, ev.Timestamp)
+		return ev
+	}
+
+	_, err = client.BusCreate(80001)
+	require.NoError(t, err)
+	ev := next(t)
+	assert.Equal(t, viipertypes.EventBusAdded, ev.Type)
+	assert.Equal(t, uint32(80001), ev.BusID)
+
+	dev, err := client.DeviceAdd(80001, "keyboard", nil)
+	require.NoError(t, err)
+	ev = next(t)
+	assert.Equal(t, viipertypes.EventDeviceAdded, ev.Type)
+	assert.Equal(t, dev.DevID, ev.DevID)
+
+	usbipClient := viiperTesting.NewUsbIpClient(t, s.UsbServer.Addr())
+	imp, err := usbipClient.AttachDevice("80001-" + dev.DevID)
+	require.NoError(t, err)
+	ev = next(t)
+	assert.Equal(t, viipertypes.EventDeviceAttached, ev.Type)
+	assert.Equal(t, dev.DevID, ev.DevID)
+	assert.NotEmpty(t, ev.Remote)
+
+	require.NoError(t, imp.Conn.Close())
+	ev = next(t)
+	assert.Equal(t, viipertypes.EventDeviceDetached, ev.Type)
+	assert.Equal(t, dev.DevID, ev.DevID)
+
+	_, err = client.BusRemove(80001)
+	require.NoError(t, err)
+	ev = next(t)
+	assert.Equal(t, viipertypes.EventDeviceRemoved, ev.Type)
+	assert.Equal(t, dev.DevID, ev.DevID)
+	ev = next(t)
+	assert.Equal(t, viipertypes.EventBusRemoved, ev.Type)
+	assert.Equal(t, uint32(80001), ev.BusID)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/Alia5/VIIPER/device"
 	"github.com/Alia5/VIIPER/internal/server/api"
 	apierror "github.com/Alia5/VIIPER/internal/server/api/error"
+	"github.com/Alia5/VIIPER/internal/server/failsafe"
 	usbs "github.com/Alia5/VIIPER/internal/server/usb"
 	"github.com/Alia5/VIIPER/viipertypes"
 )
@@ -51,6 +52,8 @@ func BusDeviceAdd(s *usbs.Server, apiSrv *api.Server) api.HandlerFunc {
 		opts := device.CreateOptions{
 			IDVendor:  deviceCreateReq.IDVendor,
 			IDProduct: deviceCreateReq.IDProduct,
+			DataDir:   apiSrv.Config().DeviceDataDir,
+			Logger:    logger,
 		}
 		if deviceCreateReq.DeviceSpecific != nil {
 			b, err := json.Marshal(deviceCreateReq.DeviceSpecific)
@@ -69,6 +72,8 @@ func BusDeviceAdd(s *usbs.Server, apiSrv *api.Server) api.HandlerFunc {
 			return apierror.ErrInternal(fmt.Sprintf("failed to add device to bus: %v", err))
 		}
 
+		failsafe.Set(devCtx, deviceCreateReq.Failsafe)
+
 		exportMeta := device.GetDeviceMeta(devCtx)
 		if exportMeta == nil {
 			return apierror.ErrInternal("failed to get device metadata from context")
@@ -1,6 +1,7 @@
 package handler_test
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"net"
@@ -10,7 +11,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
 	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/device/keyboard"
 	"github.com/Alia5/VIIPER/device/xbox360"
 	th "github.com/Alia5/VIIPER/internal/_testing"
 	"github.com/Alia5/VIIPER/internal/log"
@@ -19,6 +22,7 @@ import (
 	"github.com/Alia5/VIIPER/internal/server/usb"
 	pusb "github.com/Alia5/VIIPER/usb"
 	"github.com/Alia5/VIIPER/viiperclient"
+	"github.com/Alia5/VIIPER/viipertypes"
 	"github.com/Alia5/VIIPER/virtualbus"
 )
 
@@ -248,3 +252,76 @@ func TestBusDeviceAdd_NoConnection_TimeoutCleanup(t *testing.T) {
 		return len(usbSrv.ListBuses()) == 0
 	}, 3*time.Second, 50*time.Millisecond)
 }
+
+func TestBusDeviceAdd_Failsafe(t *testing.T) {
+	s := viiperTesting.NewTestServer(t)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+
+	r := s.ApiServer.Router()
+	r.Register("bus/create", handler.BusCreate(s.UsbServer))
+	r.Register("bus/remove", handler.BusRemove(s.UsbServer))
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	r.Register("bus/{id}/{deviceid}/state", handler.DeviceState(s.UsbServer))
+	r.RegisterStream("bus/{busId}/{deviceid}", api.DeviceStreamHandler(s.UsbServer))
+	require.NoError(t, s.ApiServer.Start())
+
+	client := viiperclient.New(s.ApiServer.Addr())
+	_, err := client.BusCreate(80200)
+	require.NoError(t, err)
+	defer client.BusRemove(80200) //nolint:errcheck
+
+	keys := func(devID string) int {
+		st, err := client.DeviceState(80200, devID)
+		require.NoError(t, err)
+		return len(st.Input["keys"].([]any))
+	}
+	press := keyboard.PressKeyWithMod(keyboard.ModLeftShift, keyboard.KeyA, keyboard.KeyB)
+	onDisconnect, watchdogMs := true, uint32(100)
+	addWithPolicy := func(p *viipertypes.FailsafePolicy) (*viiperclient.DeviceStream, *viipertypes.Device, error) {
+		devType := "keyboard"
+		dev, err := client.DeviceAddRequest(80200, &viipertypes.DeviceCreateRequest{Type: &devType, Failsafe: p})
+		if err != nil {
+			return nil, nil, err
+		}
+		stream, err := client.OpenStream(context.Background(), 80200, dev.DevID)
+		return stream, dev, err
+	}
+
+	t.Run("on disconnect", func(t *testing.T) {
+		stream, dev, err := addWithPolicy(&viipertypes.FailsafePolicy{OnDisconnect: &onDisconnect})
+		require.NoError(t, err)
+		require.Equal(t, 0, keys(dev.DevID))
+		require.NoError(t, stream.WriteBinary(&press))
+		require.Eventually(t, func() bool { return keys(dev.DevID) == 2 }, time.Second, 10*time.Millisecond)
+
+		require.NoError(t, stream.Close())
+		require.Eventually(t, func() bool { return keys(dev.DevID) == 0 }, time.Second, 10*time.Millisecond, "key is released when the stream ends")
+	})
+
+	t.Run("watchdog", func(t *testing.T) {
+		stream, dev, err := addWithPolicy(&viipertypes.FailsafePolicy{WatchdogMs: &watchdogMs})
+		require.NoError(t, err)
+		defer stream.Close() //nolint:errcheck
+		require.Equal(t, 0, keys(dev.DevID))
+
+		require.NoError(t, stream.WriteBinary(&press))
+		require.Eventually(t, func() bool { return keys(dev.DevID) == 2 }, time.Second, 10*time.Millisecond)
+		require.Eventually(t, func() bool { return keys(dev.DevID) == 0 }, time.Second, 10*time.Millisecond, "key is released without input")
+
+		require.NoError(t, stream.WriteBinary(&press))
+		require.Eventually(t, func() bool { return keys(dev.DevID) == 2 }, time.Second, 10*time.Millisecond, "input resumes")
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		stream, dev, err := client.AddDeviceAndConnect(context.Background(), 80200, "keyboard", nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, keys(dev.DevID))
+		require.NoError(t, stream.WriteBinary(&press))
+		require.Eventually(t, func() bool { return keys(dev.DevID) == 2 }, time.Second, 10*time.Millisecond)
+
+		require.NoError(t, stream.Close())
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, 2, keys(dev.DevID))
+	})
+}
@@ -4,10 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
-	"path/filepath"
-	"reflect"
 	"strconv"
-	"strings"
 
 	"github.com/Alia5/VIIPER/internal/server/api"
 	apierror "github.com/Alia5/VIIPER/internal/server/api/error"
@@ -33,7 +30,7 @@ func BusDevicesList(s *usb.Server) api.HandlerFunc {
 		metas := b.GetAllDeviceMetas()
 		out := make([]viipertypes.Device, 0, len(metas))
 		for _, m := range metas {
-			dtype := inferDeviceType(m.Dev)
+			dtype := api.DeviceType(m.Dev)
 			out = append(out, viipertypes.Device{
 				BusID:          m.Meta.BusID,
 				DevID:          fmt.Sprintf("%d", m.Meta.DevID),
@@ -51,24 +48,3 @@ func BusDevicesList(s *usb.Server) api.HandlerFunc {
 		return nil
 	}
 }
-
-// inferDeviceType attempts to derive a friendly device type name from the concrete type.
-// For devices under /devices/<name>, we return the last path element (e.g., "xbox360").
-// Fallback to the lowercased concrete type name if the package path is unavailable.
-func inferDeviceType(dev any) string {
-	if dev == nil {
-		return ""
-	}
-	t := reflect.TypeOf(dev)
-	if t.Kind() == reflect.Pointer {
-		t = t.Elem()
-	}
-	pkg := t.PkgPath() // e.g., "github.com/Alia5/VIIPER/device/xbox360"
-	if pkg != "" {
-		base := filepath.Base(pkg)
-		if base != "." && base != string(filepath.Separator) {
-			return strings.ToLower(base)
-		}
-	}
-	return strings.ToLower(t.Name())
-}
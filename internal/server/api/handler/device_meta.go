@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	apierror "github.com/Alia5/VIIPER/internal/server/api/error"
+	"github.com/Alia5/VIIPER/internal/server/usb"
+	"github.com/Alia5/VIIPER/viipertypes"
+)
+
+// DeviceUpdateMeta returns a handler that changes the meta state (battery,
+// temperature, serial, ...) of a running device.
+func DeviceUpdateMeta(s *usb.Server) api.HandlerFunc {
+	return func(req *api.Request, res *api.Response, logger *slog.Logger) error {
+		busID, devID, dev, _, err := lookupDevice(s, req)
+		if err != nil {
+			return err
+		}
+		if req.Payload == "" {
+			return apierror.ErrBadRequest("missing payload")
+		}
+		var metaReq viipertypes.DeviceMetaRequest
+		if err := json.Unmarshal([]byte(req.Payload), &metaReq); err != nil {
+			return apierror.ErrBadRequest(fmt.Sprintf("invalid JSON payload: %v", err))
+		}
+		if metaReq.Meta == nil {
+			return apierror.ErrBadRequest("missing meta")
+		}
+		devType := api.DeviceType(dev)
+		reg := api.GetRegistration(devType)
+		if reg == nil {
+			return apierror.ErrBadRequest(fmt.Sprintf("unknown device type: %s", devType))
+		}
+		meta, err := json.Marshal(metaReq.Meta)
+		if err != nil {
+			return apierror.ErrBadRequest(fmt.Sprintf("invalid meta JSON: %v", err))
+		}
+		if err := reg.UpdateMetaState(string(meta), &dev); err != nil {
+			if errors.Is(err, device.ErrNoMetaState) {
+				return apierror.ErrBadRequest(fmt.Sprintf("device %s on bus %d (%s) has no meta state", devID, busID, devType))
+			}
+			return apierror.ErrBadRequest(fmt.Sprintf("failed to update meta state: %v", err))
+		}
+		logger.Debug("updated device meta state", "busID", busID, "deviceID", devID, "meta", string(meta))
+		s.PublishDeviceUpdated(busID, devID)
+
+		payload, err := json.Marshal(viipertypes.Device{
+			BusID:          busID,
+			DevID:          devID,
+			Vid:            fmt.Sprintf("0x%04x", dev.GetDescriptor().Device.IDVendor),
+			Pid:            fmt.Sprintf("0x%04x", dev.GetDescriptor().Device.IDProduct),
+			Type:           devType,
+			DeviceSpecific: dev.GetDeviceSpecificArgs(),
+		})
+		if err != nil {
+			return apierror.ErrInternal(fmt.Sprintf("failed to marshal response: %v", err))
+		}
+		res.JSON = string(payload)
+		return nil
+	}
+}
@@ -0,0 +1,104 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/device/ns2pro"
+	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/internal/server/topology"
+	"github.com/Alia5/VIIPER/viiperclient"
+	"github.com/Alia5/VIIPER/viipertypes"
+
+	_ "github.com/Alia5/VIIPER/internal/registry" // Register devices
+)
+
+func TestDeviceUpdateMeta(t *testing.T) {
+	s := viiperTesting.NewTestServer(t)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+
+	r := s.ApiServer.Router()
+	r.Register("bus/create", handler.BusCreate(s.UsbServer))
+	r.Register("bus/remove", handler.BusRemove(s.UsbServer))
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	r.Register("bus/{id}/list", handler.BusDevicesList(s.UsbServer))
+	r.Register("bus/{id}/{deviceid}/meta", handler.DeviceUpdateMeta(s.UsbServer))
+	require.NoError(t, s.ApiServer.Start())
+
+	client := viiperclient.New(s.ApiServer.Addr())
+	_, err := client.BusCreate(90301)
+	require.NoError(t, err)
+	defer client.BusRemove(90301) //nolint:errcheck
+
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	persisted := topology.Persist(ctx, s.UsbServer, statePath, slog.New(slog.DiscardHandler))
+	defer func() { cancel(); <-persisted }()
+	persistedMeta := func(key string) any {
+		st, err := topology.Load(statePath)
+		if err != nil || len(st.Buses) != 1 || len(st.Buses[0].Devices) == 0 {
+			return nil
+		}
+		return st.Buses[0].Devices[0].DeviceSpecific[key]
+	}
+
+	ns2, err := client.DeviceAddCtx(context.Background(), 90301, "ns2pro", nil)
+	require.NoError(t, err)
+	assert.Equal(t, float64(ns2pro.BatteryMax), ns2.DeviceSpecific["battery_level"])
+	require.Eventually(t, func() bool {
+		level, _ := persistedMeta("battery_level").(float64)
+		return level == float64(ns2pro.BatteryMax)
+	}, 2*time.Second, 20*time.Millisecond, "added device is written to the state file")
+
+	dev, err := client.DeviceUpdateMeta(90301, ns2.DevID, map[string]any{"battery_level": 20, "charging": true})
+	require.NoError(t, err)
+	assert.Equal(t, "ns2pro", dev.Type)
+	assert.Equal(t, float64(20), dev.DeviceSpecific["battery_level"])
+	assert.Equal(t, true, dev.DeviceSpecific["charging"])
+	assert.Equal(t, ns2.DeviceSpecific["serial_number"], dev.DeviceSpecific["serial_number"], "fields not given keep their value")
+	assert.Eventually(t, func() bool {
+		level, _ := persistedMeta("battery_level").(float64)
+		return level == 20
+	}, 2*time.Second, 20*time.Millisecond, "meta changes are written to the state file")
+
+	list, err := client.DevicesList(90301)
+	require.NoError(t, err)
+	require.Len(t, list.Devices, 1)
+	assert.Equal(t, float64(20), list.Devices[0].DeviceSpecific["battery_level"])
+
+	ds4, err := client.DeviceAddCtx(context.Background(), 90301, "dualshock4", nil)
+	require.NoError(t, err)
+	dev, err = client.DeviceUpdateMeta(90301, ds4.DevID, map[string]any{"temperature_celsius": 42.5})
+	require.NoError(t, err)
+	assert.Equal(t, 42.5, dev.DeviceSpecific["temperature_celsius"])
+	assert.Equal(t, ds4.DeviceSpecific["serial_number"], dev.DeviceSpecific["serial_number"])
+
+	kb, err := client.DeviceAddCtx(context.Background(), 90301, "keyboard", nil)
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		devID  string
+		meta   map[string]any
+		status int
+	}{
+		"no meta state":  {kb.DevID, map[string]any{"battery_level": 1}, http.StatusBadRequest},
+		"wrong type":     {ns2.DevID, map[string]any{"battery_level": "full"}, http.StatusBadRequest},
+		"missing meta":   {ns2.DevID, nil, http.StatusBadRequest},
+		"unknown device": {"99", map[string]any{}, http.StatusNotFound},
+	} {
+		_, err := client.DeviceUpdateMeta(90301, tc.devID, tc.meta)
+		apiErr, ok := errors.AsType[*viipertypes.APIError](err)
+		require.True(t, ok, name)
+		assert.Equal(t, tc.status, apiErr.Status, name)
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/Alia5/VIIPER/internal/server/api"
+	apierror "github.com/Alia5/VIIPER/internal/server/api/error"
+	"github.com/Alia5/VIIPER/internal/server/macro"
+	"github.com/Alia5/VIIPER/internal/server/usb"
+	"github.com/Alia5/VIIPER/viipertypes"
+)
+
+// DeviceRecordStart returns a handler that starts recording the data streamed
+// to a device.
+func DeviceRecordStart(s *usb.Server) api.HandlerFunc {
+	return func(req *api.Request, res *api.Response, logger *slog.Logger) error {
+		busID, devID, dev, devCtx, err := lookupDevice(s, req)
+		if err != nil {
+			return err
+		}
+		if err := macro.StartRecording(devCtx, api.DeviceType(dev)); err != nil {
+			if errors.Is(err, macro.ErrRecording) {
+				return apierror.ErrConflict(fmt.Sprintf("device %s on bus %d is already being recorded", devID, busID))
+			}
+			return apierror.ErrInternal(fmt.Sprintf("failed to start recording: %v", err))
+		}
+
+		j, err := json.Marshal(viipertypes.MacroStatusResponse{
+			BusID:     busID,
+			DevID:     devID,
+			Recording: true,
+			Replaying: macro.Replaying(devCtx),
+		})
+		if err != nil {
+			return apierror.ErrInternal(fmt.Sprintf("failed to marshal response: %v", err))
+		}
+		res.JSON = string(j)
+		return nil
+	}
+}
+
+// DeviceRecordStop returns a handler that stops recording a device and
+// returns the recorded macro.
+func DeviceRecordStop(s *usb.Server) api.HandlerFunc {
+	return func(req *api.Request, res *api.Response, logger *slog.Logger) error {
+		busID, devID, _, devCtx, err := lookupDevice(s, req)
+		if err != nil {
+			return err
+		}
+		m, err := macro.StopRecording(devCtx)
+		if err != nil {
+			if errors.Is(err, macro.ErrNotRecording) {
+				return apierror.ErrConflict(fmt.Sprintf("device %s on bus %d is not being recorded", devID, busID))
+			}
+			return apierror.ErrInternal(fmt.Sprintf("failed to stop recording: %v", err))
+		}
+
+		j, err := json.Marshal(m)
+		if err != nil {
+			return apierror.ErrInternal(fmt.Sprintf("failed to marshal response: %v", err))
+		}
+		res.JSON = string(j)
+		return nil
+	}
+}
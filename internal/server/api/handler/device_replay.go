@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	apierror "github.com/Alia5/VIIPER/internal/server/api/error"
+	"github.com/Alia5/VIIPER/internal/server/macro"
+	"github.com/Alia5/VIIPER/internal/server/usb"
+	"github.com/Alia5/VIIPER/viipertypes"
+)
+
+// DeviceReplay returns a handler that replays a recorded macro to a device.
+// The device is kept alive while the replay runs; connecting a client stream
+// stops the replay.
+func DeviceReplay(s *usb.Server, apiSrv *api.Server) api.HandlerFunc {
+	return func(req *api.Request, res *api.Response, logger *slog.Logger) error {
+		busID, devID, dev, devCtx, err := lookupDevice(s, req)
+		if err != nil {
+			return err
+		}
+		if req.Payload == "" {
+			return apierror.ErrBadRequest("missing payload")
+		}
+		var replayReq viipertypes.MacroReplayRequest
+		if err := json.Unmarshal([]byte(req.Payload), &replayReq); err != nil {
+			return apierror.ErrBadRequest(fmt.Sprintf("invalid JSON payload: %v", err))
+		}
+		devType := api.DeviceType(dev)
+		if replayReq.Macro.DeviceType != "" && replayReq.Macro.DeviceType != devType {
+			return apierror.ErrBadRequest(fmt.Sprintf("macro recorded for %s, device is %s", replayReq.Macro.DeviceType, devType))
+		}
+		reg := api.GetRegistration(devType)
+		if reg == nil {
+			return apierror.ErrBadRequest(fmt.Sprintf("no stream handler for device type: %s", devType))
+		}
+		handler := reg.StreamHandler()
+
+		// Keep the device from being cleaned up while replaying; the cleanup
+		// goroutine started on add/disconnect keeps waiting on the timer.
+		connTimer := device.GetConnTimer(devCtx)
+		resetTimer := func() {
+			if connTimer != nil && !macro.StreamActive(devCtx) {
+				connTimer.Reset(apiSrv.Config().DeviceHandlerConnectTimeout)
+			}
+		}
+		if connTimer != nil {
+			connTimer.Stop()
+		}
+
+		replayLogger := logger.With("busID", busID, "deviceID", devID)
+		err = macro.Replay(devCtx, &replayReq.Macro, macro.Options{
+			Loop:  replayReq.Loop,
+			Speed: replayReq.Speed,
+		}, func(conn net.Conn) error {
+			return handler(conn, &dev, replayLogger)
+		}, replayLogger, resetTimer)
+		if err != nil {
+			resetTimer()
+			switch {
+			case errors.Is(err, macro.ErrStreamActive), errors.Is(err, macro.ErrReplaying):
+				return apierror.ErrConflict(fmt.Sprintf("cannot replay to device %s on bus %d: %v", devID, busID, err))
+			default:
+				return apierror.ErrBadRequest(fmt.Sprintf("invalid macro: %v", err))
+			}
+		}
+
+		j, err := json.Marshal(viipertypes.MacroStatusResponse{
+			BusID:     busID,
+			DevID:     devID,
+			Recording: macro.Recording(devCtx),
+			Replaying: true,
+		})
+		if err != nil {
+			return apierror.ErrInternal(fmt.Sprintf("failed to marshal response: %v", err))
+		}
+		res.JSON = string(j)
+		return nil
+	}
+}
+
+// DeviceReplayStop returns a handler that stops a running replay.
+func DeviceReplayStop(s *usb.Server) api.HandlerFunc {
+	return func(req *api.Request, res *api.Response, logger *slog.Logger) error {
+		busID, devID, _, devCtx, err := lookupDevice(s, req)
+		if err != nil {
+			return err
+		}
+		if !macro.StopReplay(devCtx) {
+			return apierror.ErrConflict(fmt.Sprintf("no replay running on device %s on bus %d", devID, busID))
+		}
+
+		j, err := json.Marshal(viipertypes.MacroStatusResponse{
+			BusID:     busID,
+			DevID:     devID,
+			Recording: macro.Recording(devCtx),
+			Replaying: false,
+		})
+		if err != nil {
+			return apierror.ErrInternal(fmt.Sprintf("failed to marshal response: %v", err))
+		}
+		res.JSON = string(j)
+		return nil
+	}
+}
@@ -0,0 +1,138 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/device/keyboard"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/viiperclient"
+	"github.com/Alia5/VIIPER/viipertypes"
+
+	_ "github.com/Alia5/VIIPER/internal/registry" // Register devices
+)
+
+func TestDeviceRecordReplay(t *testing.T) {
+	s := viiperTesting.NewTestServer(t)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+
+	r := s.ApiServer.Router()
+	r.Register("bus/create", handler.BusCreate(s.UsbServer))
+	r.Register("bus/remove", handler.BusRemove(s.UsbServer))
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	r.Register("bus/{id}/{deviceid}/record/start", handler.DeviceRecordStart(s.UsbServer))
+	r.Register("bus/{id}/{deviceid}/record/stop", handler.DeviceRecordStop(s.UsbServer))
+	r.Register("bus/{id}/{deviceid}/replay", handler.DeviceReplay(s.UsbServer, s.ApiServer))
+	r.Register("bus/{id}/{deviceid}/replay/stop", handler.DeviceReplayStop(s.UsbServer))
+	r.RegisterStream("bus/{busId}/{deviceid}", api.DeviceStreamHandler(s.UsbServer))
+	require.NoError(t, s.ApiServer.Start())
+
+	client := viiperclient.New(s.ApiServer.Addr())
+	_, err := client.BusCreate(90101)
+	require.NoError(t, err)
+	defer client.BusRemove(90101) //nolint:errcheck
+	stream, dev, err := client.AddDeviceAndConnect(context.Background(), 90101, "keyboard", nil)
+	require.NoError(t, err)
+
+	usbipClient := viiperTesting.NewUsbIpClient(t, s.UsbServer.Addr())
+	imp, err := usbipClient.AttachDevice("90101-" + dev.DevID)
+	require.NoError(t, err)
+	defer imp.Conn.Close() //nolint:errcheck
+
+	apiStatus := func(err error) int {
+		if apiErr, ok := errors.AsType[*viipertypes.APIError](err); ok {
+			return apiErr.Status
+		}
+		return 0
+	}
+
+	_, err = client.DeviceRecordStop(90101, dev.DevID)
+	assert.Equal(t, http.StatusConflict, apiStatus(err), "stop without recording")
+
+	st, err := client.DeviceRecordStart(90101, dev.DevID)
+	require.NoError(t, err)
+	assert.True(t, st.Recording)
+	_, err = client.DeviceRecordStart(90101, dev.DevID)
+	assert.Equal(t, http.StatusConflict, apiStatus(err), "already recording")
+
+	first := keyboard.InputState{Modifiers: keyboard.ModLeftShift}
+	last := keyboard.InputState{Modifiers: keyboard.ModLeftCtrl | keyboard.ModLeftAlt}
+	require.NoError(t, stream.WriteBinary(&first))
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, stream.WriteBinary(&last))
+	time.Sleep(20 * time.Millisecond)
+	// Frames are recorded per input state, however the stream is split.
+	firstData, err := first.MarshalBinary()
+	require.NoError(t, err)
+	lastData, err := last.MarshalBinary()
+	require.NoError(t, err)
+	_, err = stream.Write(append(slices.Clone(firstData), lastData...))
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+
+	m, err := client.DeviceRecordStop(90101, dev.DevID)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(viipertypes.MacroVersion), m.Version)
+	assert.Equal(t, "keyboard", m.DeviceType)
+	require.Len(t, m.Frames, 4)
+	assert.GreaterOrEqual(t, m.Frames[1].Offset-m.Frames[0].Offset, int64(50_000))
+	for i, want := range [][]byte{firstData, lastData, firstData, lastData} {
+		data, err := base64.StdEncoding.DecodeString(m.Frames[i].Data)
+		require.NoError(t, err)
+		assert.Equal(t, want, data, "frame %d", i)
+	}
+
+	_, err = client.DeviceReplay(90101, dev.DevID, &viipertypes.MacroReplayRequest{Macro: *m})
+	assert.Equal(t, http.StatusConflict, apiStatus(err), "stream connected")
+
+	// Reset the device, then hand it over to the replay.
+	require.NoError(t, stream.WriteBinary(&keyboard.InputState{}))
+	_, err = usbipClient.PollInputReport(imp.Conn, (&keyboard.InputState{}).BuildReport(), time.Second)
+	require.NoError(t, err)
+	require.NoError(t, stream.Close())
+
+	require.Eventually(t, func() bool {
+		st, err = client.DeviceReplay(90101, dev.DevID, &viipertypes.MacroReplayRequest{Macro: *m, Speed: 2})
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, st.Replaying)
+
+	got, err := usbipClient.PollInputReport(imp.Conn, last.BuildReport(), time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, last.BuildReport(), got)
+
+	require.Eventually(t, func() bool {
+		st, err = client.DeviceReplay(90101, dev.DevID, &viipertypes.MacroReplayRequest{Macro: *m, Loop: true})
+		return err == nil
+	}, time.Second, 10*time.Millisecond, "previous replay ends")
+	assert.True(t, st.Replaying)
+	_, err = client.DeviceReplay(90101, dev.DevID, &viipertypes.MacroReplayRequest{Macro: *m})
+	assert.Equal(t, http.StatusConflict, apiStatus(err), "already replaying")
+
+	st, err = client.DeviceReplayStop(90101, dev.DevID)
+	require.NoError(t, err)
+	assert.False(t, st.Replaying)
+	_, err = client.DeviceReplayStop(90101, dev.DevID)
+	assert.Equal(t, http.StatusConflict, apiStatus(err), "no replay running")
+
+	bad := *m
+	bad.Version = 99
+	_, err = client.DeviceReplay(90101, dev.DevID, &viipertypes.MacroReplayRequest{Macro: bad})
+	assert.Equal(t, http.StatusBadRequest, apiStatus(err), "unsupported version")
+
+	bad = *m
+	bad.DeviceType = "xbox360"
+	_, err = client.DeviceReplay(90101, dev.DevID, &viipertypes.MacroReplayRequest{Macro: bad})
+	assert.Equal(t, http.StatusBadRequest, apiStatus(err), "device type mismatch")
+}
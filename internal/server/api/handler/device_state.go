@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/Alia5/VIIPER/internal/server/api"
+	apierror "github.com/Alia5/VIIPER/internal/server/api/error"
+	"github.com/Alia5/VIIPER/internal/server/usb"
+	pusb "github.com/Alia5/VIIPER/usb"
+	"github.com/Alia5/VIIPER/viipertypes"
+)
+
+// DeviceState returns a handler that reports the last input state of a device
+// and the last output the host sent to it, without owning the device stream.
+func DeviceState(s *usb.Server) api.HandlerFunc {
+	return func(req *api.Request, res *api.Response, logger *slog.Logger) error {
+		busID, devID, dev, _, err := lookupDevice(s, req)
+		if err != nil {
+			return err
+		}
+		sd, ok := dev.(pusb.StateDevice)
+		if !ok {
+			return apierror.ErrBadRequest(fmt.Sprintf("device %s on bus %d does not report its state", devID, busID))
+		}
+		input, err := stateMap(sd.GetInputState())
+		if err != nil {
+			return apierror.ErrInternal(fmt.Sprintf("failed to encode input state: %v", err))
+		}
+		output, err := stateMap(sd.GetOutputState())
+		if err != nil {
+			return apierror.ErrInternal(fmt.Sprintf("failed to encode output state: %v", err))
+		}
+
+		resp := viipertypes.DeviceStateResponse{
+			BusID:  busID,
+			DevID:  devID,
+			Type:   api.DeviceType(dev),
+			Input:  input,
+			Output: output,
+		}
+		if qd, ok := dev.(pusb.QueuedInputDevice); ok {
+			if length, capacity, overflows, ok := qd.InputQueueStatus(); ok {
+				resp.Queue = &viipertypes.InputQueueStatus{Length: length, Capacity: capacity, Overflows: overflows}
+			}
+		}
+
+		j, err := json.Marshal(resp)
+		if err != nil {
+			return apierror.ErrInternal(fmt.Sprintf("failed to marshal response: %v", err))
+		}
+		res.JSON = string(j)
+		return nil
+	}
+}
+
+// stateMap converts a device state struct to its generic JSON object form.
+func stateMap(v any) (map[string]any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
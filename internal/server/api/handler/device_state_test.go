@@ -0,0 +1,109 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/device/keyboard"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/usbip"
+	"github.com/Alia5/VIIPER/viiperclient"
+	"github.com/Alia5/VIIPER/viipertypes"
+
+	_ "github.com/Alia5/VIIPER/internal/registry" // Register devices
+)
+
+func TestDeviceState(t *testing.T) {
+	s := viiperTesting.NewTestServer(t)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+
+	r := s.ApiServer.Router()
+	r.Register("bus/create", handler.BusCreate(s.UsbServer))
+	r.Register("bus/remove", handler.BusRemove(s.UsbServer))
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	r.Register("bus/{id}/{deviceid}/state", handler.DeviceState(s.UsbServer))
+	r.RegisterStream("bus/{busId}/{deviceid}", api.DeviceStreamHandler(s.UsbServer))
+	require.NoError(t, s.ApiServer.Start())
+
+	client := viiperclient.New(s.ApiServer.Addr())
+	_, err := client.BusCreate(90201)
+	require.NoError(t, err)
+	defer client.BusRemove(90201) //nolint:errcheck
+	stream, dev, err := client.AddDeviceAndConnect(context.Background(), 90201, "keyboard", nil)
+	require.NoError(t, err)
+	defer stream.Close() //nolint:errcheck
+
+	st, err := client.DeviceState(90201, dev.DevID)
+	require.NoError(t, err)
+	assert.Equal(t, "keyboard", st.Type)
+	assert.Equal(t, dev.DevID, st.DevID)
+	assert.Equal(t, map[string]any{"modifiers": float64(0), "keys": []any{}, "consumer": []any{}, "system": float64(0)}, st.Input)
+	assert.Equal(t, false, st.Output["capsLock"])
+
+	in := keyboard.PressKeyWithMod(keyboard.ModLeftShift, keyboard.KeyA, keyboard.KeyB)
+	require.NoError(t, stream.WriteBinary(&in))
+	require.Eventually(t, func() bool {
+		st, err = client.DeviceState(90201, dev.DevID)
+		return err == nil && len(st.Input["keys"].([]any)) == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, float64(keyboard.ModLeftShift), st.Input["modifiers"])
+	assert.Equal(t, []any{float64(keyboard.KeyA), float64(keyboard.KeyB)}, st.Input["keys"])
+
+	usbipClient := viiperTesting.NewUsbIpClient(t, s.UsbServer.Addr())
+	imp, err := usbipClient.AttachDevice("90201-" + dev.DevID)
+	require.NoError(t, err)
+	defer imp.Conn.Close() //nolint:errcheck
+	require.NoError(t, usbipClient.Submit(imp.Conn, usbip.DirOut, 1, []byte{0x01, keyboard.LEDCapsLock | keyboard.LEDNumLock}, nil))
+
+	st, err = client.DeviceState(90201, dev.DevID)
+	require.NoError(t, err)
+	assert.Equal(t, true, st.Output["capsLock"])
+	assert.Equal(t, true, st.Output["numLock"])
+	assert.Equal(t, false, st.Output["scrollLock"])
+
+	_, err = client.DeviceState(90201, "99")
+	apiErr, ok := errors.AsType[*viipertypes.APIError](err)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusNotFound, apiErr.Status)
+}
+
+func TestDeviceState_Queue(t *testing.T) {
+	s := viiperTesting.NewTestServer(t)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+
+	r := s.ApiServer.Router()
+	r.Register("bus/create", handler.BusCreate(s.UsbServer))
+	r.Register("bus/remove", handler.BusRemove(s.UsbServer))
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	r.Register("bus/{id}/{deviceid}/state", handler.DeviceState(s.UsbServer))
+	require.NoError(t, s.ApiServer.Start())
+
+	client := viiperclient.New(s.ApiServer.Addr())
+	_, err := client.BusCreate(90202)
+	require.NoError(t, err)
+	defer client.BusRemove(90202) //nolint:errcheck
+
+	queued, err := client.DeviceAdd(90202, "keyboard", &device.CreateOptions{DeviceSpecific: `{"queueSize": 16}`})
+	require.NoError(t, err)
+	assert.Equal(t, float64(16), queued.DeviceSpecific["queueSize"])
+	st, err := client.DeviceState(90202, queued.DevID)
+	require.NoError(t, err)
+	assert.Equal(t, &viipertypes.InputQueueStatus{Capacity: 16}, st.Queue)
+
+	plain, err := client.DeviceAdd(90202, "mouse", nil)
+	require.NoError(t, err)
+	st, err = client.DeviceState(90202, plain.DevID)
+	require.NoError(t, err)
+	assert.Nil(t, st.Queue)
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Alia5/VIIPER/device/composite"
+	"github.com/Alia5/VIIPER/device/keyboard"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	apierror "github.com/Alia5/VIIPER/internal/server/api/error"
+	"github.com/Alia5/VIIPER/internal/server/typing"
+	"github.com/Alia5/VIIPER/internal/server/usb"
+	"github.com/Alia5/VIIPER/viipertypes"
+)
+
+const (
+	defaultTypePress = 20 * time.Millisecond
+	defaultTypeDelay = 20 * time.Millisecond
+	maxTypeTiming    = 10000 // ms
+	maxTypeText      = 4096  // characters per request
+)
+
+// DeviceTypeText returns a handler that types UTF-8 text on a keyboard device
+// using a host keyboard layout. The keystrokes are queued and typed in the
+// background; the handler returns once they are queued.
+func DeviceTypeText(s *usb.Server) api.HandlerFunc {
+	return func(req *api.Request, res *api.Response, logger *slog.Logger) error {
+		busID, devID, dev, devCtx, err := lookupDevice(s, req)
+		if err != nil {
+			return err
+		}
+		kb, ok := dev.(typing.Keyboard)
+		if c, isComposite := dev.(*composite.Composite); isComposite {
+			kb, ok = c.Keyboard(), true
+		}
+		if !ok {
+			return apierror.ErrBadRequest(fmt.Sprintf("device %s on bus %d is not a keyboard", devID, busID))
+		}
+		if req.Payload == "" {
+			return apierror.ErrBadRequest("missing payload")
+		}
+		var typeReq viipertypes.TypeTextRequest
+		if err := json.Unmarshal([]byte(req.Payload), &typeReq); err != nil {
+			return apierror.ErrBadRequest(fmt.Sprintf("invalid JSON payload: %v", err))
+		}
+		if typeReq.Text == "" {
+			return apierror.ErrBadRequest("missing text")
+		}
+		if utf8.RuneCountInString(typeReq.Text) > maxTypeText {
+			return apierror.ErrBadRequest(fmt.Sprintf("text must be at most %d characters", maxTypeText))
+		}
+		if typeReq.Layout == "" {
+			typeReq.Layout = "us"
+		}
+		layout, ok := keyboard.LookupLayout(typeReq.Layout)
+		if !ok {
+			return apierror.ErrBadRequest(fmt.Sprintf("unknown layout %q, supported: %s", typeReq.Layout, strings.Join(keyboard.LayoutNames(), ", ")))
+		}
+		timing := typing.Timing{Press: defaultTypePress, Delay: defaultTypeDelay}
+		if ms := typeReq.PressMs; ms != nil {
+			if *ms > maxTypeTiming {
+				return apierror.ErrBadRequest(fmt.Sprintf("pressMs must be at most %d", maxTypeTiming))
+			}
+			timing.Press = time.Duration(*ms) * time.Millisecond
+		}
+		if ms := typeReq.DelayMs; ms != nil {
+			if *ms > maxTypeTiming {
+				return apierror.ErrBadRequest(fmt.Sprintf("delayMs must be at most %d", maxTypeTiming))
+			}
+			timing.Delay = time.Duration(*ms) * time.Millisecond
+		}
+		states, err := layout.TypeString(typeReq.Text)
+		if err != nil {
+			return apierror.ErrBadRequest(err.Error())
+		}
+
+		pending, err := typing.Type(devCtx, kb, states, timing)
+		if errors.Is(err, typing.ErrQueueFull) {
+			return apierror.ErrConflict(fmt.Sprintf("typing queue of device %s on bus %d is full: %d keystrokes pending, at most %d", devID, busID, pending, typing.MaxPending))
+		}
+		logger.Debug("queued text", "busID", busID, "deviceID", devID, "layout", layout.Name, "keystrokes", len(states)/2)
+
+		payload, err := json.Marshal(viipertypes.TypeTextResponse{
+			BusID:      busID,
+			DevID:      devID,
+			Keystrokes: len(states) / 2,
+			Pending:    pending,
+		})
+		if err != nil {
+			return apierror.ErrInternal(fmt.Sprintf("failed to marshal response: %v", err))
+		}
+		res.JSON = string(payload)
+		return nil
+	}
+}
@@ -0,0 +1,89 @@
+package handler_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/viiperclient"
+	"github.com/Alia5/VIIPER/viipertypes"
+
+	_ "github.com/Alia5/VIIPER/internal/registry" // Register devices
+)
+
+func TestDeviceTypeText(t *testing.T) {
+	s := viiperTesting.NewTestServer(t)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+
+	r := s.ApiServer.Router()
+	r.Register("bus/create", handler.BusCreate(s.UsbServer))
+	r.Register("bus/remove", handler.BusRemove(s.UsbServer))
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	r.Register("bus/{id}/{deviceid}/type", handler.DeviceTypeText(s.UsbServer))
+	require.NoError(t, s.ApiServer.Start())
+
+	client := viiperclient.New(s.ApiServer.Addr())
+	_, err := client.BusCreate(90203)
+	require.NoError(t, err)
+	defer client.BusRemove(90203) //nolint:errcheck
+	kb, err := client.DeviceAdd(90203, "keyboard", nil)
+	require.NoError(t, err)
+	mouse, err := client.DeviceAdd(90203, "mouse", nil)
+	require.NoError(t, err)
+	combo, err := client.DeviceAdd(90203, "composite", nil)
+	require.NoError(t, err)
+
+	zero := uint32(0)
+	resp, err := client.DeviceTypeText(90203, kb.DevID, &viipertypes.TypeTextRequest{
+		Text: "Hé", Layout: "DE", PressMs: &zero, DelayMs: &zero,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(90203), resp.BusID)
+	assert.Equal(t, kb.DevID, resp.DevID)
+	assert.Equal(t, 3, resp.Keystrokes, "é is typed with a dead key")
+	assert.Equal(t, 3, resp.Pending)
+
+	resp, err = client.DeviceTypeText(90203, combo.DevID, &viipertypes.TypeTextRequest{Text: "ok", PressMs: &zero, DelayMs: &zero})
+	require.NoError(t, err)
+	assert.Equal(t, 2, resp.Keystrokes, "composite devices type on their keyboard")
+
+	tooLong := uint32(10001)
+	tests := []struct {
+		name  string
+		devID string
+		req   *viipertypes.TypeTextRequest
+	}{
+		{"not a keyboard", mouse.DevID, &viipertypes.TypeTextRequest{Text: "a"}},
+		{"missing text", kb.DevID, &viipertypes.TypeTextRequest{}},
+		{"unknown layout", kb.DevID, &viipertypes.TypeTextRequest{Text: "a", Layout: "xx"}},
+		{"unsupported character", kb.DevID, &viipertypes.TypeTextRequest{Text: "日本"}},
+		{"press too long", kb.DevID, &viipertypes.TypeTextRequest{Text: "a", PressMs: &tooLong}},
+		{"text too long", kb.DevID, &viipertypes.TypeTextRequest{Text: strings.Repeat("ä", 4097)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.DeviceTypeText(90203, tt.devID, tt.req)
+			apiErr, ok := errors.AsType[*viipertypes.APIError](err)
+			require.True(t, ok, "got %v", err)
+			assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+		})
+	}
+
+	_, err = client.DeviceTypeText(90203, "99", &viipertypes.TypeTextRequest{Text: "a"})
+	apiErr, ok := errors.AsType[*viipertypes.APIError](err)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusNotFound, apiErr.Status)
+
+	require.Eventually(t, func() bool {
+		resp, err = client.DeviceTypeText(90203, kb.DevID, &viipertypes.TypeTextRequest{Text: "a", PressMs: &zero, DelayMs: &zero})
+		return err == nil && resp.Pending == 1
+	}, time.Second, 10*time.Millisecond, "earlier text is typed")
+}
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/Alia5/VIIPER/internal/server/api"
+	apierror "github.com/Alia5/VIIPER/internal/server/api/error"
+	"github.com/Alia5/VIIPER/internal/server/usb"
+	pusb "github.com/Alia5/VIIPER/usb"
+)
+
+// lookupDevice resolves the {id} and {deviceid} path parameters of req.
+func lookupDevice(s *usb.Server, req *api.Request) (uint32, string, pusb.Device, context.Context, error) {
+	idStr, ok := req.Params["id"]
+	if !ok {
+		return 0, "", nil, nil, apierror.ErrBadRequest("missing id parameter")
+	}
+	devID, ok := req.Params["deviceid"]
+	if !ok {
+		return 0, "", nil, nil, apierror.ErrBadRequest("missing deviceid parameter")
+	}
+	bus, dev, devCtx, err := api.LookupDevice(s, idStr, devID)
+	if err != nil {
+		return 0, "", nil, nil, err
+	}
+	return bus.BusID(), devID, dev, devCtx, nil
+}
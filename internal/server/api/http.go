@@ -0,0 +1,246 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Alia5/VIIPER/internal/server/api/auth"
+	apierror "github.com/Alia5/VIIPER/internal/server/api/error"
+	"github.com/Alia5/VIIPER/internal/server/api/websocket"
+)
+
+// maxHTTPPayload limits the request body of HTTP gateway requests.
+const maxHTTPPayload = 16 << 20
+
+// startHTTP starts the HTTP/WebSocket gateway on config.HTTPAddr.
+// Every route is served as POST /<path> with the request body as payload,
+// stream routes are served as WebSocket binary channels carrying the same wire
+// format.
+func (s *Server) startHTTP() error {
+	if s.config.Password != "" {
+		token, err := auth.DeriveHTTPToken(s.config.Password)
+		if err != nil {
+			return err
+		}
+		s.httpToken = token
+	}
+	ln, err := net.Listen("tcp", s.config.HTTPAddr)
+	if err != nil {
+		return err
+	}
+	s.httpLn = ln
+	s.config.HTTPAddr = ln.Addr().String()
+	s.httpSrv = &http.Server{
+		Handler:           http.HandlerFunc(s.serveHTTP),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.logger.Info("API HTTP gateway listening", "addr", s.config.HTTPAddr)
+	go func() {
+		if err := s.httpSrv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("API HTTP gateway stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+// HTTPAddr returns the address the HTTP gateway is listening on, or "" if it
+// is disabled.
+func (s *Server) HTTPAddr() string {
+	if s.httpLn != nil {
+		return s.httpLn.Addr().String()
+	}
+	return ""
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	connLogger := s.logger.With("remote", r.RemoteAddr, "transport", "http")
+
+	if !s.hostAllowed(r.Host) {
+		connLogger.Error("host not allowed", "host", r.Host)
+		writeHTTPError(w, apierror.ErrForbidden("host not allowed"))
+		return
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if !s.originAllowed(origin, r.Host) {
+			connLogger.Error("origin not allowed", "origin", origin)
+			writeHTTPError(w, apierror.ErrForbidden("origin not allowed"))
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "POST")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err != nil || s.requiresAuth(addr) {
+		if !s.httpAuthorized(r) {
+			connLogger.Error("authentication required")
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeHTTPError(w, apierror.ErrUnauthorized("authentication required"))
+			return
+		}
+	}
+
+	path := strings.ToLower(strings.Trim(r.URL.Path, "/"))
+	if path == "" {
+		writeHTTPError(w, apierror.ErrBadRequest("empty path"))
+		return
+	}
+
+	if websocket.IsUpgrade(r) {
+		s.serveWebSocket(w, r, path, connLogger)
+		return
+	}
+
+	h, params := s.router.Match(path)
+	if h == nil {
+		if sh, _ := s.router.MatchStream(path); sh != nil {
+			writeHTTPError(w, apierror.ErrBadRequest("stream routes require a WebSocket upgrade"))
+			return
+		}
+		connLogger.Error("api unknown path", "path", path)
+		writeHTTPError(w, apierror.ErrNotFound("unknown path: "+path))
+		return
+	}
+	// Commands change state, so GET (which cross-site links and images can
+	// trigger without an Origin header) is not accepted.
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeHTTPError(w, apierror.ErrMethodNotAllowed("use POST"))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHTTPPayload))
+	if err != nil {
+		writeHTTPError(w, apierror.ErrBadRequest("read body: "+err.Error()))
+		return
+	}
+
+	connLogger.Info("api cmd", "path", path)
+	req := &Request{Ctx: r.Context(), Params: params, Payload: strings.TrimSpace(string(body))}
+	res := &Response{}
+	if err := h(req, res, connLogger); err != nil {
+		connLogger.Error("api handler error", "path", path, "error", err)
+		writeHTTPError(w, err)
+		return
+	}
+	connLogger.Debug("api handler success", "path", path)
+	if res.JSON == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = io.WriteString(w, res.JSON)
+}
+
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request, path string, connLogger *slog.Logger) {
+	sh, params := s.router.MatchStream(path)
+	if sh == nil {
+		connLogger.Error("api unknown stream path", "path", path)
+		writeHTTPError(w, apierror.ErrNotFound("unknown stream path: "+path))
+		return
+	}
+
+	_, deviceBound := params["busId"]
+	if !deviceBound {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			writeHTTPError(w, apierror.ErrBadRequest(err.Error()))
+			return
+		}
+		defer conn.Close() //nolint:errcheck
+		connLogger.Info("api stream begin", "path", path)
+		if err := sh(conn, nil, connLogger); err != nil {
+			connLogger.Error("api stream handler error", "path", path, "error", err)
+		}
+		connLogger.Info("api stream end", "path", path)
+		return
+	}
+
+	bus, dev, devCtx, err := s.lookupStreamDevice(params)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		writeHTTPError(w, apierror.ErrBadRequest(err.Error()))
+		return
+	}
+	defer conn.Close() //nolint:errcheck
+	connLogger.Info("api stream begin", "path", path)
+	s.runDeviceStream(conn, sh, bus, dev, devCtx, path, connLogger)
+}
+
+// hostAllowed reports whether the gateway may be addressed as host (the Host
+// header). localhost and IP addresses are always allowed, other names only if
+// listed in config.HTTPAllowedHosts. This defeats DNS rebinding, where a
+// website points its own name at the gateway to pass the same-origin check.
+func (s *Server) hostAllowed(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if strings.EqualFold(host, "localhost") || net.ParseIP(host) != nil {
+		return true
+	}
+	for _, h := range s.config.HTTPAllowedHosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// originAllowed reports whether a browser on origin may use the gateway.
+// Same-origin requests are always allowed, others only if listed in
+// config.HTTPAllowedOrigins. Without this, any website could drive local
+// devices, as localhost clients need no authentication by default.
+func (s *Server) originAllowed(origin, host string) bool {
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, host) {
+		return true
+	}
+	for _, o := range s.config.HTTPAllowedOrigins {
+		if o == "*" || strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// httpAuthorized checks the gateway token derived from the API password, sent
+// as bearer token or, for browsers which cannot set WebSocket headers, as
+// "token" query parameter of a WebSocket upgrade.
+func (s *Server) httpAuthorized(r *http.Request) bool {
+	if s.httpToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok && websocket.IsUpgrade(r) {
+		token = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.httpToken)) == 1
+}
+
+func writeHTTPError(w http.ResponseWriter, err error) {
+	apiErr := apierror.WrapError(err)
+	status := apiErr.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(apiErr)
+}
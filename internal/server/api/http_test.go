@@ -0,0 +1,171 @@
+package api_test
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	th "github.com/Alia5/VIIPER/internal/_testing"
+	_ "github.com/Alia5/VIIPER/internal/registry" // Register devices
+	"github.com/Alia5/VIIPER/internal/server/api/auth"
+	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	pusb "github.com/Alia5/VIIPER/usb"
+	"github.com/Alia5/VIIPER/viipertypes"
+)
+
+func TestHTTPGateway(t *testing.T) {
+	cfg := viiperTesting.TestServerConfig(t)
+	cfg.Server.APIServerConfig.HTTPAddr = "localhost:0"
+	cfg.Server.APIServerConfig.HTTPAllowedOrigins = []string{"http://pad.example"}
+	s := viiperTesting.NewTestServerWithConfig(t, cfg)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+
+	r := s.ApiServer.Router()
+	r.Register("bus/create", handler.BusCreate(s.UsbServer))
+	r.Register("bus/remove", handler.BusRemove(s.UsbServer))
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	r.RegisterStream("echo/{busId}/{deviceid}", func(conn net.Conn, dev *pusb.Device, logger *slog.Logger) error {
+		_, err := io.Copy(conn, conn)
+		return err
+	})
+	require.NoError(t, s.ApiServer.Start())
+	addr := s.ApiServer.HTTPAddr()
+	require.NotEmpty(t, addr)
+	base := "http://" + addr
+
+	post := func(t *testing.T, path, body string, header http.Header) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, base+path, strings.NewReader(body))
+		require.NoError(t, err)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if host := header.Get("Host"); host != "" {
+			req.Host = host
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		return resp
+	}
+
+	resp := post(t, "/bus/create", "91001", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	var bus viipertypes.BusCreateResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&bus))
+	assert.Equal(t, uint32(91001), bus.BusID)
+	defer post(t, "/bus/remove", "91001", nil)
+
+	resp = post(t, "/bus/91001/add", `{"type":"keyboard"}`, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var dev viipertypes.Device
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&dev))
+
+	t.Run("problem json", func(t *testing.T) {
+		resp := post(t, "/bus/91999/add", `{"type":"keyboard"}`, nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+		var apiErr viipertypes.APIError
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&apiErr))
+		assert.Equal(t, 404, apiErr.Status)
+
+		assert.Equal(t, http.StatusNotFound, post(t, "/nope", "", nil).StatusCode)
+		assert.Equal(t, http.StatusBadRequest, post(t, "/echo/91001/"+dev.DevID, "", nil).StatusCode)
+	})
+
+	t.Run("origins", func(t *testing.T) {
+		resp := post(t, "/bus/create", "", http.Header{"Origin": {"http://evil.example"}})
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+		resp = post(t, "/bus/create", "91002", http.Header{"Origin": {"http://pad.example"}})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "http://pad.example", resp.Header.Get("Access-Control-Allow-Origin"))
+		post(t, "/bus/remove", "91002", nil)
+
+		_, resp = th.DialWebSocket(t, addr, "/echo/91001/"+dev.DevID, http.Header{"Origin": {"http://evil.example"}})
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("methods", func(t *testing.T) {
+		resp, err := http.Get(base + "/bus/create")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode, "GET can be triggered cross-site")
+	})
+
+	t.Run("hosts", func(t *testing.T) {
+		resp := post(t, "/bus/create", "91003", http.Header{"Host": {"rebound.example"}})
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+		resp = post(t, "/bus/create", "", http.Header{
+			"Host":   {"rebound.example"},
+			"Origin": {"http://rebound.example"},
+		})
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "same origin on a rebound name")
+	})
+
+	t.Run("websocket stream", func(t *testing.T) {
+		_, resp := th.DialWebSocket(t, addr, "/echo/91001/99", nil)
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		c, _ := th.DialWebSocket(t, addr, "/echo/91001/"+dev.DevID, nil)
+		require.NotNil(t, c)
+		c.WriteFrame(t, 0x2, true, []byte{0x01, 0x02})
+		op, payload := c.ReadFrame(t)
+		assert.Equal(t, byte(0x2), op)
+		assert.Equal(t, []byte{0x01, 0x02}, payload)
+	})
+}
+
+func TestHTTPGatewayAuth(t *testing.T) {
+	cfg := viiperTesting.TestServerConfig(t)
+	cfg.Server.APIServerConfig.HTTPAddr = "localhost:0"
+	cfg.Server.APIServerConfig.RequireLocalHostAuth = true
+	cfg.Server.APIServerConfig.Password = "secret"
+	s := viiperTesting.NewTestServerWithConfig(t, cfg)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+	s.ApiServer.Router().Register("ping", handler.Ping())
+	s.ApiServer.Router().RegisterStream("echo", func(conn net.Conn, dev *pusb.Device, logger *slog.Logger) error {
+		_, err := io.Copy(conn, conn)
+		return err
+	})
+	require.NoError(t, s.ApiServer.Start())
+	addr := s.ApiServer.HTTPAddr()
+	token, err := auth.DeriveHTTPToken("secret")
+	require.NoError(t, err)
+
+	ping := func(query, bearer string) int {
+		req, err := http.NewRequest(http.MethodPost, "http://"+addr+"/ping"+query, nil)
+		require.NoError(t, err)
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusUnauthorized, ping("", ""))
+	assert.Equal(t, http.StatusOK, ping("", token))
+	assert.Equal(t, http.StatusUnauthorized, ping("", "secret"), "the password is never sent over HTTP")
+	assert.Equal(t, http.StatusUnauthorized, ping("?token="+token, ""), "query tokens are for WebSockets only")
+
+	_, resp := th.DialWebSocket(t, addr, "/echo?token=secret", nil)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	c, _ := th.DialWebSocket(t, addr, "/echo?token="+token, nil)
+	require.NotNil(t, c)
+}
@@ -28,6 +28,7 @@ type HandlerFunc func(req *Request, res *Response, logger *slog.Logger) error
 
 // StreamHandlerFunc handles long-lived TCP connections for bidirectional streaming.
 // The handler takes ownership of the connection and should close it when done.
+// dev is nil for streams that are not bound to a device (routes without {busId}).
 // The logger provided is connection-scoped. Returning a non-nil error indicates
 // the handler encountered a terminal failure; the dispatcher/server will log it.
 type StreamHandlerFunc func(conn net.Conn, dev *usb.Device, logger *slog.Logger) error
@@ -9,6 +9,7 @@ import (
 	"io"
 	"log/slog"
 	"net"
+	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
@@ -16,9 +17,12 @@ import (
 	"github.com/Alia5/VIIPER/device"
 	"github.com/Alia5/VIIPER/internal/server/api/auth"
 	apierror "github.com/Alia5/VIIPER/internal/server/api/error"
+	"github.com/Alia5/VIIPER/internal/server/failsafe"
+	"github.com/Alia5/VIIPER/internal/server/macro"
 	"github.com/Alia5/VIIPER/internal/server/usb"
 	pusb "github.com/Alia5/VIIPER/usb"
 	"github.com/Alia5/VIIPER/viipertypes"
+	"github.com/Alia5/VIIPER/virtualbus"
 )
 
 // Server implements a small TCP API for managing virtual bus topology.
@@ -29,6 +33,10 @@ type Server struct {
 	logger *slog.Logger
 	router *Router
 	config *ServerConfig
+
+	httpSrv   *http.Server
+	httpLn    net.Listener
+	httpToken string
 }
 
 // New creates a new ApiServer bound to a server.Server instance.
@@ -73,6 +81,12 @@ func (s *Server) Start() error {
 	s.addr = ln.Addr().String()
 	s.config.Addr = s.addr
 	s.logger.Info("API listening", "addr", s.addr)
+	if s.config.HTTPAddr != "" {
+		if err := s.startHTTP(); err != nil {
+			_ = ln.Close()
+			return err
+		}
+	}
 	go s.serve()
 	return nil
 }
@@ -82,6 +96,9 @@ func (s *Server) Close() {
 	if s.ln != nil {
 		_ = s.ln.Close()
 	}
+	if s.httpSrv != nil {
+		_ = s.httpSrv.Close()
+	}
 }
 
 func (s *Server) serve() {
@@ -202,19 +219,7 @@ func (s *Server) handleConn(conn net.Conn) {
 		return
 	}
 
-	// Split on first whitespace character using regex \s
-	wsRegex := regexp.MustCompile(`\s`)
-	loc := wsRegex.FindStringIndex(reqData)
-
-	var path, payload string
-	if loc != nil {
-		path = reqData[:loc[0]]
-		payload = reqData[loc[1]:]
-	} else {
-		path = reqData
-		payload = ""
-	}
-
+	path, payload := splitRequest(reqData)
 	if path == "" {
 		connLogger.Error("api empty path")
 		s.writeError(w, apierror.ErrBadRequest("empty path"))
@@ -222,6 +227,10 @@ func (s *Server) handleConn(conn net.Conn) {
 	}
 
 	path = strings.ToLower(path)
+	if path == SessionPath {
+		s.serveSession(connCtx, r, w, connLogger)
+		return
+	}
 	connLogger.Info("api cmd", "path", path)
 
 	if h, params := s.router.Match(path); h != nil {
@@ -237,81 +246,119 @@ func (s *Server) handleConn(conn net.Conn) {
 		return
 	} else if sh, params := s.router.MatchStream(path); sh != nil {
 		connLogger.Info("api stream begin", "path", path)
-		busIDStr, ok := params["busId"]
-		if !ok {
-			s.writeError(w, apierror.ErrBadRequest("missing busId parameter"))
-			return
-		}
-		devIDStr, ok := params["deviceid"]
-		if !ok {
-			s.writeError(w, apierror.ErrBadRequest("missing deviceid parameter"))
+		if _, ok := params["busId"]; !ok {
+			// Not bound to a device (e.g. "events").
+			if err := sh(conn, nil, connLogger); err != nil {
+				connLogger.Error("api stream handler error", "path", path, "error", err)
+			}
+			connLogger.Info("api stream end", "path", path)
 			return
 		}
-
-		busID, err := strconv.ParseUint(busIDStr, 10, 32)
+		bus, dev, devCtx, err := s.lookupStreamDevice(params)
 		if err != nil {
-			s.writeError(w, apierror.ErrBadRequest(fmt.Sprintf("invalid busId: %v", err)))
-			return
-		}
-		bus := s.usbs.GetBus(uint32(busID))
-		if bus == nil {
-			s.writeError(w, apierror.ErrNotFound(fmt.Sprintf("bus %d not found", busID)))
+			s.writeError(w, err)
 			return
 		}
-		var dev pusb.Device
-		var devCtx context.Context
-		metas := bus.GetAllDeviceMetas()
-		for _, meta := range metas {
-			if fmt.Sprintf("%d", meta.Meta.DevID) == devIDStr {
-				dev = meta.Dev
-				devCtx = bus.GetDeviceContext(dev)
-				break
+		s.runDeviceStream(conn, sh, bus, dev, devCtx, path, connLogger)
+		return
+	}
+	connLogger.Error("api unknown path", "path", path)
+	s.writeError(w, apierror.ErrNotFound(fmt.Sprintf("unknown path: %s", path)))
+}
+
+// lookupStreamDevice resolves the device addressed by the params of a
+// device-bound stream route.
+func (s *Server) lookupStreamDevice(params map[string]string) (*virtualbus.VirtualBus, pusb.Device, context.Context, error) {
+	devID, ok := params["deviceid"]
+	if !ok {
+		return nil, nil, nil, apierror.ErrBadRequest("missing deviceid parameter")
+	}
+	return LookupDevice(s.usbs, params["busId"], devID)
+}
+
+// LookupDevice resolves the device devID on the bus busID, both as given in
+// a request path.
+func LookupDevice(srv *usb.Server, busID, devID string) (*virtualbus.VirtualBus, pusb.Device, context.Context, error) {
+	id, err := strconv.ParseUint(busID, 10, 32)
+	if err != nil {
+		return nil, nil, nil, apierror.ErrBadRequest(fmt.Sprintf("invalid busId: %v", err))
+	}
+	bus := srv.GetBus(uint32(id))
+	if bus == nil {
+		return nil, nil, nil, apierror.ErrNotFound(fmt.Sprintf("bus %d not found", id))
+	}
+	for _, meta := range bus.GetAllDeviceMetas() {
+		if fmt.Sprintf("%d", meta.Meta.DevID) == devID {
+			if devCtx := bus.GetDeviceContext(meta.Dev); devCtx != nil {
+				return bus, meta.Dev, devCtx, nil
 			}
+			break
 		}
-		if dev == nil || devCtx == nil {
-			s.writeError(w, apierror.ErrNotFound(fmt.Sprintf("device %s not found on bus %d", devIDStr, busID)))
-			return
-		}
+	}
+	return nil, nil, nil, apierror.ErrNotFound(fmt.Sprintf("device %s not found on bus %d", devID, id))
+}
 
-		connTimer := device.GetConnTimer(devCtx)
-		if connTimer != nil {
-			connTimer.Stop()
-		}
+// runDeviceStream runs a device stream handler on conn. The device's connect
+// timer is paused while the stream is active and re-armed once it ends.
+func (s *Server) runDeviceStream(conn net.Conn, sh StreamHandlerFunc, bus *virtualbus.VirtualBus, dev pusb.Device, devCtx context.Context, path string, connLogger *slog.Logger) {
+	busID := bus.BusID()
+	connTimer := device.GetConnTimer(devCtx)
+	if connTimer != nil {
+		connTimer.Stop()
+	}
 
-		// Stream handler takes ownership of connection
-		if err := sh(conn, &dev, connLogger); err != nil {
-			connLogger.Error("api stream handler error", "path", path, "error", err)
-		}
-		connLogger.Info("api stream end", "path", path)
-
-		connTimer = device.GetConnTimer(devCtx)
-		if connTimer != nil {
-			connTimer.Reset(s.config.DeviceHandlerConnectTimeout)
-			go func() {
-				select {
-				case <-devCtx.Done():
-					connTimer.Stop()
-					return
-				case <-connTimer.C:
-					exportMeta := device.GetDeviceMeta(devCtx)
-					if exportMeta != nil {
-						deviceIDStr := fmt.Sprintf("%d", exportMeta.DevID)
-						if err := bus.RemoveDeviceByID(deviceIDStr); err != nil {
-							connLogger.Error("disconnect timeout: failed to remove device", "busID", busID, "deviceID", deviceIDStr, "error", err)
-						} else {
-							connLogger.Info("disconnect timeout: removed device (no reconnection)", "busID", busID, "deviceID", deviceIDStr)
-						}
-						return
+	policy := failsafe.Policy{
+		OnDisconnect: s.config.FailsafeOnDisconnect,
+		Watchdog:     s.config.InputWatchdog,
+	}.With(failsafe.Get(devCtx))
+	conn, release := failsafe.Watch(conn, devCtx, dev, policy, connLogger)
+	// A client stream takes over from a running replay; the frames it
+	// applies are recorded while a macro recording is active.
+	conn, releaseTap := macro.Tap(conn, devCtx)
+
+	// Stream handler takes ownership of connection
+	if err := sh(conn, &dev, connLogger); err != nil {
+		connLogger.Error("api stream handler error", "path", path, "error", err)
+	}
+	releaseTap()
+	release()
+	connLogger.Info("api stream end", "path", path)
+
+	connTimer = device.GetConnTimer(devCtx)
+	if connTimer != nil {
+		connTimer.Reset(s.config.DeviceHandlerConnectTimeout)
+		go func() {
+			select {
+			case <-devCtx.Done():
+				connTimer.Stop()
+				return
+			case <-connTimer.C:
+				exportMeta := device.GetDeviceMeta(devCtx)
+				if exportMeta != nil {
+					deviceIDStr := fmt.Sprintf("%d", exportMeta.DevID)
+					if err := bus.RemoveDeviceByID(deviceIDStr); err != nil {
+						connLogger.Error("disconnect timeout: failed to remove device", "busID", busID, "deviceID", deviceIDStr, "error", err)
+					} else {
+						connLogger.Info("disconnect timeout: removed device (no reconnection)", "busID", busID, "deviceID", deviceIDStr)
 					}
-					connLogger.Warn("disconnect timeout: device context closed but metadata missing")
+					return
 				}
-			}()
-		}
+				connLogger.Warn("disconnect timeout: device context closed but metadata missing")
+			}
+		}()
+	}
+}
 
-		return
+var wsRegex = regexp.MustCompile(`\s`)
+
+// splitRequest splits a request into path and payload at the first whitespace
+// character.
+func splitRequest(reqData string) (path, payload string) {
+	loc := wsRegex.FindStringIndex(reqData)
+	if loc == nil {
+		return reqData, ""
 	}
-	connLogger.Error("api unknown path", "path", path)
-	s.writeError(w, apierror.ErrNotFound(fmt.Sprintf("unknown path: %s", path)))
+	return reqData[:loc[0]], reqData[loc[1]:]
 }
 
 func (s *Server) isLocalHostClient(addr net.Addr) bool {
@@ -1,11 +1,13 @@
 package api_test
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -90,7 +92,7 @@ func TestAPIServer_WrappedConn(t *testing.T) {
 
 		inputState     xbox360.InputState
 		expectedReport []byte
-		rumbleState    xbox360.XRumbleState
+		outputState    xbox360.OutputState
 		outPacket      []byte
 	}
 
@@ -105,7 +107,7 @@ func TestAPIServer_WrappedConn(t *testing.T) {
 				Buttons: xbox360.ButtonDPadUp,
 			},
 			expectedReport: []byte{0x00, 0x14, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
-			rumbleState: xbox360.XRumbleState{
+			outputState: xbox360.OutputState{
 				LeftMotor:  236,
 				RightMotor: 65,
 			},
@@ -121,7 +123,7 @@ func TestAPIServer_WrappedConn(t *testing.T) {
 				Buttons: xbox360.ButtonDPadUp,
 			},
 			expectedReport: []byte{0x00, 0x14, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
-			rumbleState: xbox360.XRumbleState{
+			outputState: xbox360.OutputState{
 				LeftMotor:  236,
 				RightMotor: 65,
 			},
@@ -137,7 +139,7 @@ func TestAPIServer_WrappedConn(t *testing.T) {
 				Buttons: xbox360.ButtonDPadUp,
 			},
 			expectedReport: []byte{0x00, 0x14, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
-			rumbleState: xbox360.XRumbleState{
+			outputState: xbox360.OutputState{
 				LeftMotor:  236,
 				RightMotor: 65,
 			},
@@ -251,16 +253,61 @@ func TestAPIServer_WrappedConn(t *testing.T) {
 			if !assert.NoError(t, usbipClient.Submit(imp.Conn, usbip.DirOut, 1, tc.outPacket, nil)) {
 				return
 			}
-			var buf [2]byte
+			var buf [3]byte
 			_ = stream.SetReadDeadline(time.Now().Add(750 * time.Millisecond))
 			_, err = io.ReadFull(stream, buf[:])
 			if !assert.NoError(t, err) {
 				return
 			}
-			gotOut := xbox360.XRumbleState{LeftMotor: buf[0], RightMotor: buf[1]}
-			assert.Equal(t, tc.rumbleState, gotOut)
+			gotOut := xbox360.OutputState{LeftMotor: buf[0], RightMotor: buf[1], LED: buf[2]}
+			assert.Equal(t, tc.outputState, gotOut)
 
 		})
 	}
 
 }
+
+func TestAPIServer_Session(t *testing.T) {
+	addr, srv, done := th.StartAPIServer(t, func(r *api.Router, s *srvusb.Server, apiSrv *api.Server) {
+		r.Register("bus/create", handler.BusCreate(s))
+		r.Register("bus/remove", handler.BusRemove(s))
+		r.Register("bus/list", handler.BusList(s))
+		r.RegisterStream("bus/{busId}/{deviceid}", api.DeviceStreamHandler(s))
+	})
+	defer done()
+	defer srv.RemoveBus(92001) //nolint:errcheck
+
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close() //nolint:errcheck
+	_ = c.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(c)
+
+	_, err = io.WriteString(c, "session\x00")
+	require.NoError(t, err)
+	ack, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "\n", ack)
+
+	// Pipelined requests are answered in order with their IDs.
+	_, err = io.WriteString(c, "a bus/create 92001\x00b bus/list\x00c bus/92001/1\x00d nope\x00")
+	require.NoError(t, err)
+	read := func() (string, string) {
+		resp, err := r.ReadString('\x00')
+		require.NoError(t, err)
+		id, body, _ := strings.Cut(strings.TrimSuffix(resp, "\x00"), " ")
+		return id, body
+	}
+	id, body := read()
+	assert.Equal(t, "a", id)
+	assert.JSONEq(t, `{"busId":92001}`, body)
+	id, body = read()
+	assert.Equal(t, "b", id)
+	assert.Contains(t, body, "92001")
+	id, body = read()
+	assert.Equal(t, "c", id)
+	assert.Contains(t, body, `"status":400`)
+	id, body = read()
+	assert.Equal(t, "d", id)
+	assert.Contains(t, body, `"status":404`)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+
+	apierror "github.com/Alia5/VIIPER/internal/server/api/error"
+)
+
+// SessionPath is the request that switches a connection into session mode.
+const SessionPath = "session"
+
+// serveSession serves any number of requests on one connection, so clients
+// pay connection setup and authentication only once.
+//
+// The server acknowledges the switch with an empty success line. After that,
+// requests are framed as `<id> <path>[ <payload>]\0` and answered in order as
+// `<id> <response>\0`, where <id> is echoed verbatim and <response> is what a
+// single-request connection would receive, without the trailing newline.
+// Stream routes need their own connection.
+func (s *Server) serveSession(ctx context.Context, r *bufio.Reader, w io.Writer, logger *slog.Logger) {
+	logger.Info("api session begin")
+	defer logger.Info("api session end")
+	s.writeOK(w, "")
+
+	for {
+		reqData, err := r.ReadString('\x00')
+		if err != nil {
+			if err != io.EOF {
+				logger.Error("read api session data", "error", err)
+			}
+			return
+		}
+		reqData = strings.TrimSuffix(reqData, "\x00")
+
+		id, rest, _ := strings.Cut(reqData, " ")
+		resp, err := s.sessionRequest(ctx, rest, logger)
+		if err != nil {
+			problemJSON, _ := json.Marshal(apierror.WrapError(err))
+			resp = string(problemJSON)
+		}
+		if _, err := io.WriteString(w, id+" "+resp+"\x00"); err != nil {
+			logger.Error("failed to write session response", "error", err)
+			return
+		}
+	}
+}
+
+func (s *Server) sessionRequest(ctx context.Context, reqData string, logger *slog.Logger) (string, error) {
+	path, payload := splitRequest(reqData)
+	if path == "" {
+		return "", apierror.ErrBadRequest("empty path")
+	}
+	path = strings.ToLower(path)
+	logger.Info("api cmd", "path", path)
+
+	h, params := s.router.Match(path)
+	if h == nil {
+		if sh, _ := s.router.MatchStream(path); sh != nil || path == SessionPath {
+			return "", apierror.ErrBadRequest(path + " needs its own connection")
+		}
+		return "", apierror.ErrNotFound("unknown path: " + path)
+	}
+	req := &Request{Ctx: ctx, Params: params, Payload: payload}
+	res := &Response{}
+	if err := h(req, res, logger); err != nil {
+		logger.Error("api handler error", "path", path, "error", err)
+		return "", err
+	}
+	logger.Debug("api handler success", "path", path)
+	return res.JSON, nil
+}
@@ -0,0 +1,251 @@
+// Package websocket implements the server side of RFC 6455 WebSockets, just
+// enough to carry VIIPER's binary stream protocols to browsers.
+// A Conn is a net.Conn: every Write is sent as one binary message and Read
+// returns the payload of received data messages as a plain byte stream.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Opcodes, see RFC 6455 section 5.2.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// maxControlPayload is the maximum payload size of control frames.
+const maxControlPayload = 125
+
+// ErrNotWebSocket is returned by Upgrade for requests that are not WebSocket
+// handshakes.
+var ErrNotWebSocket = errors.New("not a websocket handshake")
+
+// IsUpgrade reports whether r asks for a WebSocket upgrade.
+func IsUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") &&
+		headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// Upgrade completes the WebSocket handshake of r and takes over the underlying
+// connection. On error nothing has been written to w yet.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet || !IsUpgrade(r) {
+		return nil, ErrNotWebSocket
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, fmt.Errorf("unsupported websocket version %q", r.Header.Get("Sec-WebSocket-Version"))
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, errors.New("missing Sec-WebSocket-Key")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("connection cannot be hijacked")
+	}
+	netConn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha1.Sum([]byte(key + acceptGUID))
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(h[:]) + "\r\n\r\n"
+	if _, err := rw.WriteString(resp); err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+	_ = netConn.SetDeadline(time.Time{})
+	return &Conn{conn: netConn, r: rw.Reader}, nil
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for t := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Conn is a server side WebSocket connection.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	// read state, only touched by Read
+	remaining int64
+	mask      [4]byte
+	maskPos   int
+	closed    bool
+
+	wmu        sync.Mutex
+	closeSent  bool
+	closeOnce  sync.Once
+	closeError error
+}
+
+// Read reads the payload of incoming data messages. Message boundaries are not
+// preserved. Pings are answered, and a close frame ends the stream with io.EOF.
+func (c *Conn) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if c.closed {
+			return 0, io.EOF
+		}
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	for i := range n {
+		p[i] ^= c.mask[c.maskPos&3]
+		c.maskPos++
+	}
+	c.remaining -= int64(n)
+	return n, err
+}
+
+// nextFrame reads frame headers until a data frame with payload is found.
+// Control frames in between are handled.
+func (c *Conn) nextFrame() error {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return err
+	}
+	opcode := hdr[0] & 0x0F
+	if hdr[1]&0x80 == 0 {
+		c.closeWith(1002)
+		return errors.New("websocket: unmasked client frame")
+	}
+	length := int64(hdr[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]) & (1<<63 - 1))
+	}
+	if _, err := io.ReadFull(c.r, c.mask[:]); err != nil {
+		return err
+	}
+	c.maskPos = 0
+
+	switch opcode {
+	case opContinuation, opText, opBinary:
+		c.remaining = length
+		return nil
+	case opClose, opPing, opPong:
+		if length > maxControlPayload {
+			c.closeWith(1002)
+			return errors.New("websocket: control frame too large")
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.r, payload); err != nil {
+			return err
+		}
+		for i := range payload {
+			payload[i] ^= c.mask[i&3]
+		}
+		switch opcode {
+		case opClose:
+			c.closed = true
+			c.closeWith(1000)
+			return io.EOF
+		case opPing:
+			return c.writeFrame(opPong, payload)
+		}
+		return nil
+	default:
+		c.closeWith(1002)
+		return fmt.Errorf("websocket: unknown opcode %#x", opcode)
+	}
+}
+
+// Write sends p as one binary message.
+func (c *Conn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(opBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *Conn) writeFrame(opcode byte, p []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return net.ErrClosed
+	}
+	if opcode == opClose {
+		c.closeSent = true
+	}
+
+	hdr := make([]byte, 2, 10+len(p))
+	hdr[0] = 0x80 | opcode
+	switch {
+	case len(p) < 126:
+		hdr[1] = byte(len(p))
+	case len(p) <= 0xFFFF:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(len(p)))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(len(p)))
+	}
+	_, err := c.conn.Write(append(hdr, p...))
+	return err
+}
+
+func (c *Conn) closeWith(code uint16) {
+	_ = c.writeFrame(opClose, binary.BigEndian.AppendUint16(nil, code))
+}
+
+// Close sends a close frame and closes the underlying connection.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeWith(1000)
+		c.closeError = c.conn.Close()
+	})
+	return c.closeError
+}
+
+func (c *Conn) LocalAddr() net.Addr                { return c.conn.LocalAddr() }
+func (c *Conn) RemoteAddr() net.Addr               { return c.conn.RemoteAddr() }
+func (c *Conn) SetDeadline(t time.Time) error      { return c.conn.SetDeadline(t) }
+func (c *Conn) SetReadDeadline(t time.Time) error  { return c.conn.SetReadDeadline(t) }
+func (c *Conn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
@@ -0,0 +1,85 @@
+package websocket_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	th "github.com/Alia5/VIIPER/internal/_testing"
+	"github.com/Alia5/VIIPER/internal/server/api/websocket"
+)
+
+func echoServer(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer conn.Close() //nolint:errcheck
+		_, _ = io.Copy(conn, conn)
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func TestEcho(t *testing.T) {
+	c, _ := th.DialWebSocket(t, echoServer(t), "/", nil)
+	require.NotNil(t, c)
+
+	c.WriteFrame(t, 0x2, true, []byte{1, 2, 3})
+	op, payload := c.ReadFrame(t)
+	assert.Equal(t, byte(0x2), op)
+	assert.Equal(t, []byte{1, 2, 3}, payload)
+
+	// Large frames use the extended length encoding.
+	big := make([]byte, 70000)
+	for i := range big {
+		big[i] = byte(i)
+	}
+	c.WriteFrame(t, 0x2, true, big)
+	var got []byte
+	for len(got) < len(big) {
+		_, p := c.ReadFrame(t)
+		got = append(got, p...)
+	}
+	assert.Equal(t, big, got)
+}
+
+func TestControlFrames(t *testing.T) {
+	c, _ := th.DialWebSocket(t, echoServer(t), "/", nil)
+	require.NotNil(t, c)
+
+	// A ping in the middle of a fragmented message is answered right away.
+	c.WriteFrame(t, 0x2, false, []byte("ab"))
+	c.WriteFrame(t, 0x9, true, []byte("hi"))
+	op, payload := c.ReadFrame(t)
+	if op == 0x2 {
+		assert.Equal(t, []byte("ab"), payload)
+		op, payload = c.ReadFrame(t)
+	}
+	assert.Equal(t, byte(0xA), op)
+	assert.Equal(t, []byte("hi"), payload)
+	c.WriteFrame(t, 0x0, true, []byte("cd"))
+	_, payload = c.ReadFrame(t)
+	assert.Equal(t, []byte("cd"), payload)
+
+	c.WriteFrame(t, 0x8, true, []byte{0x03, 0xE8})
+	op, payload = c.ReadFrame(t)
+	assert.Equal(t, byte(0x8), op)
+	assert.Equal(t, []byte{0x03, 0xE8}, payload)
+}
+
+func TestUpgradeRejected(t *testing.T) {
+	addr := echoServer(t)
+	resp, err := http.Get("http://" + addr + "/")
+	require.NoError(t, err)
+	defer resp.Body.Close() //nolint:errcheck
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
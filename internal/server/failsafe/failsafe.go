@@ -0,0 +1,150 @@
+// Package failsafe returns devices to a neutral input state when the client
+// driving them goes away: when its stream disconnects, or when it stops
+// sending input for a while (watchdog).
+//
+// Without it a crashed client leaves keys held down or sticks pinned until
+// the device is removed.
+package failsafe
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/usb"
+	"github.com/Alia5/VIIPER/viipertypes"
+)
+
+// Policy controls when a device is neutralized.
+type Policy struct {
+	// OnDisconnect neutralizes the device when its last client stream ends.
+	OnDisconnect bool
+	// Watchdog neutralizes the device if a client stream sends nothing for
+	// this long. 0 disables the watchdog.
+	Watchdog time.Duration
+}
+
+// With returns p overridden by the fields set in o.
+func (p Policy) With(o *viipertypes.FailsafePolicy) Policy {
+	if o == nil {
+		return p
+	}
+	if o.OnDisconnect != nil {
+		p.OnDisconnect = *o.OnDisconnect
+	}
+	if o.WatchdogMs != nil {
+		p.Watchdog = time.Duration(*o.WatchdogMs) * time.Millisecond
+	}
+	return p
+}
+
+// Enabled reports whether the policy neutralizes devices at all.
+func (p Policy) Enabled() bool {
+	return p.OnDisconnect || p.Watchdog > 0
+}
+
+// stateKey keys the failsafe state in the device attachments.
+type stateKey struct{}
+
+type state struct {
+	mu       sync.Mutex
+	override *viipertypes.FailsafePolicy
+	streams  int
+}
+
+func getState(devCtx context.Context) *state {
+	return device.GetAttachments(devCtx).LoadOrStore(stateKey{}, func() any { return &state{} }).(*state)
+}
+
+// Set stores the per-device policy o in the device context devCtx.
+func Set(devCtx context.Context, o *viipertypes.FailsafePolicy) {
+	if o == nil {
+		return
+	}
+	st := getState(devCtx)
+	st.mu.Lock()
+	st.override = o
+	st.mu.Unlock()
+}
+
+// Get returns the per-device policy stored in devCtx, or nil if none was set.
+func Get(devCtx context.Context) *viipertypes.FailsafePolicy {
+	st, ok := device.GetAttachments(devCtx).Load(stateKey{}).(*state)
+	if !ok {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.override
+}
+
+// Neutralize resets dev to its neutral input state.
+// It reports false if dev does not implement usb.NeutralStateDevice.
+func Neutralize(dev usb.Device) bool {
+	nd, ok := dev.(usb.NeutralStateDevice)
+	if ok {
+		nd.ResetInputState()
+	}
+	return ok
+}
+
+// Watch registers a client stream to dev, whose device context is devCtx, and
+// applies p to it.
+// Data read from the returned conn feeds the watchdog.
+// release must be called once the stream has ended; it neutralizes dev if
+// p.OnDisconnect is set and no other stream to dev is left.
+func Watch(conn net.Conn, devCtx context.Context, dev usb.Device, p Policy, logger *slog.Logger) (net.Conn, func()) {
+	st := getState(devCtx)
+	st.mu.Lock()
+	st.streams++
+	st.mu.Unlock()
+
+	if p.Enabled() {
+		if _, ok := dev.(usb.NeutralStateDevice); !ok {
+			logger.Debug("failsafe: device has no neutral state")
+			p = Policy{}
+		}
+	}
+
+	w := &watchConn{Conn: conn, watchdog: p.Watchdog}
+	if p.Watchdog > 0 {
+		w.timer = time.AfterFunc(p.Watchdog, func() {
+			logger.Warn("failsafe: no input, neutralizing device", "watchdog", p.Watchdog)
+			Neutralize(dev)
+		})
+	}
+
+	var once sync.Once
+	return w, func() {
+		once.Do(func() {
+			if w.timer != nil {
+				w.timer.Stop()
+			}
+			st.mu.Lock()
+			st.streams--
+			last := st.streams == 0
+			st.mu.Unlock()
+			if p.OnDisconnect && last {
+				logger.Info("failsafe: stream ended, neutralizing device")
+				Neutralize(dev)
+			}
+		})
+	}
+}
+
+type watchConn struct {
+	net.Conn
+	timer    *time.Timer
+	watchdog time.Duration
+}
+
+func (c *watchConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 && c.timer != nil {
+		c.timer.Reset(c.watchdog)
+	}
+	return n, err
+}
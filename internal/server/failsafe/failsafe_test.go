@@ -0,0 +1,108 @@
+package failsafe
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/usb"
+	"github.com/Alia5/VIIPER/viipertypes"
+)
+
+type stubDevice struct {
+	usb.Device
+	resets atomic.Int32
+}
+
+func (d *stubDevice) ResetInputState() { d.resets.Add(1) }
+
+type plainDevice struct{ usb.Device }
+
+func TestPolicyWith(t *testing.T) {
+	on, off, ms := true, false, uint32(250)
+	base := Policy{OnDisconnect: true, Watchdog: time.Second}
+
+	assert.Equal(t, base, base.With(nil))
+	assert.Equal(t, base, base.With(&viipertypes.FailsafePolicy{}))
+	assert.Equal(t, Policy{OnDisconnect: false, Watchdog: time.Second}, base.With(&viipertypes.FailsafePolicy{OnDisconnect: &off}))
+	assert.Equal(t, Policy{OnDisconnect: true, Watchdog: 250 * time.Millisecond}, Policy{}.With(&viipertypes.FailsafePolicy{OnDisconnect: &on, WatchdogMs: &ms}))
+	assert.False(t, Policy{}.Enabled())
+}
+
+func TestSetGet(t *testing.T) {
+	on := true
+	ctx, other := device.WithAttachments(context.Background()), device.WithAttachments(context.Background())
+
+	Set(ctx, nil)
+	assert.Nil(t, Get(ctx))
+
+	o := &viipertypes.FailsafePolicy{OnDisconnect: &on}
+	Set(ctx, o)
+	assert.Same(t, o, Get(ctx))
+	assert.Nil(t, Get(other))
+	assert.Nil(t, Get(context.Background()), "no device context")
+}
+
+func TestWatchOnDisconnect(t *testing.T) {
+	dev := &stubDevice{}
+	ctx := device.WithAttachments(context.Background())
+	p := Policy{OnDisconnect: true}
+
+	c1, _ := net.Pipe()
+	c2, _ := net.Pipe()
+	_, release1 := Watch(c1, ctx, dev, p, slog.Default())
+	_, release2 := Watch(c2, ctx, dev, p, slog.Default())
+
+	release1()
+	release1()
+	assert.Equal(t, int32(0), dev.resets.Load(), "another stream is still connected")
+	release2()
+	assert.Equal(t, int32(1), dev.resets.Load())
+
+	_, release := Watch(c1, ctx, dev, Policy{}, slog.Default())
+	release()
+	assert.Equal(t, int32(1), dev.resets.Load(), "disabled policy")
+}
+
+func TestWatchWatchdog(t *testing.T) {
+	dev := &stubDevice{}
+	server, client := net.Pipe()
+	conn, release := Watch(server, device.WithAttachments(context.Background()), dev, Policy{Watchdog: 50 * time.Millisecond}, slog.Default())
+	defer release()
+
+	go func() {
+		buf := make([]byte, 8)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	defer client.Close() //nolint:errcheck
+
+	// Keep feeding input for longer than the watchdog.
+	for range 5 {
+		_, err := client.Write([]byte{0})
+		require.NoError(t, err)
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.Equal(t, int32(0), dev.resets.Load())
+
+	require.Eventually(t, func() bool { return dev.resets.Load() == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestWatchNoNeutralState(t *testing.T) {
+	dev := &plainDevice{}
+	server, _ := net.Pipe()
+	conn, release := Watch(server, device.WithAttachments(context.Background()), dev, Policy{OnDisconnect: true, Watchdog: time.Millisecond}, slog.Default())
+	assert.Nil(t, conn.(*watchConn).timer)
+	release()
+	assert.False(t, Neutralize(dev))
+}
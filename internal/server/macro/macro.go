@@ -0,0 +1,312 @@
+// Package macro records the input frames clients stream to devices and replays
+// them through the device's stream handler with the original timing.
+package macro
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/viipertypes"
+)
+
+var (
+	ErrRecording    = errors.New("already recording")
+	ErrNotRecording = errors.New("not recording")
+	ErrReplaying    = errors.New("already replaying")
+	ErrStreamActive = errors.New("a client stream is connected")
+)
+
+// MaxRecordingFrames is the number of frames a recording holds at most.
+// Frames streamed after that are not recorded, so a client streaming for a
+// long time cannot grow a recording without limit.
+const MaxRecordingFrames = 100_000
+
+// Options control a replay.
+type Options struct {
+	Loop  bool
+	Speed float64 // playback speed factor, <= 0 means 1
+}
+
+type frame struct {
+	offset time.Duration
+	data   []byte
+}
+
+type recording struct {
+	deviceType string
+	start      time.Time
+	frames     []frame
+}
+
+type replay struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// stateKey keys the macro state in the device attachments.
+type stateKey struct{}
+
+type state struct {
+	mu        sync.Mutex
+	streams   int
+	recording *recording
+	replay    *replay
+}
+
+// getState returns the macro state kept in devCtx, the device context.
+func getState(devCtx context.Context) *state {
+	return device.GetAttachments(devCtx).LoadOrStore(stateKey{}, func() any { return &state{} }).(*state)
+}
+
+// Tap registers a client stream to the device of devCtx.
+// A running replay of the device is stopped. Frames passed to RecordFrame of
+// the returned conn are recorded while a recording of the device is active.
+// release must be called once the stream has ended.
+func Tap(conn net.Conn, devCtx context.Context) (net.Conn, func()) {
+	st := getState(devCtx)
+	st.mu.Lock()
+	st.streams++
+	rp := st.replay
+	st.mu.Unlock()
+
+	if rp != nil {
+		rp.cancel()
+		<-rp.done
+	}
+
+	var once sync.Once
+	return &tapConn{Conn: conn, st: st}, func() {
+		once.Do(func() {
+			st.mu.Lock()
+			defer st.mu.Unlock()
+			st.streams--
+		})
+	}
+}
+
+type tapConn struct {
+	net.Conn
+	st *state
+}
+
+// RecordFrame records data, one complete input frame the stream handler read
+// from the connection and applied to the device, if the device is being
+// recorded and the recording holds less than MaxRecordingFrames frames.
+func (c *tapConn) RecordFrame(data []byte) {
+	c.st.mu.Lock()
+	defer c.st.mu.Unlock()
+	if rec := c.st.recording; rec != nil && len(rec.frames) < MaxRecordingFrames {
+		rec.frames = append(rec.frames, frame{
+			offset: time.Since(rec.start),
+			data:   append([]byte(nil), data...),
+		})
+	}
+}
+
+// StartRecording starts recording the input frames streamed to the device of
+// devCtx. The recording is kept in devCtx and discarded with the device.
+func StartRecording(devCtx context.Context, deviceType string) error {
+	st := getState(devCtx)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.recording != nil {
+		return ErrRecording
+	}
+	st.recording = &recording{deviceType: deviceType, start: time.Now()}
+	return nil
+}
+
+// StopRecording ends the recording of the device of devCtx and returns it.
+func StopRecording(devCtx context.Context) (*viipertypes.Macro, error) {
+	st := getState(devCtx)
+	st.mu.Lock()
+	rec := st.recording
+	st.recording = nil
+	st.mu.Unlock()
+	if rec == nil {
+		return nil, ErrNotRecording
+	}
+
+	m := &viipertypes.Macro{
+		Version:    viipertypes.MacroVersion,
+		DeviceType: rec.deviceType,
+		Frames:     make([]viipertypes.MacroFrame, len(rec.frames)),
+	}
+	for i, f := range rec.frames {
+		m.Frames[i] = viipertypes.MacroFrame{
+			Offset: f.offset.Microseconds(),
+			Data:   base64.StdEncoding.EncodeToString(f.data),
+		}
+	}
+	return m, nil
+}
+
+// Recording reports whether the device of devCtx is being recorded.
+func Recording(devCtx context.Context) bool {
+	st := getState(devCtx)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.recording != nil
+}
+
+// Replaying reports whether a macro is being replayed to the device of devCtx.
+func Replaying(devCtx context.Context) bool {
+	st := getState(devCtx)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.replay != nil
+}
+
+// StreamActive reports whether a client stream is connected to the device of
+// devCtx.
+func StreamActive(devCtx context.Context) bool {
+	st := getState(devCtx)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.streams > 0
+}
+
+// decode validates m and decodes its frames.
+func decode(m *viipertypes.Macro) ([]frame, error) {
+	if m.Version != viipertypes.MacroVersion {
+		return nil, fmt.Errorf("unsupported macro version %d", m.Version)
+	}
+	if len(m.Frames) == 0 {
+		return nil, errors.New("macro has no frames")
+	}
+	frames := make([]frame, len(m.Frames))
+	var last int64
+	for i, f := range m.Frames {
+		if f.Offset < last {
+			return nil, fmt.Errorf("frame %d: offset %d before previous frame", i, f.Offset)
+		}
+		last = f.Offset
+		data, err := base64.StdEncoding.DecodeString(f.Data)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+		frames[i] = frame{offset: time.Duration(f.Offset) * time.Microsecond, data: data}
+	}
+	return frames, nil
+}
+
+// Replay plays m back to the device of devCtx in the background.
+// run is the device's stream handler; it is fed the recorded data over an
+// in-memory connection, so frames take the same path as a client stream.
+// Data the handler sends back (rumble, LEDs, ...) is discarded.
+// The replay ends when m has been played (unless looping), when devCtx is
+// done, on StopReplay or when a client stream connects.
+// done is called after the replay has ended.
+func Replay(
+	devCtx context.Context,
+	m *viipertypes.Macro,
+	opts Options,
+	run func(conn net.Conn) error,
+	logger *slog.Logger,
+	done func(),
+) error {
+	frames, err := decode(m)
+	if err != nil {
+		return err
+	}
+	if opts.Speed <= 0 {
+		opts.Speed = 1
+	}
+	if opts.Loop && frames[len(frames)-1].offset == 0 {
+		return errors.New("cannot loop a macro without duration")
+	}
+
+	st := getState(devCtx)
+	st.mu.Lock()
+	switch {
+	case st.streams > 0:
+		st.mu.Unlock()
+		return ErrStreamActive
+	case st.replay != nil:
+		st.mu.Unlock()
+		return ErrReplaying
+	}
+	ctx, cancel := context.WithCancel(devCtx)
+	rp := &replay{cancel: cancel, done: make(chan struct{})}
+	st.replay = rp
+	st.mu.Unlock()
+
+	go func() {
+		defer func() {
+			st.mu.Lock()
+			st.replay = nil
+			st.mu.Unlock()
+			close(rp.done)
+			if done != nil {
+				done()
+			}
+		}()
+		defer cancel()
+
+		client, server := net.Pipe()
+		handlerDone := make(chan struct{})
+		go func() {
+			defer close(handlerDone)
+			if err := run(server); err != nil {
+				logger.Error("macro replay: stream handler error", "error", err)
+			}
+		}()
+		go func() { _, _ = io.Copy(io.Discard, client) }()
+		stop := context.AfterFunc(ctx, func() { _ = client.Close() })
+		defer stop()
+
+		play(ctx, client, frames, opts)
+		_ = client.Close()
+		<-handlerDone
+		logger.Info("macro replay ended")
+	}()
+	return nil
+}
+
+func play(ctx context.Context, w io.Writer, frames []frame, opts Options) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		start := time.Now()
+		for _, f := range frames {
+			wait := time.Until(start.Add(time.Duration(float64(f.offset) / opts.Speed)))
+			if wait > 0 {
+				timer.Reset(wait)
+				select {
+				case <-ctx.Done():
+					return
+				case <-timer.C:
+				}
+			}
+			if _, err := w.Write(f.data); err != nil {
+				return
+			}
+		}
+		if !opts.Loop || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// StopReplay stops a running replay of the device of devCtx and waits for it
+// to end. It reports whether a replay was running.
+func StopReplay(devCtx context.Context) bool {
+	st := getState(devCtx)
+	st.mu.Lock()
+	rp := st.replay
+	st.mu.Unlock()
+	if rp == nil {
+		return false
+	}
+	rp.cancel()
+	<-rp.done
+	return true
+}
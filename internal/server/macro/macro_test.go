@@ -0,0 +1,149 @@
+package macro
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/viipertypes"
+)
+
+type chunk struct {
+	at   time.Time
+	data string
+}
+
+// collect returns a stream handler reporting every chunk it reads on ch.
+func collect(ch chan<- chunk) func(conn net.Conn) error {
+	return func(conn net.Conn) error {
+		buf := make([]byte, 64)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+			ch <- chunk{at: time.Now(), data: string(buf[:n])}
+		}
+	}
+}
+
+func testMacro() *viipertypes.Macro {
+	enc := base64.StdEncoding.EncodeToString
+	return &viipertypes.Macro{
+		Version: viipertypes.MacroVersion,
+		Frames: []viipertypes.MacroFrame{
+			{Offset: 0, Data: enc([]byte("a"))},
+			{Offset: 40_000, Data: enc([]byte("b"))},
+		},
+	}
+}
+
+func TestReplaySpeed(t *testing.T) {
+	devCtx := device.WithAttachments(context.Background())
+	ch := make(chan chunk, 16)
+	done := make(chan struct{})
+
+	err := Replay(devCtx, testMacro(), Options{Speed: 2}, collect(ch), slog.New(slog.DiscardHandler), func() { close(done) })
+	require.NoError(t, err)
+	assert.ErrorIs(t, Replay(devCtx, testMacro(), Options{}, collect(ch), slog.New(slog.DiscardHandler), nil), ErrReplaying)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("replay did not end")
+	}
+	close(ch)
+	var got []chunk
+	for c := range ch {
+		got = append(got, c)
+	}
+	require.Len(t, got, 2)
+	assert.Equal(t, "a", got[0].data)
+	assert.Equal(t, "b", got[1].data)
+	gap := got[1].at.Sub(got[0].at)
+	assert.GreaterOrEqual(t, gap, 20*time.Millisecond)
+	assert.Less(t, gap, 40*time.Millisecond)
+	assert.False(t, Replaying(devCtx))
+}
+
+func TestReplayLoopStoppedByStream(t *testing.T) {
+	devCtx := device.WithAttachments(context.Background())
+	ch := make(chan chunk, 64)
+
+	require.NoError(t, Replay(devCtx, testMacro(), Options{Loop: true, Speed: 4}, collect(ch), slog.New(slog.DiscardHandler), nil))
+	time.Sleep(50 * time.Millisecond)
+
+	client, server := net.Pipe()
+	defer client.Close() //nolint:errcheck
+	conn, release := Tap(server, devCtx)
+	assert.False(t, Replaying(devCtx))
+	assert.True(t, StreamActive(devCtx))
+	assert.GreaterOrEqual(t, len(ch), 4, "macro looped")
+	assert.ErrorIs(t, Replay(devCtx, testMacro(), Options{}, collect(ch), slog.New(slog.DiscardHandler), nil), ErrStreamActive)
+
+	require.NoError(t, StartRecording(devCtx, "stub"))
+	go func() { _, _ = client.Write([]byte("xy")) }()
+	buf := make([]byte, 2)
+	_, err := io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	recorder, ok := conn.(interface{ RecordFrame([]byte) })
+	require.True(t, ok)
+	recorder.RecordFrame(buf)
+	release()
+
+	m, err := StopRecording(devCtx)
+	require.NoError(t, err)
+	assert.Equal(t, "stub", m.DeviceType)
+	require.Len(t, m.Frames, 1, "only frames are recorded, not reads")
+	data, err := base64.StdEncoding.DecodeString(m.Frames[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, "xy", string(data))
+	_, err = StopRecording(devCtx)
+	assert.ErrorIs(t, err, ErrNotRecording)
+}
+
+func TestRecordingLimit(t *testing.T) {
+	devCtx := device.WithAttachments(context.Background())
+	_, server := net.Pipe()
+	conn, release := Tap(server, devCtx)
+	defer release()
+	recorder := conn.(interface{ RecordFrame([]byte) })
+
+	require.NoError(t, StartRecording(devCtx, "stub"))
+	for range MaxRecordingFrames + 10 {
+		recorder.RecordFrame([]byte("x"))
+	}
+	m, err := StopRecording(devCtx)
+	require.NoError(t, err)
+	assert.Len(t, m.Frames, MaxRecordingFrames)
+}
+
+func TestReplayInvalidMacro(t *testing.T) {
+	devCtx := device.WithAttachments(context.Background())
+	run := func(net.Conn) error { return nil }
+	logger := slog.New(slog.DiscardHandler)
+
+	m := testMacro()
+	m.Version = 2
+	assert.Error(t, Replay(devCtx, m, Options{}, run, logger, nil))
+
+	m = testMacro()
+	m.Frames[1].Data = "!"
+	assert.Error(t, Replay(devCtx, m, Options{}, run, logger, nil))
+
+	m = testMacro()
+	m.Frames[1].Offset = 0
+	assert.Error(t, Replay(devCtx, m, Options{Loop: true}, run, logger, nil))
+	assert.False(t, Replaying(devCtx))
+}
@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Alia5/VIIPER/usbip"
+
+	toml "github.com/pelletier/go-toml"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Directions and operations a FaultRule can match.
+const (
+	DirClientToServer = "c2s"
+	DirServerToClient = "s2c"
+
+	OpCmdSubmit = "CMD_SUBMIT"
+	OpRetSubmit = "RET_SUBMIT"
+	OpCmdUnlink = "CMD_UNLINK"
+	OpRetUnlink = "RET_UNLINK"
+
+	URBDirIn  = "in"
+	URBDirOut = "out"
+)
+
+// Faults makes the proxy misbehave on purpose, to test how clients cope with
+// bad connections.
+//
+// Rules apply to the URB packets (CMD_SUBMIT, RET_SUBMIT, CMD_UNLINK,
+// RET_UNLINK) of every proxied connection. Every rule matching a packet
+// applies its actions; delays add up.
+type Faults struct {
+	// Seed makes the random decisions (probability, jitter) reproducible.
+	// Every connection starts from the same seed. 0 picks a random seed.
+	Seed uint64 `json:"seed,omitempty" yaml:"seed,omitempty" toml:"seed,omitempty"`
+	// DisconnectAfterMs closes every connection this many milliseconds after it was accepted.
+	DisconnectAfterMs int         `json:"disconnectAfterMs,omitempty" yaml:"disconnectAfterMs,omitempty" toml:"disconnectAfterMs,omitempty"`
+	Rules             []FaultRule `json:"rules" yaml:"rules" toml:"rules"`
+}
+
+// FaultRule selects URB packets and the faults injected into them.
+// Empty match fields match everything.
+type FaultRule struct {
+	// Direction is DirClientToServer or DirServerToClient.
+	Direction string `json:"direction,omitempty" yaml:"direction,omitempty" toml:"direction,omitempty"`
+	// Op is one of OpCmdSubmit, OpRetSubmit, OpCmdUnlink or OpRetUnlink.
+	Op string `json:"op,omitempty" yaml:"op,omitempty" toml:"op,omitempty"`
+	// Endpoint is the endpoint number (without direction bit) of submit packets.
+	Endpoint *uint8 `json:"endpoint,omitempty" yaml:"endpoint,omitempty" toml:"endpoint,omitempty"`
+	// URBDir is the transfer direction (URBDirIn or URBDirOut) of submit packets.
+	URBDir string `json:"urbDir,omitempty" yaml:"urbDir,omitempty" toml:"urbDir,omitempty"`
+	// Skip lets the first Skip matching packets of a connection through unharmed.
+	Skip int `json:"skip,omitempty" yaml:"skip,omitempty" toml:"skip,omitempty"`
+	// Count limits the rule to that many packets per connection; 0 is unlimited.
+	Count int `json:"count,omitempty" yaml:"count,omitempty" toml:"count,omitempty"`
+	// Probability applies the rule to a matching packet with this probability (0-1).
+	// 0 means always.
+	Probability float64 `json:"probability,omitempty" yaml:"probability,omitempty" toml:"probability,omitempty"`
+
+	// DelayMs holds the packet back for this many milliseconds, plus a random
+	// 0-JitterMs. Packets of a direction stay in order, like on a TCP stream.
+	DelayMs  int `json:"delayMs,omitempty" yaml:"delayMs,omitempty" toml:"delayMs,omitempty"`
+	JitterMs int `json:"jitterMs,omitempty" yaml:"jitterMs,omitempty" toml:"jitterMs,omitempty"`
+	// Drop discards the packet.
+	Drop bool `json:"drop,omitempty" yaml:"drop,omitempty" toml:"drop,omitempty"`
+	// Duplicate forwards the packet twice.
+	Duplicate bool `json:"duplicate,omitempty" yaml:"duplicate,omitempty" toml:"duplicate,omitempty"`
+	// Truncate cuts the payload of OUT CMD_SUBMIT and IN RET_SUBMIT packets to
+	// this many bytes and fixes up the length field. Isochronous URBs are left alone.
+	Truncate *int `json:"truncate,omitempty" yaml:"truncate,omitempty" toml:"truncate,omitempty"`
+	// UnlinkAfterMs sends a CMD_UNLINK for a CMD_SUBMIT this many milliseconds
+	// after forwarding it. The client sees the URB complete with -ECONNRESET
+	// if the server unlinked it; the RET_UNLINK itself is not forwarded.
+	UnlinkAfterMs *int `json:"unlinkAfterMs,omitempty" yaml:"unlinkAfterMs,omitempty" toml:"unlinkAfterMs,omitempty"`
+	// Disconnect closes the connection instead of forwarding the packet.
+	Disconnect bool `json:"disconnect,omitempty" yaml:"disconnect,omitempty" toml:"disconnect,omitempty"`
+}
+
+// LoadFaults reads a fault file. The format is chosen by the file extension
+// (.json, .yaml/.yml or .toml).
+func LoadFaults(path string) (*Faults, error) {
+	data, err := os.ReadFile(path) // nolint
+	if err != nil {
+		return nil, err
+	}
+	var f Faults
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &f)
+	case ".toml":
+		err = toml.Unmarshal(data, &f)
+	default:
+		err = json.Unmarshal(data, &f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	if err := f.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// Validate checks the rules for unknown values and impossible combinations.
+func (f *Faults) Validate() error {
+	var errs []error
+	if f.DisconnectAfterMs < 0 {
+		errs = append(errs, errors.New("disconnectAfterMs must not be negative"))
+	}
+	for i, r := range f.Rules {
+		if err := r.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("rule %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *FaultRule) validate() error {
+	switch r.Direction {
+	case "", DirClientToServer, DirServerToClient:
+	default:
+		return fmt.Errorf("unknown direction %q", r.Direction)
+	}
+	switch r.Op {
+	case "", OpCmdSubmit, OpRetSubmit, OpCmdUnlink, OpRetUnlink:
+	default:
+		return fmt.Errorf("unknown op %q", r.Op)
+	}
+	switch r.URBDir {
+	case "", URBDirIn, URBDirOut:
+	default:
+		return fmt.Errorf("unknown urbDir %q", r.URBDir)
+	}
+	if r.Skip < 0 || r.Count < 0 || r.DelayMs < 0 || r.JitterMs < 0 {
+		return errors.New("skip, count, delayMs and jitterMs must not be negative")
+	}
+	if r.Probability < 0 || r.Probability > 1 {
+		return fmt.Errorf("probability %v is not between 0 and 1", r.Probability)
+	}
+	if r.Truncate != nil && *r.Truncate < 0 {
+		return errors.New("truncate must not be negative")
+	}
+	if r.UnlinkAfterMs != nil {
+		if r.Op != OpCmdSubmit {
+			return fmt.Errorf("unlinkAfterMs needs op %s", OpCmdSubmit)
+		}
+		if *r.UnlinkAfterMs < 0 {
+			return errors.New("unlinkAfterMs must not be negative")
+		}
+	}
+	return nil
+}
+
+// matches reports whether the rule selects a packet of op for endpoint ep
+// (with direction bit) travelling in the given direction.
+func (r *FaultRule) matches(clientToServer bool, op string, ep uint8) bool {
+	if r.Direction != "" && (r.Direction == DirClientToServer) != clientToServer {
+		return false
+	}
+	if r.Op != "" && r.Op != op {
+		return false
+	}
+	submit := op == OpCmdSubmit || op == OpRetSubmit
+	if r.Endpoint != nil && (!submit || *r.Endpoint != ep&0x0F) {
+		return false
+	}
+	if r.URBDir != "" && (!submit || (r.URBDir == URBDirIn) != (ep&0x80 != 0)) {
+		return false
+	}
+	return true
+}
+
+func newRand(seed uint64) *rand.Rand {
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	return rand.New(rand.NewPCG(seed, seed))
+}
+
+func opName(command uint32) string {
+	switch command {
+	case usbip.CmdSubmitCode:
+		return OpCmdSubmit
+	case usbip.RetSubmitCode:
+		return OpRetSubmit
+	case usbip.CmdUnlinkCode:
+		return OpCmdUnlink
+	case usbip.RetUnlinkCode:
+		return OpRetUnlink
+	}
+	return ""
+}
+
+// truncatePayload cuts the payload of a non-isochronous submit packet to n
+// bytes and updates its length field.
+func truncatePayload(pkt []byte, n int) []byte {
+	if len(pkt) < 0x30 || usbip.IsIsochronous(binary.BigEndian.Uint32(pkt[32:36])) {
+		return pkt
+	}
+	if payload := len(pkt) - 0x30; payload > n {
+		pkt = pkt[:0x30+n]
+		binary.BigEndian.PutUint32(pkt[24:28], uint32(n))
+	}
+	return pkt
+}
@@ -0,0 +1,146 @@
+package proxy_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Alia5/VIIPER/internal/server/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startFaultyProxy(t *testing.T, f *proxy.Faults) string {
+	t.Helper()
+	require.NoError(t, f.Validate())
+	addr, _ := startProxy(t, startUpstream(t), func(s *proxy.Server) { s.SetFaults(f) })
+	return addr
+}
+
+func TestFaultsDrop(t *testing.T) {
+	conn := attach(t, startFaultyProxy(t, &proxy.Faults{Rules: []proxy.FaultRule{
+		{Direction: proxy.DirClientToServer, Op: proxy.OpCmdSubmit, Endpoint: new(uint8(0)), Count: 1, Drop: true},
+	}}))
+
+	_, err := controlIn(conn, 1, 0x80, 0x06, 0x0100, 0, 18)
+	assert.Error(t, err, "first request is dropped")
+	data, err := controlIn(conn, 2, 0x80, 0x06, 0x0100, 0, 18)
+	require.NoError(t, err)
+	assert.Len(t, data, 18)
+}
+
+func TestFaultsTruncateDuplicate(t *testing.T) {
+	conn := attach(t, startFaultyProxy(t, &proxy.Faults{Rules: []proxy.FaultRule{
+		{Direction: proxy.DirServerToClient, Op: proxy.OpRetSubmit, Count: 1, Truncate: new(4), Duplicate: true},
+	}}))
+
+	data, err := controlIn(conn, 1, 0x80, 0x06, 0x0100, 0, 18)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x12, 0x01}, data[:2])
+	assert.Len(t, data, 4)
+
+	seq, status, dup, err := readRet(conn, 750*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), seq)
+	assert.Zero(t, status)
+	assert.Equal(t, data, dup)
+
+	data, err = controlIn(conn, 2, 0x80, 0x06, 0x0100, 0, 18)
+	require.NoError(t, err)
+	assert.Len(t, data, 18, "count limits the rule")
+}
+
+func TestFaultsUnlink(t *testing.T) {
+	conn := attach(t, startFaultyProxy(t, &proxy.Faults{Rules: []proxy.FaultRule{
+		{Op: proxy.OpCmdSubmit, Endpoint: new(uint8(1)), URBDir: proxy.URBDirIn, UnlinkAfterMs: new(50)},
+	}}))
+
+	// Without input the interrupt IN URB stays pending until it is unlinked.
+	require.NoError(t, submitIn(conn, 1, 1, 64, [8]byte{}))
+	seq, status, data, err := readRet(conn, 750*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), seq)
+	assert.Equal(t, int32(-104), status)
+	assert.Empty(t, data)
+
+	// The RET_UNLINK of the injected CMD_UNLINK never reaches the client.
+	_, err = controlIn(conn, 2, 0x80, 0x06, 0x0100, 0, 18)
+	require.NoError(t, err)
+}
+
+func TestFaultsDelay(t *testing.T) {
+	conn := attach(t, startFaultyProxy(t, &proxy.Faults{Seed: 1, Rules: []proxy.FaultRule{
+		{Direction: proxy.DirServerToClient, Op: proxy.OpRetSubmit, DelayMs: 150, JitterMs: 50},
+	}}))
+
+	start := time.Now()
+	_, err := controlIn(conn, 1, 0x80, 0x06, 0x0100, 0, 18)
+	require.NoError(t, err)
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 150*time.Millisecond)
+	assert.Less(t, elapsed, 700*time.Millisecond)
+}
+
+func TestFaultsDisconnect(t *testing.T) {
+	conn := attach(t, startFaultyProxy(t, &proxy.Faults{Rules: []proxy.FaultRule{
+		{Direction: proxy.DirClientToServer, Op: proxy.OpCmdSubmit, Skip: 1, Disconnect: true},
+	}}))
+
+	_, err := controlIn(conn, 1, 0x80, 0x06, 0x0100, 0, 18)
+	require.NoError(t, err)
+	_, err = controlIn(conn, 2, 0x80, 0x06, 0x0100, 0, 18)
+	assert.Error(t, err)
+}
+
+func TestFaultsDisconnectAfter(t *testing.T) {
+	conn := attach(t, startFaultyProxy(t, &proxy.Faults{DisconnectAfterMs: 200}))
+
+	_, err := controlIn(conn, 1, 0x80, 0x06, 0x0100, 0, 18)
+	require.NoError(t, err)
+	require.NoError(t, submitIn(conn, 2, 1, 64, [8]byte{}))
+	start := time.Now()
+	_, _, _, err = readRet(conn, 2*time.Second)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second, "connection is closed, not timed out")
+}
+
+func TestLoadFaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "faults.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+seed: 42
+disconnectAfterMs: 30000
+rules:
+  - direction: s2c
+    op: RET_SUBMIT
+    endpoint: 1
+    delayMs: 20
+    jitterMs: 10
+  - op: CMD_SUBMIT
+    urbDir: in
+    probability: 0.1
+    unlinkAfterMs: 5
+`), 0o644))
+
+	f, err := proxy.LoadFaults(path)
+	require.NoError(t, err)
+	assert.Equal(t, &proxy.Faults{
+		Seed:              42,
+		DisconnectAfterMs: 30000,
+		Rules: []proxy.FaultRule{
+			{Direction: proxy.DirServerToClient, Op: proxy.OpRetSubmit, Endpoint: new(uint8(1)), DelayMs: 20, JitterMs: 10},
+			{Op: proxy.OpCmdSubmit, URBDir: proxy.URBDirIn, Probability: 0.1, UnlinkAfterMs: new(5)},
+		},
+	}, f)
+
+	for name, r := range map[string]proxy.FaultRule{
+		"unknown op":            {Op: "CMD_FOO"},
+		"unknown direction":     {Direction: "up"},
+		"probability above 1":   {Probability: 1.5},
+		"unlink without submit": {Op: proxy.OpRetSubmit, UnlinkAfterMs: new(5)},
+		"negative truncate":     {Truncate: new(-1)},
+	} {
+		f := proxy.Faults{Rules: []proxy.FaultRule{r}}
+		assert.Error(t, f.Validate(), name)
+	}
+}
@@ -0,0 +1,289 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Alia5/VIIPER/internal/urb"
+	"github.com/Alia5/VIIPER/usbip"
+)
+
+// injectedSeqBase is the first seqnum of injected CMD_UNLINKs, far above the
+// seqnums clients use.
+const injectedSeqBase = 0xF0000000
+
+var errFaultDisconnect = errors.New("disconnected by fault rule")
+
+// faultSession applies Faults to one proxied connection.
+type faultSession struct {
+	faults *Faults
+	logger *slog.Logger
+	framer *urb.Framer
+	pipes  [2]*pipe // indexed by clientToServer
+	conns  [2]net.Conn
+	timer  *time.Timer
+
+	mu         sync.Mutex
+	rng        *rand.Rand
+	hits       []int
+	devid      uint32
+	nextUnlink uint32
+	injected   map[uint32]uint32 // injected CMD_UNLINK seqnum -> unlinked seqnum
+	closed     bool
+}
+
+func newFaultSession(f *Faults, clientConn, upstreamConn net.Conn, logger *slog.Logger) *faultSession {
+	fs := &faultSession{
+		faults:     f,
+		logger:     logger,
+		framer:     urb.NewFramer(),
+		conns:      [2]net.Conn{clientConn, upstreamConn},
+		rng:        newRand(f.Seed),
+		hits:       make([]int, len(f.Rules)),
+		nextUnlink: injectedSeqBase,
+		injected:   map[uint32]uint32{},
+	}
+	fs.pipes[dirIndex(false)] = newPipe(clientConn)
+	fs.pipes[dirIndex(true)] = newPipe(upstreamConn)
+	if f.DisconnectAfterMs > 0 {
+		fs.timer = time.AfterFunc(time.Duration(f.DisconnectAfterMs)*time.Millisecond, func() {
+			fs.logger.Info("Fault injected", "fault", "disconnect", "after", time.Duration(f.DisconnectAfterMs)*time.Millisecond)
+			fs.disconnect()
+		})
+	}
+	return fs
+}
+
+func dirIndex(clientToServer bool) int {
+	if clientToServer {
+		return 1
+	}
+	return 0
+}
+
+// forward applies the rules to the packets completed by data and queues
+// them for the other side.
+func (fs *faultSession) forward(clientToServer bool, data []byte) error {
+	out := fs.pipes[dirIndex(clientToServer)]
+	for _, p := range fs.framer.Feed(clientToServer, data) {
+		if p.Command == 0 {
+			out.send(p.Data, 0)
+			continue
+		}
+		if !clientToServer && p.Command == usbip.RetUnlinkCode && fs.swallowUnlink(p) {
+			continue
+		}
+		if err := fs.apply(clientToServer, p, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *faultSession) apply(clientToServer bool, p urb.Packet, out *pipe) error {
+	op := opName(p.Command)
+	var (
+		delay      time.Duration
+		drop       bool
+		duplicate  bool
+		disconnect bool
+		unlink     *time.Duration
+	)
+	data := p.Data
+
+	fs.mu.Lock()
+	if p.Command == usbip.CmdSubmitCode {
+		fs.devid = binary.BigEndian.Uint32(data[8:12])
+	}
+	for i := range fs.faults.Rules {
+		r := &fs.faults.Rules[i]
+		if !r.matches(clientToServer, op, p.Ep) {
+			continue
+		}
+		fs.hits[i]++
+		if fs.hits[i] <= r.Skip || (r.Count > 0 && fs.hits[i] > r.Skip+r.Count) {
+			continue
+		}
+		if r.Probability > 0 && fs.rng.Float64() >= r.Probability {
+			continue
+		}
+		delay += time.Duration(r.DelayMs) * time.Millisecond
+		if r.JitterMs > 0 {
+			delay += time.Duration(fs.rng.Int64N(int64(r.JitterMs)*int64(time.Millisecond) + 1))
+		}
+		drop = drop || r.Drop
+		duplicate = duplicate || r.Duplicate
+		disconnect = disconnect || r.Disconnect
+		if r.Truncate != nil {
+			data = truncatePayload(data, *r.Truncate)
+		}
+		if r.UnlinkAfterMs != nil {
+			d := time.Duration(*r.UnlinkAfterMs) * time.Millisecond
+			unlink = &d
+		}
+	}
+	fs.mu.Unlock()
+
+	args := []any{"op", op, "seq", p.Seq, "ep", p.Ep}
+	switch {
+	case disconnect:
+		fs.logger.Info("Fault injected", append([]any{"fault", "disconnect"}, args...)...)
+		fs.disconnect()
+		return errFaultDisconnect
+	case drop:
+		fs.logger.Debug("Fault injected", append([]any{"fault", "drop"}, args...)...)
+		return nil
+	}
+	if len(data) != len(p.Data) {
+		fs.logger.Debug("Fault injected", append([]any{"fault", "truncate", "len", len(data) - 0x30}, args...)...)
+	}
+	if delay > 0 {
+		fs.logger.Debug("Fault injected", append([]any{"fault", "delay", "delay", delay}, args...)...)
+	}
+	out.send(data, delay)
+	if duplicate {
+		fs.logger.Debug("Fault injected", append([]any{"fault", "duplicate"}, args...)...)
+		out.send(data, delay)
+	}
+	if unlink != nil {
+		time.AfterFunc(delay+*unlink, func() { fs.injectUnlink(p.Seq) })
+	}
+	return nil
+}
+
+// injectUnlink sends a CMD_UNLINK for the URB with seqnum target upstream.
+func (fs *faultSession) injectUnlink(target uint32) {
+	fs.mu.Lock()
+	seq := fs.nextUnlink
+	fs.nextUnlink++
+	fs.injected[seq] = target
+	devid := fs.devid
+	fs.mu.Unlock()
+
+	var buf bytes.Buffer
+	_ = (&usbip.CmdUnlink{
+		Basic:        usbip.HeaderBasic{Command: usbip.CmdUnlinkCode, Seqnum: seq, Devid: devid},
+		UnlinkSeqnum: target,
+	}).Write(&buf)
+	fs.logger.Debug("Fault injected", "fault", "unlink", "op", OpCmdUnlink, "seq", seq, "unlinkSeq", target)
+	fs.pipes[dirIndex(true)].send(buf.Bytes(), 0)
+}
+
+// swallowUnlink reports whether p is the RET_UNLINK of an injected
+// CMD_UNLINK. For unlinked URBs the client gets a RET_SUBMIT with the unlink
+// status instead, since it never asked for the unlink.
+func (fs *faultSession) swallowUnlink(p urb.Packet) bool {
+	fs.mu.Lock()
+	target, ok := fs.injected[p.Seq]
+	delete(fs.injected, p.Seq)
+	fs.mu.Unlock()
+	if !ok {
+		return false
+	}
+	status := int32(binary.BigEndian.Uint32(p.Data[20:24]))
+	if status == urb.StatusConnReset {
+		var buf bytes.Buffer
+		_ = (&usbip.RetSubmit{
+			Basic:  usbip.HeaderBasic{Command: usbip.RetSubmitCode, Seqnum: target},
+			Status: status,
+		}).Write(&buf)
+		fs.pipes[dirIndex(false)].send(buf.Bytes(), 0)
+	}
+	return true
+}
+
+// drain waits until everything queued for the given direction is written.
+func (fs *faultSession) drain(clientToServer bool) {
+	fs.pipes[dirIndex(clientToServer)].close()
+}
+
+func (fs *faultSession) disconnect() {
+	fs.mu.Lock()
+	if fs.closed {
+		fs.mu.Unlock()
+		return
+	}
+	fs.closed = true
+	fs.mu.Unlock()
+	for _, c := range fs.conns {
+		_ = c.Close()
+	}
+}
+
+func (fs *faultSession) close() {
+	if fs.timer != nil {
+		fs.timer.Stop()
+	}
+	for _, p := range fs.pipes {
+		p.close()
+	}
+}
+
+// pipe writes packets to a connection after their delay, in order.
+type pipe struct {
+	dst  net.Conn
+	ch   chan delayed
+	done chan struct{}
+
+	mu     sync.Mutex
+	last   time.Time
+	closed bool
+}
+
+type delayed struct {
+	due  time.Time
+	data []byte
+}
+
+func newPipe(dst net.Conn) *pipe {
+	p := &pipe{dst: dst, ch: make(chan delayed, 256), done: make(chan struct{})}
+	go p.run()
+	return p
+}
+
+// send queues data to be written after delay, but not before the data
+// queued earlier.
+func (p *pipe) send(data []byte, delay time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	due := time.Now().Add(delay)
+	if due.Before(p.last) {
+		due = p.last
+	}
+	p.last = due
+	p.ch <- delayed{due: due, data: data}
+}
+
+func (p *pipe) run() {
+	defer close(p.done)
+	failed := false
+	for d := range p.ch {
+		if failed {
+			continue
+		}
+		time.Sleep(time.Until(d.due))
+		if _, err := p.dst.Write(d.data); err != nil {
+			failed = true
+		}
+	}
+}
+
+// close stops accepting packets and waits until the queued ones are written.
+func (p *pipe) close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.ch)
+	}
+	p.mu.Unlock()
+	<-p.done
+}
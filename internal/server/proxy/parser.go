@@ -85,6 +85,7 @@ func (p *Parser) Parse(data []byte, clientToServer bool) {
 				if dir == usbip.DirOut && xferLen > 0 && uint32(p.buf.Len()) >= xferLen {
 					p.buf.Next(int(xferLen))
 				}
+				p.skipIsoPacketDescriptors(binary.BigEndian.Uint32(peek[32:36]))
 				continue
 
 			case usbip.RetSubmitCode:
@@ -94,6 +95,7 @@ func (p *Parser) Parse(data []byte, clientToServer bool) {
 				if actualLen > 0 && uint32(p.buf.Len()) >= actualLen {
 					p.buf.Next(int(actualLen))
 				}
+				p.skipIsoPacketDescriptors(binary.BigEndian.Uint32(peek[32:36]))
 				continue
 
 			case usbip.CmdUnlinkCode:
@@ -134,6 +136,10 @@ func (p *Parser) parseCmdSubmit(data []byte, clientToServer bool) {
 		"len", xferLen,
 	}
 
+	if numPackets := binary.BigEndian.Uint32(data[32:36]); usbip.IsIsochronous(numPackets) {
+		args = append(args, "iso_packets", numPackets)
+	}
+
 	if ep == 0 {
 		args = append(args, "setup", fmt.Sprintf("[%02x %02x %02x %02x %02x %02x %02x %02x]",
 			setup[0], setup[1], setup[2], setup[3], setup[4], setup[5], setup[6], setup[7]))
@@ -147,12 +153,29 @@ func (p *Parser) parseRetSubmit(data []byte, clientToServer bool) {
 	status := int32(binary.BigEndian.Uint32(data[20:24]))
 	actualLen := binary.BigEndian.Uint32(data[24:28])
 
-	p.logger.Info("USBIP packet",
+	args := []any{
 		"dir", dirString(clientToServer),
 		"op", "RET_SUBMIT",
 		"seq", seqnum,
 		"status", status,
-		"actual_len", actualLen)
+		"actual_len", actualLen,
+	}
+	if numPackets := binary.BigEndian.Uint32(data[32:36]); usbip.IsIsochronous(numPackets) {
+		args = append(args, "iso_packets", numPackets, "error_count", binary.BigEndian.Uint32(data[36:40]))
+	}
+
+	p.logger.Info("USBIP packet", args...)
+}
+
+// skipIsoPacketDescriptors drops the iso packet descriptors trailing an
+// isochronous CMD_SUBMIT/RET_SUBMIT.
+func (p *Parser) skipIsoPacketDescriptors(numPackets uint32) {
+	if !usbip.IsIsochronous(numPackets) || numPackets > usbip.MaxIsoPackets {
+		return
+	}
+	if n := int(numPackets) * usbip.IsoPacketDescriptorSize; p.buf.Len() >= n {
+		p.buf.Next(n)
+	}
 }
 
 func (p *Parser) parseCmdUnlink(data []byte, clientToServer bool) {
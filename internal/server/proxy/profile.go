@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/Alia5/VIIPER/device/clone"
+	"github.com/Alia5/VIIPER/internal/urb"
+	"github.com/Alia5/VIIPER/usb"
+)
+
+const (
+	reqGetDescriptor      = 0x06
+	reqTypeStandardDevice = 0x80
+	reqTypeStandardIface  = 0x81
+	reqTypeDirIn          = 0x80
+	reqTypeMask           = 0x60 // standard, class or vendor
+	descTypeString        = 0x03
+)
+
+// ErrNoDevice is returned by ProfileRecorder.Save before a device was imported.
+var ErrNoDevice = errors.New("no device descriptor captured")
+
+// ProfileRecorder collects the descriptors of the device imported through the
+// proxy and the responses to its class and vendor requests into a
+// clone.Profile. Responses are taken from the EP0 traffic of the host, so only
+// what the host asks for is recorded.
+//
+// If a different device is imported later, recording starts over.
+type ProfileRecorder struct {
+	path string
+
+	mu       sync.Mutex
+	busID    string
+	speed    uint32
+	device   []byte
+	config   []byte
+	strings  map[uint8][]byte
+	reports  map[uint8][]byte
+	controls []clone.Control
+}
+
+// NewProfileRecorder returns a recorder that saves the profile to path.
+func NewProfileRecorder(path string) *ProfileRecorder {
+	r := &ProfileRecorder{path: path}
+	r.reset()
+	return r
+}
+
+func (r *ProfileRecorder) reset() {
+	r.speed = 0
+	r.device = nil
+	r.config = nil
+	r.strings = map[uint8][]byte{}
+	r.reports = map[uint8][]byte{}
+	r.controls = nil
+}
+
+// Path returns the file the profile is saved to.
+func (r *ProfileRecorder) Path() string { return r.path }
+
+// NewStream returns a stream recording one proxied connection. A nil
+// recorder returns a nil stream, which ignores everything fed to it.
+func (r *ProfileRecorder) NewStream() *urb.Stream {
+	if r == nil {
+		return nil
+	}
+	return urb.NewStream(r)
+}
+
+// Profile returns the profile recorded so far.
+func (r *ProfileRecorder) Profile() *clone.Profile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := &clone.Profile{
+		BusID:         r.busID,
+		Speed:         r.speed,
+		Device:        clone.Hex(r.device),
+		Configuration: clone.Hex(r.config),
+		Controls:      append([]clone.Control(nil), r.controls...),
+	}
+	if len(r.strings) > 0 {
+		p.Strings = map[uint8]string{}
+		for i, b := range r.strings {
+			p.Strings[i] = decodeString(b)
+		}
+	}
+	if len(r.reports) > 0 {
+		p.ReportDescriptors = map[uint8]clone.Hex{}
+		for i, b := range r.reports {
+			p.ReportDescriptors[i] = clone.Hex(b)
+		}
+	}
+	return p
+}
+
+// Save writes the profile recorded so far.
+func (r *ProfileRecorder) Save() error {
+	p := r.Profile()
+	if len(p.Device) == 0 {
+		return ErrNoDevice
+	}
+	return p.WriteFile(r.path)
+}
+
+func (r *ProfileRecorder) Imported(_ time.Time, imp urb.Import) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.busID != imp.BusID {
+		r.reset()
+		r.busID = imp.BusID
+	}
+	r.speed = imp.Speed
+}
+
+func (r *ProfileRecorder) Submitted(time.Time, uint32, *urb.Submit) {}
+
+func (r *ProfileRecorder) Completed(_ time.Time, _ uint32, s *urb.Submit, c *urb.Complete) {
+	if s.Ep != 0x80 || c.Status != 0 || len(c.Data) == 0 {
+		return
+	}
+	bm := s.Setup[0]
+	breq := s.Setup[1]
+	value := uint16(s.Setup[2]) | uint16(s.Setup[3])<<8
+	index := uint16(s.Setup[4]) | uint16(s.Setup[5])<<8
+	dtype := uint8(value >> 8)
+	dindex := uint8(value)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case bm == reqTypeStandardDevice && breq == reqGetDescriptor:
+		switch dtype {
+		case usb.DeviceDescType:
+			keepLongest(&r.device, c.Data)
+		case usb.ConfigDescType:
+			if dindex == 0 { // the clone has a single configuration
+				keepLongest(&r.config, c.Data)
+			}
+		case descTypeString:
+			b := r.strings[dindex]
+			keepLongest(&b, c.Data)
+			r.strings[dindex] = b
+		}
+	case bm == reqTypeStandardIface && breq == reqGetDescriptor && dtype == usb.ReportDescType:
+		b := r.reports[uint8(index)]
+		keepLongest(&b, c.Data)
+		r.reports[uint8(index)] = b
+	case bm&reqTypeDirIn != 0 && bm&reqTypeMask != 0:
+		ctl := clone.Control{RequestType: bm, Request: breq, Value: value, Index: index, Data: clone.Hex(append([]byte(nil), c.Data...))}
+		for i, old := range r.controls {
+			if old.RequestType == bm && old.Request == breq && old.Value == value && old.Index == index {
+				if len(ctl.Data) >= len(old.Data) {
+					r.controls[i] = ctl
+				}
+				return
+			}
+		}
+		r.controls = append(r.controls, ctl)
+	}
+}
+
+// keepLongest replaces *dst with a copy of data unless *dst is longer, so
+// short probes (e.g. the first 8 bytes of the device descriptor) do not
+// overwrite complete responses.
+func keepLongest(dst *[]byte, data []byte) {
+	if len(data) >= len(*dst) {
+		*dst = append([]byte(nil), data...)
+	}
+}
+
+// decodeString returns the text of a string descriptor.
+func decodeString(b []byte) string {
+	if len(b) < 2 {
+		return ""
+	}
+	n := min(int(b[0]), len(b))
+	units := make([]uint16, 0, (n-2)/2)
+	for i := 2; i+1 < n; i += 2 {
+		units = append(units, uint16(b[i])|uint16(b[i+1])<<8)
+	}
+	return string(utf16.Decode(units))
+}
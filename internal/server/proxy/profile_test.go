@@ -0,0 +1,87 @@
+package proxy_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/device/clone"
+	"github.com/Alia5/VIIPER/device/customhid"
+	"github.com/Alia5/VIIPER/internal/server/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile.json")
+	rec := proxy.NewProfileRecorder(path)
+	proxyAddr, proxySrv := startProxy(t, startUpstream(t), func(s *proxy.Server) { s.SetProfileRecorder(rec) })
+
+	usbipClient := viiperTesting.NewUsbIpClient(t, proxyAddr)
+	devs, err := usbipClient.ListDevices()
+	require.NoError(t, err)
+	require.Len(t, devs, 1)
+	imp, err := usbipClient.AttachDevice(devs[0].BusID)
+	require.NoError(t, err)
+
+	// Enumerate like a host: short probes first, then the full descriptors.
+	var seq uint32
+	get := func(bm, req uint8, wValue, wIndex, wLength uint16) []byte {
+		seq++
+		data, err := controlIn(imp.Conn, seq, bm, req, wValue, wIndex, wLength)
+		require.NoError(t, err)
+		return data
+	}
+	get(0x80, 0x06, 0x0100, 0, 8)
+	devDesc := get(0x80, 0x06, 0x0100, 0, 18)
+	get(0x80, 0x06, 0x0200, 0, 9)
+	configDesc := get(0x80, 0x06, 0x0200, 0, 0xFF)
+	get(0x80, 0x06, 0x0300, 0, 0xFF)
+	get(0x80, 0x06, 0x0301, 0x0409, 2)
+	get(0x80, 0x06, 0x0301, 0x0409, 0xFF)
+	get(0x80, 0x06, 0x0302, 0x0409, 0xFF)
+	reportDesc := get(0x81, 0x06, 0x2200, 0, 0xFF)
+	feature := get(0xA1, 0x01, 0x0301, 0, 64)
+	assert.Equal(t, []byte{0x01, 0xAA, 0xBB}, feature)
+	_ = imp.Conn.Close()
+
+	require.Eventually(t, func() bool {
+		p, err := clone.ReadProfile(path)
+		return err == nil && len(p.Controls) == 1
+	}, time.Second, 10*time.Millisecond, "profile is saved when the connection closes")
+	require.NoError(t, proxySrv.Close())
+
+	p, err := clone.ReadProfile(path)
+	require.NoError(t, err)
+	assert.Equal(t, devs[0].BusID, p.BusID)
+	assert.Equal(t, devs[0].Speed, p.Speed)
+	assert.Equal(t, devDesc, []byte(p.Device))
+	assert.Equal(t, configDesc, []byte(p.Configuration))
+	assert.Equal(t, map[uint8]string{0: "Љ", 1: "ACME", 2: "Pedals"}, p.Strings)
+	assert.Equal(t, map[uint8]clone.Hex{0: reportDesc}, p.ReportDescriptors)
+	assert.Equal(t, []clone.Control{{RequestType: 0xA1, Request: 0x01, Value: 0x0301, Index: 0, Data: feature}}, p.Controls)
+
+	// The recorded profile yields an identical device.
+	c, err := clone.New(&device.CreateOptions{
+		DataDir:        filepath.Dir(path),
+		DeviceSpecific: fmt.Sprintf(`{"file": %q}`, filepath.Base(path)),
+	})
+	require.NoError(t, err)
+	desc := c.GetDescriptor()
+	assert.Equal(t, uint16(customhid.DefaultVID), desc.Device.IDVendor)
+	assert.Equal(t, uint16(customhid.DefaultPID), desc.Device.IDProduct)
+	resp, handled := c.HandleControl(0xA1, 0x01, 0x0301, 0, 64, nil)
+	assert.True(t, handled)
+	assert.Equal(t, feature, resp)
+}
+
+func TestProfileRecorderNoDevice(t *testing.T) {
+	rec := proxy.NewProfileRecorder(filepath.Join(t.TempDir(), "profile.json"))
+	assert.ErrorIs(t, rec.Save(), proxy.ErrNoDevice)
+
+	var nilRec *proxy.ProfileRecorder
+	assert.NotPanics(t, func() { nilRec.NewStream().Feed(true, []byte{1, 2, 3}) })
+}
@@ -0,0 +1,143 @@
+package proxy_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/device/customhid"
+	"github.com/Alia5/VIIPER/internal/log"
+	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/internal/server/proxy"
+	"github.com/Alia5/VIIPER/usbip"
+	"github.com/Alia5/VIIPER/viiperclient"
+	"github.com/Alia5/VIIPER/virtualbus"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/Alia5/VIIPER/internal/registry" // Register devices
+)
+
+// startUpstream starts a USB-IP server with a customhid device and returns
+// its address.
+func startUpstream(t *testing.T) string {
+	t.Helper()
+	s := viiperTesting.NewTestServer(t)
+	t.Cleanup(func() {
+		s.ApiServer.Close()
+		_ = s.UsbServer.Close()
+	})
+
+	r := s.ApiServer.Router()
+	r.Register("bus/{id}/add", handler.BusDeviceAdd(s.UsbServer, s.ApiServer))
+	require.NoError(t, s.ApiServer.Start())
+
+	b, err := virtualbus.NewWithBusID(1)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = b.Close() })
+	_ = s.UsbServer.AddBus(b)
+
+	opts, err := json.Marshal(customhid.Options{
+		Manufacturer:     "ACME",
+		Product:          "Pedals",
+		ReportDescriptor: "05 01 09 04 a1 01 85 01 09 30 15 00 26 ff 00 75 08 95 01 81 02 c0",
+		FeatureReports:   []string{"01 aa bb"},
+	})
+	require.NoError(t, err)
+	client := viiperclient.New(s.ApiServer.Addr())
+	_, err = client.DeviceAddCtx(context.Background(), b.BusID(), "customhid", &device.CreateOptions{DeviceSpecific: string(opts)})
+	require.NoError(t, err)
+	return s.UsbServer.Addr()
+}
+
+// startProxy starts a proxy in front of upstream. configure is called before
+// the proxy starts listening.
+func startProxy(t *testing.T, upstream string, configure func(s *proxy.Server)) (string, *proxy.Server) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	srv := proxy.New(addr, upstream, time.Second, slog.New(slog.DiscardHandler), log.NewRaw(nil))
+	if configure != nil {
+		configure(srv)
+	}
+	go func() { _ = srv.ListenAndServe() }()
+	t.Cleanup(func() { _ = srv.Close() })
+	require.Eventually(t, func() bool {
+		c, err := net.Dial("tcp", addr)
+		if err == nil {
+			_ = c.Close()
+		}
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	return addr, srv
+}
+
+// attach imports the device of the upstream server through the proxy at addr.
+func attach(t *testing.T, addr string) net.Conn {
+	t.Helper()
+	usbipClient := viiperTesting.NewUsbIpClient(t, addr)
+	devs, err := usbipClient.ListDevices()
+	require.NoError(t, err)
+	require.Len(t, devs, 1)
+	imp, err := usbipClient.AttachDevice(devs[0].BusID)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = imp.Conn.Close() })
+	return imp.Conn
+}
+
+func submitIn(conn net.Conn, seq uint32, ep uint32, length uint32, setup [8]byte) error {
+	cmd := usbip.CmdSubmit{
+		Basic:             usbip.HeaderBasic{Command: usbip.CmdSubmitCode, Seqnum: seq, Dir: usbip.DirIn, Ep: ep},
+		TransferBufferLen: length,
+		Setup:             setup,
+	}
+	return cmd.Write(conn)
+}
+
+// readRet reads a RET_SUBMIT carrying IN data.
+func readRet(conn net.Conn, timeout time.Duration) (seq uint32, status int32, data []byte, err error) {
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{}) //nolint:errcheck
+
+	var hdr [48]byte
+	if err := usbip.ReadExactly(conn, hdr[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	if cmd := binary.BigEndian.Uint32(hdr[0:4]); cmd != usbip.RetSubmitCode {
+		return 0, 0, nil, fmt.Errorf("unexpected ret cmd %x", cmd)
+	}
+	seq = binary.BigEndian.Uint32(hdr[4:8])
+	status = int32(binary.BigEndian.Uint32(hdr[20:24]))
+	data = make([]byte, binary.BigEndian.Uint32(hdr[24:28]))
+	if err := usbip.ReadExactly(conn, data); err != nil {
+		return 0, 0, nil, err
+	}
+	return seq, status, data, nil
+}
+
+func controlIn(conn net.Conn, seq uint32, bm, req uint8, wValue, wIndex, wLength uint16) ([]byte, error) {
+	setup := [8]byte{bm, req}
+	binary.LittleEndian.PutUint16(setup[2:4], wValue)
+	binary.LittleEndian.PutUint16(setup[4:6], wIndex)
+	binary.LittleEndian.PutUint16(setup[6:8], wLength)
+	if err := submitIn(conn, seq, 0, uint32(wLength), setup); err != nil {
+		return nil, err
+	}
+	gotSeq, status, data, err := readRet(conn, 750*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	if gotSeq != seq || status != 0 {
+		return nil, fmt.Errorf("ret seq %d status %d", gotSeq, status)
+	}
+	return data, nil
+}
@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/Alia5/VIIPER/internal/log"
+	"github.com/Alia5/VIIPER/internal/pcap"
+	"github.com/Alia5/VIIPER/internal/urb"
 )
 
 type Server struct {
@@ -19,6 +21,9 @@ type Server struct {
 	connectionTimeout time.Duration
 	logger            *slog.Logger
 	rawLogger         log.RawLogger
+	capture           *pcap.Writer
+	profile           *ProfileRecorder
+	faults            *Faults
 	ln                net.Listener
 }
 
@@ -32,6 +37,25 @@ func New(listenAddr, upstreamAddr string, connectionTimeout time.Duration, logge
 	}
 }
 
+// SetCapture writes the URBs of all following connections to w.
+// Must be called before ListenAndServe.
+func (s *Server) SetCapture(w *pcap.Writer) {
+	s.capture = w
+}
+
+// SetProfileRecorder records the device imported through the proxy into a
+// clone profile, saved whenever a connection closes and on Close.
+// Must be called before ListenAndServe.
+func (s *Server) SetProfileRecorder(r *ProfileRecorder) {
+	s.profile = r
+}
+
+// SetFaults injects the faults described by f into all following connections.
+// Must be called before ListenAndServe.
+func (s *Server) SetFaults(f *Faults) {
+	s.faults = f
+}
+
 func (s *Server) ListenAndServe() error {
 	ln, err := net.Listen("tcp", s.listenAddr)
 	if err != nil {
@@ -61,6 +85,7 @@ func (s *Server) ListenAndServe() error {
 }
 
 func (s *Server) Close() error {
+	s.saveProfile()
 	if s.ln != nil {
 		return s.ln.Close()
 	}
@@ -90,36 +115,64 @@ func (s *Server) handleProxy(clientConn net.Conn) {
 		return
 	}
 
+	capture := s.capture.NewStream()
+	profile := s.profile.NewStream()
+	var faults *faultSession
+	if s.faults != nil {
+		faults = newFaultSession(s.faults, clientConn, upstreamConn, s.logger)
+		defer faults.close()
+	}
+
 	var wg sync.WaitGroup
 	wg.Add(2)
 
 	go func() {
 		defer wg.Done()
-		bytes, err := s.copyWithLogging(upstreamConn, clientConn, true)
+		bytes, err := s.copyWithLogging(upstreamConn, clientConn, true, capture, profile, faults)
 		if err != nil && !isExpectedDisconnect(err) {
 			s.logger.Debug("Client->Server copy error", "error", err)
 		}
 		s.logger.Debug("Client->Server stream ended", "bytes", bytes)
+		if faults != nil {
+			faults.drain(true)
+		}
 		halfClose(upstreamConn, true)
 		halfClose(clientConn, false)
 	}()
 
 	go func() {
 		defer wg.Done()
-		bytes, err := s.copyWithLogging(clientConn, upstreamConn, false)
+		bytes, err := s.copyWithLogging(clientConn, upstreamConn, false, capture, profile, faults)
 		if err != nil && !isExpectedDisconnect(err) {
 			s.logger.Debug("Server->Client copy error", "error", err)
 		}
 		s.logger.Debug("Server->Client stream ended", "bytes", bytes)
+		if faults != nil {
+			faults.drain(false)
+		}
 		halfClose(clientConn, true)
 		halfClose(upstreamConn, false)
 	}()
 
 	wg.Wait()
 	s.logger.Info("Connection closed", "client", clientConn.RemoteAddr())
+	s.saveProfile()
+}
+
+func (s *Server) saveProfile() {
+	if s.profile == nil {
+		return
+	}
+	if err := s.profile.Save(); err != nil {
+		if !errors.Is(err, ErrNoDevice) {
+			s.logger.Error("Failed to save device profile", "path", s.profile.Path(), "error", err)
+		}
+		return
+	}
+	s.logger.Info("Saved device profile", "path", s.profile.Path())
 }
 
-func (s *Server) copyWithLogging(dst net.Conn, src net.Conn, clientToServer bool) (int64, error) {
+func (s *Server) copyWithLogging(dst net.Conn, src net.Conn, clientToServer bool, capture *pcap.Stream, profile *urb.Stream, faults *faultSession) (int64, error) {
 	buf := make([]byte, 32*1024)
 	var total int64
 	parser := NewParser(s.logger)
@@ -131,6 +184,8 @@ func (s *Server) copyWithLogging(dst net.Conn, src net.Conn, clientToServer bool
 			s.rawLogger.Log(clientToServer, buf[:n])
 
 			parser.Parse(buf[:n], clientToServer)
+			capture.Feed(clientToServer, buf[:n])
+			profile.Feed(clientToServer, buf[:n])
 
 			if firstPacket {
 				err := src.SetDeadline(time.Time{})
@@ -146,13 +201,21 @@ func (s *Server) copyWithLogging(dst net.Conn, src net.Conn, clientToServer bool
 				firstPacket = false
 			}
 
-			wn, werr := dst.Write(buf[:n])
-			total += int64(wn)
-			if werr != nil {
-				return total, werr
-			}
-			if wn != n {
-				return total, fmt.Errorf("short write: wrote %d of %d", wn, n)
+			if faults != nil {
+				// Packets are written by the fault session, possibly later.
+				if err := faults.forward(clientToServer, buf[:n]); err != nil {
+					return total, err
+				}
+				total += int64(n)
+			} else {
+				wn, werr := dst.Write(buf[:n])
+				total += int64(wn)
+				if werr != nil {
+					return total, werr
+				}
+				if wn != n {
+					return total, fmt.Errorf("short write: wrote %d of %d", wn, n)
+				}
 			}
 		}
 
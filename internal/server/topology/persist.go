@@ -0,0 +1,63 @@
+package topology
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Alia5/VIIPER/internal/server/usb"
+	"github.com/Alia5/VIIPER/viipertypes"
+)
+
+// persistDelay batches bursts of changes (e.g. removing a bus with all its
+// devices) into one write.
+const persistDelay = 250 * time.Millisecond
+
+// Persist writes the topology of srv to path whenever a bus or device is added
+// or removed or a device's meta state changes, and a last time once ctx is
+// done.
+// The returned channel is closed after the last write.
+func Persist(ctx context.Context, srv *usb.Server, path string, logger *slog.Logger) <-chan struct{} {
+	events, unsubscribe := srv.SubscribeEvents(64)
+	done := make(chan struct{})
+
+	save := func() {
+		if err := Save(path, Snapshot(srv)); err != nil {
+			logger.Error("failed to write state file", "path", path, "error", err)
+		}
+	}
+
+	go func() {
+		defer close(done)
+		defer func() { unsubscribe() }()
+
+		save()
+		var pending <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				save()
+				return
+			case ev, ok := <-events:
+				if !ok {
+					// Dropped for falling behind; resubscribe and catch up.
+					events, unsubscribe = srv.SubscribeEvents(64)
+					save()
+					continue
+				}
+				switch ev.Type {
+				case viipertypes.EventBusAdded, viipertypes.EventBusRemoved,
+					viipertypes.EventDeviceAdded, viipertypes.EventDeviceRemoved,
+					viipertypes.EventDeviceUpdated:
+					if pending == nil {
+						pending = time.After(persistDelay)
+					}
+				}
+			case <-pending:
+				pending = nil
+				save()
+			}
+		}
+	}()
+	return done
+}
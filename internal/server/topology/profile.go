@@ -0,0 +1,66 @@
+package topology
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/internal/server/usb"
+)
+
+// Profile declares buses and devices that exist for the whole lifetime of the
+// server, e.g. the fixed controllers of a kiosk or arcade machine.
+type Profile struct {
+	// Defaults holds deviceSpecific values per device type (e.g. the xbox360
+	// subType or a dualshock4 serial_number). Values set on a device win.
+	Defaults map[string]map[string]any `json:"defaults,omitempty" yaml:"defaults,omitempty" toml:"defaults,omitempty"`
+	Buses    []Bus                     `json:"buses" yaml:"buses" toml:"buses"`
+}
+
+// LoadProfile reads a profile file, see Load for the supported formats.
+func LoadProfile(path string) (*Profile, error) {
+	var p Profile
+	if err := decode(path, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ApplyProfile creates the buses and devices of p on srv.
+// Profile devices are kept alive: they are not removed when no client stream
+// connects or a stream ends. Devices that cannot be created are skipped and
+// reported in the returned error. Device files are resolved in dataDir.
+func ApplyProfile(srv *usb.Server, p *Profile, dataDir string, logger *slog.Logger) error {
+	var errs []error
+	for _, bus := range p.Buses {
+		b, err := ensureBus(srv, bus.ID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, d := range bus.Devices {
+			d.DeviceSpecific = p.deviceSpecific(d)
+			devCtx, err := addDevice(b, d, true, device.CreateOptions{DataDir: dataDir, Logger: logger})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("bus %d: %w", bus.ID, err))
+				continue
+			}
+			meta := device.GetDeviceMeta(devCtx)
+			logger.Info("added profile device", "busID", bus.ID, "deviceID", meta.DevID, "type", d.Type)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Profile) deviceSpecific(d Device) map[string]any {
+	defaults := p.Defaults[strings.ToLower(d.Type)]
+	if len(defaults) == 0 {
+		return d.DeviceSpecific
+	}
+	out := maps.Clone(defaults)
+	maps.Copy(out, d.DeviceSpecific)
+	return out
+}
@@ -0,0 +1,129 @@
+package topology
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	"github.com/Alia5/VIIPER/internal/server/failsafe"
+	"github.com/Alia5/VIIPER/internal/server/usb"
+	pusb "github.com/Alia5/VIIPER/usb"
+	"github.com/Alia5/VIIPER/viipertypes"
+	"github.com/Alia5/VIIPER/virtualbus"
+)
+
+// Restore recreates the buses and devices of st on srv, keeping their IDs.
+// Existing buses are reused; devices that cannot be recreated are skipped and
+// reported in the returned error.
+// Like devices added through the API, restored devices are removed again if
+// no client stream connects within timeout. Device files are resolved in
+// dataDir, see device.CreateOptions.
+func Restore(srv *usb.Server, st *State, timeout time.Duration, dataDir string, logger *slog.Logger) error {
+	var errs []error
+	for _, bus := range st.Buses {
+		b, err := ensureBus(srv, bus.ID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, d := range bus.Devices {
+			devCtx, err := addDevice(b, d, false, device.CreateOptions{DataDir: dataDir, Logger: logger})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("bus %d: %w", bus.ID, err))
+				continue
+			}
+			meta := device.GetDeviceMeta(devCtx)
+			logger.Info("restored device", "busID", bus.ID, "deviceID", meta.DevID, "type", d.Type)
+			removeIfUnconnected(srv, devCtx, timeout, logger)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func ensureBus(srv *usb.Server, busID uint32) (*virtualbus.VirtualBus, error) {
+	if b := srv.GetBus(busID); b != nil {
+		return b, nil
+	}
+	b, err := virtualbus.NewWithBusID(busID)
+	if err != nil {
+		return nil, err
+	}
+	if err := srv.AddBus(b); err != nil {
+		_ = b.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// addDevice creates d with opts and adds it to b, under d.ID if set.
+func addDevice(b *virtualbus.VirtualBus, d Device, keepAlive bool, opts device.CreateOptions) (context.Context, error) {
+	dev, err := createDevice(d, opts)
+	if err != nil {
+		return nil, err
+	}
+	var devCtx context.Context
+	switch {
+	case keepAlive:
+		devCtx, err = b.AddKeepAlive(dev, d.ID)
+	case d.ID != 0:
+		devCtx, err = b.AddWithID(dev, d.ID)
+	default:
+		devCtx, err = b.Add(dev)
+	}
+	if err != nil {
+		return nil, err
+	}
+	failsafe.Set(devCtx, (*viipertypes.FailsafePolicy)(d.Failsafe))
+	return devCtx, nil
+}
+
+func createDevice(d Device, opts device.CreateOptions) (pusb.Device, error) {
+	name := strings.ToLower(d.Type)
+	reg := api.GetRegistration(name)
+	if reg == nil {
+		return nil, fmt.Errorf("unknown device type: %q", d.Type)
+	}
+	opts.IDVendor = d.IDVendor
+	opts.IDProduct = d.IDProduct
+	if len(d.DeviceSpecific) > 0 {
+		b, err := json.Marshal(d.DeviceSpecific)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deviceSpecific for %s: %w", name, err)
+		}
+		opts.DeviceSpecific = string(b)
+	}
+	dev, err := reg.CreateDevice(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("create %s: %w", name, err)
+	}
+	return dev, nil
+}
+
+// removeIfUnconnected arms the connect timer of a device, see BusDeviceAdd.
+func removeIfUnconnected(srv *usb.Server, devCtx context.Context, timeout time.Duration, logger *slog.Logger) {
+	connTimer := device.GetConnTimer(devCtx)
+	meta := device.GetDeviceMeta(devCtx)
+	if connTimer == nil || meta == nil {
+		return
+	}
+	connTimer.Reset(timeout)
+	go func() {
+		select {
+		case <-devCtx.Done():
+			connTimer.Stop()
+		case <-connTimer.C:
+			deviceIDStr := fmt.Sprintf("%d", meta.DevID)
+			if err := srv.RemoveDeviceByID(meta.BusID, deviceIDStr); err != nil {
+				logger.Error("timeout: failed to remove restored device", "busID", meta.BusID, "deviceID", deviceIDStr, "error", err)
+			} else {
+				logger.Info("timeout: removed restored device (no connection)", "busID", meta.BusID, "deviceID", deviceIDStr)
+			}
+		}
+	}()
+}
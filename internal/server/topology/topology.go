@@ -0,0 +1,177 @@
+// Package topology snapshots the buses and devices of a server, stores them
+// in json, yaml or toml files and recreates them with the same IDs.
+// It also applies profiles, which declare devices that are always present.
+package topology
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/internal/server/api"
+	"github.com/Alia5/VIIPER/internal/server/failsafe"
+	"github.com/Alia5/VIIPER/internal/server/usb"
+	"github.com/Alia5/VIIPER/virtualbus"
+
+	toml "github.com/pelletier/go-toml"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// State is a bus/device topology.
+type State struct {
+	Buses []Bus `json:"buses" yaml:"buses" toml:"buses"`
+}
+
+// Bus is a bus and the devices on it.
+type Bus struct {
+	ID      uint32   `json:"id" yaml:"id" toml:"id"`
+	Devices []Device `json:"devices,omitempty" yaml:"devices,omitempty" toml:"devices,omitempty"`
+}
+
+// Device is a device on a bus.
+// ID 0 picks the next free device ID.
+type Device struct {
+	ID             uint32         `json:"id,omitempty" yaml:"id,omitempty" toml:"id,omitempty"`
+	Type           string         `json:"type" yaml:"type" toml:"type"`
+	IDVendor       *uint16        `json:"idVendor,omitempty" yaml:"idVendor,omitempty" toml:"idVendor,omitempty"`
+	IDProduct      *uint16        `json:"idProduct,omitempty" yaml:"idProduct,omitempty" toml:"idProduct,omitempty"`
+	DeviceSpecific map[string]any `json:"deviceSpecific,omitempty" yaml:"deviceSpecific,omitempty" toml:"deviceSpecific,omitempty"`
+	Failsafe       *Failsafe      `json:"failsafe,omitempty" yaml:"failsafe,omitempty" toml:"failsafe,omitempty"`
+}
+
+// Failsafe overrides the server's failsafe defaults for a device, see
+// viipertypes.FailsafePolicy.
+type Failsafe struct {
+	OnDisconnect *bool   `json:"onDisconnect,omitempty" yaml:"onDisconnect,omitempty" toml:"onDisconnect,omitempty"`
+	WatchdogMs   *uint32 `json:"watchdogMs,omitempty" yaml:"watchdogMs,omitempty" toml:"watchdogMs,omitempty"`
+}
+
+// Snapshot returns the current topology of srv, ordered by bus and device ID.
+// Keep-alive devices are left out since they are recreated from their profile.
+func Snapshot(srv *usb.Server) *State {
+	busIDs := srv.ListBuses()
+	slices.Sort(busIDs)
+
+	st := &State{Buses: make([]Bus, 0, len(busIDs))}
+	for _, busID := range busIDs {
+		b := srv.GetBus(busID)
+		if b == nil {
+			continue
+		}
+		metas := b.GetAllDeviceMetas()
+		slices.SortFunc(metas, func(a, b virtualbus.DeviceMeta) int { return cmp.Compare(a.Meta.DevID, b.Meta.DevID) })
+
+		bus := Bus{ID: busID}
+		for _, m := range metas {
+			devCtx := b.GetDeviceContext(m.Dev)
+			if devCtx == nil || device.IsKeepAlive(devCtx) {
+				continue
+			}
+			desc := m.Dev.GetDescriptor()
+			vid, pid := desc.Device.IDVendor, desc.Device.IDProduct
+			bus.Devices = append(bus.Devices, Device{
+				ID:             m.Meta.DevID,
+				Type:           api.DeviceType(m.Dev),
+				IDVendor:       &vid,
+				IDProduct:      &pid,
+				DeviceSpecific: dropNil(m.Dev.GetDeviceSpecificArgs()),
+				Failsafe:       (*Failsafe)(failsafe.Get(devCtx)),
+			})
+		}
+		if len(bus.Devices) == 0 && len(metas) > 0 {
+			continue
+		}
+		st.Buses = append(st.Buses, bus)
+	}
+	return st
+}
+
+// dropNil removes null values, which toml cannot represent.
+func dropNil(m map[string]any) map[string]any {
+	for k, v := range m {
+		switch v := v.(type) {
+		case nil:
+			delete(m, k)
+		case map[string]any:
+			dropNil(v)
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// Load reads a topology file. The format is chosen by the file extension
+// (.json, .yaml/.yml or .toml).
+func Load(path string) (*State, error) {
+	var st State
+	if err := decode(path, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func decode(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch format(path) {
+	case "yaml":
+		err = yaml.Unmarshal(data, v)
+	case "toml":
+		err = toml.Unmarshal(data, v)
+	default:
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// Save writes st to a topology file, see Load.
+// The file is replaced atomically, so a crash never leaves a partial file.
+func Save(path string, st *State) error {
+	var data []byte
+	var err error
+	switch format(path) {
+	case "yaml":
+		data, err = yaml.Marshal(st)
+	case "toml":
+		data, err = toml.Marshal(st)
+	default:
+		data, err = json.MarshalIndent(st, "", "  ")
+	}
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", path, err)
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func format(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	default:
+		return "json"
+	}
+}
@@ -0,0 +1,192 @@
+package topology_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/device/dualsense"
+	"github.com/Alia5/VIIPER/device/xbox360"
+	_ "github.com/Alia5/VIIPER/internal/registry" // Register devices
+	"github.com/Alia5/VIIPER/internal/server/failsafe"
+	"github.com/Alia5/VIIPER/internal/server/topology"
+	"github.com/Alia5/VIIPER/internal/server/usb"
+	"github.com/Alia5/VIIPER/viipertypes"
+	"github.com/Alia5/VIIPER/virtualbus"
+)
+
+func newServer() *usb.Server {
+	return usb.New(usb.ServerConfig{BusCleanupTimeout: time.Second}, slog.New(slog.DiscardHandler), nil)
+}
+
+func removeAll(t *testing.T, srv *usb.Server) {
+	t.Helper()
+	for _, id := range srv.ListBuses() {
+		require.NoError(t, srv.RemoveBus(id))
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	for i, ext := range []string{"json", "yaml", "toml"} {
+		t.Run(ext, func(t *testing.T) {
+			// Serials/MACs are unique process-wide, so each run uses its own.
+			serial := fmt.Sprintf("AABBCCDDEE%02X", 0xA0+i)
+			mac := fmt.Sprintf("11:22:33:44:55:%02X", 0xA0+i)
+
+			srv := newServer()
+			b, err := virtualbus.NewWithBusID(70001)
+			require.NoError(t, err)
+			require.NoError(t, srv.AddBus(b))
+
+			pad, err := xbox360.New(nil)
+			require.NoError(t, err)
+			_, err = b.Add(pad)
+			require.NoError(t, err)
+			ds, err := dualsense.NewEdge(nil)
+			require.NoError(t, err)
+			ds.SetMetaState(dualsense.MetaState{SerialNumber: serial, MACAddress: mac})
+			dsCtx, err := b.Add(ds)
+			require.NoError(t, err)
+			watchdogMs := uint32(250)
+			failsafe.Set(dsCtx, &viipertypes.FailsafePolicy{WatchdogMs: &watchdogMs})
+			// Leave a gap in the device IDs.
+			require.NoError(t, b.RemoveDeviceByID("1"))
+
+			path := filepath.Join(t.TempDir(), "state."+ext)
+			require.NoError(t, topology.Save(path, topology.Snapshot(srv)))
+			removeAll(t, srv)
+
+			st, err := topology.Load(path)
+			require.NoError(t, err)
+			restored := newServer()
+			defer removeAll(t, restored)
+			require.NoError(t, topology.Restore(restored, st, time.Minute, "", slog.New(slog.DiscardHandler)))
+
+			rb := restored.GetBus(70001)
+			require.NotNil(t, rb)
+			metas := rb.GetAllDeviceMetas()
+			require.Len(t, metas, 1)
+			assert.Equal(t, uint32(2), metas[0].Meta.DevID)
+			got, ok := metas[0].Dev.(*dualsense.DualSense)
+			require.True(t, ok)
+			assert.Equal(t, "dualsenseedge", got.DeviceType())
+			assert.Equal(t, ds.GetDescriptor().Device.IDProduct, got.GetDescriptor().Device.IDProduct)
+			args := got.GetDeviceSpecificArgs()
+			assert.Equal(t, serial, args["serial_number"])
+			assert.Equal(t, mac, args["mac_address"])
+			assert.Equal(t, &viipertypes.FailsafePolicy{WatchdogMs: &watchdogMs}, failsafe.Get(rb.GetDeviceContext(got)))
+		})
+	}
+}
+
+func TestRestoreErrors(t *testing.T) {
+	srv := newServer()
+	defer removeAll(t, srv)
+
+	st := &topology.State{Buses: []topology.Bus{{
+		ID: 70002,
+		Devices: []topology.Device{
+			{ID: 3, Type: "keyboard"},
+			{ID: 3, Type: "mouse"},
+			{Type: "nope"},
+		},
+	}}}
+	err := topology.Restore(srv, st, time.Minute, "", slog.New(slog.DiscardHandler))
+	assert.ErrorContains(t, err, "already allocated")
+	assert.ErrorContains(t, err, "unknown device type")
+	require.NotNil(t, srv.GetBus(70002))
+	assert.Len(t, srv.GetBus(70002).Devices(), 1)
+}
+
+func TestRestoreTimeout(t *testing.T) {
+	srv := newServer()
+	defer removeAll(t, srv)
+
+	st := &topology.State{Buses: []topology.Bus{{ID: 70003, Devices: []topology.Device{{ID: 1, Type: "keyboard"}}}}}
+	require.NoError(t, topology.Restore(srv, st, 50*time.Millisecond, "", slog.New(slog.DiscardHandler)))
+	assert.Eventually(t, func() bool {
+		b := srv.GetBus(70003)
+		return b == nil || len(b.Devices()) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestPersist(t *testing.T) {
+	srv := newServer()
+	defer removeAll(t, srv)
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := topology.Persist(ctx, srv, path, slog.New(slog.DiscardHandler))
+
+	b, err := virtualbus.NewWithBusID(70004)
+	require.NoError(t, err)
+	require.NoError(t, srv.AddBus(b))
+	kb, err := xbox360.New(nil)
+	require.NoError(t, err)
+	_, err = b.Add(kb)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		st, err := topology.Load(path)
+		return err == nil && len(st.Buses) == 1 && len(st.Buses[0].Devices) == 1
+	}, 2*time.Second, 20*time.Millisecond)
+
+	cancel()
+	<-done
+	st, err := topology.Load(path)
+	require.NoError(t, err)
+	require.Len(t, st.Buses, 1)
+	assert.Equal(t, uint32(70004), st.Buses[0].ID)
+	assert.Equal(t, "xbox360", st.Buses[0].Devices[0].Type)
+}
+
+func TestApplyProfile(t *testing.T) {
+	srv := newServer()
+	defer removeAll(t, srv)
+
+	path := filepath.Join(t.TempDir(), "profile.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+defaults:
+  xbox360:
+    subType: 7
+buses:
+  - id: 70005
+    devices:
+      - id: 4
+        type: xbox360
+      - type: xbox360
+        deviceSpecific:
+          subType: 8
+      - type: nope
+`), 0o644))
+
+	p, err := topology.LoadProfile(path)
+	require.NoError(t, err)
+	err = topology.ApplyProfile(srv, p, "", slog.New(slog.DiscardHandler))
+	assert.ErrorContains(t, err, "unknown device type")
+
+	b := srv.GetBus(70005)
+	require.NotNil(t, b)
+	metas := b.GetAllDeviceMetas()
+	require.Len(t, metas, 2)
+	subTypes := map[uint32]any{}
+	for _, m := range metas {
+		devCtx := b.GetDeviceContext(m.Dev)
+		assert.True(t, device.IsKeepAlive(devCtx))
+		assert.Nil(t, device.GetConnTimer(devCtx))
+		subTypes[m.Meta.DevID] = m.Dev.GetDeviceSpecificArgs()["subType"]
+	}
+	assert.EqualValues(t, 7, subTypes[4])
+	assert.EqualValues(t, 8, subTypes[1])
+
+	// Profile devices are not part of the persisted state.
+	assert.Empty(t, topology.Snapshot(srv).Buses)
+}
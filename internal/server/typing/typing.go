@@ -0,0 +1,127 @@
+// Package typing types text on keyboard devices server-side.
+//
+// Text sent to a device is queued and typed in order, one keystroke after the
+// other, so clients do not have to time key presses themselves.
+package typing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/device/keyboard"
+	"github.com/Alia5/VIIPER/usb"
+)
+
+// MaxPending is the number of keystrokes that may be pending on a device.
+const MaxPending = 16384
+
+// ErrQueueFull is returned by Type if the keystrokes would exceed MaxPending.
+var ErrQueueFull = errors.New("typing queue full")
+
+// Keyboard is a device accepting keyboard input states.
+type Keyboard interface {
+	usb.Device
+	UpdateInputState(state keyboard.InputState)
+}
+
+// Timing controls how fast text is typed.
+type Timing struct {
+	// Press is how long each key is held down.
+	Press time.Duration
+	// Delay is the pause after releasing a key.
+	Delay time.Duration
+}
+
+type job struct {
+	states []keyboard.InputState // press/release pairs
+	timing Timing
+}
+
+// queueKey keys the typing queue in the device attachments.
+type queueKey struct{}
+
+type queue struct {
+	mu      sync.Mutex
+	jobs    []job
+	pending int  // keystrokes not typed yet
+	running bool // a worker types the jobs
+}
+
+// Type queues states, press/release pairs as built by keyboard.Layout.TypeString,
+// to be typed on kb after everything queued before. The queue is kept in
+// devCtx, the device context; typing stops and the queue is dropped once it
+// is done.
+// It returns the number of keystrokes pending on kb, including these, or
+// ErrQueueFull with the number pending without them if they would exceed
+// MaxPending.
+func Type(devCtx context.Context, kb Keyboard, states []keyboard.InputState, t Timing) (int, error) {
+	q := device.GetAttachments(devCtx).LoadOrStore(queueKey{}, func() any { return &queue{} }).(*queue)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending+len(states)/2 > MaxPending {
+		return q.pending, ErrQueueFull
+	}
+	q.jobs = append(q.jobs, job{states: states, timing: t})
+	q.pending += len(states) / 2
+	if !q.running {
+		q.running = true
+		go run(devCtx, kb, q)
+	}
+	return q.pending, nil
+}
+
+// Pending returns the number of keystrokes queued in the device context
+// devCtx and not typed yet.
+func Pending(devCtx context.Context) int {
+	q, ok := device.GetAttachments(devCtx).Load(queueKey{}).(*queue)
+	if !ok {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending
+}
+
+func run(ctx context.Context, kb Keyboard, q *queue) {
+	for {
+		q.mu.Lock()
+		if ctx.Err() != nil {
+			q.jobs, q.pending = nil, 0
+		}
+		if len(q.jobs) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		j := q.jobs[0]
+		q.jobs = q.jobs[1:]
+		q.mu.Unlock()
+
+		for i := 0; i+1 < len(j.states); i += 2 {
+			kb.UpdateInputState(j.states[i])
+			pressed := sleep(ctx, j.timing.Press)
+			kb.UpdateInputState(j.states[i+1])
+			q.mu.Lock()
+			q.pending--
+			q.mu.Unlock()
+			if !pressed || !sleep(ctx, j.timing.Delay) {
+				break
+			}
+		}
+	}
+}
+
+// sleep waits for d and reports false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
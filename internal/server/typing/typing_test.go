@@ -0,0 +1,101 @@
+package typing
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/device/keyboard"
+	"github.com/Alia5/VIIPER/usb"
+)
+
+type recorder struct {
+	usb.Device
+	mu     sync.Mutex
+	states []keyboard.InputState
+}
+
+func (r *recorder) UpdateInputState(st keyboard.InputState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states = append(r.states, st)
+}
+
+func (r *recorder) typed() []keyboard.InputState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]keyboard.InputState(nil), r.states...)
+}
+
+// running reports whether a queue worker runs for the device of devCtx.
+func running(devCtx context.Context) bool {
+	q, ok := device.GetAttachments(devCtx).Load(queueKey{}).(*queue)
+	if !ok {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.running
+}
+
+func TestType(t *testing.T) {
+	kb := &recorder{}
+	us, _ := keyboard.LookupLayout("us")
+	hi, err := us.TypeString("hi")
+	require.NoError(t, err)
+	bang, err := us.TypeString("!")
+	require.NoError(t, err)
+
+	ctx := device.WithAttachments(context.Background())
+	timing := Timing{Press: 5 * time.Millisecond, Delay: 5 * time.Millisecond}
+	pending, err := Type(ctx, kb, hi, timing)
+	require.NoError(t, err)
+	assert.Equal(t, 2, pending)
+	pending, err = Type(ctx, kb, bang, timing)
+	require.NoError(t, err)
+	assert.Equal(t, 3, pending, "queued after the running text")
+	assert.Equal(t, 0, Pending(device.WithAttachments(context.Background())), "queues are per device")
+
+	require.Eventually(t, func() bool { return !running(ctx) }, time.Second, time.Millisecond)
+	assert.Equal(t, 0, Pending(ctx))
+	assert.Equal(t, append(hi, bang...), kb.typed())
+}
+
+func TestTypeQueueFull(t *testing.T) {
+	kb := &recorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = device.WithAttachments(ctx)
+	timing := Timing{Press: time.Hour}
+
+	pending, err := Type(ctx, kb, make([]keyboard.InputState, 2*MaxPending), timing)
+	require.NoError(t, err)
+	assert.Equal(t, MaxPending, pending)
+	pending, err = Type(ctx, kb, make([]keyboard.InputState, 2), timing)
+	assert.ErrorIs(t, err, ErrQueueFull)
+	assert.Equal(t, MaxPending, pending)
+	assert.Equal(t, MaxPending, Pending(ctx), "rejected keystrokes are not queued")
+}
+
+func TestTypeCancel(t *testing.T) {
+	kb := &recorder{}
+	us, _ := keyboard.LookupLayout("us")
+	states, err := us.TypeString("hello")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = device.WithAttachments(ctx)
+	_, err = Type(ctx, kb, states, Timing{Press: time.Hour})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(kb.typed()) == 1 }, time.Second, time.Millisecond)
+	cancel()
+
+	require.Eventually(t, func() bool { return !running(ctx) }, time.Second, time.Millisecond)
+	assert.Equal(t, 0, Pending(ctx))
+	assert.Equal(t, states[:2], kb.typed(), "the held key is released")
+}
@@ -0,0 +1,75 @@
+package usb
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Alia5/VIIPER/viipertypes"
+	"github.com/Alia5/VIIPER/virtualbus"
+)
+
+// eventHub fans out lifecycle events to subscribers.
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[chan viipertypes.Event]struct{}
+}
+
+// SubscribeEvents returns a channel receiving all bus/device lifecycle events
+// and a function to end the subscription.
+// Subscribers that fall more than bufSize events behind are dropped; their
+// channel is closed.
+func (s *Server) SubscribeEvents(bufSize int) (<-chan viipertypes.Event, func()) {
+	ch := make(chan viipertypes.Event, bufSize)
+	s.events.mu.Lock()
+	if s.events.subs == nil {
+		s.events.subs = map[chan viipertypes.Event]struct{}{}
+	}
+	s.events.subs[ch] = struct{}{}
+	s.events.mu.Unlock()
+
+	return ch, func() {
+		s.events.mu.Lock()
+		defer s.events.mu.Unlock()
+		if _, ok := s.events.subs[ch]; ok {
+			delete(s.events.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (s *Server) publish(ev viipertypes.Event) {
+	ev.Timestamp = time.Now().UnixMilli()
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	for ch := range s.events.subs {
+		select {
+		case ch <- ev:
+		default:
+			s.logger.Warn("event subscriber too slow, dropping subscription")
+			delete(s.events.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// PublishDeviceUpdated announces that the meta state of a device changed.
+func (s *Server) PublishDeviceUpdated(busID uint32, devID string) {
+	s.publish(viipertypes.Event{
+		Type:  viipertypes.EventDeviceUpdated,
+		BusID: busID,
+		DevID: devID,
+	})
+}
+
+func (s *Server) publishDeviceChange(meta virtualbus.DeviceMeta, added bool) {
+	evType := viipertypes.EventDeviceRemoved
+	if added {
+		evType = viipertypes.EventDeviceAdded
+	}
+	s.publish(viipertypes.Event{
+		Type:  evType,
+		BusID: meta.Meta.BusID,
+		DevID: fmt.Sprintf("%d", meta.Meta.DevID),
+	})
+}
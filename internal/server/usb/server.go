@@ -18,8 +18,10 @@ import (
 	"time"
 
 	"github.com/Alia5/VIIPER/internal/log"
+	"github.com/Alia5/VIIPER/internal/pcap"
 	"github.com/Alia5/VIIPER/usb"
 	"github.com/Alia5/VIIPER/usbip"
+	"github.com/Alia5/VIIPER/viipertypes"
 	"github.com/Alia5/VIIPER/virtualbus"
 )
 
@@ -127,6 +129,8 @@ const (
 	usbReqSetDescriptor    = 0x07
 	usbReqGetConfiguration = 0x08
 	usbReqSetConfiguration = 0x09
+	usbReqGetInterface     = 0x0A
+	usbReqSetInterface     = 0x0B
 
 	// USB descriptor types
 	usbDescTypeDevice        = 0x01
@@ -138,6 +142,8 @@ const (
 	// USB request types (bmRequestType)
 	usbReqTypeStandardToDevice    = 0x00
 	usbReqTypeStandardToInterface = 0x81
+	usbReqTypeStandardOutIface    = 0x01
+	usbReqTypeDirIn               = 0x80
 	usbReqTypeStandardFromDevice  = 0x80
 	usbReqTypeMask                = 0x60
 	usbReqTypeClass               = 0x20
@@ -157,6 +163,9 @@ const (
 	hidReqTypeIn  = 0xA1
 	hidReqTypeOut = 0x21
 
+	// HID report types (wValue high byte of GET_REPORT/SET_REPORT)
+	hidReportTypeInput = 0x01
+
 	// wIndex low-byte interface selector mask.
 	usbIfaceIndexMask = 0x00FF
 
@@ -166,36 +175,36 @@ const (
 	usbConfigMaxPower100mA  = 50 // In units of 2mA
 
 	// URB header field offsets
-	urbHdrSize          = 0x30
-	urbHdrOffsetCommand = 0x00
-	urbHdrOffsetSeqnum  = 0x04
-	urbHdrOffsetDevid   = 0x08
-	urbHdrOffsetDir     = 0x0c
-	urbHdrOffsetEp      = 0x10
-	urbHdrOffsetUnlink  = 0x14
-	urbHdrOffsetFlags   = 0x14
-	urbHdrOffsetLength  = 0x18
-	urbHdrOffsetSetup   = 0x28
+	urbHdrSize             = 0x30
+	urbHdrOffsetCommand    = 0x00
+	urbHdrOffsetSeqnum     = 0x04
+	urbHdrOffsetDevid      = 0x08
+	urbHdrOffsetDir        = 0x0c
+	urbHdrOffsetEp         = 0x10
+	urbHdrOffsetUnlink     = 0x14
+	urbHdrOffsetFlags      = 0x14
+	urbHdrOffsetLength     = 0x18
+	urbHdrOffsetNumPackets = 0x20
+	urbHdrOffsetSetup      = 0x28
 
 	// Standard header peek size
 	headerPeekSize = 8
 
 	// BUSID buffer size for import
 	busIDSize = 32
-
-	// Error codes
-	errConnReset = -104 // -ECONNRESET
 )
 
 type Server struct {
 	config    *ServerConfig
 	logger    *slog.Logger
 	rawLogger log.RawLogger
+	capture   *pcap.Writer
 	busses    map[uint32]*virtualbus.VirtualBus
 	busesMu   sync.Mutex
 	ready     chan struct{}
 	readyOnce sync.Once
 	ln        net.Listener
+	events    eventHub
 }
 
 func New(config ServerConfig, logger *slog.Logger, rawLogger log.RawLogger) *Server {
@@ -208,6 +217,12 @@ func New(config ServerConfig, logger *slog.Logger, rawLogger log.RawLogger) *Ser
 	}
 }
 
+// SetCapture writes the URBs of all following connections to w.
+// Must be called before ListenAndServe.
+func (s *Server) SetCapture(w *pcap.Writer) {
+	s.capture = w
+}
+
 // AddBus registers a bus with the server. If the bus number is already present,
 // an error is returned.
 func (s *Server) AddBus(bus *virtualbus.VirtualBus) error {
@@ -220,6 +235,8 @@ func (s *Server) AddBus(bus *virtualbus.VirtualBus) error {
 		return fmt.Errorf("bus %d already registered", bus.BusID())
 	}
 	s.busses[bus.BusID()] = bus
+	bus.OnDeviceChange(s.publishDeviceChange)
+	s.publish(viipertypes.Event{Type: viipertypes.EventBusAdded, BusID: bus.BusID()})
 	return nil
 }
 
@@ -246,6 +263,8 @@ func (s *Server) RemoveBus(busID uint32) error {
 	delete(s.busses, busID)
 	s.busesMu.Unlock()
 
+	bus.OnDeviceChange(nil)
+	s.publish(viipertypes.Event{Type: viipertypes.EventBusRemoved, BusID: busID})
 	return bus.Close()
 }
 
@@ -402,7 +421,7 @@ func (s *Server) GetListenPort() uint16 {
 
 func (s *Server) handleConn(conn net.Conn) error {
 	defer conn.Close() //nolint:errcheck
-	conn = &logConn{Conn: conn, s: s}
+	conn = &logConn{Conn: conn, s: s, capture: s.capture.NewStream()}
 	if err := conn.SetDeadline(time.Now().Add(s.config.ConnectionTimeout)); err != nil {
 		s.logger.Warn("Failed to set deadline", "error", err)
 	}
@@ -423,10 +442,21 @@ func (s *Server) handleConn(conn net.Conn) error {
 			return s.handleDevList(conn)
 		case usbip.OpReqImport:
 			s.logger.Info("OP_REQ_IMPORT")
-			dev, err := s.handleImport(conn)
+			dev, meta, err := s.handleImport(conn)
 			if err != nil {
 				return fmt.Errorf("handle import: %w", err)
 			}
+			ev := viipertypes.Event{
+				BusID:  meta.BusID,
+				DevID:  fmt.Sprintf("%d", meta.DevID),
+				Remote: conn.RemoteAddr().String(),
+			}
+			ev.Type = viipertypes.EventDeviceAttached
+			s.publish(ev)
+			defer func() {
+				ev.Type = viipertypes.EventDeviceDetached
+				s.publish(ev)
+			}()
 			return s.handleUrbStream(conn, dev)
 		}
 	}
@@ -476,10 +506,10 @@ func (s *Server) handleDevList(conn net.Conn) error {
 	return nil
 }
 
-func (s *Server) handleImport(conn net.Conn) (usb.Device, error) {
+func (s *Server) handleImport(conn net.Conn) (usb.Device, *usbip.ExportMeta, error) {
 	var rest [busIDSize]byte
 	if err := usbip.ReadExactly(conn, rest[:]); err != nil {
-		return nil, fmt.Errorf("read import busid: %w", err)
+		return nil, nil, fmt.Errorf("read import busid: %w", err)
 	}
 	reqBus := string(rest[:bytes.IndexByte(rest[:], 0)])
 	s.logger.Info("Import request", "busid", reqBus)
@@ -498,7 +528,7 @@ func (s *Server) handleImport(conn net.Conn) (usb.Device, error) {
 		}
 	}
 	if chosen == nil || chosenMeta == nil || chosenDesc == nil {
-		return nil, fmt.Errorf("no device matches busid %s", reqBus)
+		return nil, nil, fmt.Errorf("no device matches busid %s", reqBus)
 	}
 	var buf bytes.Buffer
 	rep := usbip.MgmtHeader{Version: usbip.Version, Command: usbip.OpRepImport, Status: 0}
@@ -525,9 +555,9 @@ func (s *Server) handleImport(conn net.Conn) (usb.Device, error) {
 	}
 	_ = exp.WriteImport(&buf)
 	if _, err := conn.Write(buf.Bytes()); err != nil {
-		return nil, fmt.Errorf("write import reply failed: %w", err)
+		return nil, nil, fmt.Errorf("write import reply failed: %w", err)
 	}
-	return chosen, nil
+	return chosen, chosenMeta, nil
 }
 
 // getAllDeviceMetas aggregates device metas from all registered busses.
@@ -543,7 +573,8 @@ func (s *Server) getAllDeviceMetas() []virtualbus.DeviceMeta {
 
 type logConn struct {
 	net.Conn
-	s *Server
+	s       *Server
+	capture *pcap.Stream
 }
 
 func (lc *logConn) Read(p []byte) (int, error) {
@@ -551,6 +582,7 @@ func (lc *logConn) Read(p []byte) (int, error) {
 	if n > 0 && lc.s.rawLogger != nil {
 		lc.s.rawLogger.Log(true, p[:n])
 	}
+	lc.capture.Feed(true, p[:n])
 	return n, err
 }
 
@@ -559,6 +591,7 @@ func (lc *logConn) Write(p []byte) (int, error) {
 	if n > 0 && lc.s.rawLogger != nil {
 		lc.s.rawLogger.Log(false, p[:n])
 	}
+	lc.capture.Feed(false, p[:n])
 	return n, err
 }
 
@@ -597,16 +630,22 @@ func (s *Server) handleUrbStream(conn net.Conn, dev usb.Device) error {
 	var writeMu sync.Mutex
 	var retOut bytes.Buffer
 	retOut.Grow(retSubmitHeaderSize)
-	writeRet := func(seq, actualLen uint32, respData []byte, flush bool) error {
+	writeRet := func(seq uint32, status int32, actualLen uint32, respData []byte, iso []usbip.IsoPacketDescriptor, flush bool) error {
 		writeMu.Lock()
 		defer writeMu.Unlock()
+		var errorCount uint32
+		for _, d := range iso {
+			if d.Status != usb.StatusOK {
+				errorCount++
+			}
+		}
 		ret := usbip.RetSubmit{
 			Basic:           usbip.HeaderBasic{Command: usbip.RetSubmitCode, Seqnum: seq, Devid: 0, Dir: 0, Ep: 0},
-			Status:          0,
+			Status:          status,
 			ActualLength:    actualLen,
 			StartFrame:      0,
-			NumberOfPackets: 0,
-			ErrorCount:      0,
+			NumberOfPackets: uint32(len(iso)),
+			ErrorCount:      errorCount,
 		}
 		retOut.Reset()
 		if err := ret.Write(&retOut); err != nil {
@@ -620,6 +659,11 @@ func (s *Server) handleUrbStream(conn net.Conn, dev usb.Device) error {
 				return fmt.Errorf("write RET_SUBMIT payload: %w", err)
 			}
 		}
+		if len(iso) > 0 {
+			if err := usbip.WriteIsoPacketDescriptors(writer, iso); err != nil {
+				return fmt.Errorf("write RET_SUBMIT iso packets: %w", err)
+			}
+		}
 		if flush && bw != nil {
 			if err := bw.Flush(); err != nil {
 				return fmt.Errorf("flush response: %w", err)
@@ -642,6 +686,8 @@ func (s *Server) handleUrbStream(conn net.Conn, dev usb.Device) error {
 	lastInResp := map[uint32][]byte{}
 
 	var outPayloadScratch []byte
+	// Completion time of the last queued isochronous URB per endpoint address.
+	isoNext := map[uint32]time.Time{}
 
 	for {
 		select {
@@ -698,10 +744,10 @@ func (s *Server) handleUrbStream(conn net.Conn, dev usb.Device) error {
 			pendingMu.Unlock()
 			// -ECONNRESET signals the URB was unlinked before completion;
 			// status 0 means it already completed normally.
-			status := int32(0)
+			status := usb.StatusOK
 			if found {
 				cancel()
-				status = errConnReset
+				status = usb.StatusConnReset
 			}
 			ret := usbip.RetUnlink{Basic: usbip.HeaderBasic{Command: usbip.RetUnlinkCode, Seqnum: seq, Devid: 0, Dir: 0, Ep: 0}, Status: status}
 			writeMu.Lock()
@@ -730,28 +776,97 @@ func (s *Server) handleUrbStream(conn net.Conn, dev usb.Device) error {
 			}
 		}
 
+		numPackets := binary.BigEndian.Uint32(hdr[urbHdrOffsetNumPackets : urbHdrOffsetNumPackets+4])
+		if ep != 0 && usbip.IsIsochronous(numPackets) {
+			iso, err := usbip.ReadIsoPacketDescriptors(conn, numPackets)
+			if err != nil {
+				return fmt.Errorf("read iso packet descriptors: %w", err)
+			}
+
+			// Iso URBs complete one packet per service interval, back to back,
+			// like on a real bus. The data itself is exchanged right away.
+			epAddr := ep
+			if dir == usbip.DirIn {
+				epAddr |= 0x80
+			}
+			due := time.Now()
+			if next := isoNext[epAddr]; next.After(due) {
+				due = next
+			}
+			due = due.Add(time.Duration(numPackets) * isoPacketInterval(dev.GetDescriptor(), epAddr))
+			isoNext[epAddr] = due
+
+			urbCtx, urbCancel := context.WithCancel(ctx)
+			pendingMu.Lock()
+			pending[seq] = urbCancel
+			pendingMu.Unlock()
+
+			respData, xferErr := s.processIsoSubmit(urbCtx, dev, ep, dir, iso, xferLen, outPayload)
+			status := usb.TransferStatus(xferErr)
+			if status != usb.StatusOK {
+				s.logger.Debug("iso URB failed", "seq", seq, "ep", ep, "status", status, "error", xferErr)
+			}
+			var actualLen uint32
+			for _, d := range iso {
+				actualLen += d.ActualLength
+			}
+
+			go func(seq uint32) {
+				defer urbCancel()
+				timer := time.NewTimer(time.Until(due))
+				defer timer.Stop()
+				select {
+				case <-urbCtx.Done():
+					return
+				case <-timer.C:
+				}
+
+				pendingMu.Lock()
+				delete(pending, seq)
+				pendingMu.Unlock()
+
+				if err := writeRet(seq, status, actualLen, respData, iso, true); err != nil {
+					if isClientDisconnect(err) {
+						s.logger.Debug("URB completion after disconnect", "seq", seq, "error", err)
+					} else {
+						s.logger.Error("write iso RET_SUBMIT", "seq", seq, "error", err)
+					}
+				}
+			}(seq)
+			continue
+		}
+
 		if dir == usbip.DirIn && ep != 0 {
 			urbCtx, urbCancel := context.WithCancel(ctx)
 			pendingMu.Lock()
 			pending[seq] = urbCancel
 			pendingMu.Unlock()
 			interval := endpointInterval(dev.GetDescriptor(), ep)
+			replay := true
+			if md, ok := dev.(usb.MessageEndpointDevice); ok && md.IsMessageEndpoint(ep) {
+				replay = false
+			}
 
-			go func(seq, ep, dir uint32) {
+			go func(seq, ep, dir, xferLen uint32) {
 				defer urbCancel()
 				var respData []byte
+				var xferErr error
 				for {
 					attemptCtx, attemptCancel := urbCtx, context.CancelFunc(func() {})
 					if interval > 0 {
 						attemptCtx, attemptCancel = context.WithTimeout(urbCtx, interval)
 					}
-					respData = s.processSubmit(attemptCtx, dev, ep, dir, nil, nil)
-					expired := respData == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded)
+					respData, xferErr = s.processSubmit(attemptCtx, dev, ep, dir, nil, nil)
+					expired := respData == nil && xferErr == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded)
 					attemptCancel()
 
 					if urbCtx.Err() != nil {
 						return
 					}
+					if xferErr != nil {
+						respData = nil
+						break
+					}
 					if respData != nil {
 						respMu.Lock()
 						lastInResp[ep] = append([]byte(nil), respData...)
@@ -762,7 +877,7 @@ func (s *Server) handleUrbStream(conn net.Conn, dev usb.Device) error {
 						respMu.Lock()
 						cached, ok := lastInResp[ep]
 						respMu.Unlock()
-						if ok {
+						if ok && replay {
 							respData = cached
 							break
 						}
@@ -776,24 +891,40 @@ func (s *Server) handleUrbStream(conn net.Conn, dev usb.Device) error {
 				delete(pending, seq)
 				pendingMu.Unlock()
 
-				if err := writeRet(seq, uint32(len(respData)), respData, true); err != nil {
+				status := usb.TransferStatus(xferErr)
+				if uint32(len(respData)) > xferLen {
+					s.logger.Debug("IN transfer overflow", "seq", seq, "ep", ep, "len", len(respData), "xferLen", xferLen)
+					respData = respData[:xferLen]
+					status = usb.StatusOverflow
+				}
+				if status != usb.StatusOK {
+					s.logger.Debug("URB failed", "seq", seq, "ep", ep, "status", status, "error", xferErr)
+				}
+
+				if err := writeRet(seq, status, uint32(len(respData)), respData, nil, true); err != nil {
 					if isClientDisconnect(err) {
 						s.logger.Debug("URB completion after disconnect", "seq", seq, "error", err)
 					} else {
 						s.logger.Error("write async RET_SUBMIT", "seq", seq, "error", err)
 					}
 				}
-			}(seq, ep, dir)
+			}(seq, ep, dir, xferLen)
 			continue
 		}
 
 		// EP0 and OUT transfers never block and are handled in order.
-		respData := s.processSubmit(ctx, dev, ep, dir, setup, outPayload)
+		respData, xferErr := s.processSubmit(ctx, dev, ep, dir, setup, outPayload)
+		status := usb.TransferStatus(xferErr)
 		actualLen := uint32(len(respData))
 		if dir == usbip.DirOut {
 			actualLen = uint32(len(outPayload))
 		}
-		if err := writeRet(seq, actualLen, respData, ep == 0); err != nil {
+		if status != usb.StatusOK {
+			s.logger.Debug("URB failed", "seq", seq, "ep", ep, "status", status, "error", xferErr)
+			respData = nil
+			actualLen = 0
+		}
+		if err := writeRet(seq, status, actualLen, respData, nil, ep == 0); err != nil {
 			return err
 		}
 	}
@@ -812,6 +943,25 @@ func endpointInterval(desc *usb.Descriptor, ep uint32) time.Duration {
 	return 0
 }
 
+// isoPacketInterval returns the service interval of the isochronous endpoint
+// epAddr, i.e. the bus time one packet of an iso URB takes.
+func isoPacketInterval(desc *usb.Descriptor, epAddr uint32) time.Duration {
+	frame := time.Millisecond
+	if desc.Device.Speed >= 3 {
+		frame = 125 * time.Microsecond // high speed microframes
+	}
+	for i := range desc.Interfaces {
+		for _, epDesc := range desc.Interfaces[i].Endpoints {
+			if uint32(epDesc.BEndpointAddress) != epAddr || epDesc.BMAttributes&0x03 != 0x01 {
+				continue
+			}
+			// bInterval is an exponent for iso endpoints: 2^(bInterval-1) frames.
+			return frame << (min(max(epDesc.BInterval, 1), 16) - 1)
+		}
+	}
+	return frame
+}
+
 // isClientDisconnect tests whether an error represents a normal client
 // disconnect (EOF, ECONNRESET, broken pipe, or the Windows WSAECONNRESET
 // translated error). We treat those as normal client disconnects and log
@@ -839,13 +989,21 @@ func isClientDisconnect(err error) bool {
 	return false
 }
 
-func (s *Server) processSubmit(ctx context.Context, dev usb.Device, ep uint32, dir uint32, setup []byte, out []byte) []byte {
+// processSubmit handles a single CMD_SUBMIT. The returned error is reported to
+// the host as the URB status (see usb.TransferStatus); control requests nobody
+// handles are answered with a STALL. HID GET_REPORT(Input) requests are
+// answered with the current input report of devices implementing
+// usb.InputReportDevice.
+func (s *Server) processSubmit(ctx context.Context, dev usb.Device, ep uint32, dir uint32, setup []byte, out []byte) ([]byte, error) {
 	if ep != 0 {
-		return dev.HandleTransfer(ctx, ep, dir, out)
+		if td, ok := dev.(usb.TransferStatusDevice); ok {
+			return td.HandleTransferStatus(ctx, ep, dir, out)
+		}
+		return dev.HandleTransfer(ctx, ep, dir, out), nil
 	}
 	if len(setup) != 8 {
 		s.logger.Debug("EP0 submit with invalid setup size", "setupLen", len(setup), "setup", setup)
-		return nil
+		return nil, usb.ErrStall
 	}
 	bm := setup[0]
 	breq := setup[1]
@@ -854,16 +1012,16 @@ func (s *Server) processSubmit(ctx context.Context, dev usb.Device, ep uint32, d
 	wLength := binary.LittleEndian.Uint16(setup[6:8])
 
 	if breq == usbReqGetStatus {
-		return []byte{0x00, 0x00}
+		return []byte{0x00, 0x00}, nil
 	}
 	if breq == usbReqSetAddress && bm == usbReqTypeStandardToDevice {
-		return nil
+		return nil, nil
 	}
 	if breq == usbReqSetConfiguration && bm == usbReqTypeStandardToDevice {
-		return nil
+		return nil, nil
 	}
 	if breq == usbReqGetConfiguration && bm == usbReqTypeStandardFromDevice {
-		return []byte{0x01}
+		return []byte{0x01}, nil
 	}
 
 	desc := dev.GetDescriptor()
@@ -885,12 +1043,9 @@ func (s *Server) processSubmit(ctx context.Context, dev usb.Device, ep uint32, d
 			}
 		}
 		if len(data) == 0 {
-			return nil
+			return nil, usb.ErrStall
 		}
-		if int(wLength) < len(data) {
-			return data[:wLength]
-		}
-		return data
+		return truncate(data, wLength), nil
 	}
 
 	if desc.MicrosoftOS10 != nil &&
@@ -898,10 +1053,7 @@ func (s *Server) processSubmit(ctx context.Context, dev usb.Device, ep uint32, d
 		(breq == desc.MicrosoftOS10.EffectiveVendorCode() ||
 			wIndex == 0x0004 || wIndex == 0x0005) {
 		if data, ok := desc.MicrosoftOS10.ControlResponse(wValue, wIndex); ok {
-			if int(wLength) < len(data) {
-				return data[:wLength]
-			}
-			return data
+			return truncate(data, wLength), nil
 		}
 	}
 
@@ -916,14 +1068,14 @@ func (s *Server) processSubmit(ctx context.Context, dev usb.Device, ep uint32, d
 					d, err := ifaceConf.HID.DescriptorBytes()
 					if err != nil {
 						s.logger.Error("failed to build HID descriptor", "iface", iface, "error", err)
-						return nil
+						return nil, usb.ErrStall
 					}
 					data = []byte(d)
 				case usbDescTypeHIDReport:
 					d, err := ifaceConf.HID.ReportBytes()
 					if err != nil {
 						s.logger.Error("failed to build HID report descriptor", "iface", iface, "error", err)
-						return nil
+						return nil, usb.ErrStall
 					}
 					data = []byte(d)
 				}
@@ -938,23 +1090,39 @@ func (s *Server) processSubmit(ctx context.Context, dev usb.Device, ep uint32, d
 			}
 		}
 		if len(data) == 0 {
-			return nil
+			return nil, usb.ErrStall
 		}
-		if int(wLength) < len(data) {
-			return data[:wLength]
-		}
-		return data
+		return truncate(data, wLength), nil
 	}
 
-	if cd, ok := dev.(usb.ControlDevice); ok {
+	if cd, ok := dev.(usb.ControlStatusDevice); ok {
+		if resp, handled, err := cd.HandleControlStatus(bm, breq, wValue, wIndex, wLength, out); handled {
+			if err != nil {
+				return nil, err
+			}
+			return truncate(resp, wLength), nil
+		}
+	} else if cd, ok := dev.(usb.ControlDevice); ok {
 		if resp, handled := cd.HandleControl(bm, breq, wValue, wIndex, wLength, out); handled {
-			if resp == nil {
-				return nil
+			return truncate(resp, wLength), nil
+		}
+	}
+
+	if bm&usbReqTypeMask == 0 {
+		switch {
+		case (breq == usbReqClearFeature || breq == usbReqSetFeature) && bm&usbReqTypeDirIn == 0:
+			return nil, nil
+		case breq == usbReqGetInterface && bm == usbReqTypeStandardToInterface:
+			if _, ok := desc.Interface(uint8(wIndex & usbIfaceIndexMask)); ok {
+				return []byte{0x00}, nil
 			}
-			if int(wLength) < len(resp) {
-				return resp[:wLength]
+		case breq == usbReqSetInterface && bm == usbReqTypeStandardOutIface:
+			for _, iface := range desc.Interfaces {
+				if uint16(iface.Descriptor.BInterfaceNumber) == wIndex&usbIfaceIndexMask &&
+					uint16(iface.Descriptor.BAlternateSetting) == wValue {
+					return nil, nil
+				}
 			}
-			return resp
 		}
 	}
 
@@ -962,24 +1130,75 @@ func (s *Server) processSubmit(ctx context.Context, dev usb.Device, ep uint32, d
 		if desc.Interfaces[iface].Descriptor.BInterfaceClass == usbInterfaceClassHID {
 			switch {
 			case bm == hidReqTypeIn && breq == hidReqGetIdle:
-				return []byte{0x00}
+				return []byte{0x00}, nil
 			case bm == hidReqTypeOut && breq == hidReqSetIdle:
-				return nil
+				return nil, nil
 			case bm == hidReqTypeIn && breq == hidReqGetProtocol:
-				return []byte{0x01}
+				return []byte{0x01}, nil
 			case bm == hidReqTypeOut && breq == hidReqSetProtocol:
-				return nil
-			case (bm == hidReqTypeIn || bm == hidReqTypeOut) && (breq == hidReqGetReport || breq == hidReqSetReport):
-				return nil
+				return nil, nil
+			case bm == hidReqTypeOut && breq == hidReqSetReport:
+				return nil, nil
+			case bm == hidReqTypeIn && breq == hidReqGetReport && wValue>>8 == hidReportTypeInput:
+				if rd, ok := dev.(usb.InputReportDevice); ok {
+					if report := rd.GetInputReport(uint8(iface), uint8(wValue)); report != nil {
+						return truncate(report, wLength), nil
+					}
+				}
 			}
 		}
 	}
 
-	if (bm & usbReqTypeMask) != usbReqTypeClass {
-		s.logger.Debug("EP0 control unhandled", "bmRequestType", bm, "bRequest", breq, "wValue", wValue, "wIndex", wIndex, "wLength", wLength)
+	s.logger.Debug("EP0 control unhandled, stalling", "bmRequestType", bm, "bRequest", breq, "wValue", wValue, "wIndex", wIndex, "wLength", wLength)
+	return nil, usb.ErrStall
+}
+
+// processIsoSubmit handles an isochronous CMD_SUBMIT. It stores the result of
+// every packet in iso and returns the packed IN payload of the RET_SUBMIT.
+func (s *Server) processIsoSubmit(ctx context.Context, dev usb.Device, ep uint32, dir uint32, iso []usbip.IsoPacketDescriptor, xferLen uint32, out []byte) ([]byte, error) {
+	for i := range iso {
+		iso[i].ActualLength = 0
+		iso[i].Status = usb.StatusOK
+	}
+	idev, ok := dev.(usb.IsochronousDevice)
+	if !ok {
+		return nil, usb.ErrStall
 	}
 
-	return nil
+	packets := make([]usb.IsoPacket, len(iso))
+	for i, d := range iso {
+		if uint64(d.Offset)+uint64(d.Length) > uint64(xferLen) {
+			return nil, usb.ErrProtocol
+		}
+		packets[i] = usb.IsoPacket{Offset: d.Offset, Length: d.Length}
+	}
+	buf := out
+	if dir == usbip.DirIn {
+		buf = make([]byte, xferLen)
+	}
+	if err := idev.HandleIsochronous(ctx, ep, dir, packets, buf); err != nil {
+		return nil, err
+	}
+
+	for i, p := range packets {
+		iso[i].Status = p.Status
+		iso[i].ActualLength = min(p.ActualLength, p.Length)
+		if p.ActualLength > p.Length {
+			iso[i].Status = usb.StatusOverflow
+		}
+	}
+	if dir == usbip.DirIn {
+		return usbip.PackIsoData(buf, iso), nil
+	}
+	return nil, nil
+}
+
+// truncate limits a control IN data stage to wLength bytes.
+func truncate(data []byte, wLength uint16) []byte {
+	if data != nil && int(wLength) < len(data) {
+		return data[:wLength]
+	}
+	return data
 }
 
 func (s *Server) buildConfigDescriptor(desc *usb.Descriptor) []byte {
@@ -0,0 +1,315 @@
+package usb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	usbdesc "github.com/Alia5/VIIPER/usb"
+	"github.com/Alia5/VIIPER/usbip"
+	"github.com/Alia5/VIIPER/virtualbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type statusDevice struct {
+	desc usbdesc.Descriptor
+}
+
+func (d *statusDevice) HandleTransfer(ctx context.Context, ep uint32, dir uint32, out []byte) []byte {
+	return nil
+}
+
+func (d *statusDevice) HandleTransferStatus(ctx context.Context, ep uint32, dir uint32, out []byte) ([]byte, error) {
+	if ep == 2 {
+		return nil, usbdesc.ErrStall
+	}
+	return []byte{0x01}, nil
+}
+
+func (d *statusDevice) HandleControlStatus(bmRequestType, bRequest uint8, wValue, wIndex, wLength uint16, data []byte) ([]byte, bool, error) {
+	switch {
+	case bmRequestType == 0xC0 && bRequest == 0x01:
+		return []byte{0xAA, 0xBB, 0xCC}, true, nil
+	case bmRequestType == 0xC0 && bRequest == 0x02:
+		return nil, true, usbdesc.ErrTimeout
+	}
+	return nil, false, nil
+}
+
+func (d *statusDevice) GetDescriptor() *usbdesc.Descriptor    { return &d.desc }
+func (d *statusDevice) GetDeviceSpecificArgs() map[string]any { return nil }
+
+func TestProcessSubmitStatus(t *testing.T) {
+	dev := &statusDevice{desc: usbdesc.Descriptor{
+		Interfaces: []usbdesc.InterfaceConfig{
+			{Descriptor: usbdesc.InterfaceDescriptor{BInterfaceNumber: 0, BInterfaceClass: 0x03}},
+		},
+		Strings: map[uint8]string{0: "Љ"},
+	}}
+	s := &Server{logger: slog.New(slog.DiscardHandler)}
+
+	type testCase struct {
+		name       string
+		ep         uint32
+		dir        uint32
+		setup      []byte
+		wantResp   []byte
+		wantStatus int32
+	}
+
+	cases := []testCase{
+		{name: "interrupt IN", ep: 1, dir: usbip.DirIn, wantResp: []byte{0x01}},
+		{name: "halted endpoint", ep: 2, dir: usbip.DirIn, wantStatus: usbdesc.StatusStall},
+		{name: "invalid setup", setup: []byte{0x80}, wantStatus: usbdesc.StatusStall},
+		{name: "unknown string", setup: []byte{0x80, 0x06, 0x05, 0x03, 0x00, 0x00, 0xFF, 0x00}, wantStatus: usbdesc.StatusStall},
+		{name: "device qualifier", setup: []byte{0x80, 0x06, 0x00, 0x06, 0x00, 0x00, 0x0A, 0x00}, wantStatus: usbdesc.StatusStall},
+		{name: "vendor request handled", setup: []byte{0xC0, 0x01, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00}, wantResp: []byte{0xAA, 0xBB}},
+		{name: "vendor request error", setup: []byte{0xC0, 0x02, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00}, wantStatus: usbdesc.StatusTimeout},
+		{name: "vendor request unhandled", setup: []byte{0xC0, 0x03, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00}, wantStatus: usbdesc.StatusStall},
+		{name: "clear endpoint halt", setup: []byte{0x02, 0x01, 0x00, 0x00, 0x81, 0x00, 0x00, 0x00}},
+		{name: "set interface", setup: []byte{0x01, 0x0B, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{name: "set unknown alt setting", setup: []byte{0x01, 0x0B, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00}, wantStatus: usbdesc.StatusStall},
+		{name: "HID set idle", setup: []byte{0x21, 0x0A, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{name: "HID get report unhandled", setup: []byte{0xA1, 0x01, 0x00, 0x01, 0x00, 0x00, 0x40, 0x00}, wantStatus: usbdesc.StatusStall},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := s.processSubmit(context.Background(), dev, tc.ep, tc.dir, tc.setup, nil)
+			assert.Equal(t, tc.wantStatus, usbdesc.TransferStatus(err))
+			assert.Equal(t, tc.wantResp, resp)
+		})
+	}
+}
+
+type inputReportDevice struct {
+	statusDevice
+}
+
+func (d *inputReportDevice) GetInputReport(iface, reportID uint8) []byte {
+	if iface == 0 && reportID == 1 {
+		return []byte{0x01, 0x02, 0x00, 0x04}
+	}
+	return nil
+}
+
+func TestProcessSubmitGetInputReport(t *testing.T) {
+	dev := &inputReportDevice{statusDevice{desc: usbdesc.Descriptor{
+		Interfaces: []usbdesc.InterfaceConfig{
+			{Descriptor: usbdesc.InterfaceDescriptor{BInterfaceNumber: 0, BInterfaceClass: 0x03}},
+		},
+	}}}
+	s := &Server{logger: slog.New(slog.DiscardHandler)}
+
+	type testCase struct {
+		name       string
+		setup      []byte
+		wantResp   []byte
+		wantStatus int32
+	}
+
+	cases := []testCase{
+		{name: "input report", setup: []byte{0xA1, 0x01, 0x01, 0x01, 0x00, 0x00, 0x40, 0x00}, wantResp: []byte{0x01, 0x02, 0x00, 0x04}},
+		{name: "truncated", setup: []byte{0xA1, 0x01, 0x01, 0x01, 0x00, 0x00, 0x02, 0x00}, wantResp: []byte{0x01, 0x02}},
+		{name: "unknown report id", setup: []byte{0xA1, 0x01, 0x05, 0x01, 0x00, 0x00, 0x40, 0x00}, wantStatus: usbdesc.StatusStall},
+		{name: "feature report", setup: []byte{0xA1, 0x01, 0x01, 0x03, 0x00, 0x00, 0x40, 0x00}, wantStatus: usbdesc.StatusStall},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := s.processSubmit(context.Background(), dev, 0, usbip.DirIn, tc.setup, nil)
+			assert.Equal(t, tc.wantStatus, usbdesc.TransferStatus(err))
+			assert.Equal(t, tc.wantResp, resp)
+		})
+	}
+}
+
+type isoDevice struct {
+	statusDevice
+	received []byte
+}
+
+func (d *isoDevice) HandleIsochronous(ctx context.Context, ep uint32, dir uint32, packets []usbdesc.IsoPacket, buf []byte) error {
+	for i := range packets {
+		p := &packets[i]
+		if dir == usbip.DirOut {
+			d.received = append(d.received, buf[p.Offset:p.Offset+p.Length]...)
+			p.ActualLength = p.Length
+			continue
+		}
+		// Short packets: only half of each packet carries data.
+		for j := range p.Length / 2 {
+			buf[p.Offset+j] = byte(i + 1)
+		}
+		p.ActualLength = p.Length / 2
+	}
+	return nil
+}
+
+func TestIsochronousSubmit(t *testing.T) {
+	dev := &isoDevice{statusDevice: statusDevice{desc: usbdesc.Descriptor{
+		Device: usbdesc.DeviceDescriptor{Speed: 2},
+		Interfaces: []usbdesc.InterfaceConfig{{
+			Descriptor: usbdesc.InterfaceDescriptor{BInterfaceNumber: 0, BInterfaceClass: 0x01},
+			Endpoints: []usbdesc.EndpointDescriptor{
+				{BEndpointAddress: 0x81, BMAttributes: 0x01, WMaxPacketSize: 8, BInterval: 1},
+				{BEndpointAddress: 0x02, BMAttributes: 0x01, WMaxPacketSize: 8, BInterval: 1},
+			},
+		}},
+	}}}
+
+	s := New(ServerConfig{}, slog.New(slog.DiscardHandler), nil)
+	bus, err := virtualbus.NewWithBusID(1)
+	require.NoError(t, err)
+	defer bus.Close() //nolint:errcheck
+	require.NoError(t, s.AddBus(bus))
+	_, err = bus.Add(dev)
+	require.NoError(t, err)
+
+	client, conn := net.Pipe()
+	defer client.Close() //nolint:errcheck
+	go func() { _ = s.handleUrbStream(conn, dev) }()
+	_ = client.SetDeadline(time.Now().Add(2 * time.Second))
+
+	submit := func(seq, dir, ep uint32, payload []byte, packets []usbip.IsoPacketDescriptor) (status int32, actualLen uint32, data []byte, ret []usbip.IsoPacketDescriptor) {
+		t.Helper()
+		var xferLen uint32
+		for _, p := range packets {
+			xferLen += p.Length
+		}
+		var b bytes.Buffer
+		cmd := usbip.CmdSubmit{
+			Basic:             usbip.HeaderBasic{Command: usbip.CmdSubmitCode, Seqnum: seq, Dir: dir, Ep: ep},
+			TransferBufferLen: xferLen,
+			NumberOfPackets:   uint32(len(packets)),
+		}
+		require.NoError(t, cmd.Write(&b))
+		b.Write(payload)
+		require.NoError(t, usbip.WriteIsoPacketDescriptors(&b, packets))
+		_, err := client.Write(b.Bytes())
+		require.NoError(t, err)
+
+		var hdr [48]byte
+		require.NoError(t, usbip.ReadExactly(client, hdr[:]))
+		assert.Equal(t, uint32(usbip.RetSubmitCode), binary.BigEndian.Uint32(hdr[0:4]))
+		assert.Equal(t, seq, binary.BigEndian.Uint32(hdr[4:8]))
+		status = int32(binary.BigEndian.Uint32(hdr[20:24]))
+		actualLen = binary.BigEndian.Uint32(hdr[24:28])
+		if dir == usbip.DirIn {
+			data = make([]byte, actualLen)
+			require.NoError(t, usbip.ReadExactly(client, data))
+		}
+		ret, err = usbip.ReadIsoPacketDescriptors(client, binary.BigEndian.Uint32(hdr[32:36]))
+		require.NoError(t, err)
+		return status, actualLen, data, ret
+	}
+
+	packets := []usbip.IsoPacketDescriptor{{Offset: 0, Length: 4}, {Offset: 4, Length: 4}, {Offset: 8, Length: 4}}
+
+	start := time.Now()
+	status, actualLen, data, ret := submit(1, usbip.DirIn, 1, nil, packets)
+	assert.GreaterOrEqual(t, time.Since(start), 3*time.Millisecond, "one packet per frame")
+	assert.Equal(t, usbdesc.StatusOK, status)
+	assert.Equal(t, uint32(6), actualLen)
+	assert.Equal(t, []byte{1, 1, 2, 2, 3, 3}, data)
+	if assert.Len(t, ret, 3) {
+		assert.Equal(t, uint32(2), ret[1].ActualLength)
+		assert.Equal(t, uint32(4), ret[1].Offset)
+		assert.Equal(t, []byte{1, 1, 0, 0, 2, 2, 0, 0, 3, 3, 0, 0}, usbip.UnpackIsoData(data, ret, 12))
+	}
+
+	status, actualLen, _, ret = submit(2, usbip.DirOut, 2, []byte("0123456789ab"), packets)
+	assert.Equal(t, usbdesc.StatusOK, status)
+	assert.Equal(t, uint32(12), actualLen)
+	assert.Len(t, ret, 3)
+	assert.Equal(t, []byte("0123456789ab"), dev.received)
+
+	// Devices without isochronous support stall iso URBs.
+	iso := []usbip.IsoPacketDescriptor{{Offset: 0, Length: 4, ActualLength: 4}}
+	_, err = s.processIsoSubmit(context.Background(), &dev.statusDevice, 1, usbip.DirIn, iso, 4, nil)
+	assert.ErrorIs(t, err, usbdesc.ErrStall)
+	assert.Zero(t, iso[0].ActualLength)
+}
+
+type messageDevice struct {
+	desc    usbdesc.Descriptor
+	message bool
+	data    chan []byte
+}
+
+func (d *messageDevice) HandleTransfer(ctx context.Context, ep uint32, dir uint32, out []byte) []byte {
+	select {
+	case <-ctx.Done():
+		return nil
+	case b := <-d.data:
+		return b
+	}
+}
+
+func (d *messageDevice) IsMessageEndpoint(ep uint32) bool      { return d.message }
+func (d *messageDevice) GetDescriptor() *usbdesc.Descriptor    { return &d.desc }
+func (d *messageDevice) GetDeviceSpecificArgs() map[string]any { return nil }
+
+func TestMessageEndpointNoReplay(t *testing.T) {
+	for _, message := range []bool{false, true} {
+		dev := &messageDevice{message: message, data: make(chan []byte, 1), desc: usbdesc.Descriptor{
+			Device: usbdesc.DeviceDescriptor{Speed: 2},
+			Interfaces: []usbdesc.InterfaceConfig{{
+				Descriptor: usbdesc.InterfaceDescriptor{BInterfaceNumber: 0, BInterfaceClass: 0xff},
+				Endpoints: []usbdesc.EndpointDescriptor{
+					{BEndpointAddress: 0x81, BMAttributes: 0x03, WMaxPacketSize: 8, BInterval: 1},
+				},
+			}},
+		}}
+
+		s := New(ServerConfig{}, slog.New(slog.DiscardHandler), nil)
+		bus, err := virtualbus.NewWithBusID(1)
+		require.NoError(t, err)
+		require.NoError(t, s.AddBus(bus))
+		_, err = bus.Add(dev)
+		require.NoError(t, err)
+
+		client, conn := net.Pipe()
+		go func() { _ = s.handleUrbStream(conn, dev) }()
+
+		submit := func(seq uint32) ([]byte, error) {
+			cmd := usbip.CmdSubmit{
+				Basic:             usbip.HeaderBasic{Command: usbip.CmdSubmitCode, Seqnum: seq, Dir: usbip.DirIn, Ep: 1},
+				TransferBufferLen: 8,
+			}
+			var b bytes.Buffer
+			require.NoError(t, cmd.Write(&b))
+			_ = client.SetDeadline(time.Now().Add(100 * time.Millisecond))
+			if _, err := client.Write(b.Bytes()); err != nil {
+				return nil, err
+			}
+			var hdr [48]byte
+			if err := usbip.ReadExactly(client, hdr[:]); err != nil {
+				return nil, err
+			}
+			data := make([]byte, binary.BigEndian.Uint32(hdr[24:28]))
+			err := usbip.ReadExactly(client, data)
+			return data, err
+		}
+
+		dev.data <- []byte{0x01}
+		got, err := submit(1)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0x01}, got)
+
+		got, err = submit(2)
+		if message {
+			assert.Error(t, err, "message endpoints must not repeat the last response")
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{0x01}, got)
+		}
+		_ = client.Close()
+		_ = bus.Close()
+	}
+}
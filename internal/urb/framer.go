@@ -0,0 +1,188 @@
+package urb
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/Alia5/VIIPER/usbip"
+)
+
+const (
+	headerSize    = 0x30
+	importReqSize = 8 + 32
+	importRepSize = 8 + 312
+
+	// maxBuffered bounds the bytes buffered for one direction of a
+	// connection; beyond it the stream is considered out of sync.
+	maxBuffered = 4 << 20
+)
+
+// Packet is one USB-IP packet of a connection.
+//
+// Management operations have Op set (e.g. usbip.OpRepImport), URB packets
+// Command (e.g. usbip.CmdSubmitCode). Data that cannot be parsed is passed on
+// as a packet with neither set.
+type Packet struct {
+	Op      uint16
+	Command uint32
+	Seq     uint32
+	// Ep is the endpoint number with the direction bit (0x80) set for IN.
+	// RET_SUBMIT packets carry the endpoint of their CMD_SUBMIT.
+	Ep uint8
+	// Data is the complete packet including its payload.
+	Data []byte
+}
+
+// Framer splits the byte streams of one USB-IP connection into packets.
+// Feed it the raw bytes of both directions in the order they were read;
+// incomplete packets are buffered until the rest arrives.
+//
+// Once a direction can no longer be parsed (device list connections, failed
+// imports, unknown commands), everything it carries is passed on unparsed.
+type Framer struct {
+	mu      sync.Mutex
+	dirs    [2]framerDir     // indexed by clientToServer
+	pending map[uint32]uint8 // seqnum -> endpoint of submitted URBs
+}
+
+type framerDir struct {
+	buf  []byte
+	lost bool
+}
+
+// NewFramer returns a Framer for a new connection.
+func NewFramer() *Framer {
+	return &Framer{pending: map[uint32]uint8{}}
+}
+
+// Feed processes data read from one direction of the connection and returns
+// the packets it completes. The packets do not alias data.
+func (f *Framer) Feed(clientToServer bool, data []byte) []Packet {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := &f.dirs[dirIndex(clientToServer)]
+	if d.lost {
+		return raw(data)
+	}
+	d.buf = append(d.buf, data...)
+
+	var packets []Packet
+	consumed := 0
+	for {
+		p, n := f.next(d.buf[consumed:])
+		if n < 0 {
+			d.lost = true
+			packets = append(packets, raw(d.buf[consumed:])...)
+			d.buf = nil
+			return packets
+		}
+		if n == 0 {
+			break
+		}
+		p.Data = append([]byte(nil), d.buf[consumed:consumed+n]...)
+		packets = append(packets, p)
+		consumed += n
+	}
+	d.buf = append(d.buf[:0], d.buf[consumed:]...)
+	if len(d.buf) > maxBuffered {
+		d.lost = true
+		packets = append(packets, raw(d.buf)...)
+		d.buf = nil
+	}
+	return packets
+}
+
+func raw(data []byte) []Packet {
+	if len(data) == 0 {
+		return nil
+	}
+	return []Packet{{Data: append([]byte(nil), data...)}}
+}
+
+func dirIndex(clientToServer bool) int {
+	if clientToServer {
+		return 1
+	}
+	return 0
+}
+
+// next returns the packet at the start of b and its size, 0 if b does not
+// hold a complete packet yet, or -1 if nothing more can be parsed.
+func (f *Framer) next(b []byte) (Packet, int) {
+	if len(b) < 8 {
+		return Packet{}, 0
+	}
+	if binary.BigEndian.Uint16(b[0:2]) == usbip.Version {
+		op := binary.BigEndian.Uint16(b[2:4])
+		switch op {
+		case usbip.OpReqImport:
+			return Packet{Op: op}, sizeIfComplete(b, importReqSize)
+		case usbip.OpRepImport:
+			if binary.BigEndian.Uint32(b[4:8]) != 0 {
+				return Packet{}, -1 // import failed, the connection is closed
+			}
+			return Packet{Op: op}, sizeIfComplete(b, importRepSize)
+		case usbip.OpReqDevlist, usbip.OpRepDevlist:
+			return Packet{}, -1 // device list connections carry no URBs
+		}
+	}
+	if len(b) < headerSize {
+		return Packet{}, 0
+	}
+
+	p := Packet{
+		Command: binary.BigEndian.Uint32(b[0:4]),
+		Seq:     binary.BigEndian.Uint32(b[4:8]),
+	}
+	switch p.Command {
+	case usbip.CmdSubmitCode:
+		p.Ep = uint8(binary.BigEndian.Uint32(b[16:20]) & 0x0F)
+		in := binary.BigEndian.Uint32(b[12:16]) == usbip.DirIn
+		var payload int
+		if in {
+			p.Ep |= 0x80
+		} else {
+			payload = int(binary.BigEndian.Uint32(b[24:28]))
+		}
+		size := headerSize + payload + isoSize(binary.BigEndian.Uint32(b[32:36]))
+		if len(b) < size {
+			return Packet{}, 0
+		}
+		f.pending[p.Seq] = p.Ep
+		return p, size
+
+	case usbip.RetSubmitCode:
+		ep, ok := f.pending[p.Seq]
+		// Only IN completions carry data; assume IN for unknown URBs.
+		var payload int
+		if !ok || ep&0x80 != 0 {
+			payload = int(binary.BigEndian.Uint32(b[24:28]))
+		}
+		size := headerSize + payload + isoSize(binary.BigEndian.Uint32(b[32:36]))
+		if len(b) < size {
+			return Packet{}, 0
+		}
+		delete(f.pending, p.Seq)
+		p.Ep = ep
+		return p, size
+
+	case usbip.CmdUnlinkCode, usbip.RetUnlinkCode:
+		return p, headerSize
+	}
+	return Packet{}, -1
+}
+
+func sizeIfComplete(b []byte, size int) int {
+	if len(b) < size {
+		return 0
+	}
+	return size
+}
+
+// isoSize returns the size of the iso packet descriptors following a URB.
+func isoSize(numPackets uint32) int {
+	if !usbip.IsIsochronous(numPackets) || numPackets > usbip.MaxIsoPackets {
+		return 0
+	}
+	return int(numPackets) * usbip.IsoPacketDescriptorSize
+}
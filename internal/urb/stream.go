@@ -0,0 +1,180 @@
+// Package urb reconstructs the URBs of a USB-IP connection from the raw bytes
+// of both directions, for consumers that observe or manipulate traffic they
+// do not take part in (capture files, device profiles, the proxy).
+package urb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/Alia5/VIIPER/usbip"
+)
+
+// StatusConnReset (-ECONNRESET) is the status of unlinked URBs.
+const StatusConnReset = -104
+
+// Import describes the device of a successful OP_REP_IMPORT.
+type Import struct {
+	Path      string
+	BusID     string
+	Busnum    uint32
+	Devnum    uint32
+	Speed     uint32
+	IDVendor  uint16
+	IDProduct uint16
+	BcdDevice uint16
+}
+
+// Submit is a CMD_SUBMIT.
+type Submit struct {
+	Devid      uint32
+	Ep         uint8 // endpoint number with the direction bit (0x80) set for IN
+	Setup      [8]byte
+	Length     uint32 // transfer buffer length
+	Flags      uint32
+	StartFrame uint32
+	NumPackets uint32
+	Interval   int32
+	Data       []byte // OUT payload
+}
+
+// In reports whether the URB transfers data from the device to the host.
+func (s *Submit) In() bool { return s.Ep&0x80 != 0 }
+
+// Complete is the RET_SUBMIT of a URB, or the synthesized completion of a
+// URB unlinked with StatusConnReset.
+type Complete struct {
+	Status     int32
+	Length     uint32 // actual length
+	StartFrame uint32
+	NumPackets uint32
+	ErrorCount uint32
+	Data       []byte // IN payload
+}
+
+// Handler receives the events of a Stream. Calls are serialized, and the Data
+// slices are only valid for the duration of the call.
+type Handler interface {
+	Imported(ts time.Time, imp Import)
+	Submitted(ts time.Time, seq uint32, s *Submit)
+	Completed(ts time.Time, seq uint32, s *Submit, c *Complete)
+}
+
+// Stream decodes the URBs of one USB-IP connection. Feed it the raw bytes of
+// both directions in the order they were read. Device list connections are
+// ignored.
+type Stream struct {
+	h      Handler
+	framer *Framer
+
+	mu      sync.Mutex
+	pending map[uint32]*Submit // submitted URBs by seqnum, without payload
+	unlinks map[uint32]uint32  // CMD_UNLINK seqnum -> unlinked seqnum
+}
+
+// NewStream returns a Stream reporting to h.
+func NewStream(h Handler) *Stream {
+	return &Stream{
+		h:       h,
+		framer:  NewFramer(),
+		pending: map[uint32]*Submit{},
+		unlinks: map[uint32]uint32{},
+	}
+}
+
+// Feed processes data read from one direction of the connection.
+// A nil Stream ignores everything fed to it.
+func (s *Stream) Feed(clientToServer bool, data []byte) {
+	if s == nil || len(data) == 0 {
+		return
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.framer.Feed(clientToServer, data) {
+		s.handle(p, now)
+	}
+}
+
+func (s *Stream) handle(p Packet, now time.Time) {
+	b := p.Data
+	if p.Op == usbip.OpRepImport {
+		s.h.Imported(now, parseImport(b))
+		return
+	}
+
+	switch p.Command {
+	case usbip.CmdSubmitCode:
+		sub := &Submit{
+			Devid:      binary.BigEndian.Uint32(b[8:12]),
+			Ep:         p.Ep,
+			Flags:      binary.BigEndian.Uint32(b[20:24]),
+			Length:     binary.BigEndian.Uint32(b[24:28]),
+			StartFrame: binary.BigEndian.Uint32(b[28:32]),
+			NumPackets: binary.BigEndian.Uint32(b[32:36]),
+			Interval:   int32(binary.BigEndian.Uint32(b[36:40])),
+		}
+		copy(sub.Setup[:], b[40:48])
+		if !sub.In() {
+			sub.Data = b[headerSize : headerSize+int(sub.Length)]
+		}
+		s.h.Submitted(now, p.Seq, sub)
+
+		pending := *sub
+		pending.Data = nil
+		s.pending[p.Seq] = &pending
+
+	case usbip.RetSubmitCode:
+		sub, ok := s.pending[p.Seq]
+		if !ok {
+			return
+		}
+		delete(s.pending, p.Seq)
+		c := &Complete{
+			Status:     int32(binary.BigEndian.Uint32(b[20:24])),
+			Length:     binary.BigEndian.Uint32(b[24:28]),
+			StartFrame: binary.BigEndian.Uint32(b[28:32]),
+			NumPackets: binary.BigEndian.Uint32(b[32:36]),
+			ErrorCount: binary.BigEndian.Uint32(b[36:40]),
+		}
+		if sub.In() {
+			c.Data = b[headerSize : headerSize+int(c.Length)]
+		}
+		s.h.Completed(now, p.Seq, sub, c)
+
+	case usbip.CmdUnlinkCode:
+		s.unlinks[p.Seq] = binary.BigEndian.Uint32(b[20:24])
+
+	case usbip.RetUnlinkCode:
+		status := int32(binary.BigEndian.Uint32(b[20:24]))
+		target, ok := s.unlinks[p.Seq]
+		delete(s.unlinks, p.Seq)
+		if sub, pending := s.pending[target]; ok && pending && status == StatusConnReset {
+			delete(s.pending, target)
+			s.h.Completed(now, target, sub, &Complete{Status: status})
+		}
+	}
+}
+
+func parseImport(b []byte) Import {
+	return Import{
+		Path:      cString(b[8:264]),
+		BusID:     cString(b[264:296]),
+		Busnum:    binary.BigEndian.Uint32(b[296:300]),
+		Devnum:    binary.BigEndian.Uint32(b[300:304]),
+		Speed:     binary.BigEndian.Uint32(b[304:308]),
+		IDVendor:  binary.BigEndian.Uint16(b[308:310]),
+		IDProduct: binary.BigEndian.Uint16(b[310:312]),
+		BcdDevice: binary.BigEndian.Uint16(b[312:314]),
+	}
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
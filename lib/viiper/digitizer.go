@@ -0,0 +1,176 @@
+package main
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+
+typedef uintptr_t USBServerHandle;
+
+typedef uintptr_t DigitizerDeviceHandle;
+
+#define DIGITIZER_BTN_LEFT      0x01u
+#define DIGITIZER_BTN_RIGHT     0x02u
+#define DIGITIZER_BTN_MIDDLE    0x04u
+#define DIGITIZER_BTN_BACK      0x08u
+#define DIGITIZER_BTN_FORWARD   0x10u
+#define DIGITIZER_AXIS_MAX      32767u
+#define DIGITIZER_MAX_CONTACTS  10
+
+typedef struct {
+	uint8_t Buttons;
+	uint16_t X;
+	uint16_t Y;
+	int16_t Wheel;
+	int16_t Pan;
+	uint16_t Touch;
+	uint16_t TouchX[DIGITIZER_MAX_CONTACTS];
+	uint16_t TouchY[DIGITIZER_MAX_CONTACTS];
+} DigitizerDeviceState;
+
+*/
+import "C"
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/cgo"
+	"slices"
+
+	"github.com/Alia5/VIIPER/device"
+	"github.com/Alia5/VIIPER/device/digitizer"
+	"github.com/Alia5/VIIPER/internal/server/api"
+)
+
+// CreateDigitizerDevice creates a new absolute pointer and touch screen device on the bus with the given ID on the server associated with the given handle.
+// @param serverHandle Handle to the USB server.
+// @param outDeviceHandle Output parameter for the created device handle.
+// @param busID ID of the bus to add the device to.
+// @param autoAttachLocalhost If true, the device will be automatically attached to a USBIP-Client/Driver running on THIS machine.
+// @param idVendor Optional USB vendor ID (0 = default).
+// @param idProduct Optional USB product ID (0 = default).
+//
+//export CreateDigitizerDevice
+func CreateDigitizerDevice(
+	serverHandle C.USBServerHandle,
+	outDeviceHandle *C.DigitizerDeviceHandle,
+	busID uint32,
+	autoAttachLocalhost bool,
+	idVendor uint16,
+	idProduct uint16,
+) bool {
+	sh := cgo.Handle(serverHandle)
+	shw, ok := sh.Value().(*usbServerHandleWrapper)
+	if !ok {
+		return false
+	}
+	bus := shw.s.GetBus(busID)
+	if bus == nil {
+		return false
+	}
+
+	opts := &device.CreateOptions{}
+	if idVendor != 0 {
+		opts.IDVendor = &idVendor
+	}
+	if idProduct != 0 {
+		opts.IDProduct = &idProduct
+	}
+
+	d, err := digitizer.New(opts)
+	if err != nil {
+		return false
+	}
+	devCtx, err := bus.Add(d)
+	if err != nil {
+		return false
+	}
+	exportMeta := device.GetDeviceMeta(devCtx)
+	if exportMeta == nil {
+		return false
+	}
+
+	if autoAttachLocalhost {
+		err := api.AttachLocalhostClient(
+			context.Background(),
+			exportMeta,
+			shw.s.GetListenPort(),
+			true,
+			slog.Default(),
+		)
+		if err != nil {
+			slog.Error("failed to auto-attach localhost client", "error", err)
+			return false
+		}
+	}
+
+	handleWrapper := &deviceHandleWrapper{
+		device:     d,
+		exportMeta: exportMeta,
+		usbServer:  shw,
+	}
+	*outDeviceHandle = C.DigitizerDeviceHandle(cgo.NewHandle(handleWrapper))
+
+	shw.mtx.Lock()
+	defer shw.mtx.Unlock()
+	shw.deviceHandles[busID] = append(shw.deviceHandles[busID], deviceHandle(*outDeviceHandle))
+	return true
+}
+
+// SetDigitizerDeviceState updates the input state of the digitizer device associated with the given handle.
+// @param handle Handle to the digitizer device.
+// @param state New input state. X/Y and the contact positions are absolute (0-32767), Wheel/Pan are relative and consumed each poll cycle.
+// Bit n of Touch is set while contact n touches the screen.
+//
+//export SetDigitizerDeviceState
+func SetDigitizerDeviceState(handle C.DigitizerDeviceHandle, state C.DigitizerDeviceState) bool {
+	dh := cgo.Handle(handle)
+	dhw, ok := dh.Value().(*deviceHandleWrapper)
+	if !ok {
+		return false
+	}
+	digitizerDevice, ok := dhw.device.(*digitizer.Digitizer)
+	if !ok {
+		return false
+	}
+	s := digitizer.InputState{
+		Buttons: uint8(state.Buttons),
+		X:       uint16(state.X),
+		Y:       uint16(state.Y),
+		Wheel:   int16(state.Wheel),
+		Pan:     int16(state.Pan),
+		Touch:   uint16(state.Touch),
+	}
+	for i := range digitizer.MaxContacts {
+		s.TouchX[i] = uint16(state.TouchX[i])
+		s.TouchY[i] = uint16(state.TouchY[i])
+	}
+	digitizerDevice.UpdateInputState(s)
+	return true
+}
+
+// RemoveDigitizerDevice removes the digitizer device associated with the given handle from the server.
+// @param handle Handle to the digitizer device to remove.
+//
+//export RemoveDigitizerDevice
+func RemoveDigitizerDevice(handle C.DigitizerDeviceHandle) bool {
+	dh := cgo.Handle(handle)
+	dhw, ok := dh.Value().(*deviceHandleWrapper)
+	if !ok {
+		return false
+	}
+	if err := dhw.usbServer.s.RemoveDeviceByID(dhw.exportMeta.BusID, fmt.Sprintf("%d", dhw.exportMeta.DevID)); err != nil {
+		return false
+	}
+
+	shw := dhw.usbServer
+	busID := dhw.exportMeta.BusID
+
+	shw.mtx.Lock()
+	defer shw.mtx.Unlock()
+	shw.deviceHandles[busID] = slices.DeleteFunc(shw.deviceHandles[busID], func(h deviceHandle) bool {
+		return h == deviceHandle(handle)
+	})
+	dh.Delete()
+
+	return true
+}
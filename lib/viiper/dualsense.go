@@ -91,12 +91,76 @@ typedef struct {
 	const char* ShellColor;     // NULL = use default (2-char code, e.g. "00", "Z1")
 } DSMetaState;
 
+#define DS_OUTPUT_FLAG0_COMPATIBLE_VIBRATION  0x01u
+#define DS_OUTPUT_FLAG0_HAPTICS_SELECT        0x02u
+#define DS_OUTPUT_FLAG0_RIGHT_TRIGGER_EFFECT  0x04u
+#define DS_OUTPUT_FLAG0_LEFT_TRIGGER_EFFECT   0x08u
+#define DS_OUTPUT_FLAG0_HEADPHONE_VOLUME      0x10u
+#define DS_OUTPUT_FLAG0_SPEAKER_VOLUME        0x20u
+#define DS_OUTPUT_FLAG0_MIC_VOLUME            0x40u
+#define DS_OUTPUT_FLAG0_AUDIO_CONTROL         0x80u
+#define DS_OUTPUT_FLAG1_MIC_MUTE_LED          0x01u
+#define DS_OUTPUT_FLAG1_POWER_SAVE            0x02u
+#define DS_OUTPUT_FLAG1_LIGHTBAR              0x04u
+#define DS_OUTPUT_FLAG1_RELEASE_LEDS          0x08u
+#define DS_OUTPUT_FLAG1_PLAYER_INDICATOR      0x10u
+#define DS_OUTPUT_FLAG1_HAPTIC_LOW_PASS       0x20u
+#define DS_OUTPUT_FLAG1_MOTOR_POWER           0x40u
+#define DS_OUTPUT_FLAG1_AUDIO_CONTROL2        0x80u
+#define DS_OUTPUT_FLAG2_LIGHTBAR_SETUP        0x02u
+#define DS_OUTPUT_FLAG2_COMPATIBLE_VIBRATION2 0x04u
+
+#define DS_TRIGGER_MODE_OFF              0x05u
+#define DS_TRIGGER_MODE_SIMPLE_FEEDBACK  0x01u
+#define DS_TRIGGER_MODE_SIMPLE_WEAPON    0x02u
+#define DS_TRIGGER_MODE_SIMPLE_VIBRATION 0x06u
+#define DS_TRIGGER_MODE_LIMITED_FEEDBACK 0x11u
+#define DS_TRIGGER_MODE_LIMITED_WEAPON   0x12u
+#define DS_TRIGGER_MODE_FEEDBACK         0x21u
+#define DS_TRIGGER_MODE_BOW              0x22u
+#define DS_TRIGGER_MODE_GALLOPING        0x23u
+#define DS_TRIGGER_MODE_WEAPON           0x25u
+#define DS_TRIGGER_MODE_VIBRATION        0x26u
+#define DS_TRIGGER_MODE_MACHINE          0x27u
+
+typedef struct {
+	uint8_t RumbleSmall;
+	uint8_t RumbleLarge;
+	uint8_t LedRed;
+	uint8_t LedGreen;
+	uint8_t LedBlue;
+	uint8_t PlayerLeds;
+	uint8_t ValidFlag0;         // DS_OUTPUT_FLAG0_*
+	uint8_t ValidFlag1;         // DS_OUTPUT_FLAG1_*
+	uint8_t ValidFlag2;         // DS_OUTPUT_FLAG2_*
+	uint8_t RightTriggerMode;   // DS_TRIGGER_MODE_*
+	uint8_t RightTriggerParams[10];
+	uint8_t LeftTriggerMode;    // DS_TRIGGER_MODE_*
+	uint8_t LeftTriggerParams[10];
+	uint8_t MuteLed;            // 0 = off, 1 = on, 2 = pulse
+	uint8_t PowerSave;
+	uint8_t HeadphoneVolume;
+	uint8_t SpeakerVolume;
+	uint8_t MicVolume;
+	uint8_t AudioControl;
+	uint8_t AudioControl2;
+	uint8_t MotorPower;         // low nibble: rumble reduction, high nibble: trigger reduction
+	uint8_t LedBrightness;
+	uint8_t LightbarSetup;
+} DSOutputState;
+
 typedef void (*DSOutputCallback)(DSDeviceHandle handle, uint8_t rumbleSmall, uint8_t rumbleLarge, uint8_t ledRed, uint8_t ledGreen, uint8_t ledBlue, uint8_t playerLeds);
 
 static void viiper_call_ds_output(DSOutputCallback fn, DSDeviceHandle handle, uint8_t rumbleSmall, uint8_t rumbleLarge, uint8_t ledRed, uint8_t ledGreen, uint8_t ledBlue, uint8_t playerLeds) {
 	fn(handle, rumbleSmall, rumbleLarge, ledRed, ledGreen, ledBlue, playerLeds);
 }
 
+typedef void (*DSOutputCallbackEx)(DSDeviceHandle handle, DSOutputState output);
+
+static void viiper_call_ds_output_ex(DSOutputCallbackEx fn, DSDeviceHandle handle, DSOutputState output) {
+	fn(handle, output);
+}
+
 */
 import "C"
 import (
@@ -286,6 +350,7 @@ func SetDualSenseDeviceState(handle C.DSDeviceHandle, state C.DSDeviceState) boo
 }
 
 // SetDualSenseOutputCallback sets a callback to be invoked when the host sends output (rumble/LED) commands to the device.
+// It replaces a callback set with SetDualSenseOutputCallbackEx.
 // @param handle Handle to the DualSense device.
 // @param callback Callback receiving rumbleSmall, rumbleLarge, ledRed, ledGreen, ledBlue, playerLeds. Pass NULL to clear.
 //
@@ -317,6 +382,59 @@ func SetDualSenseOutputCallback(handle C.DSDeviceHandle, cb C.DSOutputCallback)
 	return true
 }
 
+// SetDualSenseOutputCallbackEx sets a callback to be invoked when the host sends output reports (rumble/LED/adaptive trigger) to the device.
+// It replaces a callback set with SetDualSenseOutputCallback.
+// @param handle Handle to the DualSense device.
+// @param callback Callback receiving the decoded output report (rumble, LEDs, adaptive triggers, audio, power save). Pass NULL to clear.
+//
+//export SetDualSenseOutputCallbackEx
+func SetDualSenseOutputCallbackEx(handle C.DSDeviceHandle, cb C.DSOutputCallbackEx) bool {
+	dh := cgo.Handle(handle)
+	dhw, ok := dh.Value().(*deviceHandleWrapper)
+	if !ok {
+		return false
+	}
+	dsDevice, ok := dhw.device.(*dualsense.DualSense)
+	if !ok {
+		return false
+	}
+	if cb == nil {
+		dsDevice.SetOutputCallback(nil)
+		return true
+	}
+	dsDevice.SetOutputCallback(func(out dualsense.OutputState) {
+		cOut := C.DSOutputState{
+			RumbleSmall:      C.uint8_t(out.RumbleSmall),
+			RumbleLarge:      C.uint8_t(out.RumbleLarge),
+			LedRed:           C.uint8_t(out.LedRed),
+			LedGreen:         C.uint8_t(out.LedGreen),
+			LedBlue:          C.uint8_t(out.LedBlue),
+			PlayerLeds:       C.uint8_t(out.PlayerLeds),
+			ValidFlag0:       C.uint8_t(out.ValidFlag0),
+			ValidFlag1:       C.uint8_t(out.ValidFlag1),
+			ValidFlag2:       C.uint8_t(out.ValidFlag2),
+			RightTriggerMode: C.uint8_t(out.RightTriggerMode),
+			LeftTriggerMode:  C.uint8_t(out.LeftTriggerMode),
+			MuteLed:          C.uint8_t(out.MuteLed),
+			PowerSave:        C.uint8_t(out.PowerSave),
+			HeadphoneVolume:  C.uint8_t(out.HeadphoneVolume),
+			SpeakerVolume:    C.uint8_t(out.SpeakerVolume),
+			MicVolume:        C.uint8_t(out.MicVolume),
+			AudioControl:     C.uint8_t(out.AudioControl),
+			AudioControl2:    C.uint8_t(out.AudioControl2),
+			MotorPower:       C.uint8_t(out.MotorPower),
+			LedBrightness:    C.uint8_t(out.LedBrightness),
+			LightbarSetup:    C.uint8_t(out.LightbarSetup),
+		}
+		for i := range out.RightTriggerParams {
+			cOut.RightTriggerParams[i] = C.uint8_t(out.RightTriggerParams[i])
+			cOut.LeftTriggerParams[i] = C.uint8_t(out.LeftTriggerParams[i])
+		}
+		C.viiper_call_ds_output_ex(cb, handle, cOut)
+	})
+	return true
+}
+
 // RemoveDualSenseDevice removes the DualSense device associated with the given handle from the server.
 // @param handle Handle to the DualSense device to remove.
 //
@@ -122,9 +122,37 @@ typedef uintptr_t KeyboardDeviceHandle;
 #define KB_KEY_VOLUME_UP   0x80u
 #define KB_KEY_VOLUME_DOWN 0x81u
 
+#define KB_CONSUMER_MAX_KEYS 4
+
+#define KB_CONSUMER_BRIGHTNESS_UP   0x006Fu
+#define KB_CONSUMER_BRIGHTNESS_DOWN 0x0070u
+#define KB_CONSUMER_PLAY            0x00B0u
+#define KB_CONSUMER_PAUSE           0x00B1u
+#define KB_CONSUMER_NEXT_TRACK      0x00B5u
+#define KB_CONSUMER_PREV_TRACK      0x00B6u
+#define KB_CONSUMER_STOP            0x00B7u
+#define KB_CONSUMER_PLAY_PAUSE      0x00CDu
+#define KB_CONSUMER_MUTE            0x00E2u
+#define KB_CONSUMER_VOLUME_UP       0x00E9u
+#define KB_CONSUMER_VOLUME_DOWN     0x00EAu
+#define KB_CONSUMER_MAIL            0x018Au
+#define KB_CONSUMER_CALCULATOR      0x0192u
+#define KB_CONSUMER_MY_COMPUTER     0x0194u
+#define KB_CONSUMER_BROWSER_SEARCH  0x0221u
+#define KB_CONSUMER_BROWSER_HOME    0x0223u
+#define KB_CONSUMER_BROWSER_BACK    0x0224u
+#define KB_CONSUMER_BROWSER_FORWARD 0x0225u
+#define KB_CONSUMER_BROWSER_REFRESH 0x0227u
+
+#define KB_SYSTEM_POWER_DOWN 0x01u
+#define KB_SYSTEM_SLEEP      0x02u
+#define KB_SYSTEM_WAKE_UP    0x04u
+
 typedef struct {
 	uint8_t Modifiers;
 	uint8_t KeyBitmap[32];
+	uint16_t Consumer[KB_CONSUMER_MAX_KEYS];
+	uint8_t System;
 } KeyboardDeviceState;
 
 typedef void (*KeyboardLEDCallback)(KeyboardDeviceHandle handle, uint8_t leds);
@@ -224,7 +252,7 @@ func CreateKeyboardDevice(
 
 // SetKeyboardDeviceState updates the input state of the keyboard device associated with the given handle.
 // @param handle Handle to the keyboard device.
-// @param state New input state (Modifiers bitmask + 256-bit key bitmap).
+// @param state New input state (Modifiers bitmask + 256-bit key bitmap, Consumer Page usages and System Control flags).
 //
 //export SetKeyboardDeviceState
 func SetKeyboardDeviceState(handle C.KeyboardDeviceHandle, state C.KeyboardDeviceState) bool {
@@ -239,10 +267,14 @@ func SetKeyboardDeviceState(handle C.KeyboardDeviceHandle, state C.KeyboardDevic
 	}
 	s := keyboard.InputState{
 		Modifiers: uint8(state.Modifiers),
+		System:    uint8(state.System),
 	}
 	for i, v := range state.KeyBitmap {
 		s.KeyBitmap[i] = byte(v)
 	}
+	for i, v := range state.Consumer {
+		s.Consumer[i] = uint16(v)
+	}
 	kbDevice.UpdateInputState(s)
 	return true
 }
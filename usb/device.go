@@ -31,3 +31,109 @@ type ControlDevice interface {
 	// If handled is true, the returned bytes (if any) will be used as the IN data stage.
 	HandleControl(bmRequestType, bRequest uint8, wValue, wIndex, wLength uint16, data []byte) (resp []byte, handled bool)
 }
+
+// TransferStatusDevice is an optional interface for devices that need to fail
+// non-EP0 transfers with a URB status (e.g. STALL a halted endpoint).
+//
+// If implemented, the server calls HandleTransferStatus instead of HandleTransfer.
+// A non-nil error (see TransferError) is reported to the host as the RET_SUBMIT status.
+type TransferStatusDevice interface {
+	HandleTransferStatus(ctx context.Context, ep uint32, dir uint32, out []byte) ([]byte, error)
+}
+
+// ControlStatusDevice is an optional interface for devices that need to fail
+// control requests with a URB status.
+//
+// If implemented, the server calls HandleControlStatus instead of HandleControl.
+// handled has the same meaning as for ControlDevice. If handled is true and err is
+// non-nil (e.g. ErrStall), the error is reported to the host as the RET_SUBMIT status.
+//
+// Requests that neither the device nor the server's default handling accept are
+// answered with a STALL.
+type ControlStatusDevice interface {
+	HandleControlStatus(bmRequestType, bRequest uint8, wValue, wIndex, wLength uint16, data []byte) (resp []byte, handled bool, err error)
+}
+
+// InputReportDevice is an optional interface for HID devices that answer
+// GET_REPORT(Input) control requests with their current input report.
+//
+// The server calls it for GET_REPORT(Input) requests on HID interfaces that
+// the device does not handle itself (see ControlDevice). Requests for which
+// it returns nil are answered with a STALL.
+type InputReportDevice interface {
+	// GetInputReport returns the current input report reportID (0 if the
+	// interface has no report IDs) of interface iface, including the report
+	// ID. Pending reports are not consumed; relative values like mouse
+	// movement are reported as 0.
+	GetInputReport(iface, reportID uint8) []byte
+}
+
+// IsoPacket is one packet of an isochronous transfer.
+type IsoPacket struct {
+	// Offset of the packet in the transfer buffer.
+	Offset uint32
+	// Length is the packet size requested by the host (IN) or sent by it (OUT).
+	Length uint32
+	// ActualLength is set by the device to the number of bytes transferred.
+	ActualLength uint32
+	// Status is set by the device to fail a single packet (e.g. StatusOverflow).
+	Status int32
+}
+
+// IsochronousDevice is an optional interface for devices with isochronous
+// endpoints (e.g. USB audio streaming).
+//
+// HandleIsochronous is called once per isochronous URB instead of HandleTransfer.
+// For IN transfers buf is a zeroed transfer buffer; fill each packet at its Offset
+// and set its ActualLength. For OUT transfers buf holds the data sent by the host;
+// set ActualLength of every consumed packet.
+//
+// HandleIsochronous must not block: the server completes URBs at the rate given
+// by the endpoint's bInterval. A non-nil error fails the whole URB.
+type IsochronousDevice interface {
+	HandleIsochronous(ctx context.Context, ep uint32, dir uint32, packets []IsoPacket, buf []byte) error
+}
+
+// StateDevice is an optional interface for devices that expose their current
+// state, e.g. for monitoring or tests that do not own the device stream.
+//
+// Both values must be JSON-encodable snapshots that are safe to use after the
+// call returns.
+type StateDevice interface {
+	// GetInputState returns the last input state the device built reports from.
+	GetInputState() any
+	// GetOutputState returns the last output (rumble, LEDs, ...) sent by the
+	// host, or nil if the device has none or nothing was received yet.
+	GetOutputState() any
+}
+
+// MessageEndpointDevice is an optional interface for devices whose IN
+// endpoints carry one-off messages instead of state reports.
+//
+// If an interrupt IN transfer gets no data within the endpoint's interval, the
+// server answers it with the endpoint's previous response. For endpoints where
+// IsMessageEndpoint returns true, the transfer stays pending (NAK) instead,
+// until the device returns data or the host unlinks it.
+type MessageEndpointDevice interface {
+	IsMessageEndpoint(ep uint32) bool
+}
+
+// NeutralStateDevice is an optional interface for devices that can return to a
+// neutral input state: nothing pressed, sticks centered, no movement.
+//
+// The server uses it to release a device whose client went away, see the
+// failsafe options of the API server.
+type NeutralStateDevice interface {
+	// ResetInputState replaces the input state with the neutral one.
+	ResetInputState()
+}
+
+// QueuedInputDevice is an optional interface for devices with a queued input
+// mode, where input states are delivered to the host in order instead of only
+// the latest one.
+type QueuedInputDevice interface {
+	// InputQueueStatus returns the number of queued input states, the queue
+	// size and how many states overflowed it. ok is false if queued input is
+	// not enabled.
+	InputQueueStatus() (length, capacity int, overflows uint64, ok bool)
+}
@@ -0,0 +1,54 @@
+package usb
+
+import "errors"
+
+// URB status codes as sent in USB/IP RET_SUBMIT. USB/IP uses the negative
+// Linux errno values on the wire regardless of the host platform.
+const (
+	StatusOK        int32 = 0
+	StatusStall     int32 = -32  // -EPIPE
+	StatusProtocol  int32 = -71  // -EPROTO
+	StatusOverflow  int32 = -75  // -EOVERFLOW
+	StatusTimeout   int32 = -110 // -ETIMEDOUT
+	StatusConnReset int32 = -104 // -ECONNRESET
+)
+
+// TransferError is a failed USB transfer.
+// The server reports Status to the host as the URB status of the RET_SUBMIT.
+type TransferError struct {
+	Status int32
+	Reason string
+}
+
+func (e *TransferError) Error() string { return "usb: " + e.Reason }
+
+// Is reports whether target is a TransferError with the same status, so
+// wrapped or freshly constructed errors match the sentinels below.
+func (e *TransferError) Is(target error) bool {
+	t, ok := target.(*TransferError)
+	return ok && t.Status == e.Status
+}
+
+var (
+	// ErrStall signals a STALL handshake: the endpoint is halted or the
+	// (control) request is not supported.
+	ErrStall = &TransferError{Status: StatusStall, Reason: "stall"}
+	// ErrTimeout signals that the device kept NAKing until the transfer timed out.
+	ErrTimeout = &TransferError{Status: StatusTimeout, Reason: "timeout"}
+	// ErrOverflow signals that the device sent more data than the host requested (babble).
+	ErrOverflow = &TransferError{Status: StatusOverflow, Reason: "overflow"}
+	// ErrProtocol signals a generic protocol error (bad CRC, bit stuffing, ...).
+	ErrProtocol = &TransferError{Status: StatusProtocol, Reason: "protocol error"}
+)
+
+// TransferStatus maps err to the URB status sent to the host.
+// nil maps to StatusOK, TransferErrors to their status and any other error to StatusProtocol.
+func TransferStatus(err error) int32 {
+	if err == nil {
+		return StatusOK
+	}
+	if te, ok := errors.AsType[*TransferError](err); ok {
+		return te.Status
+	}
+	return StatusProtocol
+}
@@ -11,28 +11,52 @@ const (
 	UsagePageKeyboard       uint16 = 0x07
 	UsagePageLEDs           uint16 = 0x08
 	UsagePageButton         uint16 = 0x09
+	UsagePageOrdinal        uint16 = 0x0A
 	UsagePageConsumer       uint16 = 0x0C
+	UsagePageDigitizer      uint16 = 0x0D
+	UsagePagePID            uint16 = 0x0F
 )
 
 // Generic Desktop usages.
 const (
-	UsagePointer  uint16 = 0x01
-	UsageMouse    uint16 = 0x02
-	UsageJoystick uint16 = 0x04
-	UsageGamePad  uint16 = 0x05
-	UsageKeyboard uint16 = 0x06
-	UsageX        uint16 = 0x30
-	UsageY        uint16 = 0x31
-	UsageZ        uint16 = 0x32
-	UsageRx       uint16 = 0x33
-	UsageRy       uint16 = 0x34
-	UsageRz       uint16 = 0x35
-	UsageWheel    uint16 = 0x38
+	UsagePointer   uint16 = 0x01
+	UsageMouse     uint16 = 0x02
+	UsageJoystick  uint16 = 0x04
+	UsageGamePad   uint16 = 0x05
+	UsageKeyboard  uint16 = 0x06
+	UsageX         uint16 = 0x30
+	UsageY         uint16 = 0x31
+	UsageZ         uint16 = 0x32
+	UsageRx        uint16 = 0x33
+	UsageRy        uint16 = 0x34
+	UsageRz        uint16 = 0x35
+	UsageSlider    uint16 = 0x36
+	UsageDial      uint16 = 0x37
+	UsageWheel     uint16 = 0x38
+	UsageHatSwitch uint16 = 0x39
+
+	UsageSystemControl   uint16 = 0x80
+	UsageSystemPowerDown uint16 = 0x81
+	UsageSystemSleep     uint16 = 0x82
+	UsageSystemWakeUp    uint16 = 0x83
+)
+
+// Digitizer usages.
+const (
+	UsageTouchScreen         uint16 = 0x04
+	UsageFinger              uint16 = 0x22
+	UsageInRange             uint16 = 0x32
+	UsageTipSwitch           uint16 = 0x42
+	UsageConfidence          uint16 = 0x47
+	UsageContactIdentifier   uint16 = 0x51
+	UsageContactCount        uint16 = 0x54
+	UsageContactCountMaximum uint16 = 0x55
 )
 
 // Consumer usages.
 const (
-	UsageACPan uint16 = 0x0238
+	UsageConsumerControl uint16 = 0x01
+	UsageACPan           uint16 = 0x0238
 )
 
 // CollectionKind values.
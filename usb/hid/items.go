@@ -16,6 +16,15 @@ func (u Usage) encode(e *encoder) error {
 	return e.short(0x0, ItemTypeLocal, dataU32(uint32(u.Usage)))
 }
 
+// ExtendedUsage sets a usage on another usage page than the current one
+// (Local item, tag 0x0, 4 bytes: page in the high, usage in the low word).
+type ExtendedUsage struct{ Page, Usage uint16 }
+
+func (u ExtendedUsage) encode(e *encoder) error {
+	v := uint32(u.Page)<<16 | uint32(u.Usage)
+	return e.short(0x0, ItemTypeLocal, Data{uint8(v), uint8(v >> 8), uint8(v >> 16), uint8(v >> 24)})
+}
+
 // Collection begins a collection (Main item, tag 0xA) and implicitly ends it.
 type Collection struct {
 	Kind  CollectionKind
@@ -125,3 +134,11 @@ type Unit struct{ Value uint32 }
 func (u Unit) encode(e *encoder) error {
 	return e.short(0x6, ItemTypeGlobal, dataU32(u.Value))
 }
+
+// UnitExponent sets the base 10 exponent of the unit (Global item, tag 0x5).
+// Values -8..7 are encoded as a 4-bit two's complement nibble.
+type UnitExponent struct{ Exp int8 }
+
+func (u UnitExponent) encode(e *encoder) error {
+	return e.short(0x5, ItemTypeGlobal, Data{uint8(u.Exp) & 0x0F})
+}
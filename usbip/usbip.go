@@ -2,6 +2,7 @@ package usbip
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
 )
 
@@ -274,6 +275,104 @@ func (r *RetSubmit) Write(w io.Writer) error {
 	return err
 }
 
+// IsoPacketDescriptorSize is the wire size of one iso packet descriptor.
+const IsoPacketDescriptorSize = 16
+
+// MaxIsoPackets caps number_of_packets of a single URB (USBIP_MAX_ISO_PACKETS).
+const MaxIsoPackets = 1024
+
+// NonIsoPackets is sent as number_of_packets for non-isochronous URBs by some
+// implementations; 0 means the same.
+const NonIsoPackets = 0xFFFFFFFF
+
+// IsoPacketDescriptor describes one packet of an isochronous URB.
+// The descriptors follow the transfer buffer in CMD_SUBMIT and RET_SUBMIT.
+type IsoPacketDescriptor struct {
+	Offset       uint32
+	Length       uint32
+	ActualLength uint32
+	Status       int32
+}
+
+// IsIsochronous reports whether number_of_packets denotes an isochronous URB.
+func IsIsochronous(numberOfPackets uint32) bool {
+	return numberOfPackets != 0 && numberOfPackets != NonIsoPackets
+}
+
+func (d *IsoPacketDescriptor) Write(w io.Writer) error {
+	_, err := w.Write(d.appendTo(make([]byte, 0, IsoPacketDescriptorSize)))
+	return err
+}
+
+func (d *IsoPacketDescriptor) appendTo(buf []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, d.Offset)
+	buf = binary.BigEndian.AppendUint32(buf, d.Length)
+	buf = binary.BigEndian.AppendUint32(buf, d.ActualLength)
+	return binary.BigEndian.AppendUint32(buf, uint32(d.Status))
+}
+
+// WriteIsoPacketDescriptors writes descs back to back.
+func WriteIsoPacketDescriptors(w io.Writer, descs []IsoPacketDescriptor) error {
+	buf := make([]byte, 0, len(descs)*IsoPacketDescriptorSize)
+	for i := range descs {
+		buf = descs[i].appendTo(buf)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadIsoPacketDescriptors reads n iso packet descriptors.
+func ReadIsoPacketDescriptors(r io.Reader, n uint32) ([]IsoPacketDescriptor, error) {
+	if n > MaxIsoPackets {
+		return nil, fmt.Errorf("too many iso packets: %d", n)
+	}
+	buf := make([]byte, int(n)*IsoPacketDescriptorSize)
+	if err := ReadExactly(r, buf); err != nil {
+		return nil, err
+	}
+	descs := make([]IsoPacketDescriptor, n)
+	for i := range descs {
+		b := buf[i*IsoPacketDescriptorSize:]
+		descs[i] = IsoPacketDescriptor{
+			Offset:       binary.BigEndian.Uint32(b[0:4]),
+			Length:       binary.BigEndian.Uint32(b[4:8]),
+			ActualLength: binary.BigEndian.Uint32(b[8:12]),
+			Status:       int32(binary.BigEndian.Uint32(b[12:16])),
+		}
+	}
+	return descs, nil
+}
+
+// PackIsoData returns the transferred part of every packet of an isochronous IN
+// buffer back to back, as sent in RET_SUBMIT.
+func PackIsoData(buf []byte, descs []IsoPacketDescriptor) []byte {
+	var out []byte
+	for _, d := range descs {
+		end := uint64(d.Offset) + uint64(d.ActualLength)
+		if end > uint64(len(buf)) {
+			continue
+		}
+		out = append(out, buf[d.Offset:end]...)
+	}
+	return out
+}
+
+// UnpackIsoData spreads packed RET_SUBMIT data back to the packet offsets of a
+// bufLen byte transfer buffer.
+func UnpackIsoData(data []byte, descs []IsoPacketDescriptor, bufLen uint32) []byte {
+	buf := make([]byte, bufLen)
+	pos := 0
+	for _, d := range descs {
+		end := uint64(d.Offset) + uint64(d.ActualLength)
+		if end > uint64(bufLen) || pos+int(d.ActualLength) > len(data) {
+			break
+		}
+		copy(buf[d.Offset:end], data[pos:pos+int(d.ActualLength)])
+		pos += int(d.ActualLength)
+	}
+	return buf
+}
+
 // CmdUnlink and RetUnlink
 type CmdUnlink struct {
 	Basic        HeaderBasic
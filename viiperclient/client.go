@@ -33,6 +33,9 @@ func NewWithConfig(addr string, cfg *Config) *Client {
 // This is primarily useful for testing or when advanced transport configuration is needed.
 func WithTransport(t *Transport) *Client { return &Client{transport: t} }
 
+// Close releases the pooled connections of the client, see Config.PoolSize.
+func (c *Client) Close() error { return c.transport.Close() }
+
 // Ping returns the version and identity of the VIIPER server.
 func (c *Client) Ping() (*viipertypes.PingResponse, error) {
 	return c.PingCtx(context.Background())
@@ -101,9 +104,6 @@ func (c *Client) DeviceAdd(busID uint32, devType string, o *device.CreateOptions
 }
 
 func (c *Client) DeviceAddCtx(ctx context.Context, busID uint32, devType string, o *device.CreateOptions) (*viipertypes.Device, error) {
-	pathParams := map[string]string{"id": fmt.Sprintf("%d", busID)}
-	const path = "bus/{id}/add"
-
 	if o == nil {
 		o = &device.CreateOptions{}
 	}
@@ -120,6 +120,20 @@ func (c *Client) DeviceAddCtx(ctx context.Context, busID uint32, devType string,
 		IDProduct:      o.IDProduct,
 		DeviceSpecific: deviceSpecific,
 	}
+	return c.DeviceAddRequestCtx(ctx, busID, &req)
+}
+
+// DeviceAddRequest adds a new device described by req to the given bus.
+// Unlike DeviceAdd it can set every field of the request, e.g. a failsafe
+// policy.
+func (c *Client) DeviceAddRequest(busID uint32, req *viipertypes.DeviceCreateRequest) (*viipertypes.Device, error) {
+	return c.DeviceAddRequestCtx(context.Background(), busID, req)
+}
+
+func (c *Client) DeviceAddRequestCtx(ctx context.Context, busID uint32, req *viipertypes.DeviceCreateRequest) (*viipertypes.Device, error) {
+	pathParams := map[string]string{"id": fmt.Sprintf("%d", busID)}
+	const path = "bus/{id}/add"
+
 	payloadBytes, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("marshal device create request: %w", err)
@@ -165,6 +179,64 @@ func (c *Client) DevicesListCtx(ctx context.Context, busID uint32) (*viipertypes
 	return parse[viipertypes.DevicesListResponse](raw)
 }
 
+// DeviceState retrieves the last input state of a device and the last output
+// (rumble, LEDs, ...) the host sent to it, without connecting to its stream.
+func (c *Client) DeviceState(busID uint32, devID string) (*viipertypes.DeviceStateResponse, error) {
+	return c.DeviceStateCtx(context.Background(), busID, devID)
+}
+
+func (c *Client) DeviceStateCtx(ctx context.Context, busID uint32, devID string) (*viipertypes.DeviceStateResponse, error) {
+	pathParams := map[string]string{"id": fmt.Sprintf("%d", busID), "deviceid": devID}
+	const path = "bus/{id}/{deviceid}/state"
+	raw, err := c.transport.DoCtx(ctx, path, nil, pathParams)
+	if err != nil {
+		return nil, err
+	}
+	return parse[viipertypes.DeviceStateResponse](raw)
+}
+
+// DeviceUpdateMeta changes the meta state (battery, temperature, serial, ...)
+// of a running device, e.g. to simulate a draining battery. Fields not in meta
+// keep their value. Returns the device with its updated device-specific state.
+func (c *Client) DeviceUpdateMeta(busID uint32, devID string, meta map[string]any) (*viipertypes.Device, error) {
+	return c.DeviceUpdateMetaCtx(context.Background(), busID, devID, meta)
+}
+
+func (c *Client) DeviceUpdateMetaCtx(ctx context.Context, busID uint32, devID string, meta map[string]any) (*viipertypes.Device, error) {
+	pathParams := map[string]string{"id": fmt.Sprintf("%d", busID), "deviceid": devID}
+	const path = "bus/{id}/{deviceid}/meta"
+	payloadBytes, err := json.Marshal(viipertypes.DeviceMetaRequest{Meta: meta})
+	if err != nil {
+		return nil, fmt.Errorf("marshal device meta request: %w", err)
+	}
+	raw, err := c.transport.DoCtx(ctx, path, string(payloadBytes), pathParams)
+	if err != nil {
+		return nil, err
+	}
+	return parse[viipertypes.Device](raw)
+}
+
+// DeviceTypeText types text on a keyboard device using the host keyboard
+// layout given in req. The keystrokes are queued server-side; it returns once
+// they are queued, not typed.
+func (c *Client) DeviceTypeText(busID uint32, devID string, req *viipertypes.TypeTextRequest) (*viipertypes.TypeTextResponse, error) {
+	return c.DeviceTypeTextCtx(context.Background(), busID, devID, req)
+}
+
+func (c *Client) DeviceTypeTextCtx(ctx context.Context, busID uint32, devID string, req *viipertypes.TypeTextRequest) (*viipertypes.TypeTextResponse, error) {
+	pathParams := map[string]string{"id": fmt.Sprintf("%d", busID), "deviceid": devID}
+	const path = "bus/{id}/{deviceid}/type"
+	payloadBytes, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal type text request: %w", err)
+	}
+	raw, err := c.transport.DoCtx(ctx, path, string(payloadBytes), pathParams)
+	if err != nil {
+		return nil, err
+	}
+	return parse[viipertypes.TypeTextResponse](raw)
+}
+
 func parse[T any](data string) (*T, error) {
 	if data == "" {
 		return nil, errors.New("empty response")
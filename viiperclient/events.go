@@ -0,0 +1,101 @@
+package viiperclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/Alia5/VIIPER/viipertypes"
+)
+
+// EventStream is a subscription to the server's bus/device lifecycle events.
+type EventStream struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// OpenEventStream subscribes to the server's "events" stream and returns once
+// the subscription is live. Earlier events are not replayed; subscribe first,
+// then query the current topology (BusList, DevicesList).
+func (c *Client) OpenEventStream(ctx context.Context) (*EventStream, error) {
+	conn, err := c.dialStream(ctx, "events")
+	if err != nil {
+		return nil, err
+	}
+	s := &EventStream{conn: conn, r: bufio.NewReader(conn)}
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	line, err := s.r.ReadBytes('\n')
+	stop()
+	if err != nil {
+		conn.Close() // nolint
+		return nil, fmt.Errorf("read subscription: %w", err)
+	}
+	var ev viipertypes.Event
+	if err := json.Unmarshal(line, &ev); err == nil && ev.Type == viipertypes.EventSubscribed {
+		return s, nil
+	}
+	conn.Close() // nolint
+	var apiErr viipertypes.APIError
+	if err := json.Unmarshal(line, &apiErr); err == nil && apiErr.Status != 0 {
+		return nil, apiErr
+	}
+	return nil, fmt.Errorf("unexpected subscription response: %s", line)
+}
+
+// Next blocks until the next event arrives.
+func (s *EventStream) Next() (*viipertypes.Event, error) {
+	line, err := s.r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	var ev viipertypes.Event
+	if err := json.Unmarshal(line, &ev); err != nil {
+		return nil, fmt.Errorf("decode event: %w", err)
+	}
+	return &ev, nil
+}
+
+// Events reads events in a background goroutine until ctx is cancelled or the
+// stream fails. The terminal error is delivered on the error channel.
+func (s *EventStream) Events(ctx context.Context, chSize int) (<-chan viipertypes.Event, <-chan error) {
+	evCh := make(chan viipertypes.Event, chSize)
+	errCh := make(chan error, 1)
+
+	stop := context.AfterFunc(ctx, func() { _ = s.conn.Close() })
+	go func() {
+		defer close(evCh)
+		defer close(errCh)
+		defer stop()
+		for {
+			ev, err := s.Next()
+			if err != nil {
+				if ctx.Err() != nil {
+					err = ctx.Err()
+				}
+				errCh <- err
+				return
+			}
+			select {
+			case evCh <- *ev:
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return evCh, errCh
+}
+
+// SetReadDeadline sets the read deadline for the underlying connection.
+func (s *EventStream) SetReadDeadline(t time.Time) error {
+	return s.conn.SetReadDeadline(t)
+}
+
+// Close ends the subscription.
+func (s *EventStream) Close() error {
+	return s.conn.Close()
+}
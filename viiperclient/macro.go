@@ -0,0 +1,101 @@
+package viiperclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Alia5/VIIPER/viipertypes"
+)
+
+// DeviceRecordStart starts recording the data streamed to a device.
+// Stop the recording with DeviceRecordStop to obtain the macro.
+func (c *Client) DeviceRecordStart(busID uint32, devID string) (*viipertypes.MacroStatusResponse, error) {
+	return c.DeviceRecordStartCtx(context.Background(), busID, devID)
+}
+
+func (c *Client) DeviceRecordStartCtx(ctx context.Context, busID uint32, devID string) (*viipertypes.MacroStatusResponse, error) {
+	pathParams := map[string]string{"id": fmt.Sprintf("%d", busID), "deviceid": devID}
+	const path = "bus/{id}/{deviceid}/record/start"
+	raw, err := c.transport.DoCtx(ctx, path, nil, pathParams)
+	if err != nil {
+		return nil, err
+	}
+	return parse[viipertypes.MacroStatusResponse](raw)
+}
+
+// DeviceRecordStop stops recording a device and returns the recorded macro.
+func (c *Client) DeviceRecordStop(busID uint32, devID string) (*viipertypes.Macro, error) {
+	return c.DeviceRecordStopCtx(context.Background(), busID, devID)
+}
+
+func (c *Client) DeviceRecordStopCtx(ctx context.Context, busID uint32, devID string) (*viipertypes.Macro, error) {
+	pathParams := map[string]string{"id": fmt.Sprintf("%d", busID), "deviceid": devID}
+	const path = "bus/{id}/{deviceid}/record/stop"
+	raw, err := c.transport.DoCtx(ctx, path, nil, pathParams)
+	if err != nil {
+		return nil, err
+	}
+	return parse[viipertypes.Macro](raw)
+}
+
+// DeviceReplay replays a macro to a device with its recorded timing.
+// The replay runs on the server; connecting a stream to the device stops it.
+func (c *Client) DeviceReplay(busID uint32, devID string, req *viipertypes.MacroReplayRequest) (*viipertypes.MacroStatusResponse, error) {
+	return c.DeviceReplayCtx(context.Background(), busID, devID, req)
+}
+
+func (c *Client) DeviceReplayCtx(ctx context.Context, busID uint32, devID string, req *viipertypes.MacroReplayRequest) (*viipertypes.MacroStatusResponse, error) {
+	pathParams := map[string]string{"id": fmt.Sprintf("%d", busID), "deviceid": devID}
+	const path = "bus/{id}/{deviceid}/replay"
+	payloadBytes, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal replay request: %w", err)
+	}
+	raw, err := c.transport.DoCtx(ctx, path, string(payloadBytes), pathParams)
+	if err != nil {
+		return nil, err
+	}
+	return parse[viipertypes.MacroStatusResponse](raw)
+}
+
+// DeviceReplayStop stops a running replay.
+func (c *Client) DeviceReplayStop(busID uint32, devID string) (*viipertypes.MacroStatusResponse, error) {
+	return c.DeviceReplayStopCtx(context.Background(), busID, devID)
+}
+
+func (c *Client) DeviceReplayStopCtx(ctx context.Context, busID uint32, devID string) (*viipertypes.MacroStatusResponse, error) {
+	pathParams := map[string]string{"id": fmt.Sprintf("%d", busID), "deviceid": devID}
+	const path = "bus/{id}/{deviceid}/replay/stop"
+	raw, err := c.transport.DoCtx(ctx, path, nil, pathParams)
+	if err != nil {
+		return nil, err
+	}
+	return parse[viipertypes.MacroStatusResponse](raw)
+}
+
+// SaveMacro writes m to a macro file.
+func SaveMacro(path string, m *viipertypes.Macro) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("marshal macro: %w", err)
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// LoadMacro reads a macro file written by SaveMacro.
+func LoadMacro(path string) (*viipertypes.Macro, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m viipertypes.Macro
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("decode macro: %w", err)
+	}
+	if m.Version != viipertypes.MacroVersion {
+		return nil, fmt.Errorf("unsupported macro version %d", m.Version)
+	}
+	return &m, nil
+}
@@ -0,0 +1,213 @@
+package viiperclient
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// sessionPath switches a connection into session mode: the server acknowledges
+// with an empty line, then answers requests framed as `<id> <request>\x00` with
+// `<id> <response>\x00`.
+//
+// A session carries one request at a time. The server executes the requests
+// of a session in order, so pipelining them would only queue requests behind
+// each other; concurrent requests use separate sessions of the pool instead.
+// The id guards against reading a response that does not belong to the
+// request.
+const sessionPath = "session"
+
+var errSessionUnsupported = errors.New("server does not support sessions")
+
+// errSessionClosed reports a session connection that was closed before the
+// server read the request, e.g. an idle session of a restarted server.
+var errSessionClosed = errors.New("session closed by server")
+
+// sessionPool holds the session connections of a Transport. slots limits the
+// number of open sessions; idle sessions wait in idle for the next request.
+type sessionPool struct {
+	slots chan struct{}
+
+	mu     sync.Mutex
+	idle   []*session
+	closed bool
+}
+
+type session struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	nextID uint64
+}
+
+func (t *Transport) sessions() *sessionPool {
+	t.poolOnce.Do(func() {
+		t.pool = &sessionPool{slots: make(chan struct{}, t.cfg.PoolSize)}
+	})
+	return t.pool
+}
+
+// doPooled sends one request over a pooled session, opening a new session if
+// none is idle and the pool is not exhausted.
+// If an idle session turns out to be closed by the server, the request is
+// sent again once on a new session. The server answers every request it
+// reads, so the request was not executed.
+func (t *Transport) doPooled(ctx context.Context, line []byte) (string, error) {
+	p := t.sessions()
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return "", fmt.Errorf("dial: %w", ctx.Err())
+	}
+	defer func() { <-p.slots }()
+
+	s := p.get()
+	reused := s != nil
+	if !reused {
+		var err error
+		if s, err = t.openSession(ctx); err != nil {
+			return "", err
+		}
+	}
+	resp, err := s.do(ctx, line, t.cfg)
+	if err != nil && reused && errors.Is(err, errSessionClosed) {
+		_ = s.conn.Close()
+		if s, err = t.openSession(ctx); err != nil {
+			return "", err
+		}
+		resp, err = s.do(ctx, line, t.cfg)
+	}
+	if err != nil {
+		_ = s.conn.Close()
+		return "", err
+	}
+	p.put(s)
+	return resp, nil
+}
+
+func (t *Transport) openSession(ctx context.Context) (*session, error) {
+	conn, err := t.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write([]byte(sessionPath + "\x00")); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("write: %w", err)
+	}
+	if t.cfg.ReadTimeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(t.cfg.ReadTimeout))
+	}
+	r := bufio.NewReader(conn)
+	ack, err := r.ReadString('\n')
+	if err != nil {
+		_ = conn.Close()
+		if ack != "" {
+			// Older servers answer with an error and close the connection.
+			return nil, errSessionUnsupported
+		}
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	if ack != "\n" {
+		_ = conn.Close()
+		return nil, errSessionUnsupported
+	}
+	return &session{conn: conn, r: r}, nil
+}
+
+func (s *session) do(ctx context.Context, line []byte, cfg Config) (string, error) {
+	s.nextID++
+	id := strconv.FormatUint(s.nextID, 10)
+
+	if err := s.conn.SetDeadline(deadline(ctx, cfg.WriteTimeout)); err != nil {
+		return "", err
+	}
+	req := make([]byte, 0, len(id)+len(line)+2)
+	req = append(append(append(req, id...), ' '), line...)
+	if _, err := s.conn.Write(append(req, '\x00')); err != nil {
+		if connClosed(err) {
+			err = fmt.Errorf("%w: %w", errSessionClosed, err)
+		}
+		return "", fmt.Errorf("write: %w", err)
+	}
+
+	if err := s.conn.SetReadDeadline(deadline(ctx, cfg.ReadTimeout)); err != nil {
+		return "", err
+	}
+	resp, err := s.r.ReadString('\x00')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		if resp == "" && connClosed(err) {
+			err = fmt.Errorf("%w: %w", errSessionClosed, err)
+		}
+		return "", fmt.Errorf("read: %w", err)
+	}
+	gotID, body, _ := strings.Cut(strings.TrimSuffix(resp, "\x00"), " ")
+	if gotID != id {
+		return "", fmt.Errorf("session response id %q does not match request id %q", gotID, id)
+	}
+	return body, nil
+}
+
+// connClosed reports whether err is the result of the peer closing the
+// connection.
+func connClosed(err error) bool {
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// deadline returns the earlier of now+timeout and the deadline of ctx.
+// A zero result means no deadline.
+func deadline(ctx context.Context, timeout time.Duration) time.Time {
+	var d time.Time
+	if timeout > 0 {
+		d = time.Now().Add(timeout)
+	}
+	if cd, ok := ctx.Deadline(); ok && (d.IsZero() || cd.Before(d)) {
+		d = cd
+	}
+	return d
+}
+
+func (p *sessionPool) get() *session {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n := len(p.idle); n > 0 {
+		s := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		return s
+	}
+	return nil
+}
+
+func (p *sessionPool) put(s *session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		_ = s.conn.Close()
+		return
+	}
+	p.idle = append(p.idle, s)
+}
+
+// Close closes the idle session connections of a pooled Transport. Sessions
+// still in use are closed once their request completes.
+func (t *Transport) Close() error {
+	p := t.sessions()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, s := range p.idle {
+		_ = s.conn.Close()
+	}
+	p.idle = nil
+	return nil
+}
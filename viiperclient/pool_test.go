@@ -0,0 +1,149 @@
+package viiperclient_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	viiperTesting "github.com/Alia5/VIIPER/_testing"
+	"github.com/Alia5/VIIPER/internal/server/api/handler"
+	"github.com/Alia5/VIIPER/viiperclient"
+)
+
+// countingProxy forwards connections to addr and counts them.
+func countingProxy(t *testing.T, addr string) (string, *atomic.Int32) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	var n atomic.Int32
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			n.Add(1)
+			go func() {
+				defer c.Close() //nolint:errcheck
+				up, err := net.Dial("tcp", addr)
+				if err != nil {
+					return
+				}
+				defer up.Close() //nolint:errcheck
+				go func() { _, _ = io.Copy(up, c) }()
+				_, _ = io.Copy(c, up)
+			}()
+		}
+	}()
+	return ln.Addr().String(), &n
+}
+
+func TestPooledTransport(t *testing.T) {
+	cfg := viiperTesting.TestServerConfig(t)
+	cfg.Server.APIServerConfig.RequireLocalHostAuth = true
+	cfg.Server.APIServerConfig.Password = "test123"
+	s := viiperTesting.NewTestServerWithConfig(t, cfg)
+	defer s.UsbServer.Close() //nolint:errcheck
+	defer s.ApiServer.Close() //nolint:errcheck
+	r := s.ApiServer.Router()
+	r.Register("bus/create", handler.BusCreate(s.UsbServer))
+	r.Register("bus/remove", handler.BusRemove(s.UsbServer))
+	r.Register("bus/list", handler.BusList(s.UsbServer))
+	require.NoError(t, s.ApiServer.Start())
+
+	addr, conns := countingProxy(t, s.ApiServer.Addr())
+	client := viiperclient.NewWithConfig(addr, &viiperclient.Config{Password: "test123", PoolSize: 2})
+	defer client.Close() //nolint:errcheck
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Go(func() {
+			busID := uint32(93001 + i)
+			_, err := client.BusCreate(busID)
+			assert.NoError(t, err)
+			_, err = client.BusRemove(busID)
+			assert.NoError(t, err)
+		})
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, conns.Load(), int32(2))
+
+	// Errors are returned per request and keep the session usable.
+	_, err := client.BusRemove(93999)
+	assert.ErrorContains(t, err, "404")
+	list, err := client.BusList()
+	require.NoError(t, err)
+	assert.NotContains(t, list.Buses, uint32(93001))
+	assert.LessOrEqual(t, conns.Load(), int32(2))
+}
+
+func TestPooledTransportStaleSession(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close() //nolint:errcheck
+	var conns atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			// Answer a single request, then close the session as a
+			// restarting server would.
+			r := bufio.NewReader(conn)
+			_, _ = r.ReadString('\x00')
+			_, _ = conn.Write([]byte("\n"))
+			req, _ := r.ReadString('\x00')
+			id, _, _ := strings.Cut(req, " ")
+			_, _ = conn.Write([]byte(id + ` {"buses":[1]}` + "\x00"))
+			_ = conn.Close()
+		}
+	}()
+
+	client := viiperclient.NewWithConfig(ln.Addr().String(), &viiperclient.Config{PoolSize: 1})
+	defer client.Close() //nolint:errcheck
+	for range 2 {
+		list, err := client.BusList()
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{1}, list.Buses)
+	}
+	assert.Equal(t, int32(2), conns.Load())
+}
+
+func TestPooledTransportFallback(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close() //nolint:errcheck
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			req, _ := bufio.NewReader(conn).ReadString('\x00')
+			if strings.HasPrefix(req, "session") {
+				_, _ = conn.Write([]byte(`{"status":404,"title":"Not Found","detail":"unknown path: session"}` + "\n"))
+			} else {
+				_, _ = conn.Write([]byte(`{"buses":[1]}` + "\n"))
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	client := viiperclient.NewWithConfig(ln.Addr().String(), &viiperclient.Config{PoolSize: 1})
+	defer client.Close() //nolint:errcheck
+	for range 2 {
+		list, err := client.BusList()
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{1}, list.Buses)
+	}
+}
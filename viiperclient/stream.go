@@ -30,6 +30,21 @@ type DeviceStream struct {
 // OpenStream connects to an existing device's stream channel.
 // The device must already exist on the bus (use DeviceAdd first).
 func (c *Client) OpenStream(ctx context.Context, busID uint32, devID string) (*DeviceStream, error) {
+	conn, err := c.dialStream(ctx, fmt.Sprintf("bus/%d/%s", busID, devID))
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &DeviceStream{
+		conn:  conn,
+		BusID: busID,
+		DevID: devID,
+	}
+	return ds, nil
+}
+
+// dialStream connects (and authenticates) to the API server and requests the stream at path.
+func (c *Client) dialStream(ctx context.Context, path string) (net.Conn, error) {
 	addr := c.transport.addr
 	if c.transport.mock != nil {
 		return nil, fmt.Errorf("stream connections not supported with mock transport")
@@ -65,18 +80,11 @@ func (c *Client) OpenStream(ctx context.Context, busID uint32, devID string) (*D
 		}
 	}
 
-	streamPath := fmt.Sprintf("bus/%d/%s\x00", busID, devID)
-	if _, err := conn.Write([]byte(streamPath)); err != nil {
+	if _, err := conn.Write([]byte(path + "\x00")); err != nil {
 		conn.Close() // nolint
 		return nil, fmt.Errorf("write stream path: %w", err)
 	}
-
-	ds := &DeviceStream{
-		conn:  conn,
-		BusID: busID,
-		DevID: devID,
-	}
-	return ds, nil
+	return conn, nil
 }
 
 // AddDeviceAndConnect creates a device on the specified bus and immediately connects to its stream.
@@ -131,12 +139,12 @@ func (s *DeviceStream) Read(buf []byte) (int, error) {
 // and returns any value that implements encoding.BinaryUnmarshaler (the interface is only
 // used for typing; StartReading does not call UnmarshalBinary itself).
 //
-// Example (xbox360 rumble, fixed 2 bytes):
+// Example (xbox360 rumble and LED ring, fixed 3 bytes):
 //
-//	rumbleCh, errCh := stream.StartReading(ctx, 10, func(r *bufio.Reader) (encoding.BinaryUnmarshaler, error) {
-//	    var b [2]byte
+//	outputCh, errCh := stream.StartReading(ctx, 10, func(r *bufio.Reader) (encoding.BinaryUnmarshaler, error) {
+//	    var b [3]byte
 //	    if _, err := io.ReadFull(r, b[:]); err != nil { return nil, err }
-//	    msg := new(xbox360.XRumbleState)
+//	    msg := new(xbox360.OutputState)
 //	    if err := msg.UnmarshalBinary(b[:]); err != nil { return nil, err }
 //	    return msg, nil
 //	})
@@ -4,12 +4,15 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Alia5/VIIPER/internal/server/api/auth"
@@ -22,6 +25,11 @@ type Config struct {
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	Password     string
+	// PoolSize > 0 enables pooled mode: up to PoolSize session connections are
+	// kept open and reused, so requests don't pay connection setup and
+	// authentication each time. Falls back to one connection per request if
+	// the server does not support sessions.
+	PoolSize int
 }
 
 func defaultConfig() Config {
@@ -38,10 +46,16 @@ func defaultConfig() Config {
 // Response framing: server writes a single JSON (or empty success) line terminated by `\n` and then
 // closes the connection. We therefore read until EOF (connection close) and trim a single trailing
 // newline if present. Embedded newlines in the response (future multi-line responses) are preserved.
+// In pooled mode (Config.PoolSize) requests are sent over persistent session connections instead,
+// see pool.go; call Close to release them.
 type Transport struct {
 	addr string
 	mock func(path string, payload any, pathParams map[string]string) (string, error)
 	cfg  Config
+
+	poolOnce   sync.Once
+	pool       *sessionPool
+	noSessions atomic.Bool
 }
 
 // NewTransport creates a new low-level transport.
@@ -94,16 +108,46 @@ func (t *Transport) DoCtx(ctx context.Context, path string, payload any, pathPar
 	} else {
 		lineBytes = []byte(fullPath)
 	}
+	if t.cfg.PoolSize > 0 && !t.noSessions.Load() {
+		resp, err := t.doPooled(ctx, lineBytes)
+		if !errors.Is(err, errSessionUnsupported) {
+			return resp, err
+		}
+		t.noSessions.Store(true)
+	}
+
+	conn, err := t.dial(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close() //nolint:errcheck
+
+	if _, err := conn.Write(append(lineBytes, '\x00')); err != nil {
+		return "", fmt.Errorf("write: %w", err)
+	}
+	if t.cfg.ReadTimeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(t.cfg.ReadTimeout))
+	}
+	respBytes, err := io.ReadAll(conn)
+	if err != nil && len(respBytes) == 0 {
+		return "", fmt.Errorf("read: %w", err)
+	}
+	resp := string(respBytes)
+
+	return strings.TrimSuffix(resp, "\n"), nil
+}
+
+// dial connects to the server and performs the auth handshake if a password is
+// configured.
+func (t *Transport) dial(ctx context.Context) (net.Conn, error) {
 	if err := ctx.Err(); err != nil {
-		return "", fmt.Errorf("dial: %w", err)
+		return nil, fmt.Errorf("dial: %w", err)
 	}
 	d := &net.Dialer{Timeout: t.cfg.DialTimeout}
 	conn, err := d.DialContext(ctx, "tcp", t.addr)
 	if err != nil {
-		return "", fmt.Errorf("dial: %w", err)
+		return nil, fmt.Errorf("dial: %w", err)
 	}
-	defer conn.Close() //nolint:errcheck
-
 	if tcpConn, ok := conn.(*net.TCPConn); ok {
 		if err := tcpConn.SetNoDelay(true); err != nil {
 			slog.Warn("failed to set TCP_NODELAY", "error", err)
@@ -117,38 +161,27 @@ func (t *Transport) DoCtx(ctx context.Context, path string, payload any, pathPar
 	if t.cfg.Password != "" {
 		key, err := auth.DeriveKey(t.cfg.Password)
 		if err != nil {
-			return "", err
+			conn.Close() // nolint
+			return nil, err
 		}
 		r := bufio.NewReader(conn)
 		clientNonce, serverNonce, err := auth.HandleAuthHandshake(r, conn, key, true)
 		if err != nil {
-
+			conn.Close() // nolint
 			if strings.Contains(err.Error(), "read handshake response: EOF") {
-				return "", apierror.ErrUnauthorized("invalid password")
+				return nil, apierror.ErrUnauthorized("invalid password")
 			}
-			return "", err
+			return nil, err
 		}
 		sessionKey := auth.DeriveSessionKey(key, serverNonce, clientNonce)
-		conn, err = auth.WrapConn(conn, sessionKey)
+		secConn, err := auth.WrapConn(conn, sessionKey)
 		if err != nil {
 			conn.Close() // nolint
-			return "", err
+			return nil, err
 		}
+		conn = secConn
 	}
-
-	if _, err := conn.Write(append(lineBytes, '\x00')); err != nil {
-		return "", fmt.Errorf("write: %w", err)
-	}
-	if t.cfg.ReadTimeout > 0 {
-		_ = conn.SetReadDeadline(time.Now().Add(t.cfg.ReadTimeout))
-	}
-	respBytes, err := io.ReadAll(conn)
-	if err != nil && len(respBytes) == 0 {
-		return "", fmt.Errorf("read: %w", err)
-	}
-	resp := string(respBytes)
-
-	return strings.TrimSuffix(resp, "\n"), nil
+	return conn, nil
 }
 
 func fillPath(pattern string, params map[string]string) string {
@@ -67,11 +67,120 @@ type DeviceRemoveResponse struct {
 	DevID string `json:"devId"`
 }
 
+// Event types pushed on the "events" stream.
+const (
+	EventSubscribed     = "subscribed" // first event; the subscription is live
+	EventBusAdded       = "bus_added"
+	EventBusRemoved     = "bus_removed"
+	EventDeviceAdded    = "device_added"
+	EventDeviceRemoved  = "device_removed"
+	EventDeviceUpdated  = "device_updated"  // device meta state changed
+	EventDeviceAttached = "device_attached" // USB/IP client imported the device
+	EventDeviceDetached = "device_detached" // USB/IP client connection ended
+)
+
+// Event is a bus/device lifecycle event, sent as one JSON object per line on
+// the "events" stream.
+type Event struct {
+	Type      string `json:"type"`
+	Timestamp int64  `json:"timestamp"` // Unix milliseconds
+	BusID     uint32 `json:"busId"`
+	DevID     string `json:"devId,omitempty"`
+	Remote    string `json:"remote,omitempty"` // USB/IP client address for attach/detach
+}
+
+// MacroVersion is the current version of the macro format.
+const MacroVersion = 1
+
+// Macro is a recording of the data a client streamed to a device.
+// It doubles as the macro file format (JSON).
+type Macro struct {
+	Version    uint32       `json:"version"`
+	DeviceType string       `json:"deviceType"`
+	Frames     []MacroFrame `json:"frames"`
+}
+
+// MacroFrame is one recorded input frame, as the device's stream handler
+// decoded and applied it.
+type MacroFrame struct {
+	Offset int64  `json:"offset"` // microseconds since the start of the recording
+	Data   string `json:"data"`   // base64 encoded frame in the device's wire format
+}
+
+type MacroReplayRequest struct {
+	Macro Macro   `json:"macro"`
+	Loop  bool    `json:"loop,omitempty"`
+	Speed float64 `json:"speed,omitempty"` // playback speed factor, 0 means 1
+}
+
+type MacroStatusResponse struct {
+	BusID     uint32 `json:"busId"`
+	DevID     string `json:"devId"`
+	Recording bool   `json:"recording"`
+	Replaying bool   `json:"replaying"`
+}
+
+// DeviceStateResponse holds the last input state of a device and the last
+// output the host sent to it. Field names match the device's wire format.
+type DeviceStateResponse struct {
+	BusID  uint32         `json:"busId"`
+	DevID  string         `json:"devId"`
+	Type   string         `json:"type"`
+	Input  map[string]any `json:"input"`
+	Output map[string]any `json:"output"` // nil until the host sent output
+	// Queue is set for devices in queued input mode.
+	Queue *InputQueueStatus `json:"queue,omitempty"`
+}
+
+// InputQueueStatus reports the input queue of a device in queued input mode.
+// Overflows counts input states that did not fit the queue and were merged
+// into the last queued state instead; keystrokes or clicks may have been lost.
+type InputQueueStatus struct {
+	Length    int    `json:"length"`
+	Capacity  int    `json:"capacity"`
+	Overflows uint64 `json:"overflows"`
+}
+
+// DeviceMetaRequest changes the meta state (battery, temperature, serial, ...)
+// of a running device. Meta holds the fields to change, named as in the
+// device's deviceSpecific options; fields not given keep their value.
+type DeviceMetaRequest struct {
+	Meta map[string]any `json:"meta"`
+}
+
+// TypeTextRequest types text on a keyboard device. Keystrokes are queued
+// server-side and typed after text queued before.
+type TypeTextRequest struct {
+	Text    string  `json:"text"`              // at most 4096 characters
+	Layout  string  `json:"layout,omitempty"`  // host keyboard layout, default "us"
+	PressMs *uint32 `json:"pressMs,omitempty"` // how long each key is held, default 20
+	DelayMs *uint32 `json:"delayMs,omitempty"` // pause after each key, default 20
+}
+
+type TypeTextResponse struct {
+	BusID      uint32 `json:"busId"`
+	DevID      string `json:"devId"`
+	Keystrokes int    `json:"keystrokes"` // keystrokes queued by this request
+	Pending    int    `json:"pending"`    // keystrokes not typed yet, including these
+}
+
+// FailsafePolicy controls how a device is released when its client goes away.
+// Unset fields use the server's defaults.
+type FailsafePolicy struct {
+	// OnDisconnect resets the device to a neutral input state as soon as its
+	// client stream disconnects.
+	OnDisconnect *bool `json:"onDisconnect,omitempty"`
+	// WatchdogMs resets the device to a neutral input state if its client
+	// stream sends nothing for this many milliseconds. 0 disables the watchdog.
+	WatchdogMs *uint32 `json:"watchdogMs,omitempty"`
+}
+
 type DeviceCreateRequest struct {
-	Type           *string        `json:"type"`
-	IDVendor       *uint16        `json:"idVendor,omitempty"`
-	IDProduct      *uint16        `json:"idProduct,omitempty"`
-	DeviceSpecific map[string]any `json:"deviceSpecific,omitempty"`
+	Type           *string         `json:"type"`
+	IDVendor       *uint16         `json:"idVendor,omitempty"`
+	IDProduct      *uint16         `json:"idProduct,omitempty"`
+	DeviceSpecific map[string]any  `json:"deviceSpecific,omitempty"`
+	Failsafe       *FailsafePolicy `json:"failsafe,omitempty"`
 }
 
 // UnmarshalJSON implements custom unmarshaling to accept both uint16 and hex string formats
@@ -79,10 +188,11 @@ type DeviceCreateRequest struct {
 func (d *DeviceCreateRequest) UnmarshalJSON(data []byte) error {
 	// Parse into a temporary structure with flexible types
 	var raw struct {
-		Type           *string        `json:"type"`
-		IDVendor       any            `json:"idVendor,omitempty"`
-		IDProduct      any            `json:"idProduct,omitempty"`
-		DeviceSpecific map[string]any `json:"deviceSpecific,omitempty"`
+		Type           *string         `json:"type"`
+		IDVendor       any             `json:"idVendor,omitempty"`
+		IDProduct      any             `json:"idProduct,omitempty"`
+		DeviceSpecific map[string]any  `json:"deviceSpecific,omitempty"`
+		Failsafe       *FailsafePolicy `json:"failsafe,omitempty"`
 	}
 
 	if err := json.Unmarshal(data, &raw); err != nil {
@@ -108,6 +218,7 @@ func (d *DeviceCreateRequest) UnmarshalJSON(data []byte) error {
 	}
 
 	d.DeviceSpecific = raw.DeviceSpecific
+	d.Failsafe = raw.Failsafe
 
 	return nil
 }
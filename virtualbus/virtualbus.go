@@ -4,6 +4,7 @@ package virtualbus
 import (
 	"context"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 
@@ -28,6 +29,7 @@ type VirtualBus struct {
 	devices         []busDevice
 	emptyCtx        context.Context
 	emptyCancel     context.CancelFunc
+	onDeviceChange  func(meta DeviceMeta, added bool)
 }
 
 // DeviceMeta exposes a registered device and its metadata for external queries.
@@ -76,7 +78,30 @@ func NewWithBusID(busID uint32) (*VirtualBus, error) {
 //
 // which returns a static descriptor that will be used for bus registration.
 // Returns a context containing the device's lifecycle and metadata (use GetDeviceMeta to extract).
+// Devices implementing io.Closer are closed once the context is done, i.e. when
+// the device is removed or the bus is closed.
 func (vb *VirtualBus) Add(dev usb.Device) (context.Context, error) {
+	return vb.add(dev, 0, false)
+}
+
+// AddWithID is like Add but registers the device under a specific device ID,
+// e.g. to restore a previous topology.
+// Returns an error if the device ID is already allocated.
+func (vb *VirtualBus) AddWithID(dev usb.Device, devID uint32) (context.Context, error) {
+	if devID == 0 {
+		return nil, fmt.Errorf("invalid device id 0")
+	}
+	return vb.add(dev, devID, false)
+}
+
+// AddKeepAlive is like AddWithID but the device has no connect timer, so it is
+// never removed for lack of a client stream (see device.IsKeepAlive).
+// A devID of 0 picks the next free device ID.
+func (vb *VirtualBus) AddKeepAlive(dev usb.Device, devID uint32) (context.Context, error) {
+	return vb.add(dev, devID, true)
+}
+
+func (vb *VirtualBus) add(dev usb.Device, devID uint32, keepAlive bool) (context.Context, error) {
 	vb.mtx.Lock()
 	defer vb.mtx.Unlock()
 
@@ -92,14 +117,19 @@ func (vb *VirtualBus) Add(dev usb.Device) (context.Context, error) {
 		}
 	}
 	busID := vb.busID
-	var devID uint32
-	for i := uint32(1); ; i++ {
-		if !vb.allocatedDevIDs[i] {
-			devID = i
-			vb.allocatedDevIDs[i] = true
-			break
+	if devID != 0 {
+		if vb.allocatedDevIDs[devID] {
+			return nil, fmt.Errorf("device id %d already allocated on bus %d", devID, busID)
+		}
+	} else {
+		for i := uint32(1); ; i++ {
+			if !vb.allocatedDevIDs[i] {
+				devID = i
+				break
+			}
 		}
 	}
+	vb.allocatedDevIDs[devID] = true
 
 	busDevID := fmt.Sprintf("%d-%d", busID, devID)
 	path := fmt.Sprintf("%s%d/%s", basepath, busID, busDevID)
@@ -109,16 +139,35 @@ func (vb *VirtualBus) Add(dev usb.Device) (context.Context, error) {
 	copy(meta.USBBusID[:], busDevID)
 	meta.BusID = busID
 	meta.DevID = devID
-	connTimer := time.NewTimer(0)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	ctx = context.WithValue(ctx, device.ExportMetaKey, &meta)
-	ctx = context.WithValue(ctx, device.ConnTimerKey, connTimer)
+	ctx = device.WithAttachments(ctx)
+	if keepAlive {
+		ctx = context.WithValue(ctx, device.KeepAliveKey, true)
+	} else {
+		ctx = context.WithValue(ctx, device.ConnTimerKey, time.NewTimer(0))
+	}
+	if c, ok := dev.(io.Closer); ok {
+		context.AfterFunc(ctx, func() { _ = c.Close() })
+	}
 
 	vb.devices = append(vb.devices, busDevice{dev: dev, meta: meta, ctx: ctx, cancel: cancel})
+	if vb.onDeviceChange != nil {
+		vb.onDeviceChange(DeviceMeta{Dev: dev, Meta: meta}, true)
+	}
 	return ctx, nil
 }
 
+// OnDeviceChange registers fn to be called whenever a device is added to or
+// removed from the bus. fn is called with the bus locked and must not call
+// back into the bus.
+func (vb *VirtualBus) OnDeviceChange(fn func(meta DeviceMeta, added bool)) {
+	vb.mtx.Lock()
+	defer vb.mtx.Unlock()
+	vb.onDeviceChange = fn
+}
+
 // GetAllDeviceMetas returns a copy of all registered devices with their descriptors and export metadata.
 func (vb *VirtualBus) GetAllDeviceMetas() []DeviceMeta {
 	vb.mtx.Lock()
@@ -172,6 +221,9 @@ func (vb *VirtualBus) RemoveDeviceByID(deviceID string) error {
 			}
 			delete(vb.allocatedDevIDs, d.meta.DevID)
 			vb.devices = append(vb.devices[:i], vb.devices[i+1:]...)
+			if vb.onDeviceChange != nil {
+				vb.onDeviceChange(DeviceMeta{Dev: d.dev, Meta: d.meta}, false)
+			}
 
 			return nil
 		}
@@ -193,6 +245,9 @@ func (vb *VirtualBus) Remove(dev usb.Device) error {
 			}
 			delete(vb.allocatedDevIDs, d.meta.DevID)
 			vb.devices = append(vb.devices[:i], vb.devices[i+1:]...)
+			if vb.onDeviceChange != nil {
+				vb.onDeviceChange(DeviceMeta{Dev: d.dev, Meta: d.meta}, false)
+			}
 			return nil
 		}
 	}